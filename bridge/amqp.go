@@ -0,0 +1,232 @@
+package bridge
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec/jsonline"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type (
+	// AMQPChannel is the minimal interface of an AMQP channel, e.g. of RabbitMQ.
+	AMQPChannel interface {
+		// Qos limits the number of unacknowledged deliveries of the channel.
+		Qos(prefetch int) error
+		// Consume starts delivering the messages of queue with manual acknowledgement.
+		Consume(queue string) (<-chan *Delivery, error)
+		// Publish publishes msg to the queue named msg.Subject through the default exchange,
+		// msg.Reply and msg.CorrelationID map to the reply-to and correlation-id properties.
+		Publish(msg *Message) error
+	}
+
+	// Delivery is a message consumed from an AMQP queue.
+	Delivery struct {
+		Message
+		// Ack acknowledges the delivery.
+		Ack func() error
+	}
+)
+
+// ErrAMQPReplyTimeout is returned when no reply arrives on the reply queue in time.
+var ErrAMQPReplyTimeout = errors.New("rpc: bridge: timeout waiting for the AMQP reply")
+
+// AMQPServer serves the routes of a server.Server from an AMQP queue.
+// The service method is carried in the request, so a single queue serves all routes.
+type AMQPServer struct {
+	Server  *server.Server
+	Channel AMQPChannel
+	// Queue is the name of the request queue.
+	Queue string
+	// Concurrency is the maximum number of requests handled at a time, 1 if 0.
+	Concurrency int
+	// Prefetch is the maximum number of unacknowledged deliveries, Concurrency if 0.
+	Prefetch int
+}
+
+// Serve consumes the request queue and blocks until the delivery channel is closed.
+// A delivery is acknowledged once its reply is published.
+func (s *AMQPServer) Serve() error {
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	prefetch := s.Prefetch
+	if prefetch <= 0 {
+		prefetch = concurrency
+	}
+	if err := s.Channel.Qos(prefetch); err != nil {
+		return err
+	}
+	deliveries, err := s.Channel.Consume(s.Queue)
+	if err != nil {
+		return err
+	}
+	log.Infof("rpc: bridge ->	amqp queue %s", s.Queue)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for d := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(d *Delivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			s.handle(d)
+		}(d)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *AMQPServer) handle(d *Delivery) {
+	defer func() {
+		if err := d.Ack(); err != nil {
+			log.Debugf("rpc: bridge: ack: %s", err.Error())
+		}
+	}()
+	if d.Reply == "" {
+		log.Debugf("rpc: bridge: message on %s has no reply-to queue", d.Subject)
+		return
+	}
+	addr := &server.MessageAddr{Net: "amqp", Addr: d.Reply}
+	resp, err := s.Server.ServeMessage(jsonline.NewJSONLineServerCodec, addr, d.Data)
+	if err != nil {
+		log.Debugf("rpc: bridge: %s", err.Error())
+	}
+	if len(resp) == 0 {
+		return
+	}
+	err = s.Channel.Publish(&Message{
+		Subject:       d.Reply,
+		CorrelationID: d.CorrelationID,
+		Data:          resp,
+	})
+	if err != nil {
+		log.Debugf("rpc: bridge: publish reply to %s: %s", d.Reply, err.Error())
+	}
+}
+
+// AMQPSelector is a client.Selector whose invoker sends the requests to an AMQP queue
+// and matches the replies consumed from ReplyQueue by correlation ID.
+// The plugins of the client are not invoked for the requests sent through the broker.
+type AMQPSelector struct {
+	seq     uint64 // first for the 64-bit alignment required by atomic.
+	Channel AMQPChannel
+	// Queue is the name of the request queue.
+	Queue string
+	// ReplyQueue is the name of an exclusive queue the replies are published to.
+	ReplyQueue string
+	// Timeout is the maximum time to wait for a reply, 10s if 0.
+	Timeout time.Duration
+	invoker *invoker
+	err     error
+	pending map[string]chan []byte
+	mu      sync.Mutex
+	once    sync.Once
+}
+
+var _ client.Selector = new(AMQPSelector)
+
+// SetNewInvokerFunc is meaningless for AMQPSelector because there is no connection to dial.
+func (s *AMQPSelector) SetNewInvokerFunc(client.NewInvokerFunc) {}
+
+// SetSelectMode is meaningless for AMQPSelector because the broker routes the requests.
+func (s *AMQPSelector) SetSelectMode(client.SelectMode) {}
+
+// Select returns the AMQP invoker, it fails if the reply queue can not be consumed.
+func (s *AMQPSelector) Select(options ...interface{}) (client.Invoker, error) {
+	s.once.Do(s.init)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.invoker, nil
+}
+
+// List returns the AMQP invoker.
+func (s *AMQPSelector) List() []client.Invoker {
+	s.once.Do(s.init)
+	if s.err != nil {
+		return nil
+	}
+	return []client.Invoker{s.invoker}
+}
+
+// HandleFailed is meaningless for AMQPSelector because the broker handles failures.
+func (s *AMQPSelector) HandleFailed(client.Invoker) {}
+
+// HandleResult is meaningless for AMQPSelector because the broker routes the requests.
+func (s *AMQPSelector) HandleResult(client.Invoker, error, time.Duration) {}
+
+func (s *AMQPSelector) init() {
+	s.pending = make(map[string]chan []byte)
+	replies, err := s.Channel.Consume(s.ReplyQueue)
+	if err != nil {
+		s.err = err
+		return
+	}
+	go s.dispatch(replies)
+	s.invoker = &invoker{
+		address: s.Queue,
+		request: s.request,
+	}
+}
+
+// dispatch delivers the replies to the waiting requests.
+func (s *AMQPSelector) dispatch(replies <-chan *Delivery) {
+	for d := range replies {
+		s.mu.Lock()
+		ch, ok := s.pending[d.CorrelationID]
+		delete(s.pending, d.CorrelationID)
+		s.mu.Unlock()
+		if ok {
+			ch <- d.Data
+		} else {
+			log.Debugf("rpc: bridge: discarding reply with unknown correlation id %q", d.CorrelationID)
+		}
+		if err := d.Ack(); err != nil {
+			log.Debugf("rpc: bridge: ack: %s", err.Error())
+		}
+	}
+}
+
+func (s *AMQPSelector) request(_ string, data []byte) ([]byte, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	id := strconv.FormatUint(atomic.AddUint64(&s.seq, 1), 10)
+	ch := make(chan []byte, 1)
+	s.mu.Lock()
+	s.pending[id] = ch
+	s.mu.Unlock()
+	err := s.Channel.Publish(&Message{
+		Subject:       s.Queue,
+		Reply:         s.ReplyQueue,
+		CorrelationID: id,
+		Data:          data,
+	})
+	if err != nil {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-timer.C:
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, ErrAMQPReplyTimeout
+	}
+}
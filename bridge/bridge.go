@@ -0,0 +1,90 @@
+// Package bridge makes services reachable through a message broker with request-reply support,
+// such as NATS or MQTT, without direct TCP connectivity between clients and servers.
+// AMQPServer and AMQPSelector do the same for AMQP brokers such as RabbitMQ,
+// using a request queue, reply-to queues and correlation IDs.
+//
+// The server subscribes to one subject per route and publishes the responses on the reply subjects,
+// the client publishes the requests and waits for the replies.
+// Messages are encoded with the jsonline codec.
+//
+// The package does not depend on any broker client, implement Broker with a small adapter,
+// e.g. for NATS:
+//
+//	type natsBroker struct{ nc *nats.Conn }
+//	func (b natsBroker) Subscribe(subject string, handler func(*bridge.Message)) error {
+//		_, err := b.nc.Subscribe(subject, func(m *nats.Msg) {
+//			handler(&bridge.Message{Subject: m.Subject, Reply: m.Reply, Data: m.Data})
+//		})
+//		return err
+//	}
+//	func (b natsBroker) Publish(subject string, data []byte) error {
+//		return b.nc.Publish(subject, data)
+//	}
+//	func (b natsBroker) Request(subject string, data []byte, timeout time.Duration) ([]byte, error) {
+//		m, err := b.nc.Request(subject, data, timeout)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return m.Data, nil
+//	}
+package bridge
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+type (
+	// Broker is the minimal interface of a message broker with request-reply support.
+	Broker interface {
+		// Subscribe calls handler for each message published on subject.
+		Subscribe(subject string, handler func(msg *Message)) error
+		// Publish publishes data on subject.
+		Publish(subject string, data []byte) error
+		// Request publishes data on subject and waits for the reply until timeout.
+		Request(subject string, data []byte, timeout time.Duration) ([]byte, error)
+	}
+
+	// Message is a message received from a Broker.
+	Message struct {
+		// Subject is the subject the message was published on.
+		Subject string
+		// Reply is the subject to publish the reply on.
+		Reply string
+		// CorrelationID identifies the request the reply belongs to,
+		// it is only used by brokers that need it, such as AMQP.
+		CorrelationID string
+		// Data is the payload.
+		Data []byte
+	}
+
+	// SubjectFunc maps a service method path to a broker subject.
+	SubjectFunc func(prefix, path string) string
+)
+
+// DotSubject maps "/a/b/c" to "prefix.a.b.c", the convention of NATS.
+func DotSubject(prefix, path string) string {
+	return joinSubject(prefix, strings.Replace(strings.Trim(path, "/"), "/", ".", -1), ".")
+}
+
+// SlashSubject maps "/a/b/c" to "prefix/a/b/c", the convention of MQTT.
+func SlashSubject(prefix, path string) string {
+	return joinSubject(prefix, strings.Trim(path, "/"), "/")
+}
+
+func joinSubject(prefix, subject, sep string) string {
+	if prefix == "" {
+		return subject
+	}
+	return prefix + sep + subject
+}
+
+// pathOf returns the path of a service method URI.
+func pathOf(serviceMethod string) string {
+	u, err := url.Parse(serviceMethod)
+	if err != nil {
+		return serviceMethod
+	}
+	return u.Path
+}
@@ -0,0 +1,188 @@
+package bridge
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// memBroker is an in-memory Broker.
+type memBroker struct {
+	mu       sync.Mutex
+	handlers map[string]func(*Message)
+	inboxes  map[string]chan []byte
+	seq      int
+}
+
+func newMemBroker() *memBroker {
+	return &memBroker{
+		handlers: make(map[string]func(*Message)),
+		inboxes:  make(map[string]chan []byte),
+	}
+}
+
+func (b *memBroker) Subscribe(subject string, handler func(*Message)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[subject] = handler
+	return nil
+}
+
+func (b *memBroker) Publish(subject string, data []byte) error {
+	b.mu.Lock()
+	inbox, ok := b.inboxes[subject]
+	handler := b.handlers[subject]
+	b.mu.Unlock()
+	if ok {
+		inbox <- data
+		return nil
+	}
+	if handler != nil {
+		go handler(&Message{Subject: subject, Data: data})
+	}
+	return nil
+}
+
+func (b *memBroker) Request(subject string, data []byte, timeout time.Duration) ([]byte, error) {
+	b.mu.Lock()
+	handler := b.handlers[subject]
+	b.seq++
+	reply := "_INBOX." + strconv.Itoa(b.seq)
+	inbox := make(chan []byte, 1)
+	b.inboxes[reply] = inbox
+	b.mu.Unlock()
+	if handler == nil {
+		return nil, errors.New("no responders on " + subject)
+	}
+	go handler(&Message{Subject: subject, Reply: reply, Data: data})
+	select {
+	case resp := <-inbox:
+		return resp, nil
+	case <-time.After(timeout):
+		return nil, errors.New("timeout")
+	}
+}
+
+type Arith struct{}
+
+type Args struct {
+	A, B int
+}
+
+func (Arith) Mul(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (Arith) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func TestBridge(t *testing.T) {
+	broker := newMemBroker()
+	srv := server.NewServer(server.Server{})
+	srv.NamedRegister("arith", new(Arith))
+	if err := (&Server{Server: srv, Broker: broker, Prefix: "rpc"}).Serve(); err != nil {
+		t.Fatal(err)
+	}
+	if broker.handlers["rpc.arith.mul"] == nil {
+		t.Fatalf("subject rpc.arith.mul is not subscribed: %v", broker.handlers)
+	}
+
+	c := client.NewClient(client.Client{}, &Selector{Broker: broker, Prefix: "rpc", Timeout: time.Second})
+	var reply int
+	if rpcErr := c.Call("/arith/mul", &Args{7, 8}, &reply); rpcErr != nil {
+		t.Fatal(rpcErr.Error)
+	}
+	if reply != 56 {
+		t.Fatalf("expect 56, got %d", reply)
+	}
+
+	rpcErr := c.Call("/arith/div", &Args{7, 0}, &reply)
+	if rpcErr == nil || rpcErr.Error != "divide by zero" {
+		t.Fatalf("expect divide by zero error, got %v", rpcErr)
+	}
+}
+
+// memAMQP is an in-memory AMQPChannel.
+type memAMQP struct {
+	mu     sync.Mutex
+	queues map[string]chan *Delivery
+	acked  int32
+}
+
+func (c *memAMQP) queue(name string) chan *Delivery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queues == nil {
+		c.queues = make(map[string]chan *Delivery)
+	}
+	q, ok := c.queues[name]
+	if !ok {
+		q = make(chan *Delivery, 16)
+		c.queues[name] = q
+	}
+	return q
+}
+
+func (c *memAMQP) Qos(prefetch int) error {
+	return nil
+}
+
+func (c *memAMQP) Consume(queue string) (<-chan *Delivery, error) {
+	return c.queue(queue), nil
+}
+
+func (c *memAMQP) Publish(msg *Message) error {
+	c.queue(msg.Subject) <- &Delivery{
+		Message: *msg,
+		Ack: func() error {
+			atomic.AddInt32(&c.acked, 1)
+			return nil
+		},
+	}
+	return nil
+}
+
+func TestAMQPBridge(t *testing.T) {
+	ch := new(memAMQP)
+	srv := server.NewServer(server.Server{})
+	srv.NamedRegister("arith", new(Arith))
+	go (&AMQPServer{Server: srv, Channel: ch, Queue: "rpc", Concurrency: 4}).Serve()
+
+	c := client.NewClient(client.Client{}, &AMQPSelector{
+		Channel:    ch,
+		Queue:      "rpc",
+		ReplyQueue: "rpc.reply",
+		Timeout:    time.Second,
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var reply int
+			if rpcErr := c.Call("/arith/mul", &Args{i, 3}, &reply); rpcErr != nil {
+				t.Error(rpcErr.Error)
+				return
+			}
+			if reply != i*3 {
+				t.Errorf("expect %d, got %d", i*3, reply)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&ch.acked); n < 10 {
+		t.Fatalf("expect at least 10 acks, got %d", n)
+	}
+}
@@ -0,0 +1,196 @@
+package bridge
+
+import (
+	"bytes"
+	"io"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec/jsonline"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// Selector is a client.Selector whose invoker sends the requests through a Broker.
+// The plugins of the client are not invoked for the requests sent through the broker.
+type Selector struct {
+	Broker Broker
+	// Prefix is prepended to the subjects.
+	Prefix string
+	// SubjectFunc maps a service method path to a subject, DotSubject if nil.
+	SubjectFunc SubjectFunc
+	// Timeout is the maximum time to wait for a reply, 10s if 0.
+	Timeout time.Duration
+	invoker *invoker
+	once    sync.Once
+}
+
+var _ client.Selector = new(Selector)
+
+// SetNewInvokerFunc is meaningless for Selector because there is no connection to dial.
+func (s *Selector) SetNewInvokerFunc(client.NewInvokerFunc) {}
+
+// SetSelectMode is meaningless for Selector because the broker routes the requests.
+func (s *Selector) SetSelectMode(client.SelectMode) {}
+
+// Select returns the broker invoker.
+func (s *Selector) Select(options ...interface{}) (client.Invoker, error) {
+	s.once.Do(s.init)
+	return s.invoker, nil
+}
+
+// List returns the broker invoker.
+func (s *Selector) List() []client.Invoker {
+	s.once.Do(s.init)
+	return []client.Invoker{s.invoker}
+}
+
+// HandleFailed is meaningless for Selector because the broker handles failures.
+func (s *Selector) HandleFailed(client.Invoker) {}
+
+// HandleResult is meaningless for Selector because the broker routes the requests.
+func (s *Selector) HandleResult(client.Invoker, error, time.Duration) {}
+
+func (s *Selector) init() {
+	subjectFunc := s.SubjectFunc
+	if subjectFunc == nil {
+		subjectFunc = DotSubject
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	s.invoker = &invoker{
+		address: s.Prefix,
+		request: func(serviceMethod string, data []byte) ([]byte, error) {
+			return s.Broker.Request(subjectFunc(s.Prefix, pathOf(serviceMethod)), data, timeout)
+		},
+	}
+}
+
+// invoker is a client.Invoker that sends each request as a message by request.
+type invoker struct {
+	address string
+	request func(serviceMethod string, data []byte) ([]byte, error)
+	mu      sync.Mutex
+	closed  bool
+	lastErr *common.RPCError
+}
+
+var _ client.Invoker = new(invoker)
+
+func (i *invoker) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	rpcErr := i.call(serviceMethod, args, reply)
+	if rpcErr != nil && rpcErr.Type < 0 {
+		i.mu.Lock()
+		i.lastErr = rpcErr
+		i.mu.Unlock()
+	}
+	return rpcErr
+}
+
+func (i *invoker) call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	if i.State() == client.Closed {
+		return common.RPCErrShutdown
+	}
+	var req bytes.Buffer
+	c := jsonline.NewJSONLineClientCodec(&messageRWC{w: &req})
+	err := c.WriteRequest(&rpc.Request{ServiceMethod: serviceMethod}, args)
+	if err != nil {
+		return common.NewRPCError(common.ErrorTypeClientWriteRequest, err.Error())
+	}
+	data, err := i.request(serviceMethod, req.Bytes())
+	if err != nil {
+		return common.NewRPCError(common.ErrorTypeClientConnect, err.Error())
+	}
+	c = jsonline.NewJSONLineClientCodec(&messageRWC{r: bytes.NewReader(data)})
+	var resp rpc.Response
+	if err = c.ReadResponseHeader(&resp); err != nil {
+		return common.NewRPCError(common.ErrorTypeClientReadResponseHeader, err.Error())
+	}
+	if resp.Error != "" {
+		return common.ParseResponseError(resp.Error)
+	}
+	if err = c.ReadResponseBody(reply); err != nil {
+		return common.NewRPCError(common.ErrorTypeClientReadResponseBody, err.Error())
+	}
+	return nil
+}
+
+func (i *invoker) Go(serviceMethod string, args interface{}, reply interface{}, done chan *client.Call) *client.Call {
+	call := &client.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+	}
+	if done == nil {
+		done = make(chan *client.Call, 10) // buffered.
+	} else if cap(done) == 0 {
+		log.Panic("rpc: done channel is unbuffered")
+	}
+	call.Done = done
+	go func() {
+		call.Error = i.Call(serviceMethod, args, reply)
+		select {
+		case call.Done <- call:
+		default:
+			log.Debug("rpc: discarding Call reply due to insufficient Done chan capacity")
+		}
+	}()
+	return call
+}
+
+func (i *invoker) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.closed = true
+	return nil
+}
+
+func (i *invoker) State() client.InvokerState {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		return client.Closed
+	}
+	if i.lastErr != nil {
+		return client.Degraded
+	}
+	return client.Ready
+}
+
+func (i *invoker) LastError() *common.RPCError {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.lastErr
+}
+
+func (i *invoker) Address() string {
+	return i.address
+}
+
+// messageRWC is an io.ReadWriteCloser of a message.
+type messageRWC struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (m *messageRWC) Read(b []byte) (int, error) {
+	if m.r == nil {
+		return 0, io.EOF
+	}
+	return m.r.Read(b)
+}
+
+func (m *messageRWC) Write(b []byte) (int, error) {
+	if m.w == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return m.w.Write(b)
+}
+
+func (m *messageRWC) Close() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"github.com/henrylee2cn/myrpc/codec/jsonline"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// Server serves the routes of a server.Server through a Broker.
+type Server struct {
+	Server *server.Server
+	Broker Broker
+	// Prefix is prepended to the subjects.
+	Prefix string
+	// SubjectFunc maps a route to a subject, DotSubject if nil.
+	SubjectFunc SubjectFunc
+}
+
+// Serve subscribes to the subjects of all the registered routes.
+// Routes registered later are not served.
+func (s *Server) Serve() error {
+	subjectFunc := s.SubjectFunc
+	if subjectFunc == nil {
+		subjectFunc = DotSubject
+	}
+	for _, path := range s.Server.Routers() {
+		subject := subjectFunc(s.Prefix, path)
+		err := s.Broker.Subscribe(subject, s.handle)
+		if err != nil {
+			return err
+		}
+		log.Infof("rpc: bridge ->	%s -> %s", subject, path)
+	}
+	return nil
+}
+
+func (s *Server) handle(msg *Message) {
+	if msg.Reply == "" {
+		log.Debugf("rpc: bridge: message on %s has no reply subject", msg.Subject)
+		return
+	}
+	addr := &server.MessageAddr{Net: "bridge", Addr: msg.Reply}
+	resp, err := s.Server.ServeMessage(jsonline.NewJSONLineServerCodec, addr, msg.Data)
+	if err != nil {
+		log.Debugf("rpc: bridge: %s", err.Error())
+	}
+	if len(resp) == 0 {
+		return
+	}
+	if err = s.Broker.Publish(msg.Reply, resp); err != nil {
+		log.Debugf("rpc: bridge: publish reply to %s: %s", msg.Reply, err.Error())
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"io"
 	"net"
@@ -14,6 +15,7 @@ import (
 	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
 	"github.com/henrylee2cn/myrpc/common"
 	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/memnet"
 )
 
 type (
@@ -37,7 +39,55 @@ type (
 		ReadTimeout time.Duration
 		//WriteTimeout sets writedeadline for underlying net.Conns
 		WriteTimeout time.Duration
-		selector     Selector
+		// QueueSize is the maximum number of calls waiting for an available invoker.
+		// The calls queued select an invoker again in turn, the oldest first, as the calls of the client complete.
+		// If 0, calls fail immediately when no invoker is available.
+		QueueSize int
+		// QueueTimeout is the maximum time a queued call waits for an invoker.
+		// If 0, 5s is used.
+		QueueTimeout time.Duration
+		// QueueOverflow decides what to do when the queue is full.
+		QueueOverflow OverflowPolicy
+		// Tap receives copies of the bytes exchanged with the servers, if it is not nil.
+		Tap Tap
+		// TapSampleRate is the fraction of connections, in (0, 1], that are tapped.
+		// If it is 0, all connections are tapped.
+		TapSampleRate float64
+		// DedupWindow, if it is not 0, suppresses the calls identical to one issued less than DedupWindow ago,
+		// i.e. of the same service method and JSON-encoded args, e.g. double-submits of UI-driven code.
+		// They share the result of the first call instead, the reply being shallow-copied.
+		DedupWindow time.Duration
+		// BroadcastPolicy decides when a call of the Broadcast mode succeeds.
+		BroadcastPolicy BroadcastPolicy
+		// Quorum is the number of servers that must succeed with BroadcastQuorum.
+		// If it is 0, a majority of the servers is used.
+		Quorum int
+		// BackupDelay is how long a call of the Failbackup mode waits for a server before sending it to another one.
+		// If it is 0, 10ms is used.
+		BackupDelay time.Duration
+		// Breaker, if it is not nil, rejects the calls to the servers failing, see Breaker.
+		Breaker *Breaker
+		// Pool, if it is not nil, opens a pool of connections to each server instead of a single one, see Pool.
+		Pool *Pool
+		// Reconnect, if it is not nil, redials the broken connections with backoff, see Reconnect.
+		Reconnect *Reconnect
+		// MaxResponseBodySize, if it is not 0, is the maximum number of bytes read for a response, header and body:
+		// the reads of the codec fail beyond it, so that a response announcing a huge length is not allocated,
+		// and the call fails with an error of type common.ErrorTypeClientMessageTooLarge, the connection being closed.
+		// The size is approximate because the codecs buffer their reads. It does not apply to the h2c network.
+		MaxResponseBodySize int64
+		// Clock is the source of the time of the queue, of the backups, of the breaker, of the pools, of the redials
+		// and of DedupWindow, e.g. the virtual clock of a test, see sim.Sim.
+		// If it is nil, common.SystemClock is used. The deadlines of Timeout are enforced by the network in real time.
+		Clock    common.Clock
+		selector Selector
+		queue    *requestQueue
+		dedup    *dedupTable
+		targets  *targetTable
+		policies *policyTable
+		id       string // of the Client in the request IDs, see common.RequestIDKey
+		requests uint64 // requests with an ID
+		drain    *drainState
 	}
 )
 
@@ -51,10 +101,13 @@ const (
 	Failfast
 	//Failtry use current client again
 	Failtry
-	//Broadcast sends requests to all servers and Success only when all servers return OK
+	//Broadcast sends requests to all servers and Success only when all servers return OK, see BroadcastPolicy
 	Broadcast
 	//Forking sends requests to all servers and Success once one server returns OK
 	Forking
+	//Failbackup sends the request to another server too if the first has not returned after BackupDelay, or has failed,
+	// and uses the first reply returning OK
+	Failbackup
 )
 
 // NewClient creates a new Client
@@ -73,10 +126,19 @@ func (client *Client) init() *Client {
 	if client.MaxTry <= 0 {
 		client.MaxTry = 3
 	}
+	if client.Clock == nil {
+		client.Clock = common.SystemClock
+	}
 	if client.selector == nil {
 		log.Fatal("rpc: client do not have a 'Selector' field!")
 	}
 	client.selector.SetNewInvokerFunc(client.newInvoker)
+	client.queue = new(requestQueue)
+	client.dedup = new(dedupTable)
+	client.targets = new(targetTable)
+	client.policies = new(policyTable)
+	client.id = newClientID()
+	client.drain = new(drainState)
 	return client
 }
 
@@ -84,17 +146,40 @@ var _ NewInvokerFunc = new(Client).newInvoker
 
 // NewInvoker connects to an RPC server at the setted network address.
 func (client *Client) newInvoker(network, address string, dialTimeout time.Duration) (Invoker, error) {
+	return client.dial(network, address, dialTimeout, client.ClientCodecFunc)
+}
+
+// dial is like newInvoker, with the codec codecFunc.
+func (client *Client) dial(network, address string, dialTimeout time.Duration, codecFunc ClientCodecFunc) (Invoker, error) {
+	if client.Pool != nil {
+		return client.newPool(network, address, dialTimeout, codecFunc)
+	}
+	if client.Reconnect != nil {
+		return client.newReconnector(network, address, dialTimeout, codecFunc)
+	}
+	return client.dialConn(network, address, dialTimeout, codecFunc)
+}
+
+// dialConn is like dial, for a single connection.
+func (client *Client) dialConn(network, address string, dialTimeout time.Duration, codecFunc ClientCodecFunc) (Invoker, error) {
 	var wrapper = &clientCodecWrapper{
 		pluginContainer: client.PluginContainer,
+		network:         network,
+		codecFunc:       codecFunc,
 		timeout:         client.Timeout,
 		readTimeout:     client.ReadTimeout,
 		writeTimeout:    client.WriteTimeout,
+		maxResponseSize: client.MaxResponseBodySize,
 	}
 	switch network {
 	case "http":
 		return client.newHTTPClient(network, address, dialTimeout, wrapper)
 	case "kcp":
 		return client.newKCPClient(address, wrapper)
+	case "h2c":
+		return client.newH2CClient(address, dialTimeout, wrapper)
+	case memnet.Network:
+		return client.newMemClient(address, dialTimeout, wrapper)
 	default:
 		return client.newXXXClient(network, address, dialTimeout, wrapper)
 	}
@@ -114,13 +199,13 @@ func (client *Client) newXXXClient(network, address string, dialTimeout time.Dur
 		conn, err = dialer.Dial(network, address)
 	}
 	if err == nil {
-		wrapper.codecConn = NewClientCodecConn(conn)
+		wrapper.codecConn = NewClientCodecConn(wrapper.limitConn(client.tapConn(conn, address)))
 		err = client.PluginContainer.doPostConnected(wrapper.codecConn)
 		if err == nil {
 			if wrapper.codecConn.GetClientCodec() == nil {
-				wrapper.codecConn.SetClientCodec(client.ClientCodecFunc)
+				wrapper.codecConn.SetClientCodec(wrapper.codecFunc)
 			}
-			return newInvoker(wrapper), nil
+			return newInvoker(wrapper, address), nil
 		}
 		wrapper.codecConn.Close()
 	}
@@ -145,18 +230,18 @@ func (client *Client) newHTTPClient(network, address string, dialTimeout time.Du
 		conn, err = dialer.Dial(network, address)
 	}
 	if err == nil {
-		wrapper.codecConn = NewClientCodecConn(conn)
+		wrapper.codecConn = NewClientCodecConn(wrapper.limitConn(client.tapConn(conn, address)))
 		err = client.PluginContainer.doPostConnected(wrapper.codecConn)
 		if err == nil {
 			if wrapper.codecConn.GetClientCodec() == nil {
-				wrapper.codecConn.SetClientCodec(client.ClientCodecFunc)
+				wrapper.codecConn.SetClientCodec(wrapper.codecFunc)
 			}
 			io.WriteString(wrapper.codecConn, "CONNECT "+client.HTTPPath+" HTTP/1.0\n\n")
 			// Require successful HTTP response before switching to RPC protocol.
 			resp, err = http.ReadResponse(bufio.NewReader(wrapper.codecConn), &http.Request{Method: "CONNECT"})
 			if err == nil {
 				if resp.Status == common.Connected {
-					return newInvoker(wrapper), nil
+					return newInvoker(wrapper, address), nil
 				}
 				err = common.NewError("unexpected HTTP response: " + resp.Status)
 			}
@@ -171,16 +256,33 @@ func (client *Client) newHTTPClient(network, address string, dialTimeout time.Du
 	}).Error())
 }
 
+// newMemClient connects to a server of the in-memory network, see package memnet.
+func (client *Client) newMemClient(address string, dialTimeout time.Duration, wrapper *clientCodecWrapper) (Invoker, error) {
+	conn, err := memnet.DialTimeout(address, dialTimeout)
+	if err == nil {
+		wrapper.codecConn = NewClientCodecConn(wrapper.limitConn(client.tapConn(conn, address)))
+		err = client.PluginContainer.doPostConnected(wrapper.codecConn)
+		if err == nil {
+			if wrapper.codecConn.GetClientCodec() == nil {
+				wrapper.codecConn.SetClientCodec(wrapper.codecFunc)
+			}
+			return newInvoker(wrapper, address), nil
+		}
+		wrapper.codecConn.Close()
+	}
+	return nil, common.NewError("dial error: " + err.Error())
+}
+
 func (client *Client) newKCPClient(address string, wrapper *clientCodecWrapper) (Invoker, error) {
 	conn, err := kcp.DialWithOptions(address, client.KCPBlock, 10, 3)
 	if err == nil {
-		wrapper.codecConn = NewClientCodecConn(conn)
+		wrapper.codecConn = NewClientCodecConn(wrapper.limitConn(client.tapConn(conn, address)))
 		err = client.PluginContainer.doPostConnected(wrapper.codecConn)
 		if err == nil {
 			if wrapper.codecConn.GetClientCodec() == nil {
-				wrapper.codecConn.SetClientCodec(client.ClientCodecFunc)
+				wrapper.codecConn.SetClientCodec(wrapper.codecFunc)
 			}
-			return newInvoker(wrapper), nil
+			return newInvoker(wrapper, address), nil
 		}
 		wrapper.codecConn.Close()
 	}
@@ -188,30 +290,73 @@ func (client *Client) newKCPClient(address string, wrapper *clientCodecWrapper)
 }
 
 //Call invokes the named function, waits for it to complete, and returns its error status.
-func (client *Client) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
-	if client.FailMode == Broadcast {
-		return client.invokerBroadCast(serviceMethod, args, &reply)
+// The calls with options are not deduplicated, see DedupWindow.
+func (client *Client) Call(serviceMethod string, args interface{}, reply interface{}, opts ...CallOption) (rpcErr *common.RPCError) {
+	o := newCallOptions(opts)
+	defer client.applyPolicy(serviceMethod, o)()
+	start := time.Now()
+	defer func() {
+		client.postCall(serviceMethod, o, start, rpcErr)
+	}()
+	if !client.drain.begin() {
+		return closedError()
+	}
+	defer client.drain.end()
+	// the call is counted, so it is served even if Shutdown is called before its invoker is selected, as by Go.
+	o.admitted = true
+	if client.DedupWindow > 0 && len(opts) == 0 {
+		if key, ok := dedupKey(serviceMethod, args); ok {
+			return client.dedup.do(client.Clock, key, client.DedupWindow, reply, func() *common.RPCError {
+				return client.call(serviceMethod, args, reply, o)
+			})
+		}
+	}
+	return client.call(serviceMethod, args, reply, o)
+}
+
+func (client *Client) call(serviceMethod string, args interface{}, reply interface{}, o *callOptions) *common.RPCError {
+	if o.ctx != nil && o.ctx.Err() != nil {
+		return canceledError(o.ctx.Err())
+	}
+	if o.invoker != nil || o.target != "" {
+		return client.callTarget(serviceMethod, args, reply, o)
 	}
-	if client.FailMode == Forking {
-		return client.invokerForking(serviceMethod, args, &reply)
+	if o.failMode == Broadcast {
+		return client.invokerBroadCast(serviceMethod, args, reply, o)
+	}
+	if o.failMode == Forking {
+		return client.invokerForking(serviceMethod, args, &reply, o)
+	}
+	if o.failMode == Failbackup {
+		return client.invokerBackup(serviceMethod, args, reply, o)
 	}
 	var (
 		invoker Invoker
 		rpcErr  *common.RPCError
 		err     error
 	)
-	if client.FailMode == Failover {
-		for tries := client.MaxTry; tries > 0; tries-- {
-			invoker, err = client.selector.Select(serviceMethod, args)
+	if o.failMode == Failover || o.failMode == Failfast {
+		tries := o.maxTry
+		if o.failMode == Failfast {
+			tries = 1
+		}
+		for ; tries > 0; tries-- {
+			invoker, err = client.nextInvoker(serviceMethod, args, o)
 			if err != nil || invoker == nil {
 				log.Error("rpc: failed to select a invoker: " + err.Error())
 				continue
 			}
 
-			rpcErr = invoker.Call(serviceMethod, args, reply)
+			rpcErr = client.invokeSelected(invoker, serviceMethod, args, reply, o)
 			if rpcErr == nil {
 				return nil
 			}
+			if rpcErr.Type == common.ErrorTypeClientCanceled {
+				return rpcErr
+			}
+			if rpcErr.Type == common.ErrorTypeClientCircuitOpen {
+				continue
+			}
 			client.selector.HandleFailed(invoker)
 			if rpcErr.Type == common.ErrorTypeClientShutdown || rpcErr.Type > 0 {
 				break
@@ -219,19 +364,25 @@ func (client *Client) Call(serviceMethod string, args interface{}, reply interfa
 			log.Error("rpc: failed to call: " + rpcErr.Error)
 		}
 
-	} else if client.FailMode == Failtry {
-		for tries := client.MaxTry; tries > 0; tries-- {
+	} else if o.failMode == Failtry {
+		for tries := o.maxTry; tries > 0; tries-- {
 			if invoker == nil {
-				if invoker, err = client.selector.Select(serviceMethod, args); err != nil {
+				if invoker, err = client.nextInvoker(serviceMethod, args, o); err != nil {
 					log.Error("rpc: failed to select a invoker: " + err.Error())
 				}
 			}
 
 			if invoker != nil {
-				rpcErr = invoker.Call(serviceMethod, args, reply)
+				rpcErr = client.invokeSelected(invoker, serviceMethod, args, reply, o)
 				if rpcErr == nil {
 					return nil
 				}
+				if rpcErr.Type == common.ErrorTypeClientCanceled {
+					return rpcErr
+				}
+				if rpcErr.Type == common.ErrorTypeClientCircuitOpen {
+					continue
+				}
 
 				client.selector.HandleFailed(invoker)
 				if rpcErr.Type == common.ErrorTypeClientShutdown || rpcErr.Type > 0 {
@@ -250,36 +401,56 @@ func (client *Client) Call(serviceMethod string, args interface{}, reply interfa
 	return rpcErr
 }
 
-func (client *Client) invokerBroadCast(serviceMethod string, args interface{}, reply *interface{}) *common.RPCError {
-	invokers := client.selector.List()
-
-	if len(invokers) == 0 {
-		log.Infof("rpc: no any invoker is available")
-		return nil
+// nextInvoker selects an invoker, even once the client is closed for the first try of a call, see Shutdown.
+func (client *Client) nextInvoker(serviceMethod string, args interface{}, o *callOptions) (Invoker, error) {
+	if o.admitted {
+		o.admitted = false
+		return client.waitInvoker(true, serviceMethod, args)
 	}
+	return client.selectInvoker(serviceMethod, args)
+}
 
-	l := len(invokers)
-	done := make(chan *Call, l)
-	for _, invoker := range invokers {
-		invoker.Go(serviceMethod, args, reply, done)
+// invoke calls serviceMethod on invoker, and hands the results other than the reply to o.
+func (client *Client) invoke(invoker Invoker, serviceMethod string, args interface{}, reply interface{}, o *callOptions) *common.RPCError {
+	if o.trailer == nil && o.ctx == nil && o.conns == nil && !o.idempotent {
+		return invoker.Call(serviceMethod, args, reply)
 	}
+	call := <-o.goInvoker(invoker, serviceMethod, args, reply, make(chan *Call, 1)).Done
+	o.receive(call)
+	return call.Error
+}
 
-	for l > 0 {
-		call := <-done
-		if call == nil || call.Error != nil {
-			if call != nil {
-				log.Warnf("rpc: failed to call: %v", call.Error)
-			}
-			return common.RPCErrBroadCast
-		}
-		*reply = call.Reply
-		l--
+// invokeSelected is like invoke, for an invoker of the selector, and reports the call to the selector.
+// The call is rejected if the circuit of the server is open, see Breaker.
+func (client *Client) invokeSelected(invoker Invoker, serviceMethod string, args interface{}, reply interface{}, o *callOptions) *common.RPCError {
+	breaker := client.Breaker
+	if breaker != nil && !breaker.allow(invoker.Address(), client.Clock.Now()) {
+		return circuitOpenError(invoker.Address())
+	}
+	result := client.track(invoker)
+	rpcErr := client.invoke(invoker, serviceMethod, args, reply, o)
+	result(rpcErr)
+	if breaker != nil {
+		breaker.report(invoker.Address(), rpcErr, client.Clock.Now())
 	}
+	return rpcErr
+}
 
-	return nil
+// track reports a call starting on an invoker of the selector to a FeedbackSelector,
+// and returns the function reporting its result to the selector, see Selector.HandleResult.
+func (client *Client) track(invoker Invoker) func(*common.RPCError) {
+	if fs, ok := client.selector.(FeedbackSelector); ok {
+		fs.CallStarted(invoker)
+	}
+	start := time.Now()
+	return func(rpcErr *common.RPCError) {
+		client.selector.HandleResult(invoker, rpcErr.Err(), time.Since(start))
+		// the invoker may be available again for the calls waiting in the request queue.
+		client.queue.notify()
+	}
 }
 
-func (client *Client) invokerForking(serviceMethod string, args interface{}, reply *interface{}) *common.RPCError {
+func (client *Client) invokerForking(serviceMethod string, args interface{}, reply *interface{}, o *callOptions) *common.RPCError {
 	invokers := client.selector.List()
 
 	if len(invokers) == 0 {
@@ -289,66 +460,134 @@ func (client *Client) invokerForking(serviceMethod string, args interface{}, rep
 
 	l := len(invokers)
 	done := make(chan *Call, l)
+	results := make(map[*Call]func(*common.RPCError), l)
 	for _, invoker := range invokers {
-		invoker.Go(serviceMethod, args, reply, done)
+		result := client.track(invoker)
+		results[o.goInvoker(invoker, serviceMethod, args, reply, done)] = result
+	}
+	report := func(call *Call) {
+		if result := results[call]; result != nil {
+			result(call.Error)
+		}
 	}
 
+	var causes []error
 	for l > 0 {
 		call := <-done
 		if call != nil && call.Error == nil {
+			report(call)
+			// the other calls are reported once complete.
+			go func(l int) {
+				for ; l > 1; l-- {
+					if call := <-done; call != nil {
+						report(call)
+					}
+				}
+			}(l)
 			*reply = call.Reply
+			o.receive(call)
 			return nil
 		}
 		if call == nil {
 			break
 		}
+		report(call)
 		if call.Error != nil {
 			log.Warnf("rpc: failed to call: %v", call.Error)
+			causes = append(causes, call.Error.Err())
 		}
 		l--
 	}
 
-	return common.RPCErrForking
+	return &common.RPCError{
+		Type:   common.RPCErrForking.Type,
+		Error:  common.RPCErrForking.Error,
+		Causes: causes,
+	}
 }
 
 // Go invokes the function asynchronously. It returns the Call structure representing the invocation.
 // The done channel will signal when the call is complete by returning the same Call object.
 // If done is nil, Go will allocate a new channel.
 // If non-nil, done must be buffered or Go will deliberately crash.
-func (client *Client) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
-	invoker, err := client.selector.Select()
-	if err != nil {
-		call := new(Call)
-		call.ServiceMethod = serviceMethod
-		call.Args = args
-		call.Reply = reply
-		call.Error = &common.RPCError{
-			Type:  common.ErrorTypeClientConnect,
-			Error: err.Error(),
-		}
-		if done == nil {
-			done = make(chan *Call, 1) // buffered.
-		} else {
-			// If caller passes done != nil, it must arrange that
-			// done has enough buffer for the number of simultaneous
-			// RPCs that will be using that channel. If the channel
-			// is totally unbuffered, it's best not to run at all.
-			if cap(done) == 0 {
-				log.Panic("rpc: done channel is unbuffered")
-			}
+// The invoker is selected and the call retried, broadcast or forked as by Call, see FailMode.
+// The options are those of Call, the trailer of the response being set to call.Trailer.
+func (client *Client) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call, opts ...CallOption) *Call {
+	return client.goCall(serviceMethod, args, reply, done, newCallOptions(opts))
+}
+
+func (client *Client) goCall(serviceMethod string, args interface{}, reply interface{}, done chan *Call, o *callOptions) *Call {
+	call := new(Call)
+	call.ServiceMethod = serviceMethod
+	call.Args = args
+	call.Reply = reply
+	if done == nil {
+		done = make(chan *Call, 1) // buffered.
+	} else {
+		// If caller passes done != nil, it must arrange that
+		// done has enough buffer for the number of simultaneous
+		// RPCs that will be using that channel. If the channel
+		// is totally unbuffered, it's best not to run at all.
+		if cap(done) == 0 {
+			log.Panic("rpc: done channel is unbuffered")
 		}
-		call.Done = done
+	}
+	call.Done = done
+	call.Idempotent = o.idempotent
+	o.trailer = &call.Trailer
+	cancel := client.applyPolicy(serviceMethod, o)
+	if !client.drain.begin() {
+		call.Error = closedError()
+		client.postCall(serviceMethod, o, time.Now(), call.Error)
+		cancel()
 		call.done()
 		return call
 	}
-	return invoker.Go(serviceMethod, args, reply, done)
+	// the call is counted before Go returns, so Shutdown waits for it and it is served even if Shutdown
+	// is called before its invoker is selected, which may wait in the request queue, see QueueSize.
+	o.admitted = true
+	go func() {
+		start := time.Now()
+		call.Error = client.call(serviceMethod, args, reply, o)
+		client.postCall(serviceMethod, o, start, call.Error)
+		cancel()
+		call.done()
+		// the call is delivered before Shutdown returns.
+		client.drain.end()
+	}()
+	return call
 }
 
-// Close closes the connection
+// postCall reports the call of serviceMethod started at start to the PostCall plugins.
+func (client *Client) postCall(serviceMethod string, o *callOptions, start time.Time, rpcErr *common.RPCError) {
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client.PluginContainer.doPostCall(ctx, serviceMethod, time.Since(start), rpcErr)
+}
+
+// Close closes the connections at once, aborting the outstanding calls, and the new calls fail
+// with common.ErrClientClosed. See Shutdown to wait for the outstanding calls first.
 func (client *Client) Close() error {
+	client.drain.close()
+	client.queue.wakeAll()
+	client.closeInvokers()
+	return nil
+}
+
+// closeInvokers closes the connections of the selector and of the targets.
+func (client *Client) closeInvokers() {
 	for _, invoker := range client.selector.List() {
 		client.selector.HandleFailed(invoker)
 		invoker.Close()
 	}
-	return nil
+	client.targets.close()
+	client.policies.close()
+}
+
+// AsRPCError returns the RPCError of err, e.g. the error of a call made through rpcErr.Err(),
+// to inspect the Type of the failure, and the Code and Details of a service error, see common.NewCodeError.
+func AsRPCError(err error) (*common.RPCError, bool) {
+	return common.AsRPCError(err)
 }
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// invokerBackup calls serviceMethod on the server selected, and also on another one if the first has not answered
+// after BackupDelay, or has failed to, the first reply succeeding wins.
+// Each server decodes into a new reply, the one winning is copied into reply, a pointer.
+// The requests share an ID, so that a server receiving both executes the call once, see server.Server.DedupWindow.
+func (client *Client) invokerBackup(serviceMethod string, args interface{}, reply interface{}, o *callOptions) *common.RPCError {
+	serviceMethod = common.AddQuery(serviceMethod, url.Values{common.RequestIDKey: {client.requestID()}})
+	first, err := client.nextInvoker(serviceMethod, args, o)
+	if err != nil {
+		return &common.RPCError{
+			Type:  common.ErrorTypeClientConnect,
+			Error: err.Error(),
+		}
+	}
+	delay := client.BackupDelay
+	if delay <= 0 {
+		delay = 10 * time.Millisecond
+	}
+	timer := client.Clock.NewTimer(delay)
+	defer timer.Stop()
+
+	done := make(chan *Call, 2)
+	received := make(map[*Call]func(*Call), 2)
+	send := func(invoker Invoker) {
+		call, receive := client.goSelected(invoker, serviceMethod, args, newReply(reply), o, done)
+		received[call] = receive
+	}
+	send(first)
+	inflight, backedUp := 1, false
+	backup := func() {
+		backedUp = true
+		if invoker := client.backupInvoker(first, serviceMethod, args); invoker != nil {
+			send(invoker)
+			inflight++
+		}
+	}
+
+	var rpcErr *common.RPCError
+	for inflight > 0 {
+		select {
+		case call := <-done:
+			inflight--
+			received[call](call)
+			if call.Error == nil || call.Error.Type > 0 || call.Error.Type == common.ErrorTypeClientCanceled {
+				if inflight > 0 {
+					// the other call is reported once complete.
+					go func() {
+						call := <-done
+						received[call](call)
+					}()
+				}
+				if call.Error == nil {
+					setReply(reply, call.Reply)
+					o.receive(call)
+				}
+				return call.Error
+			}
+			rpcErr = call.Error
+			if !backedUp {
+				backup()
+			}
+		case <-timer.C():
+			if !backedUp {
+				backup()
+			}
+		}
+	}
+	return rpcErr
+}
+
+// backupInvoker selects an invoker other than first, or returns nil if there is none.
+func (client *Client) backupInvoker(first Invoker, serviceMethod string, args interface{}) Invoker {
+	for tries := client.MaxTry; tries > 0; tries-- {
+		invoker, err := client.selectInvoker(serviceMethod, args)
+		if err != nil {
+			return nil
+		}
+		if invoker != first {
+			return invoker
+		}
+	}
+	return nil
+}
+
+// goSelected is like invokeSelected, asynchronously: the call is sent to done,
+// and receive must be called with it once it is received from done.
+func (client *Client) goSelected(invoker Invoker, serviceMethod string, args interface{}, reply interface{}, o *callOptions, done chan *Call) (call *Call, receive func(*Call)) {
+	breaker := client.Breaker
+	if breaker != nil && !breaker.allow(invoker.Address(), client.Clock.Now()) {
+		call = &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+		call.Error = circuitOpenError(invoker.Address())
+		call.done()
+		return call, func(*Call) {}
+	}
+	result := client.track(invoker)
+	call = o.goInvoker(invoker, serviceMethod, args, reply, done)
+	return call, func(call *Call) {
+		result(call.Error)
+		if breaker != nil {
+			breaker.report(invoker.Address(), call.Error, client.Clock.Now())
+		}
+		if call.Error != nil && call.Error.Type < 0 && call.Error.Type != common.ErrorTypeClientCanceled &&
+			call.Error.Type != common.ErrorTypeClientCircuitOpen {
+			client.selector.HandleFailed(invoker)
+		}
+	}
+}
+
+// requestID returns a new ID of request, unique to the Client, see common.RequestIDKey.
+func (client *Client) requestID() string {
+	return client.id + "-" + strconv.FormatUint(atomic.AddUint64(&client.requests, 1), 10)
+}
+
+// newClientID returns a random ID of Client.
+func newClientID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// BreakerState is the state of the circuit of a server, see Breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets the calls pass.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects the calls.
+	BreakerOpen
+	// BreakerHalfOpen lets the probe calls pass.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker is the circuit breaker of the servers of a Client: the circuit of a server opens after consecutive failures,
+// and the calls to it are rejected at once with an error of type ErrorTypeClientCircuitOpen, so that Failover tries
+// another server. Once OpenTimeout passes, the circuit is half-open and lets probe calls pass: it closes once they
+// succeed, else opens again. The circuits are those of the invokers selected, the calls of Broadcast and Forking
+// and those to a target dialed apart pass.
+type Breaker struct {
+	// Failures is the number of consecutive failures opening the circuit.
+	// If it is 0, 5 is used.
+	Failures int
+	// OpenTimeout is how long the circuit stays open before letting probe calls pass.
+	// If it is 0, 10s is used.
+	OpenTimeout time.Duration
+	// Probes is the number of probe calls that must succeed to close the circuit, the others are rejected meanwhile.
+	// If it is 0, 1 is used.
+	Probes int
+	// IsFailure reports whether the error of a call is a failure of the server, the calls canceled are not.
+	// If it is nil, the errors of the connection and the overloads of the server are, not the errors of the services.
+	IsFailure func(rpcErr *common.RPCError) bool
+	// OnStateChange, if it is not nil, is called when the circuit of the server address changes state,
+	// e.g. to log or to export a metric. It must not call the Breaker.
+	OnStateChange func(address string, from, to BreakerState)
+
+	circuits map[string]*circuit // address -> circuit
+	mu       sync.Mutex
+}
+
+// circuit is the circuit of a server.
+type circuit struct {
+	state     BreakerState
+	failures  int // consecutive, while closed
+	opened    time.Time
+	probing   int // probe calls in progress, while half-open
+	succeeded int // probe calls succeeded, while half-open
+}
+
+// State returns the state of the circuit of the server address.
+func (b *Breaker) State(address string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[address]; c != nil {
+		return c.state
+	}
+	return BreakerClosed
+}
+
+// allow reports whether a call to the server address may pass at now, counting it as a probe if the circuit is half-open.
+func (b *Breaker) allow(address string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[address]
+	if c == nil {
+		return true
+	}
+	if c.state == BreakerOpen {
+		timeout := b.OpenTimeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		if now.Sub(c.opened) < timeout {
+			return false
+		}
+		c.probing, c.succeeded = 0, 0
+		b.setState(address, c, BreakerHalfOpen)
+	}
+	if c.state == BreakerHalfOpen {
+		if c.probing+c.succeeded >= b.probes() {
+			return false
+		}
+		c.probing++
+	}
+	return true
+}
+
+// report counts the result, at now, of a call to the server address allowed.
+func (b *Breaker) report(address string, rpcErr *common.RPCError, now time.Time) {
+	if rpcErr != nil && rpcErr.Type == common.ErrorTypeClientCanceled {
+		b.mu.Lock()
+		if c := b.circuits[address]; c != nil && c.state == BreakerHalfOpen && c.probing > 0 {
+			c.probing--
+		}
+		b.mu.Unlock()
+		return
+	}
+	failed := rpcErr != nil && b.isFailure(rpcErr)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuits[address]
+	if c == nil {
+		if !failed {
+			return
+		}
+		if b.circuits == nil {
+			b.circuits = make(map[string]*circuit)
+		}
+		c = new(circuit)
+		b.circuits[address] = c
+	}
+	switch c.state {
+	case BreakerClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		failures := b.Failures
+		if failures <= 0 {
+			failures = 5
+		}
+		if c.failures >= failures {
+			c.opened = now
+			b.setState(address, c, BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if c.probing > 0 {
+			c.probing--
+		}
+		if failed {
+			c.opened = now
+			b.setState(address, c, BreakerOpen)
+			return
+		}
+		c.succeeded++
+		if c.succeeded >= b.probes() {
+			c.failures = 0
+			b.setState(address, c, BreakerClosed)
+		}
+	}
+}
+
+func (b *Breaker) probes() int {
+	if b.Probes <= 0 {
+		return 1
+	}
+	return b.Probes
+}
+
+func (b *Breaker) isFailure(rpcErr *common.RPCError) bool {
+	if b.IsFailure != nil {
+		return b.IsFailure(rpcErr)
+	}
+	switch rpcErr.Type {
+	case common.ErrorTypeClientShutdown, common.ErrorTypeClientCircuitOpen:
+		return false
+	case common.ErrorTypeServerOverloaded:
+		return true
+	}
+	return rpcErr.Type < 0
+}
+
+// setState changes the state of the circuit c, b.mu is held.
+func (b *Breaker) setState(address string, c *circuit, state BreakerState) {
+	from := c.state
+	c.state = state
+	if b.OnStateChange != nil {
+		b.OnStateChange(address, from, state)
+	}
+}
+
+// circuitOpenError is the error of the calls rejected because the circuit of the server address is open.
+func circuitOpenError(address string) *common.RPCError {
+	err := common.ErrCircuitOpen.Format(address)
+	return &common.RPCError{
+		Type:   common.ErrorTypeClientCircuitOpen,
+		Error:  err.Error(),
+		Causes: []error{err},
+	}
+}
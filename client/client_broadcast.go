@@ -0,0 +1,155 @@
+package client
+
+import (
+	"reflect"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// BroadcastPolicy decides when a call of the Broadcast mode succeeds.
+type BroadcastPolicy int
+
+const (
+	// BroadcastAll waits for all the servers, and succeeds if they all do.
+	BroadcastAll BroadcastPolicy = iota
+	// BroadcastQuorum succeeds once Quorum servers do, without waiting for the others,
+	// and fails once Quorum can not be reached any more.
+	BroadcastQuorum
+	// BroadcastCollect waits for all the servers, and succeeds if one does at least, see Replies for the others.
+	BroadcastCollect
+	// BroadcastFirstError fails once a server does, without waiting for the others, and succeeds if they all do.
+	BroadcastFirstError
+)
+
+// BroadcastReply is the outcome of the call of a server in Broadcast mode.
+type BroadcastReply struct {
+	Address string
+	// Reply is a new value of the type of the reply of the call, holding the reply of the server if Error is nil.
+	Reply interface{}
+	Error *common.RPCError
+}
+
+// Replies receives into r the outcome of the call of each server in Broadcast mode, in their order of arrival.
+// The calls still in progress when the call returns, e.g. once the quorum is reached, are left out.
+func Replies(r *[]BroadcastReply) CallOption {
+	return func(o *callOptions) {
+		o.replies = r
+	}
+}
+
+// invokerBroadCast calls serviceMethod on all the servers, each into a new reply, see BroadcastPolicy.
+// The first reply of a server succeeding is copied into reply, a pointer.
+func (client *Client) invokerBroadCast(serviceMethod string, args interface{}, reply interface{}, o *callOptions) *common.RPCError {
+	invokers := client.selector.List()
+
+	if len(invokers) == 0 {
+		log.Infof("rpc: no any invoker is available")
+		return nil
+	}
+
+	l := len(invokers)
+	quorum := l
+	switch client.BroadcastPolicy {
+	case BroadcastQuorum:
+		quorum = client.Quorum
+		if quorum <= 0 {
+			quorum = l/2 + 1
+		}
+	case BroadcastCollect:
+		quorum = 1
+	}
+
+	type pending struct {
+		address string
+		result  func(*common.RPCError)
+	}
+	done := make(chan *Call, l)
+	calls := make(map[*Call]pending, l)
+	for _, invoker := range invokers {
+		result := client.track(invoker)
+		call := o.goInvoker(invoker, serviceMethod, args, newReply(reply), done)
+		calls[call] = pending{address: invoker.Address(), result: result}
+	}
+	report := func(call *Call) BroadcastReply {
+		p := calls[call]
+		if p.result != nil {
+			p.result(call.Error)
+		}
+		return BroadcastReply{Address: p.address, Reply: call.Reply, Error: call.Error}
+	}
+
+	var (
+		replies   []BroadcastReply
+		causes    []error
+		succeeded int
+	)
+	defer func() {
+		if o.replies != nil {
+			*o.replies = replies
+		}
+	}()
+	for received := 0; received < l; received++ {
+		call := <-done
+		if call == nil {
+			continue
+		}
+		replies = append(replies, report(call))
+		if call.Error != nil {
+			log.Warnf("rpc: failed to call: %v", call.Error)
+			causes = append(causes, call.Error.Err())
+		} else {
+			if succeeded == 0 {
+				setReply(reply, call.Reply)
+				o.receive(call)
+			}
+			succeeded++
+		}
+
+		var finished bool
+		switch client.BroadcastPolicy {
+		case BroadcastQuorum:
+			finished = succeeded >= quorum || succeeded+l-received-1 < quorum
+		case BroadcastFirstError:
+			finished = call.Error != nil
+		}
+		if finished && received < l-1 {
+			// the other calls are reported once complete.
+			go func(rest int) {
+				for ; rest > 0; rest-- {
+					if call := <-done; call != nil {
+						report(call)
+					}
+				}
+			}(l - received - 1)
+			break
+		}
+	}
+
+	if succeeded < quorum {
+		return &common.RPCError{
+			Type:   common.RPCErrBroadCast.Type,
+			Error:  common.RPCErrBroadCast.Error,
+			Causes: causes,
+		}
+	}
+	return nil
+}
+
+// newReply returns a new value of the type of reply, a pointer, so that the servers do not decode into the same value.
+func newReply(reply interface{}) interface{} {
+	v := reflect.ValueOf(reply)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reply
+	}
+	return reflect.New(v.Type().Elem()).Interface()
+}
+
+// setReply copies the reply r of newReply into reply.
+func setReply(reply, r interface{}) {
+	v := reflect.ValueOf(reply)
+	if v.Kind() != reflect.Ptr || v.IsNil() || r == reply {
+		return
+	}
+	v.Elem().Set(reflect.ValueOf(r).Elem())
+}
@@ -1,9 +1,14 @@
 package client
 
 import (
+	"errors"
 	"io"
 	"net"
 	"net/rpc"
+	"sync"
+	"sync/atomic"
+
+	"github.com/henrylee2cn/myrpc/common"
 )
 
 type (
@@ -33,6 +38,10 @@ type (
 	clientCodecConn struct {
 		net.Conn
 		rpc.ClientCodec
+		// closed is set once Close is called, see Close.
+		closed    int32
+		closeOnce sync.Once
+		closeErr  error
 	}
 )
 
@@ -60,14 +69,35 @@ func (conn *clientCodecConn) GetClientCodec() rpc.ClientCodec {
 	return conn.ClientCodec
 }
 
-// Close closes the connection.
+// WriteRequest writes the request.
+// Once the connection is closed, it fails with common.ErrConnClosed without encoding the request.
+func (conn *clientCodecConn) WriteRequest(req *rpc.Request, body interface{}) error {
+	if atomic.LoadInt32(&conn.closed) == 1 {
+		return common.ErrConnClosed
+	}
+	return conn.ClientCodec.WriteRequest(req, body)
+}
+
+// Close closes the codec, which flushes what it holds, then the connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
+// Close is idempotent: the following calls return the error of the first one.
 func (conn *clientCodecConn) Close() error {
-	var err error
-	if conn.ClientCodec != nil {
-		err = conn.ClientCodec.Close()
-	} else {
-		err = conn.Conn.Close()
-	}
-	return err
+	conn.closeOnce.Do(func() {
+		atomic.StoreInt32(&conn.closed, 1)
+		if conn.ClientCodec != nil {
+			conn.closeErr = conn.ClientCodec.Close()
+		}
+		// the codec may not close the connection, e.g. h2c or when a plugin wraps it.
+		if conn.Conn != nil {
+			if err := conn.Conn.Close(); conn.closeErr == nil && !isClosedError(err) {
+				conn.closeErr = err
+			}
+		}
+	})
+	return conn.closeErr
+}
+
+// isClosedError reports whether err is caused by closing a connection already closed.
+func isClosedError(err error) bool {
+	return err == nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe)
 }
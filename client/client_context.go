@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// contextInvoker is implemented by the invokers that can abandon a call once its context is done.
+type contextInvoker interface {
+	goContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call
+}
+
+var _ contextInvoker = new(invoker)
+
+// CallContext is like Call, but the call is abandoned once ctx is done, canceled or past its deadline,
+// instead of waiting for the connection-level timeout.
+// The server is asked to cancel the call, the context of which is done then, see server.Context.StdContext.
+// The error is then of type ErrorTypeClientCanceled, and errors.Is(rpcErr.Err(), ctx.Err()) reports true.
+// The call is not retried on another server once ctx is done.
+// The metadata of ctx are added to the query of serviceMethod, see common.WithMetadata.
+func (client *Client) CallContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, opts ...CallOption) *common.RPCError {
+	serviceMethod = common.AddQuery(serviceMethod, common.MetadataFromContext(ctx))
+	opts = append(opts[:len(opts):len(opts)], func(o *callOptions) {
+		o.ctx = ctx
+	})
+	return client.Call(serviceMethod, args, reply, opts...)
+}
+
+// GoContext is like Go, but the call is abandoned once ctx is done, see CallContext.
+func (client *Client) GoContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call, opts ...CallOption) *Call {
+	serviceMethod = common.AddQuery(serviceMethod, common.MetadataFromContext(ctx))
+	o := newCallOptions(opts)
+	o.ctx = ctx
+	return client.goCall(serviceMethod, args, reply, done, o)
+}
+
+// goInvoker invokes serviceMethod on invoker asynchronously, abandoning it once the context of o is done.
+// The call is sent over the connection with the codec of the Policy of o to the server of invoker, if any.
+func (o *callOptions) goInvoker(invoker Invoker, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	if o.conns != nil {
+		conn, err := o.conns.invoker(invoker)
+		if err != nil {
+			call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+			call.Error = &common.RPCError{
+				Type:  common.ErrorTypeClientConnect,
+				Error: err.Error(),
+			}
+			call.done()
+			return call
+		}
+		invoker = conn
+	}
+	if o.idempotent {
+		if invoker, ok := invoker.(resendInvoker); ok {
+			return invoker.goResend(o.ctx, serviceMethod, args, reply, done)
+		}
+	}
+	if o.ctx != nil {
+		if invoker, ok := invoker.(contextInvoker); ok {
+			return invoker.goContext(o.ctx, serviceMethod, args, reply, done)
+		}
+	}
+	return invoker.Go(serviceMethod, args, reply, done)
+}
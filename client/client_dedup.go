@@ -0,0 +1,101 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// dedupCall is a call whose result is shared by the identical calls issued within the DedupWindow.
+type dedupCall struct {
+	issued time.Time
+	done   chan struct{}
+	// reply is a shallow copy of the reply, nil if the call had no reply pointer.
+	reply  reflect.Value
+	rpcErr *common.RPCError
+}
+
+// dedupTable tracks the calls of the current DedupWindow by method and args hash.
+type dedupTable struct {
+	calls map[[sha256.Size]byte]*dedupCall
+	mu    sync.Mutex
+}
+
+// dedupKey hashes the method and the JSON of args, it returns false if args is not JSON-encodable.
+func dedupKey(serviceMethod string, args interface{}) ([sha256.Size]byte, bool) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	h := sha256.New()
+	h.Write([]byte(serviceMethod))
+	h.Write([]byte{0})
+	h.Write(b)
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key, true
+}
+
+// do runs call, unless an identical call was issued less than window ago,
+// in which case it waits for that call and copies its result into reply.
+func (t *dedupTable) do(clock common.Clock, key [sha256.Size]byte, window time.Duration, reply interface{}, call func() *common.RPCError) *common.RPCError {
+	replyv := reflect.ValueOf(reply)
+	if reply != nil && (replyv.Kind() != reflect.Ptr || replyv.IsNil()) {
+		return call()
+	}
+	now := clock.Now()
+	t.mu.Lock()
+	if t.calls == nil {
+		t.calls = make(map[[sha256.Size]byte]*dedupCall)
+	}
+	if c, ok := t.calls[key]; ok && now.Sub(c.issued) < window {
+		t.mu.Unlock()
+		<-c.done
+		if c.rpcErr != nil {
+			return c.rpcErr
+		}
+		if reply == nil {
+			return nil
+		}
+		if !c.reply.IsValid() || c.reply.Type() != replyv.Elem().Type() {
+			return call()
+		}
+		replyv.Elem().Set(c.reply)
+		return nil
+	}
+	c := &dedupCall{issued: now, done: make(chan struct{})}
+	t.calls[key] = c
+	t.mu.Unlock()
+	clock.AfterFunc(window, func() {
+		t.mu.Lock()
+		if t.calls[key] == c {
+			delete(t.calls, key)
+		}
+		t.mu.Unlock()
+	})
+
+	defer func() {
+		if p := recover(); p != nil {
+			// the identical calls waiting fail instead of hanging, the panic goes on in this one.
+			c.rpcErr = &common.RPCError{
+				Type:  common.ErrorTypeUnknown,
+				Error: fmt.Sprintf("rpc: panic of the deduplicated call: %v", p),
+			}
+			close(c.done)
+			panic(p)
+		}
+	}()
+	c.rpcErr = call()
+	if c.rpcErr == nil && reply != nil {
+		// copied, so that the caller may modify its reply.
+		c.reply = reflect.New(replyv.Elem().Type()).Elem()
+		c.reply.Set(replyv.Elem())
+	}
+	close(c.done)
+	return c.rpcErr
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// H2CContentType is the content type of the h2c request and response bodies.
+const H2CContentType = "application/x-myrpc"
+
+var errH2CNoStream = errors.New("rpc: h2c connection has no byte stream")
+
+// newH2CClient returns an invoker that sends each call as an HTTP/2 stream, see Server.ServeH2C.
+// The connection is made with the first call.
+// Tap and PostConnected plugins are not invoked because there is no byte stream to wrap.
+func (client *Client) newH2CClient(address string, dialTimeout time.Duration, wrapper *clientCodecWrapper) (Invoker, error) {
+	var protocols http.Protocols
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		Protocols:   &protocols,
+	}
+	scheme := "http://"
+	if client.TLSConfig != nil {
+		protocols.SetHTTP2(true)
+		transport.TLSClientConfig = client.TLSConfig
+		scheme = "https://"
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	codec := &h2cCodec{
+		httpClient: &http.Client{Transport: transport, Timeout: client.Timeout},
+		baseURL:    scheme + address,
+		address:    address,
+		codecFunc:  wrapper.codecFunc,
+		results:    make(chan *h2cResult, 64),
+		done:       make(chan struct{}),
+	}
+	wrapper.codecConn = &clientCodecConn{Conn: codec, ClientCodec: codec}
+	return newInvoker(wrapper, address), nil
+}
+
+// h2cCodec is a rpc.ClientCodec that posts each request as an HTTP/2 stream,
+// and a net.Conn without byte stream for the sake of ClientCodecConn.
+type h2cCodec struct {
+	httpClient *http.Client
+	baseURL    string
+	address    string
+	codecFunc  ClientCodecFunc
+	results    chan *h2cResult
+	current    rpc.ClientCodec // decodes the body of the last read response
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+type h2cResult struct {
+	seq           uint64
+	serviceMethod string
+	data          []byte
+	err           error
+}
+
+var _ rpc.ClientCodec = new(h2cCodec)
+var _ net.Conn = new(h2cCodec)
+
+func (c *h2cCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	u, err := url.Parse(r.ServiceMethod)
+	if err != nil {
+		return err
+	}
+	target := c.baseURL + u.Path
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	var buf bytes.Buffer
+	if err = c.codecFunc(&bufferRWC{w: &buf}).WriteRequest(r, body); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", target, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", H2CContentType)
+	go c.post(req, &h2cResult{seq: r.Seq, serviceMethod: r.ServiceMethod})
+	return nil
+}
+
+func (c *h2cCodec) post(req *http.Request, result *h2cResult) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err == nil {
+		if resp.StatusCode != http.StatusOK {
+			err = errors.New("unexpected HTTP response: " + resp.Status)
+		} else {
+			result.data, err = io.ReadAll(resp.Body)
+		}
+		resp.Body.Close()
+	}
+	result.err = err
+	select {
+	case c.results <- result:
+	case <-c.done:
+	}
+}
+
+func (c *h2cCodec) ReadResponseHeader(r *rpc.Response) error {
+	var result *h2cResult
+	select {
+	case result = <-c.results:
+	case <-c.done:
+		return io.EOF
+	}
+	c.current = nil
+	if result.err != nil {
+		// a failed stream only fails its own call.
+		r.Seq = result.seq
+		r.ServiceMethod = result.serviceMethod
+		r.Error = common.EncodeErrorType(common.ErrorTypeClientConnect) + result.err.Error()
+		return nil
+	}
+	dec := c.codecFunc(&bufferRWC{r: bytes.NewReader(result.data)})
+	if err := dec.ReadResponseHeader(r); err != nil {
+		r.Seq = result.seq
+		r.ServiceMethod = result.serviceMethod
+		r.Error = common.EncodeErrorType(common.ErrorTypeClientReadResponseHeader) + err.Error()
+		return nil
+	}
+	c.current = dec
+	return nil
+}
+
+func (c *h2cCodec) ReadResponseBody(body interface{}) error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.ReadResponseBody(body)
+}
+
+func (c *h2cCodec) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.httpClient.CloseIdleConnections()
+	})
+	return nil
+}
+
+func (c *h2cCodec) Read(b []byte) (int, error) {
+	return 0, errH2CNoStream
+}
+
+func (c *h2cCodec) Write(b []byte) (int, error) {
+	return 0, errH2CNoStream
+}
+
+func (c *h2cCodec) LocalAddr() net.Addr {
+	return h2cAddr("")
+}
+
+func (c *h2cCodec) RemoteAddr() net.Addr {
+	return h2cAddr(c.address)
+}
+
+// SetDeadline does nothing, Client.Timeout limits each stream instead.
+func (c *h2cCodec) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *h2cCodec) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *h2cCodec) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type h2cAddr string
+
+func (a h2cAddr) Network() string {
+	return "h2c"
+}
+
+func (a h2cAddr) String() string {
+	return string(a)
+}
+
+// bufferRWC is an io.ReadWriteCloser of a single encoded message.
+type bufferRWC struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (b *bufferRWC) Read(p []byte) (int, error) {
+	if b.r == nil {
+		return 0, io.EOF
+	}
+	return b.r.Read(p)
+}
+
+func (b *bufferRWC) Write(p []byte) (int, error) {
+	if b.w == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return b.w.Write(p)
+}
+
+func (b *bufferRWC) Close() error {
+	return nil
+}
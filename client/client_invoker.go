@@ -1,9 +1,13 @@
 package client
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/rpc"
+	"net/url"
+	"strconv"
 	"sync"
 
 	"github.com/henrylee2cn/myrpc/common"
@@ -18,14 +22,24 @@ type (
 		Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError
 		Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call
 		Close() error
+		// State returns the current connection state.
+		State() InvokerState
+		// LastError returns the last connection-level error, or nil.
+		LastError() *common.RPCError
+		// Address returns the remote address of the connection.
+		Address() string
 	}
 
+	// InvokerState describes the connection state of an Invoker.
+	InvokerState int
+
 	// Client represents an RPC Client.
 	// There may be multiple outstanding Calls associated
 	// with a single Client, and a Client may be used by
 	// multiple goroutines simultaneously.
 	invoker struct {
-		codec *clientCodecWrapper
+		codec   *clientCodecWrapper
+		address string
 
 		reqMutex sync.Mutex // protects following
 		request  rpc.Request
@@ -35,6 +49,9 @@ type (
 		pending  map[uint64]*Call
 		closing  bool // user has called Close
 		shutdown bool // server has told us to stop
+		state    InvokerState
+		lastErr  *common.RPCError
+		exited   chan struct{} // closed once input exits
 	}
 
 	// Call represents an active RPC.
@@ -43,16 +60,53 @@ type (
 		Args          interface{}      // The argument to the function (*struct).
 		Reply         interface{}      // The reply from the function (*struct).
 		Error         *common.RPCError // After completion, the error status.
+		Trailer       url.Values       // After completion, the trailer of the response, if any.
 		Done          chan *Call       // Strobes when call is complete.
+		// Idempotent reports whether the call is sent again once its connection is redialed,
+		// if it breaks while the call is pending, see Client.Reconnect and the Idempotent option.
+		Idempotent bool
+
+		seq  uint64
+		ctx  context.Context // cancels the call once it is done, if it is not nil
+		stop func() bool     // stops watching ctx
 	}
 )
 
+const (
+	// Connecting means the connection is being established. Only the connections redialed report it,
+	// see Client.Reconnect: the others are returned by the selectors once they are established, Ready.
+	Connecting InvokerState = iota
+	// Ready means the connection is established and healthy.
+	Ready
+	// Degraded means the connection is open but the last request failed.
+	Degraded
+	// Closed means the connection has been closed or shut down.
+	Closed
+)
+
+var invokerStateStrs = [...]string{
+	"Connecting",
+	"Ready",
+	"Degraded",
+	"Closed",
+}
+
+func (s InvokerState) String() string {
+	if s < 0 || int(s) >= len(invokerStateStrs) {
+		return "InvokerState(" + strconv.Itoa(int(s)) + ")"
+	}
+	return invokerStateStrs[s]
+}
+
 // newInvoker is like NewClientWithConn but uses the specified
 // codec to encode requests and decode responses.
-func newInvoker(codec *clientCodecWrapper) Invoker {
+func newInvoker(codec *clientCodecWrapper, address string) Invoker {
 	invoker := &invoker{
 		codec:   codec,
+		address: address,
 		pending: make(map[uint64]*Call),
+		state:   Ready,
+		exited:  make(chan struct{}),
 	}
 	go invoker.input()
 	return invoker
@@ -83,6 +137,59 @@ func (invoker *invoker) Go(serviceMethod string, args interface{}, reply interfa
 	return call
 }
 
+// goContext is like Go, but the call is abandoned once ctx is done, see Client.GoContext.
+func (invoker *invoker) goContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	call := new(Call)
+	call.ServiceMethod = serviceMethod
+	call.Args = args
+	call.Reply = reply
+	call.ctx = ctx
+	if done == nil {
+		done = make(chan *Call, 10) // buffered.
+	} else if cap(done) == 0 {
+		log.Panic("rpc: done channel is unbuffered")
+	}
+	call.Done = done
+	if ctx != nil && ctx.Err() != nil {
+		call.Error = canceledError(ctx.Err())
+		call.done()
+		return call
+	}
+	invoker.send(call)
+	return call
+}
+
+// cancel fails call with the error of its context, if it is pending,
+// and asks the server to cancel it.
+func (invoker *invoker) cancel(call *Call) {
+	invoker.mutex.Lock()
+	if invoker.pending[call.seq] != call {
+		invoker.mutex.Unlock()
+		return
+	}
+	delete(invoker.pending, call.seq)
+	invoker.mutex.Unlock()
+	call.Error = canceledError(call.ctx.Err())
+	call.done()
+
+	// Plugins are skipped, the request is not a call.
+	invoker.reqMutex.Lock()
+	defer invoker.reqMutex.Unlock()
+	invoker.request.Seq = call.seq
+	invoker.request.ServiceMethod = common.CancelServiceMethod
+	if err := invoker.codec.codecConn.WriteRequest(&invoker.request, struct{}{}); err != nil {
+		log.Debug("rpc: failed to cancel a call: " + err.Error())
+	}
+}
+
+func canceledError(err error) *common.RPCError {
+	return &common.RPCError{
+		Type:   common.ErrorTypeClientCanceled,
+		Error:  err.Error(),
+		Causes: []error{err},
+	}
+}
+
 // Call invokes the named function, waits for it to complete, and returns its error status.
 func (invoker *invoker) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
 	call := <-invoker.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
@@ -98,10 +205,30 @@ func (invoker *invoker) Close() error {
 		return errors.New(common.RPCErrShutdown.Error)
 	}
 	invoker.closing = true
+	invoker.state = Closed
 	invoker.mutex.Unlock()
 	return invoker.codec.Close()
 }
 
+// State returns the current connection state.
+func (invoker *invoker) State() InvokerState {
+	invoker.mutex.Lock()
+	defer invoker.mutex.Unlock()
+	return invoker.state
+}
+
+// LastError returns the last connection-level error, or nil.
+func (invoker *invoker) LastError() *common.RPCError {
+	invoker.mutex.Lock()
+	defer invoker.mutex.Unlock()
+	return invoker.lastErr
+}
+
+// Address returns the remote address of the connection.
+func (invoker *invoker) Address() string {
+	return invoker.address
+}
+
 func (invoker *invoker) send(call *Call) {
 	invoker.reqMutex.Lock()
 	defer invoker.reqMutex.Unlock()
@@ -116,17 +243,25 @@ func (invoker *invoker) send(call *Call) {
 	}
 	seq := invoker.seq
 	invoker.seq++
+	call.seq = seq
 	invoker.pending[seq] = call
+	if call.ctx != nil {
+		call.stop = context.AfterFunc(call.ctx, func() { invoker.cancel(call) })
+	}
 	invoker.mutex.Unlock()
 
 	// Encode and send the request.
 	invoker.request.Seq = seq
 	invoker.request.ServiceMethod = call.ServiceMethod
-	rpcErr := invoker.codec.WriteRequest(&invoker.request, call.Args)
+	rpcErr := invoker.write(call.Args)
 	if rpcErr != nil {
 		invoker.mutex.Lock()
 		call = invoker.pending[seq]
 		delete(invoker.pending, seq)
+		invoker.lastErr = rpcErr
+		if invoker.state == Ready {
+			invoker.state = Degraded
+		}
 		invoker.mutex.Unlock()
 		if call != nil {
 			call.Error = rpcErr
@@ -135,11 +270,42 @@ func (invoker *invoker) send(call *Call) {
 	}
 }
 
+// write encodes and sends the request. A panic of the codec or of a plugin fails the request,
+// and closes the connection since the stream may be corrupt, so the pending calls fail too.
+func (invoker *invoker) write(args interface{}) (rpcErr *common.RPCError) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Criticalf("rpc: invoker (%s) writing the request: %v\n[PANIC]\n%s\n", invoker.address, p, common.PanicTrace(4))
+			rpcErr = &common.RPCError{
+				Type:  common.ErrorTypeClientWriteRequest,
+				Error: fmt.Sprintf("rpc: panic writing the request: %v", p),
+			}
+			invoker.codec.Close()
+		}
+	}()
+	return invoker.codec.WriteRequest(&invoker.request, args)
+}
+
+// input reads the responses until the connection fails. Once it exits, even by a panic of the codec or of a plugin,
+// the connection is closed and the pending calls fail with an error of type ErrorTypeClientConnectionLost,
+// or RPCErrShutdown if the invoker is closed.
 func (invoker *invoker) input() {
 	var (
 		rpcErr   *common.RPCError
 		response rpc.Response
+		reading  *Call // the call whose response body is being read
 	)
+	defer func() {
+		if p := recover(); p != nil {
+			log.Criticalf("rpc: invoker (%s) reading the responses: %v\n[PANIC]\n%s\n", invoker.address, p, common.PanicTrace(4))
+			rpcErr = &common.RPCError{
+				Type:  common.ErrorTypeClientReadResponseBody,
+				Error: fmt.Sprintf("rpc: panic reading the responses: %v", p),
+			}
+			invoker.codec.Close()
+		}
+		invoker.terminate(rpcErr, reading)
+	}()
 	for rpcErr == nil {
 		response = rpc.Response{}
 		rpcErr = invoker.codec.ReadResponseHeader(&response)
@@ -150,6 +316,9 @@ func (invoker *invoker) input() {
 		invoker.mutex.Lock()
 		call := invoker.pending[seq]
 		delete(invoker.pending, seq)
+		if invoker.state == Degraded {
+			invoker.state = Ready
+		}
 		invoker.mutex.Unlock()
 
 		switch {
@@ -165,23 +334,33 @@ func (invoker *invoker) input() {
 			// We've got an error response. Give this to the request;
 			// any subsequent requests will get the ReadResponseBody
 			// error if there is one.
-			rpcErr = parseResponseError(response.Error)
+			reading = call
+			rpcErr = common.ParseResponseError(response.Error)
 			call.Error = rpcErr
+			_, call.Trailer = common.SplitTrailer(response.ServiceMethod)
 			rpcErr = invoker.codec.ReadResponseBody(nil)
+			reading = nil
 			call.done()
 
 		default:
+			reading = call
+			_, call.Trailer = common.SplitTrailer(response.ServiceMethod)
 			rpcErr = invoker.codec.ReadResponseBody(call.Reply)
 			if rpcErr != nil {
 				call.Error = rpcErr
 			}
+			reading = nil
 			call.done()
 		}
 	}
-	// Terminate pending calls.
+}
+
+// terminate fails the pending calls, and reading if it is not nil, once input exits with rpcErr.
+func (invoker *invoker) terminate(rpcErr *common.RPCError, reading *Call) {
 	invoker.reqMutex.Lock()
 	invoker.mutex.Lock()
 	invoker.shutdown = true
+	invoker.state = Closed
 	closing := invoker.closing
 	if rpcErr != nil && rpcErr.Error == io.EOF.Error() {
 		if closing {
@@ -192,15 +371,43 @@ func (invoker *invoker) input() {
 	} else if !closing {
 		log.Debug("rpc: invoker protocol error: " + rpcErr.Error)
 	}
-	for _, call := range invoker.pending {
-		call.Error = rpcErr
-		call.done()
+	// a response too large fails the calls pending with its own error, the header of the response
+	// being possibly unread, e.g. by json, see Client.MaxResponseBodySize.
+	if !closing && rpcErr.Type != common.ErrorTypeClientMessageTooLarge {
+		rpcErr = connectionLostError(invoker.address, rpcErr)
+	}
+	invoker.lastErr = rpcErr
+	calls := make([]*Call, 0, len(invoker.pending)+1)
+	for seq, call := range invoker.pending {
+		delete(invoker.pending, seq)
+		calls = append(calls, call)
+	}
+	if reading != nil {
+		calls = append(calls, reading)
 	}
 	invoker.mutex.Unlock()
 	invoker.reqMutex.Unlock()
+	close(invoker.exited)
+	for _, call := range calls {
+		call.Error = rpcErr
+		call.done()
+	}
+}
+
+// connectionLostError is the error of the calls pending when the connection to the server address is lost by cause.
+func connectionLostError(address string, cause *common.RPCError) *common.RPCError {
+	err := common.ErrConnectionLost.Format(address, cause.Error)
+	return &common.RPCError{
+		Type:   common.ErrorTypeClientConnectionLost,
+		Error:  err.Error(),
+		Causes: []error{err, cause.Err()},
+	}
 }
 
 func (call *Call) done() {
+	if call.stop != nil {
+		call.stop()
+	}
 	select {
 	case call.Done <- call:
 		// ok
@@ -210,10 +417,3 @@ func (call *Call) done() {
 		log.Debug("rpc: discarding Call reply due to insufficient Done chan capacity")
 	}
 }
-
-func parseResponseError(errMsg string) *common.RPCError {
-	return &common.RPCError{
-		Type:  common.ErrorType(errMsg[0]),
-		Error: errMsg[1:],
-	}
-}
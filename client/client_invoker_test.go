@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"net/rpc"
+	"testing"
+
+	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/memnet"
+)
+
+// rejectPlugin fails the writes of the requests of its path.
+type rejectPlugin string
+
+func (p rejectPlugin) Name() string { return "reject" }
+
+func (p rejectPlugin) PreWriteRequest(r *rpc.Request, body interface{}) error {
+	if r.ServiceMethod == string(p) {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+// echoConn serves the connection accepted by lis with the gob codec, replying their argument to the requests,
+// until the connection is closed or a request is sent on closed.
+func echoConn(t *testing.T, lis *memnet.Listener, closed chan struct{}) {
+	conn, err := lis.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go func() {
+		<-closed
+		conn.Close()
+	}()
+	c := codecGob.NewGobServerCodec(conn)
+	for {
+		req := new(rpc.Request)
+		var arg string
+		if c.ReadRequestHeader(req) != nil || c.ReadRequestBody(&arg) != nil {
+			return
+		}
+		c.WriteResponse(&rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}, arg)
+	}
+}
+
+func TestInvokerState(t *testing.T) {
+	address := t.Name()
+	lis, err := memnet.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	closed := make(chan struct{})
+	go echoConn(t, lis, closed)
+
+	c := NewClient(Client{}, new(testSelector))
+	c.PluginContainer.Add(rejectPlugin("/test/reject"))
+	i, err := c.dialConn(memnet.Network, address, 0, codecGob.NewGobClientCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	if i.State() != Ready || i.LastError() != nil || i.Address() != address {
+		t.Fatalf("expect a Ready invoker of %s, got %s of %s, %v", address, i.State(), i.Address(), i.LastError())
+	}
+
+	var reply string
+	rpcErr := i.Call("/test/reject", "hello", &reply)
+	if rpcErr == nil || rpcErr.Type != common.ErrorTypeClientPreWriteRequest {
+		t.Fatalf("expect the request to be rejected, got %v", rpcErr)
+	}
+	if i.State() != Degraded || i.LastError() != rpcErr {
+		t.Fatalf("expect the invoker Degraded by the failed request, got %s, %v", i.State(), i.LastError())
+	}
+	// a response makes it Ready again.
+	if rpcErr := i.Call("/test/echo", "hello", &reply); rpcErr != nil || reply != "hello" {
+		t.Fatalf("expect the call to be served, got %q, %v", reply, rpcErr)
+	}
+	if i.State() != Ready {
+		t.Fatalf("expect the invoker Ready once a response is read, got %s", i.State())
+	}
+
+	close(closed)
+	<-i.(*invoker).exited
+	if rpcErr := i.LastError(); i.State() != Closed || rpcErr == nil || rpcErr.Type != common.ErrorTypeClientConnectionLost {
+		t.Fatalf("expect the invoker Closed by the lost connection, got %s, %v", i.State(), rpcErr)
+	}
+}
+
+func TestInvokerStateString(t *testing.T) {
+	for state, s := range map[InvokerState]string{
+		Connecting:       "Connecting",
+		Ready:            "Ready",
+		Closed:           "Closed",
+		InvokerState(-1): "InvokerState(-1)",
+		InvokerState(7):  "InvokerState(7)",
+	} {
+		if state.String() != s {
+			t.Errorf("expect %s, got %s", s, state.String())
+		}
+	}
+}
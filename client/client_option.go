@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+// CallOption configures a single call of Client.Call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	trailer *url.Values
+	target  string
+	invoker Invoker
+	ctx     context.Context
+	replies *[]BroadcastReply
+	// admitted is set by Call and Go for the first selection of the call, counted by then, see Client.Shutdown.
+	admitted bool
+	// idempotent calls are sent again over a redialed connection, see Idempotent.
+	idempotent bool
+
+	// the settings of the call, see Policy.
+	failMode FailMode
+	maxTry   int
+	conns    *codecConns
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	o := new(callOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Trailer receives the trailer of the response into t, see server.Context.SetTrailer.
+// t is left nil if the response has no trailer.
+func Trailer(t *url.Values) CallOption {
+	return func(o *callOptions) {
+		o.trailer = t
+	}
+}
+
+// receive hands the results of call, other than the reply, to the options.
+func (o *callOptions) receive(call *Call) {
+	if o.trailer != nil {
+		*o.trailer = call.Trailer
+	}
+}
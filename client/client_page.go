@@ -0,0 +1,112 @@
+package client
+
+import (
+	"reflect"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// The fields of the page-token convention of the list-style methods:
+// the args have a string PageToken field, empty for the first page,
+// and the reply has a string NextPageToken field, empty for the last page.
+const (
+	PageTokenField     = "PageToken"
+	NextPageTokenField = "NextPageToken"
+)
+
+// Pager calls a list-style method page by page, following the page-token convention.
+//
+//	pages := c.Pages("/user/list", &ListArgs{Size: 100}, new(ListReply))
+//	for pages.Next() {
+//		for _, user := range pages.Reply().(*ListReply).Users {
+//			...
+//		}
+//	}
+//	if rpcErr := pages.Err(); rpcErr != nil {
+//		...
+//	}
+type Pager struct {
+	client        *Client
+	serviceMethod string
+	opts          []CallOption
+	args          interface{}
+	token         reflect.Value // PageToken field of the args
+	replyType     reflect.Type
+	reply         interface{}
+	next          string
+	pages         int
+	done          bool
+	err           *common.RPCError
+}
+
+// Pages returns a Pager calling serviceMethod with args, a pointer to a struct whose PageToken field is set for each page.
+// reply is a pointer to the reply of the first page, a new reply of its type is allocated for the following pages.
+func (client *Client) Pages(serviceMethod string, args interface{}, reply interface{}, opts ...CallOption) *Pager {
+	p := &Pager{
+		client:        client,
+		serviceMethod: serviceMethod,
+		opts:          opts,
+		args:          args,
+		reply:         reply,
+	}
+	argsv := reflect.ValueOf(args)
+	if argsv.Kind() != reflect.Ptr || argsv.Elem().Kind() != reflect.Struct {
+		p.fail("args of " + serviceMethod + " is not a pointer to struct")
+		return p
+	}
+	if p.token = argsv.Elem().FieldByName(PageTokenField); !p.token.IsValid() || p.token.Kind() != reflect.String {
+		p.fail("args of " + serviceMethod + " has no string " + PageTokenField + " field")
+		return p
+	}
+	replyv := reflect.ValueOf(reply)
+	if replyv.Kind() != reflect.Ptr || replyv.Elem().Kind() != reflect.Struct {
+		p.fail("reply of " + serviceMethod + " is not a pointer to struct")
+		return p
+	}
+	if next, ok := replyv.Type().Elem().FieldByName(NextPageTokenField); !ok || next.Type.Kind() != reflect.String {
+		p.fail("reply of " + serviceMethod + " has no string " + NextPageTokenField + " field")
+		return p
+	}
+	p.replyType = replyv.Type().Elem()
+	p.next = p.token.String()
+	return p
+}
+
+func (p *Pager) fail(errMsg string) {
+	p.done = true
+	p.err = common.NewRPCError(common.ErrorTypeUnknown, errMsg)
+}
+
+// Next calls the method for the next page, it returns false after the last page or an error.
+func (p *Pager) Next() bool {
+	if p.done {
+		return false
+	}
+	if p.pages > 0 {
+		p.reply = reflect.New(p.replyType).Interface()
+	}
+	p.pages++
+	p.token.SetString(p.next)
+	if p.err = p.client.Call(p.serviceMethod, p.args, p.reply, p.opts...); p.err != nil {
+		p.done = true
+		return false
+	}
+	next := reflect.ValueOf(p.reply).Elem().FieldByName(NextPageTokenField).String()
+	if next == p.next && next != "" {
+		p.fail(p.serviceMethod + " returned the page token " + next + " again")
+		return false
+	}
+	p.next = next
+	p.done = next == ""
+	return true
+}
+
+// Reply returns the reply of the current page.
+func (p *Pager) Reply() interface{} {
+	return p.reply
+}
+
+// Err returns the error that stopped the Pager, if any.
+func (p *Pager) Err() *common.RPCError {
+	return p.err
+}
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"context"
 	"net/rpc"
+	"time"
 
 	"github.com/henrylee2cn/myrpc/common"
 	"github.com/henrylee2cn/myrpc/plugin"
@@ -17,6 +19,12 @@ type (
 		PostConnected(ClientCodecConn) error
 	}
 
+	// IRewriteRequestPlugin rewrites the outgoing service method and args before they are written,
+	// e.g. to talk to a plain net/rpc server.
+	IRewriteRequestPlugin interface {
+		RewriteRequest(serviceMethod string, args interface{}) (string, interface{}, error)
+	}
+
 	//IPreWriteRequestPlugin means as its name.
 	IPreWriteRequestPlugin interface {
 		PreWriteRequest(*rpc.Request, interface{}) error
@@ -47,6 +55,13 @@ type (
 		PostReadResponseBody(interface{}) error
 	}
 
+	// IPostCallPlugin observes each call made with Call, CallContext, Go or GoContext once it is complete, retries included:
+	// ctx is the context of the call, context.Background() for Call and Go, elapsed is its duration and rpcErr its error, if any.
+	// It can collect the metrics of the downstream calls of a service, tagged with the metadata of ctx.
+	IPostCallPlugin interface {
+		PostCall(ctx context.Context, serviceMethod string, elapsed time.Duration, rpcErr *common.RPCError)
+	}
+
 	//IClientPluginContainer represents a plugin container that defines all methods to manage plugins.
 	//And it also defines all extension points.
 	IClientPluginContainer interface {
@@ -54,6 +69,7 @@ type (
 
 		doPostConnected(ClientCodecConn) error
 
+		doRewriteRequest(*rpc.Request, interface{}) (interface{}, error)
 		doPreWriteRequest(*rpc.Request, interface{}) error
 		doPostWriteRequest(*rpc.Request, interface{}) error
 
@@ -62,6 +78,8 @@ type (
 
 		doPreReadResponseBody(interface{}) error
 		doPostReadResponseBody(interface{}) error
+
+		doPostCall(ctx context.Context, serviceMethod string, elapsed time.Duration, rpcErr *common.RPCError)
 	}
 )
 
@@ -71,10 +89,11 @@ type ClientPluginContainer struct {
 }
 
 // doPostConnected handles connected.
-func (p *ClientPluginContainer) doPostConnected(codecConn ClientCodecConn) error {
-	var err error
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostConnectedPlugin); ok {
+func (p *ClientPluginContainer) doPostConnected(codecConn ClientCodecConn) (err error) {
+	var i int
+	defer p.Recover("PostConnected", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostConnectedPlugin); ok && p.Enabled(i) {
 			err = plugin.PostConnected(codecConn)
 			if err != nil { //interrupt
 				codecConn.Close()
@@ -85,10 +104,28 @@ func (p *ClientPluginContainer) doPostConnected(codecConn ClientCodecConn) error
 	return nil
 }
 
+// doRewriteRequest invokes RewriteRequest plugin, it sets the service method of r and returns the args to write.
+func (p *ClientPluginContainer) doRewriteRequest(r *rpc.Request, body interface{}) (_ interface{}, err error) {
+	var i int
+	defer p.Recover("RewriteRequest", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IRewriteRequestPlugin); ok && p.Enabled(i) {
+			serviceMethod, args, err := plugin.RewriteRequest(r.ServiceMethod, body)
+			if err != nil {
+				return nil, common.ErrRewriteRequest.Format(p.Plugins[i].Name(), err.Error())
+			}
+			r.ServiceMethod, body = serviceMethod, args
+		}
+	}
+	return body, nil
+}
+
 // doPreWriteRequest invokes doPreWriteRequest plugin.
-func (p *ClientPluginContainer) doPreWriteRequest(r *rpc.Request, body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPreWriteRequestPlugin); ok {
+func (p *ClientPluginContainer) doPreWriteRequest(r *rpc.Request, body interface{}) (err error) {
+	var i int
+	defer p.Recover("PreWriteRequest", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPreWriteRequestPlugin); ok && p.Enabled(i) {
 			err := plugin.PreWriteRequest(r, body)
 			if err != nil {
 				return common.ErrPreWriteRequest.Format(p.Plugins[i].Name(), err.Error())
@@ -100,9 +137,11 @@ func (p *ClientPluginContainer) doPreWriteRequest(r *rpc.Request, body interface
 }
 
 // doPostWriteRequest invokes doPostWriteRequest plugin.
-func (p *ClientPluginContainer) doPostWriteRequest(r *rpc.Request, body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostWriteRequestPlugin); ok {
+func (p *ClientPluginContainer) doPostWriteRequest(r *rpc.Request, body interface{}) (err error) {
+	var i int
+	defer p.Recover("PostWriteRequest", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostWriteRequestPlugin); ok && p.Enabled(i) {
 			err := plugin.PostWriteRequest(r, body)
 			if err != nil {
 				return common.ErrPostWriteRequest.Format(p.Plugins[i].Name(), err.Error())
@@ -114,9 +153,11 @@ func (p *ClientPluginContainer) doPostWriteRequest(r *rpc.Request, body interfac
 }
 
 // doPreReadResponseHeader invokes doPreReadResponseHeader plugin.
-func (p *ClientPluginContainer) doPreReadResponseHeader(r *rpc.Response) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPreReadResponseHeaderPlugin); ok {
+func (p *ClientPluginContainer) doPreReadResponseHeader(r *rpc.Response) (err error) {
+	var i int
+	defer p.Recover("PreReadResponseHeader", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPreReadResponseHeaderPlugin); ok && p.Enabled(i) {
 			err := plugin.PreReadResponseHeader(r)
 			if err != nil {
 				return common.ErrPreReadResponseHeader.Format(p.Plugins[i].Name(), err.Error())
@@ -127,9 +168,11 @@ func (p *ClientPluginContainer) doPreReadResponseHeader(r *rpc.Response) error {
 }
 
 // doPostReadResponseHeader invokes doPostReadResponseHeader plugin.
-func (p *ClientPluginContainer) doPostReadResponseHeader(r *rpc.Response) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostReadResponseHeaderPlugin); ok {
+func (p *ClientPluginContainer) doPostReadResponseHeader(r *rpc.Response) (err error) {
+	var i int
+	defer p.Recover("PostReadResponseHeader", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostReadResponseHeaderPlugin); ok && p.Enabled(i) {
 			err := plugin.PostReadResponseHeader(r)
 			if err != nil {
 				return common.ErrPostReadResponseHeader.Format(p.Plugins[i].Name(), err.Error())
@@ -140,9 +183,11 @@ func (p *ClientPluginContainer) doPostReadResponseHeader(r *rpc.Response) error
 }
 
 // doPreReadResponseBody invokes doPreReadResponseBody plugin.
-func (p *ClientPluginContainer) doPreReadResponseBody(body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPreReadResponseBodyPlugin); ok {
+func (p *ClientPluginContainer) doPreReadResponseBody(body interface{}) (err error) {
+	var i int
+	defer p.Recover("PreReadResponseBody", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPreReadResponseBodyPlugin); ok && p.Enabled(i) {
 			err := plugin.PreReadResponseBody(body)
 			if err != nil {
 				return common.ErrPreReadResponseBody.Format(p.Plugins[i].Name(), err.Error())
@@ -153,9 +198,11 @@ func (p *ClientPluginContainer) doPreReadResponseBody(body interface{}) error {
 }
 
 // doPostReadResponseBody invokes doPostReadResponseBody plugin.
-func (p *ClientPluginContainer) doPostReadResponseBody(body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostReadResponseBodyPlugin); ok {
+func (p *ClientPluginContainer) doPostReadResponseBody(body interface{}) (err error) {
+	var i int
+	defer p.Recover("PostReadResponseBody", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostReadResponseBodyPlugin); ok && p.Enabled(i) {
 			err := plugin.PostReadResponseBody(body)
 			if err != nil {
 				return common.ErrPostReadResponseBody.Format(p.Plugins[i].Name(), err.Error())
@@ -165,3 +212,14 @@ func (p *ClientPluginContainer) doPostReadResponseBody(body interface{}) error {
 
 	return nil
 }
+
+// doPostCall invokes PostCall plugin.
+func (p *ClientPluginContainer) doPostCall(ctx context.Context, serviceMethod string, elapsed time.Duration, rpcErr *common.RPCError) {
+	var i int
+	defer p.Recover("PostCall", &i, nil)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostCallPlugin); ok && p.Enabled(i) {
+			plugin.PostCall(ctx, serviceMethod, elapsed, rpcErr)
+		}
+	}
+}
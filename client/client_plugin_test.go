@@ -0,0 +1,47 @@
+package client
+
+import (
+	"errors"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/plugin"
+)
+
+// panicPlugin panics in PreWriteRequest, and counts the requests it sees in PostWriteRequest.
+type panicPlugin struct {
+	writes int
+}
+
+func (p *panicPlugin) Name() string { return "broken" }
+
+func (p *panicPlugin) PreWriteRequest(r *rpc.Request, body interface{}) error {
+	panic("boom")
+}
+
+func (p *panicPlugin) PostWriteRequest(r *rpc.Request, body interface{}) error {
+	p.writes++
+	return nil
+}
+
+func TestPluginPanic(t *testing.T) {
+	p := &ClientPluginContainer{PluginContainer: plugin.PluginContainer{MaxPanics: 2}}
+	broken := new(panicPlugin)
+	p.Add(broken)
+	r := &rpc.Request{ServiceMethod: "/test/echo"}
+	for n := 0; n < 2; n++ {
+		err := p.doPreWriteRequest(r, nil)
+		if !errors.Is(err, common.ErrPluginPanic) || !strings.Contains(err.Error(), "'broken' panicked in PreWriteRequest: boom") {
+			t.Fatalf("expect the panic to fail the request, got %v", err)
+		}
+	}
+	// the plugin is disabled after MaxPanics panics, in all its hooks.
+	if err := p.doPreWriteRequest(r, nil); err != nil {
+		t.Fatalf("expect the disabled plugin to be skipped, got %v", err)
+	}
+	if p.doPostWriteRequest(r, nil); broken.writes != 0 {
+		t.Fatal("expect the disabled plugin to be skipped in all its hooks")
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy overrides the settings of the Client for the calls of a service method, see SetMethodPolicy.
+// The zero value of a field keeps the setting of the Client.
+type Policy struct {
+	// FailMode is the FailMode of the calls. Failover, the zero value, keeps the FailMode of the Client.
+	FailMode FailMode
+	// Timeout, if it is not 0, abandons the calls once it passes, the tries included, as CallContext does.
+	Timeout time.Duration
+	// MaxTry is the maximum number of attempts of the calls.
+	MaxTry int
+	// ClientCodecFunc, if it is not nil, encodes the calls over connections of their own,
+	// dialed with it to the servers selected and kept until Close.
+	// The invokers not dialed by the Client, e.g. those of local.Invoker, keep their codec.
+	ClientCodecFunc ClientCodecFunc
+}
+
+// policyTable holds the policies of the service methods, by path.
+type policyTable struct {
+	policies map[string]*methodPolicy
+	mu       sync.RWMutex
+}
+
+// methodPolicy is a Policy set, with the connections dialed for its ClientCodecFunc.
+type methodPolicy struct {
+	Policy
+	conns *codecConns
+}
+
+// SetMethodPolicy overrides the settings of the Client for the calls of the service method path,
+// e.g. "/arith/mul", whatever their query, replacing the Policy set before for path. A zero Policy removes it.
+//
+//	client.SetMethodPolicy("/arith/mul", client.Policy{Timeout: 200 * time.Millisecond, FailMode: client.Failfast})
+func (client *Client) SetMethodPolicy(path string, p Policy) {
+	t := client.policies
+	t.mu.Lock()
+	old := t.policies[path]
+	if p.FailMode == Failover && p.Timeout == 0 && p.MaxTry == 0 && p.ClientCodecFunc == nil {
+		delete(t.policies, path)
+	} else {
+		if t.policies == nil {
+			t.policies = make(map[string]*methodPolicy)
+		}
+		mp := &methodPolicy{Policy: p}
+		if p.ClientCodecFunc != nil {
+			mp.conns = &codecConns{client: client, codecFunc: p.ClientCodecFunc}
+		}
+		t.policies[path] = mp
+	}
+	t.mu.Unlock()
+	if old != nil && old.conns != nil {
+		old.conns.close()
+	}
+}
+
+// policy returns the policy of serviceMethod, or nil if there is none.
+func (t *policyTable) policy(serviceMethod string) *methodPolicy {
+	if i := strings.IndexByte(serviceMethod, '?'); i >= 0 {
+		serviceMethod = serviceMethod[:i]
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.policies[serviceMethod]
+}
+
+// close closes the connections dialed for the policies.
+func (t *policyTable) close() {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, mp := range t.policies {
+		if mp.conns != nil {
+			mp.conns.close()
+		}
+	}
+}
+
+// applyPolicy sets the settings of the call of serviceMethod to o, those of its Policy if any, else those of the Client.
+// The returned function releases the context of the Timeout, once the call is done.
+func (client *Client) applyPolicy(serviceMethod string, o *callOptions) (cancel func()) {
+	o.failMode, o.maxTry = client.FailMode, client.MaxTry
+	mp := client.policies.policy(serviceMethod)
+	if mp == nil {
+		return func() {}
+	}
+	if mp.FailMode != Failover {
+		o.failMode = mp.FailMode
+	}
+	if mp.MaxTry > 0 {
+		o.maxTry = mp.MaxTry
+	}
+	o.conns = mp.conns
+	if mp.Timeout <= 0 {
+		return func() {}
+	}
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	o.ctx, cancel = context.WithTimeout(ctx, mp.Timeout)
+	return cancel
+}
+
+// codecConns holds the connections dialed with the ClientCodecFunc of a Policy, by network and address.
+type codecConns struct {
+	client    *Client
+	codecFunc ClientCodecFunc
+	targetTable
+}
+
+// invoker returns the connection with the codec to the server of selected, dialing it if there is none.
+func (c *codecConns) invoker(selected Invoker) (Invoker, error) {
+	var network string
+	switch inv := selected.(type) {
+	case *invoker:
+		network = inv.codec.network
+	case *pool:
+		network = inv.network
+	case *reconnector:
+		network = inv.network
+	default:
+		return selected, nil
+	}
+	target := network + "@" + selected.Address()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if invoker, ok := c.invokers[target]; ok && invoker.State() != Closed {
+		return invoker, nil
+	}
+	invoker, err := c.client.dial(network, selected.Address(), c.client.Timeout, c.codecFunc)
+	if err != nil {
+		return nil, err
+	}
+	if c.invokers == nil {
+		c.invokers = make(map[string]Invoker)
+	}
+	c.invokers[target] = invoker
+	return invoker, nil
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// Pool configures the pools of connections of a Client, one per server, see Client.Pool.
+// The calls are sent over the connection with the fewest calls in progress, and a connection is added
+// while they all have ConnCalls calls in progress at least, so that the calls of a busy caller
+// are not serialized on one connection. The broken connections are replaced.
+type Pool struct {
+	// MinConns is the number of connections kept open.
+	// If it is 0, 1 is used.
+	MinConns int
+	// MaxConns is the maximum number of connections.
+	// If it is less than MinConns, MinConns is used.
+	MaxConns int
+	// ConnCalls is the number of calls in progress on every connection that adds one.
+	// If it is 0, 16 is used.
+	ConnCalls int
+	// MaxIdleTime closes the connections beyond MinConns without calls for longer.
+	// If it is 0, 1 minute is used.
+	MaxIdleTime time.Duration
+	// CheckInterval is the interval of the health checks, which evict the broken and the idle connections,
+	// and dial those missing up to MinConns.
+	// If it is 0, 10s is used.
+	CheckInterval time.Duration
+}
+
+// pool is an Invoker sending the calls over several connections to the same server.
+type pool struct {
+	client    *Client
+	config    Pool
+	network   string
+	address   string
+	timeout   time.Duration // of the dials
+	codecFunc ClientCodecFunc
+
+	conns   []*poolConn
+	dialing bool
+	closed  bool
+	lastErr *common.RPCError
+	mu      sync.Mutex
+	stop    chan struct{}
+}
+
+// poolConn is a connection of a pool.
+type poolConn struct {
+	Invoker
+	used time.Time // last
+}
+
+var (
+	_ Invoker        = new(pool)
+	_ contextInvoker = new(pool)
+)
+
+// newPool returns the pool of connections to the server at address, dialing the first one at once.
+func (client *Client) newPool(network, address string, dialTimeout time.Duration, codecFunc ClientCodecFunc) (Invoker, error) {
+	invoker, err := client.dialConn(network, address, dialTimeout, codecFunc)
+	if err != nil {
+		return nil, err
+	}
+	p := &pool{
+		client:    client,
+		config:    *client.Pool,
+		network:   network,
+		address:   address,
+		timeout:   dialTimeout,
+		codecFunc: codecFunc,
+		conns:     []*poolConn{{Invoker: invoker, used: client.Clock.Now()}},
+		stop:      make(chan struct{}),
+	}
+	if p.config.MinConns <= 0 {
+		p.config.MinConns = 1
+	}
+	if p.config.MaxConns < p.config.MinConns {
+		p.config.MaxConns = p.config.MinConns
+	}
+	if p.config.ConnCalls <= 0 {
+		p.config.ConnCalls = 16
+	}
+	if p.config.MaxIdleTime <= 0 {
+		p.config.MaxIdleTime = time.Minute
+	}
+	if p.config.CheckInterval <= 0 {
+		p.config.CheckInterval = 10 * time.Second
+	}
+	p.mu.Lock()
+	p.grow()
+	p.mu.Unlock()
+	go p.check()
+	return p, nil
+}
+
+// Call invokes the named function over a connection of the pool, waits for it to complete, and returns its error status.
+func (p *pool) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	invoker, rpcErr := p.pick()
+	if rpcErr != nil {
+		return rpcErr
+	}
+	return invoker.Call(serviceMethod, args, reply)
+}
+
+// Go invokes the function asynchronously over a connection of the pool, see Invoker.
+func (p *pool) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	return p.goContext(nil, serviceMethod, args, reply, done)
+}
+
+// goContext is like Go, but the call is abandoned once ctx is done, see Client.GoContext.
+func (p *pool) goContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	invoker, rpcErr := p.pick()
+	if rpcErr != nil {
+		if done == nil {
+			done = make(chan *Call, 1)
+		}
+		call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done, Error: rpcErr}
+		call.done()
+		return call
+	}
+	if ctx != nil {
+		if invoker, ok := invoker.(contextInvoker); ok {
+			return invoker.goContext(ctx, serviceMethod, args, reply, done)
+		}
+	}
+	return invoker.Go(serviceMethod, args, reply, done)
+}
+
+// pick returns the open connection with the fewest calls in progress,
+// dialing one if there is none, and adding one in the background if they are all busy.
+func (p *pool) pick() (Invoker, *common.RPCError) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, common.RPCErrShutdown
+	}
+	p.prune()
+	var (
+		best  *poolConn
+		calls int
+	)
+	for _, c := range p.conns {
+		if n := pendingCalls(c.Invoker); best == nil || n < calls {
+			best, calls = c, n
+		}
+	}
+	if best == nil {
+		// the connections are broken, the call waits for a new one.
+		invoker, err := p.client.dialConn(p.network, p.address, p.timeout, p.codecFunc)
+		if err != nil {
+			return nil, &common.RPCError{
+				Type:  common.ErrorTypeClientConnect,
+				Error: err.Error(),
+			}
+		}
+		best = &poolConn{Invoker: invoker}
+		p.conns = append(p.conns, best)
+	} else if calls >= p.config.ConnCalls && len(p.conns) < p.config.MaxConns && !p.dialing {
+		p.dialing = true
+		go p.add()
+	}
+	best.used = p.client.Clock.Now()
+	return best.Invoker, nil
+}
+
+// prune closes and removes the broken connections, p.mu is held.
+func (p *pool) prune() {
+	conns := p.conns[:0]
+	for _, c := range p.conns {
+		if c.State() != Closed {
+			conns = append(conns, c)
+			continue
+		}
+		if err := c.LastError(); err != nil {
+			p.lastErr = err
+		}
+		c.Close()
+	}
+	for i := len(conns); i < len(p.conns); i++ {
+		p.conns[i] = nil
+	}
+	p.conns = conns
+}
+
+// grow dials the connections missing up to MinConns in the background, p.mu is held.
+func (p *pool) grow() {
+	if !p.closed && !p.dialing && len(p.conns) < p.config.MinConns {
+		p.dialing = true
+		go p.add()
+	}
+}
+
+// add dials a connection and adds it to the pool, then the others missing up to MinConns.
+func (p *pool) add() {
+	invoker, err := p.client.dialConn(p.network, p.address, p.timeout, p.codecFunc)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing = false
+	if err != nil {
+		log.Debugf("rpc: pool of %s: %s", p.address, err.Error())
+		return
+	}
+	if p.closed || len(p.conns) >= p.config.MaxConns {
+		invoker.Close()
+		return
+	}
+	p.conns = append(p.conns, &poolConn{Invoker: invoker, used: p.client.Clock.Now()})
+	p.grow()
+}
+
+// check evicts the broken and the idle connections, and dials those missing, every CheckInterval until Close.
+func (p *pool) check() {
+	for {
+		timer := p.client.Clock.NewTimer(p.config.CheckInterval)
+		select {
+		case <-p.stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		var evicted []Invoker
+		now := p.client.Clock.Now()
+		p.mu.Lock()
+		p.prune()
+		conns := p.conns
+		kept := make([]*poolConn, 0, len(conns))
+		for i, c := range conns {
+			// c is evicted if MinConns connections are kept without it.
+			if len(kept)+len(conns)-i > p.config.MinConns && pendingCalls(c.Invoker) == 0 &&
+				now.Sub(c.used) > p.config.MaxIdleTime {
+				evicted = append(evicted, c.Invoker)
+				continue
+			}
+			kept = append(kept, c)
+		}
+		p.conns = kept
+		p.grow()
+		p.mu.Unlock()
+		for _, invoker := range evicted {
+			invoker.Close()
+		}
+	}
+}
+
+// Close closes the connections of the pool.
+func (p *pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errors.New(common.RPCErrShutdown.Error)
+	}
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+	close(p.stop)
+	for _, c := range conns {
+		c.Close()
+	}
+	return nil
+}
+
+// State returns the best state of the connections, Closed once the pool is closed.
+func (p *pool) State() InvokerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return Closed
+	}
+	state := Closed
+	for _, c := range p.conns {
+		switch s := c.State(); {
+		case s == Ready:
+			return Ready
+		case s == Degraded || state == Closed:
+			state = s
+		}
+	}
+	if state == Closed {
+		// a connection is dialed by the next call.
+		return Degraded
+	}
+	return state
+}
+
+// LastError returns the last connection-level error of the connections, or nil.
+func (p *pool) LastError() *common.RPCError {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		if err := c.LastError(); err != nil {
+			return err
+		}
+	}
+	return p.lastErr
+}
+
+// Address returns the remote address of the connections.
+func (p *pool) Address() string {
+	return p.address
+}
+
+// pendingCalls returns the number of calls in progress on invoker, 0 if it is not known.
+func pendingCalls(conn Invoker) int {
+	if inv, ok := conn.(*invoker); ok {
+		inv.mutex.Lock()
+		defer inv.mutex.Unlock()
+		return len(inv.pending)
+	}
+	return 0
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// OverflowPolicy decides what to do with a new call when the request queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowFailFast fails the new call immediately.
+	OverflowFailFast OverflowPolicy = iota
+	// OverflowDropOldest fails the oldest queued call and queues the new one.
+	OverflowDropOldest
+)
+
+// queueRecheckInterval is the interval at which the oldest queued call selects an invoker again,
+// for the invokers becoming available unseen by the client, e.g. the servers added to the list of its selector.
+// The queued calls are woken at once, in turn, when the calls of the client complete.
+const queueRecheckInterval = time.Second
+
+// requestQueue tracks the calls waiting for an available invoker, the oldest first.
+type requestQueue struct {
+	waiters []*queueWaiter
+	mu      sync.Mutex
+}
+
+// queueWaiter is a call waiting in the request queue.
+type queueWaiter struct {
+	wake    chan struct{} // signaled once an invoker may be available for it
+	dropped chan struct{} // closed once it is dropped for a newer call, see OverflowDropOldest
+}
+
+// enqueue adds a waiter, it returns nil if the queue is full.
+func (q *requestQueue) enqueue(size int, policy OverflowPolicy) *queueWaiter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiters) >= size {
+		if policy != OverflowDropOldest {
+			return nil
+		}
+		close(q.waiters[0].dropped)
+		q.waiters = q.waiters[1:]
+	}
+	w := &queueWaiter{wake: make(chan struct{}, 1), dropped: make(chan struct{})}
+	q.waiters = append(q.waiters, w)
+	return w
+}
+
+// remove removes a waiter that is leaving the queue by itself.
+// If it was woken in vain, the next waiter is woken in its place.
+func (q *requestQueue) remove(w *queueWaiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, waiter := range q.waiters {
+		if waiter == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			break
+		}
+	}
+	select {
+	case <-w.wake:
+		q.wakeFirst()
+	default:
+	}
+}
+
+// notify wakes the oldest waiter, once an invoker may have become available.
+func (q *requestQueue) notify() {
+	q.mu.Lock()
+	q.wakeFirst()
+	q.mu.Unlock()
+}
+
+// wakeFirst wakes the oldest waiter, if any, q.mu is held.
+func (q *requestQueue) wakeFirst() {
+	if len(q.waiters) == 0 {
+		return
+	}
+	select {
+	case q.waiters[0].wake <- struct{}{}:
+	default:
+	}
+}
+
+// wakeAll wakes all the waiters, e.g. once the client is closed.
+func (q *requestQueue) wakeAll() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, w := range q.waiters {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// first reports whether w is the oldest waiter.
+func (q *requestQueue) first(w *queueWaiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters) > 0 && q.waiters[0] == w
+}
+
+// selectInvoker selects an invoker, if none is available and QueueSize > 0,
+// it waits in the request queue until an invoker becomes available or QueueTimeout expires.
+// No invoker is selected once the client is closed.
+func (client *Client) selectInvoker(options ...interface{}) (Invoker, error) {
+	if client.drain.isClosed() {
+		return nil, common.ErrClientClosed
+	}
+	return client.waitInvoker(false, options...)
+}
+
+// waitInvoker selects an invoker as selectInvoker, but if admitted, the call is already counted by Shutdown,
+// e.g. a call of Go, and an invoker is selected for it even once the client is closed.
+func (client *Client) waitInvoker(admitted bool, options ...interface{}) (Invoker, error) {
+	invoker, err := client.selector.Select(options...)
+	if err == nil || client.QueueSize <= 0 {
+		return invoker, err
+	}
+	w := client.queue.enqueue(client.QueueSize, client.QueueOverflow)
+	if w == nil {
+		return nil, common.ErrQueueFull
+	}
+	defer client.queue.remove(w)
+
+	timeout := client.QueueTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	deadline := client.Clock.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		recheck := client.Clock.NewTimer(queueRecheckInterval)
+		select {
+		case <-w.dropped:
+			recheck.Stop()
+			return nil, common.ErrQueueDropped
+		case <-deadline.C():
+			recheck.Stop()
+			return nil, common.ErrQueueTimeout.Format(err.Error())
+		case <-w.wake:
+			recheck.Stop()
+		case <-recheck.C():
+			if !client.queue.first(w) {
+				continue
+			}
+		}
+		if !admitted && client.drain.isClosed() {
+			return nil, common.ErrClientClosed
+		}
+		invoker, err = client.selector.Select(options...)
+		if err == nil {
+			// the next waiter tries too, more invokers may be available.
+			client.queue.remove(w)
+			client.queue.notify()
+			return invoker, nil
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+// blockInvoker signals the argument of each call on started, and replies it once the call is released.
+type blockInvoker struct {
+	testInvoker
+	started chan string
+	release chan struct{}
+}
+
+func (i *blockInvoker) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	i.started <- args.(string)
+	<-i.release
+	*reply.(*string) = args.(string)
+	return nil
+}
+
+// limitSelector selects its invoker for limit calls in progress at most.
+type limitSelector struct {
+	testSelector
+	limit int
+	calls int
+}
+
+func (s *limitSelector) Select(options ...interface{}) (Invoker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls >= s.limit {
+		return nil, errNoInvoker
+	}
+	s.calls++
+	return s.invoker, nil
+}
+
+func (s *limitSelector) HandleResult(Invoker, error, time.Duration) {
+	s.mu.Lock()
+	s.calls--
+	s.mu.Unlock()
+}
+
+// queued waits until n calls wait in the request queue of c.
+func queued(c *Client, n int) {
+	for {
+		c.queue.mu.Lock()
+		waiters := len(c.queue.waiters)
+		c.queue.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueueFIFO(t *testing.T) {
+	invoker := &blockInvoker{started: make(chan string, 4), release: make(chan struct{})}
+	s := &limitSelector{testSelector: testSelector{invoker: invoker}, limit: 1}
+	// the clock is not advanced: the queued calls are woken by the calls completing only.
+	c := NewClient(Client{Clock: sim.New(1), QueueSize: 3}, s)
+	results := make(chan *common.RPCError, 4)
+	call := func(arg string) {
+		var reply string
+		results <- c.Call("/test/echo", arg, &reply)
+	}
+
+	go call("a")
+	<-invoker.started
+	for n, arg := range []string{"b", "c", "d"} {
+		go call(arg)
+		queued(c, n+1)
+	}
+	for _, arg := range []string{"b", "c", "d"} {
+		invoker.release <- struct{}{}
+		if started := <-invoker.started; started != arg {
+			t.Fatalf("expect the queued calls to run in turn, %s started before %s", started, arg)
+		}
+	}
+	invoker.release <- struct{}{}
+	for n := 0; n < 4; n++ {
+		if rpcErr := <-results; rpcErr != nil {
+			t.Fatalf("expect the calls to be served, got %v", rpcErr)
+		}
+	}
+}
+
+// queueTimeout begins the message of common.ErrQueueTimeout.
+var queueTimeout = strings.TrimSuffix(common.ErrQueueTimeout.Error(), "%s")
+
+func TestQueueOverflow(t *testing.T) {
+	for _, test := range []struct {
+		policy OverflowPolicy
+		// first and second begin the errors of the first and of the second call queued, once the queue is full.
+		first, second string
+	}{
+		{OverflowFailFast, queueTimeout, common.ErrQueueFull.Error()},
+		{OverflowDropOldest, common.ErrQueueDropped.Error(), queueTimeout},
+	} {
+		clock := sim.New(1)
+		s := &limitSelector{testSelector: testSelector{invoker: new(testInvoker)}}
+		c := NewClient(Client{Clock: clock, MaxTry: 1, QueueSize: 1, QueueOverflow: test.policy, QueueTimeout: time.Second}, s)
+		first, second := make(chan *common.RPCError, 1), make(chan *common.RPCError, 1)
+		var reply string
+		go func() { first <- c.Call("/test/echo", "", &reply) }()
+		queued(c, 1)
+		go func() { second <- c.Call("/test/echo", "", &reply) }()
+
+		// one of the calls leaves the full queue at once, the other one times out.
+		timeout := time.After(time.Second)
+		for len(first)+len(second) == 0 {
+			select {
+			case <-timeout:
+				t.Fatalf("policy %d: expect a call to leave the full queue", test.policy)
+			case <-time.After(time.Millisecond):
+			}
+		}
+		queued(c, 1)
+		clock.WaitTimers(2)
+		clock.Advance(time.Second)
+		for _, result := range []struct {
+			rpcErr *common.RPCError
+			msg    string
+		}{{<-first, test.first}, {<-second, test.second}} {
+			if result.rpcErr == nil || !strings.HasPrefix(result.rpcErr.Error, result.msg) {
+				t.Fatalf("policy %d: expect %q, got %v", test.policy, result.msg, result.rpcErr)
+			}
+		}
+	}
+}
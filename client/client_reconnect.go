@@ -0,0 +1,360 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// Reconnect configures the reconnection of the connections of a Client, see Client.Reconnect.
+// Once a connection breaks, it is redialed in the background with a backoff doubling after each failure.
+// The calls pending on the broken connection fail with an error of type ErrorTypeClientConnectionLost,
+// but the idempotent ones, see Idempotent, which wait for the new connection and are sent again over it.
+// The other calls made meanwhile fail at once with an error of type ErrorTypeClientConnect,
+// so that Failover tries another server.
+// Reconnect is ignored with a Pool, which replaces the broken connections itself.
+type Reconnect struct {
+	// MinBackoff is the delay before the first redial.
+	// If it is 0, 100ms is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between two redials.
+	// If it is 0, 10s is used.
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of failed redials before giving up, the connection is Closed then.
+	// If it is 0, the connection is redialed until Close.
+	MaxAttempts int
+	// MaxResends is the maximum number of times an idempotent call is sent again.
+	// If it is 0, 3 is used.
+	MaxResends int
+}
+
+// reconnector is an Invoker redialing its connection once it breaks.
+type reconnector struct {
+	client    *Client
+	config    Reconnect
+	network   string
+	address   string
+	timeout   time.Duration // of the dials
+	codecFunc ClientCodecFunc
+
+	conn      *invoker      // nil while redialing, or once given up
+	redialing chan struct{} // closed once the connection is redialed or given up, nil unless it is redialed
+	closed    bool
+	lastErr   *common.RPCError
+	mu        sync.Mutex
+	stop      chan struct{}
+}
+
+// resendInvoker is implemented by the invokers that can send a call again over a new connection, see Idempotent.
+type resendInvoker interface {
+	goResend(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call
+}
+
+var (
+	_ Invoker        = new(reconnector)
+	_ contextInvoker = new(reconnector)
+	_ resendInvoker  = new(reconnector)
+)
+
+// Idempotent marks the call as safe to execute more than once: if its connection breaks while it is pending,
+// it is sent again once the connection is redialed instead of failing, see Client.Reconnect.
+func Idempotent() CallOption {
+	return func(o *callOptions) {
+		o.idempotent = true
+	}
+}
+
+// newReconnector returns the connection to the server at address, redialed once it breaks.
+func (client *Client) newReconnector(network, address string, dialTimeout time.Duration, codecFunc ClientCodecFunc) (Invoker, error) {
+	conn, err := client.dialConn(network, address, dialTimeout, codecFunc)
+	if err != nil {
+		return nil, err
+	}
+	r := &reconnector{
+		client:    client,
+		config:    *client.Reconnect,
+		network:   network,
+		address:   address,
+		timeout:   dialTimeout,
+		codecFunc: codecFunc,
+		conn:      conn.(*invoker),
+		stop:      make(chan struct{}),
+	}
+	if r.config.MinBackoff <= 0 {
+		r.config.MinBackoff = 100 * time.Millisecond
+	}
+	if r.config.MaxBackoff <= 0 {
+		r.config.MaxBackoff = 10 * time.Second
+	}
+	if r.config.MaxBackoff < r.config.MinBackoff {
+		r.config.MaxBackoff = r.config.MinBackoff
+	}
+	if r.config.MaxResends <= 0 {
+		r.config.MaxResends = 3
+	}
+	go r.watch(r.conn)
+	return r, nil
+}
+
+// watch redials the connection each time it breaks, until Close or MaxAttempts failed redials.
+func (r *reconnector) watch(conn *invoker) {
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-conn.exited:
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return
+		}
+		r.broken(conn)
+		redialing := r.redialing
+		r.mu.Unlock()
+
+		conn = r.redial()
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		r.conn = conn
+		r.redialing = nil
+		close(redialing)
+		r.mu.Unlock()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+// broken marks conn, the reader of which has exited, as broken and being redialed, r.mu is held.
+// It is called by watch, or before by a call, since the calls pending on conn fail before watch runs.
+func (r *reconnector) broken(conn *invoker) {
+	if r.conn != conn {
+		return
+	}
+	r.conn = nil
+	r.lastErr = conn.LastError()
+	r.redialing = make(chan struct{})
+}
+
+// redial dials the connection again with backoff, and returns it,
+// or nil after MaxAttempts failed dials or once the reconnector is closed.
+func (r *reconnector) redial() *invoker {
+	var delay time.Duration
+	for attempt := 1; r.config.MaxAttempts <= 0 || attempt <= r.config.MaxAttempts; attempt++ {
+		delay = r.backoff(delay)
+		timer := r.client.Clock.NewTimer(delay)
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+		conn, err := r.client.dialConn(r.network, r.address, r.timeout, r.codecFunc)
+		if err == nil {
+			return conn.(*invoker)
+		}
+		log.Debugf("rpc: redialing %s: %s", r.address, err.Error())
+		r.mu.Lock()
+		r.lastErr = &common.RPCError{
+			Type:  common.ErrorTypeClientConnect,
+			Error: err.Error(),
+		}
+		r.mu.Unlock()
+	}
+	log.Warnf("rpc: giving up redialing %s", r.address)
+	return nil
+}
+
+// backoff returns the delay before the next redial, given the previous delay:
+// it doubles up to MaxBackoff, and a quarter of it is random so that the clients of a server do not redial together.
+func (r *reconnector) backoff(previous time.Duration) time.Duration {
+	delay := 2 * previous
+	if delay < r.config.MinBackoff {
+		delay = r.config.MinBackoff
+	}
+	if delay > r.config.MaxBackoff {
+		delay = r.config.MaxBackoff
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/4)+1))
+}
+
+// current returns the connection, or the error of the calls if it is broken.
+func (r *reconnector) current() (*invoker, *common.RPCError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.closed:
+		return nil, common.RPCErrShutdown
+	case r.conn != nil:
+		select {
+		case <-r.conn.exited:
+			r.broken(r.conn)
+		default:
+			return r.conn, nil
+		}
+	}
+	return nil, r.brokenError()
+}
+
+// await is like current, but waits for the connection while it is redialed, or until ctx is done if it is not nil.
+func (r *reconnector) await(ctx context.Context) (*invoker, *common.RPCError) {
+	var ctxDone <-chan struct{}
+	if ctx != nil {
+		ctxDone = ctx.Done()
+	}
+	for {
+		conn, rpcErr := r.current()
+		r.mu.Lock()
+		redialing := r.redialing
+		r.mu.Unlock()
+		if conn != nil || redialing == nil || rpcErr.Type == common.ErrorTypeClientShutdown {
+			return conn, rpcErr
+		}
+		select {
+		case <-redialing:
+		case <-r.stop:
+		case <-ctxDone:
+			return nil, canceledError(ctx.Err())
+		}
+	}
+}
+
+// brokenError is the error of the calls made while the connection is broken, r.mu is held.
+func (r *reconnector) brokenError() *common.RPCError {
+	cause := r.lastErr
+	if cause == nil {
+		cause = common.RPCErrShutdown
+	}
+	return &common.RPCError{
+		Type:   common.ErrorTypeClientConnect,
+		Error:  "rpc: the connection to " + r.address + " is broken: " + cause.Error,
+		Causes: []error{cause.Err()},
+	}
+}
+
+// Call invokes the named function, waits for it to complete, and returns its error status.
+func (r *reconnector) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	conn, rpcErr := r.current()
+	if rpcErr != nil {
+		return rpcErr
+	}
+	return conn.Call(serviceMethod, args, reply)
+}
+
+// Go invokes the function asynchronously, see Invoker.
+func (r *reconnector) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	return r.goContext(nil, serviceMethod, args, reply, done)
+}
+
+// goContext is like Go, but the call is abandoned once ctx is done, see Client.GoContext.
+func (r *reconnector) goContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	conn, rpcErr := r.current()
+	if rpcErr != nil {
+		if done == nil {
+			done = make(chan *Call, 1)
+		}
+		call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done, Error: rpcErr}
+		call.done()
+		return call
+	}
+	if ctx != nil {
+		return conn.goContext(ctx, serviceMethod, args, reply, done)
+	}
+	return conn.Go(serviceMethod, args, reply, done)
+}
+
+// goResend is like goContext, but the call waits for the connection while it is redialed,
+// and is sent again over the new one if its connection breaks, up to MaxResends times.
+func (r *reconnector) goResend(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 10) // buffered.
+	} else if cap(done) == 0 {
+		log.Panic("rpc: done channel is unbuffered")
+	}
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done, Idempotent: true}
+	go func() {
+		for resends := 0; ; resends++ {
+			conn, rpcErr := r.await(ctx)
+			if rpcErr != nil {
+				call.Error = rpcErr
+				break
+			}
+			sent := make(chan *Call, 1)
+			if ctx != nil {
+				conn.goContext(ctx, serviceMethod, args, reply, sent)
+			} else {
+				conn.Go(serviceMethod, args, reply, sent)
+			}
+			result := <-sent
+			call.Error, call.Trailer = result.Error, result.Trailer
+			if call.Error == nil || call.Error.Type != common.ErrorTypeClientConnectionLost || resends >= r.config.MaxResends {
+				break
+			}
+			log.Debugf("rpc: sending %s again to %s: %s", serviceMethod, r.address, call.Error.Error)
+		}
+		call.done()
+	}()
+	return call
+}
+
+// Close closes the connection, and stops redialing it.
+func (r *reconnector) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return errors.New(common.RPCErrShutdown.Error)
+	}
+	r.closed = true
+	conn := r.conn
+	r.conn = nil
+	r.mu.Unlock()
+	close(r.stop)
+	if conn != nil {
+		conn.Close()
+	}
+	return nil
+}
+
+// State returns the state of the connection, Connecting while it is redialed.
+func (r *reconnector) State() InvokerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.closed:
+		return Closed
+	case r.conn != nil:
+		return r.conn.State()
+	case r.redialing != nil:
+		return Connecting
+	}
+	return Closed
+}
+
+// LastError returns the last connection-level error, or nil.
+func (r *reconnector) LastError() *common.RPCError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn != nil {
+		if err := r.conn.LastError(); err != nil {
+			return err
+		}
+	}
+	return r.lastErr
+}
+
+// Address returns the remote address of the connection.
+func (r *reconnector) Address() string {
+	return r.address
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// drainState tracks the outstanding calls of a Client, so that Shutdown waits for them.
+type drainState struct {
+	calls  int
+	closed bool
+	idle   chan struct{} // closed once the client is closed and no call is outstanding
+	mu     sync.Mutex
+}
+
+// begin counts a new call, it returns false if the client is closed.
+func (d *drainState) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.calls++
+	return true
+}
+
+// end counts a complete call.
+func (d *drainState) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls--
+	if d.closed && d.calls == 0 {
+		close(d.idle)
+	}
+}
+
+// isClosed reports whether the client is closed.
+func (d *drainState) isClosed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed
+}
+
+// close refuses the new calls, and returns a channel closed once no call is outstanding.
+func (d *drainState) close() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		d.idle = make(chan struct{})
+		if d.calls == 0 {
+			close(d.idle)
+		}
+	}
+	return d.idle
+}
+
+// closedError is the error of the calls made once the client is closed.
+func closedError() *common.RPCError {
+	return &common.RPCError{
+		Type:   common.ErrorTypeClientShutdown,
+		Error:  common.ErrClientClosed.Error(),
+		Causes: []error{common.ErrClientClosed},
+	}
+}
+
+// Shutdown closes the client gracefully: no server is selected any more and the new calls fail
+// with common.ErrClientClosed, the outstanding calls, those of Go included, are waited for until ctx is done,
+// and then the connections are closed.
+// It returns ctx.Err() if calls were still outstanding when ctx was done, they are aborted.
+// Unlike Shutdown, Close aborts the outstanding calls at once.
+func (client *Client) Shutdown(ctx context.Context) error {
+	idle := client.drain.close()
+	// the calls waiting in the request queue leave it, but those counted before.
+	client.queue.wakeAll()
+	var err error
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	client.closeInvokers()
+	return err
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+// testInvoker replies its address to every call.
+type testInvoker struct {
+	address string
+}
+
+func (i *testInvoker) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	*reply.(*string) = i.address
+	return nil
+}
+
+func (i *testInvoker) Go(serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+	call.Error = i.Call(serviceMethod, args, reply)
+	call.done()
+	return call
+}
+
+func (i *testInvoker) Close() error                { return nil }
+func (i *testInvoker) State() InvokerState         { return Ready }
+func (i *testInvoker) LastError() *common.RPCError { return nil }
+func (i *testInvoker) Address() string             { return i.address }
+
+var errNoInvoker = errors.New("no invoker available")
+
+// testSelector selects its invoker once its first fails selections have failed,
+// and signals each selection on selects, if it is not nil.
+type testSelector struct {
+	invoker Invoker
+	fails   int
+	selects chan struct{}
+	mu      sync.Mutex
+}
+
+func (s *testSelector) SetSelectMode(SelectMode)                   {}
+func (s *testSelector) SetNewInvokerFunc(NewInvokerFunc)           {}
+func (s *testSelector) List() []Invoker                            { return []Invoker{s.invoker} }
+func (s *testSelector) HandleFailed(Invoker)                       {}
+func (s *testSelector) HandleResult(Invoker, error, time.Duration) {}
+
+func (s *testSelector) Select(options ...interface{}) (Invoker, error) {
+	if s.selects != nil {
+		s.selects <- struct{}{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return nil, errNoInvoker
+	}
+	return s.invoker, nil
+}
+
+func TestShutdownAdmittedCall(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		clock := sim.New(1)
+		s := &testSelector{invoker: &testInvoker{address: "a"}, fails: 1, selects: make(chan struct{}, 2)}
+		c := NewClient(Client{Clock: clock, QueueSize: 1}, s)
+		result := make(chan *common.RPCError, 1)
+		var reply string
+		if async {
+			call := c.Go("/test/echo", "", &reply, nil)
+			go func() { result <- (<-call.Done).Error }()
+		} else {
+			go func() { result <- c.Call("/test/echo", "", &reply) }()
+		}
+
+		// the call is counted, but no invoker is selected for it yet: it waits in the request queue.
+		<-s.selects
+		clock.WaitTimers(2)
+		shutdown := make(chan error, 1)
+		go func() { shutdown <- c.Shutdown(context.Background()) }()
+		// Shutdown wakes the queue: the call counted before it selects its invoker all the same.
+		if rpcErr := <-result; rpcErr != nil || reply != "a" {
+			t.Fatalf("async %v: expect the call counted before Shutdown to run, got %q, %v", async, reply, rpcErr)
+		}
+		if err := <-shutdown; err != nil {
+			t.Fatalf("async %v: unexpected Shutdown error %v", async, err)
+		}
+		if rpcErr := c.Call("/test/echo", "", &reply); rpcErr == nil || !errors.Is(rpcErr.Err(), common.ErrClientClosed) {
+			t.Fatalf("async %v: expect the calls after Shutdown to fail with ErrClientClosed, got %v", async, rpcErr)
+		}
+	}
+}
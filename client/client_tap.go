@@ -0,0 +1,51 @@
+package client
+
+import (
+	"math/rand"
+	"net"
+)
+
+// Tap receives copies of the bytes exchanged with the servers,
+// e.g. for wire-level debugging without external packet capture.
+// The methods are called synchronously on the connection, so they should be fast,
+// and must not retain b after returning.
+type Tap interface {
+	// TapWrite receives a copy of the bytes written to the server at address.
+	TapWrite(address string, b []byte)
+	// TapRead receives a copy of the bytes read from the server at address.
+	TapRead(address string, b []byte)
+}
+
+// tapConn is a net.Conn that copies the bytes to a Tap.
+type tapConn struct {
+	net.Conn
+	tap     Tap
+	address string
+}
+
+func (c *tapConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.tap.TapRead(c.address, b[:n])
+	}
+	return n, err
+}
+
+func (c *tapConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.tap.TapWrite(c.address, b[:n])
+	}
+	return n, err
+}
+
+// tapConn wraps conn with the client's Tap if the connection is sampled.
+func (client *Client) tapConn(conn net.Conn, address string) net.Conn {
+	if client.Tap == nil {
+		return conn
+	}
+	if client.TapSampleRate > 0 && rand.Float64() >= client.TapSampleRate {
+		return conn
+	}
+	return &tapConn{Conn: conn, tap: client.Tap, address: address}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/memnet"
+)
+
+// recordTap records the bytes tapped.
+type recordTap struct {
+	address       string
+	written, read bytes.Buffer
+	mu            sync.Mutex
+}
+
+func (r *recordTap) TapWrite(address string, b []byte) {
+	r.mu.Lock()
+	r.address = address
+	r.written.Write(b)
+	r.mu.Unlock()
+}
+
+func (r *recordTap) TapRead(address string, b []byte) {
+	r.mu.Lock()
+	r.read.Write(b)
+	r.mu.Unlock()
+}
+
+func TestTap(t *testing.T) {
+	address := t.Name()
+	lis, err := memnet.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	for _, test := range []struct {
+		rate   float64
+		tapped bool
+	}{
+		{0, true}, // all the connections
+		{1, true},
+		{1e-12, false},
+	} {
+		closed := make(chan struct{})
+		go echoConn(t, lis, closed)
+		tap := new(recordTap)
+		c := NewClient(Client{Tap: tap, TapSampleRate: test.rate}, new(testSelector))
+		invoker, err := c.dialConn(memnet.Network, address, 0, codecGob.NewGobClientCodec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply string
+		if rpcErr := invoker.Call("/test/echo", "tapped", &reply); rpcErr != nil {
+			t.Fatal(rpcErr)
+		}
+		invoker.Close()
+		close(closed)
+
+		tap.mu.Lock()
+		// gob writes the strings as they are.
+		written := bytes.Contains(tap.written.Bytes(), []byte("/test/echo")) && bytes.Contains(tap.written.Bytes(), []byte("tapped"))
+		read := bytes.Contains(tap.read.Bytes(), []byte("tapped"))
+		if test.tapped && (!written || !read || tap.address != address) || !test.tapped && tap.written.Len()+tap.read.Len() > 0 {
+			t.Errorf("rate %g: expect the connection tapped %v, got %d bytes written and %d read of %q",
+				test.rate, test.tapped, tap.written.Len(), tap.read.Len(), tap.address)
+		}
+		tap.mu.Unlock()
+	}
+}
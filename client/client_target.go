@@ -0,0 +1,115 @@
+package client
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// targetTable holds the invokers dialed for the WithTarget calls, by network and address.
+type targetTable struct {
+	invokers map[string]Invoker
+	mu       sync.Mutex
+}
+
+// WithTarget sends the call to the server at address, bypassing the selector for this call only,
+// e.g. for debugging, cache affinity or follow-up calls that must hit the same node.
+// address is "host:port" for TCP, or "network@address" for any other network, e.g. "kcp@10.0.0.5:8972".
+// The connection of the selector to address is used if there is one, else a connection is dialed and kept until Close.
+// The call is not retried on another server.
+func WithTarget(address string) CallOption {
+	return func(o *callOptions) {
+		o.target = address
+	}
+}
+
+// WithInvoker sends the call through invoker, bypassing the selector for this call only.
+func WithInvoker(invoker Invoker) CallOption {
+	return func(o *callOptions) {
+		o.invoker = invoker
+	}
+}
+
+// splitTarget splits the network from the address of WithTarget.
+func splitTarget(target string) (network, address string) {
+	if i := strings.Index(target, "@"); i >= 0 {
+		return target[:i], target[i+1:]
+	}
+	return "tcp", target
+}
+
+// callTarget calls serviceMethod on the invoker set by WithInvoker or WithTarget.
+func (client *Client) callTarget(serviceMethod string, args interface{}, reply interface{}, o *callOptions) *common.RPCError {
+	if o.invoker != nil {
+		return client.invoke(o.invoker, serviceMethod, args, reply, o)
+	}
+	invoker, dialed, err := client.targetInvoker(o.target)
+	if err != nil {
+		return &common.RPCError{
+			Type:  common.ErrorTypeClientConnect,
+			Error: err.Error(),
+		}
+	}
+	var rpcErr *common.RPCError
+	if dialed {
+		rpcErr = client.invoke(invoker, serviceMethod, args, reply, o)
+	} else {
+		rpcErr = client.invokeSelected(invoker, serviceMethod, args, reply, o)
+	}
+	if rpcErr != nil && rpcErr.Type < 0 && rpcErr.Type != common.ErrorTypeClientCircuitOpen {
+		if dialed {
+			client.targets.drop(o.target, invoker)
+		} else {
+			client.selector.HandleFailed(invoker)
+		}
+	}
+	return rpcErr
+}
+
+// targetInvoker returns the connection of the selector to target, else the one dialed for it.
+// dialed reports whether the invoker is not the one of the selector.
+func (client *Client) targetInvoker(target string) (invoker Invoker, dialed bool, err error) {
+	network, address := splitTarget(target)
+	for _, invoker := range client.selector.List() {
+		if invoker.Address() == address && invoker.State() != Closed {
+			return invoker, false, nil
+		}
+	}
+
+	t := client.targets
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if invoker, ok := t.invokers[target]; ok && invoker.State() != Closed {
+		return invoker, true, nil
+	}
+	invoker, err = client.newInvoker(network, address, client.Timeout)
+	if err != nil {
+		return nil, true, err
+	}
+	if t.invokers == nil {
+		t.invokers = make(map[string]Invoker)
+	}
+	t.invokers[target] = invoker
+	return invoker, true, nil
+}
+
+// drop closes invoker and forgets it, if it is still the one of target.
+func (t *targetTable) drop(target string, invoker Invoker) {
+	t.mu.Lock()
+	if t.invokers[target] == invoker {
+		delete(t.invokers, target)
+	}
+	t.mu.Unlock()
+	invoker.Close()
+}
+
+// close closes all the invokers dialed for targets.
+func (t *targetTable) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for target, invoker := range t.invokers {
+		invoker.Close()
+		delete(t.invokers, target)
+	}
+}
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"net"
 	"net/rpc"
+	"strconv"
 	"time"
 
 	"github.com/henrylee2cn/myrpc/common"
@@ -10,9 +12,37 @@ import (
 type clientCodecWrapper struct {
 	pluginContainer IClientPluginContainer
 	codecConn       ClientCodecConn
+	network         string
+	codecFunc       ClientCodecFunc
 	timeout         time.Duration
 	readTimeout     time.Duration
 	writeTimeout    time.Duration
+	maxResponseSize int64
+	limit           *common.LimitedConn // of the reads, if maxResponseSize is not 0
+}
+
+// limitConn returns conn whose reads are limited to maxResponseSize for each response, if it is not 0.
+func (w *clientCodecWrapper) limitConn(conn net.Conn) net.Conn {
+	if w.maxResponseSize <= 0 {
+		return conn
+	}
+	w.limit = common.NewLimitedConn(conn)
+	return w.limit
+}
+
+// readError returns the error of type errorType reading a response, or of type ErrorTypeClientMessageTooLarge
+// if the response exceeds maxResponseSize.
+func (w *clientCodecWrapper) readError(errorType common.ErrorType, err error) *common.RPCError {
+	if w.limit != nil && w.limit.Exceeded() {
+		return &common.RPCError{
+			Type:  common.ErrorTypeClientMessageTooLarge,
+			Error: common.ErrMessageTooLarge.Format(strconv.FormatInt(w.maxResponseSize, 10)).Error(),
+		}
+	}
+	return &common.RPCError{
+		Type:  errorType,
+		Error: err.Error(),
+	}
 }
 
 func (w *clientCodecWrapper) WriteRequest(r *rpc.Request, body interface{}) *common.RPCError {
@@ -23,8 +53,16 @@ func (w *clientCodecWrapper) WriteRequest(r *rpc.Request, body interface{}) *com
 		w.codecConn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
 	}
 
+	body, err := w.pluginContainer.doRewriteRequest(r, body)
+	if err != nil {
+		return &common.RPCError{
+			Type:  common.ErrorTypeClientPreWriteRequest,
+			Error: err.Error(),
+		}
+	}
+
 	//pre
-	err := w.pluginContainer.doPreWriteRequest(r, body)
+	err = w.pluginContainer.doPreWriteRequest(r, body)
 	if err != nil {
 		return &common.RPCError{
 			Type:  common.ErrorTypeClientPreWriteRequest,
@@ -68,12 +106,12 @@ func (w *clientCodecWrapper) ReadResponseHeader(r *rpc.Response) *common.RPCErro
 		}
 	}
 
+	if w.limit != nil {
+		w.limit.Limit(w.maxResponseSize)
+	}
 	err = w.codecConn.ReadResponseHeader(r)
 	if err != nil {
-		return &common.RPCError{
-			Type:  common.ErrorTypeClientReadResponseHeader,
-			Error: err.Error(),
-		}
+		return w.readError(common.ErrorTypeClientReadResponseHeader, err)
 	}
 
 	//post
@@ -99,10 +137,7 @@ func (w *clientCodecWrapper) ReadResponseBody(body interface{}) *common.RPCError
 
 	err = w.codecConn.ReadResponseBody(body)
 	if err != nil {
-		return &common.RPCError{
-			Type:  common.ErrorTypeClientReadResponseBody,
-			Error: err.Error(),
-		}
+		return w.readError(common.ErrorTypeClientReadResponseBody, err)
 	}
 
 	//post
@@ -116,6 +151,7 @@ func (w *clientCodecWrapper) ReadResponseBody(body interface{}) *common.RPCError
 	return nil
 }
 
+// Close closes the codec and then the connection, once, see clientCodecConn.Close.
 func (w *clientCodecWrapper) Close() error {
 	return w.codecConn.Close()
 }
@@ -0,0 +1,65 @@
+package record
+
+import (
+	"crypto/aes"
+	"errors"
+	"sync"
+)
+
+// ErrUnknownKey is returned when a file is encrypted with a key missing from the Keyring.
+var ErrUnknownKey = errors.New("record: unknown key")
+
+// Keyring holds the AES keys of the recording files by ID.
+// Recording uses the current key, reading uses the key a file was written with,
+// so old files stay readable as long as their keys are kept.
+type Keyring struct {
+	keys    map[string][]byte
+	current string
+	mu      sync.RWMutex
+}
+
+// NewKeyring creates an empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// Add adds a key of 16, 24 or 32 bytes, for AES-128, AES-192 or AES-256.
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" {
+		return errors.New("record: empty key id")
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// Rotate adds the key and makes it the current one,
+// the Recorders using the Keyring start new files with it.
+func (k *Keyring) Rotate(id string, key []byte) error {
+	if err := k.Add(id, key); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.current = id
+	k.mu.Unlock()
+	return nil
+}
+
+// Current returns the current key and its ID, or an empty ID if there is none.
+func (k *Keyring) Current() (string, []byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current, k.keys[k.current]
+}
+
+// Get returns the key of id.
+func (k *Keyring) Get(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
@@ -0,0 +1,254 @@
+// Package record records the traffic of clients to files through client.Tap,
+// optionally encrypted at rest with AES-GCM, since captured payloads may contain personal data.
+//
+// Each connection direction is recorded to its own file, readable by myrpc-dump.
+// An encrypted file starts with a header naming its key:
+//
+//	"MRPE" | version byte | key id length byte | key id
+//
+// followed by chunks, one per captured write or read:
+//
+//	length uint32 | nonce [12]byte | AES-GCM sealed bytes, with the chunk index as additional data
+package record
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+const (
+	magic   = "MRPE"
+	version = 1
+)
+
+// Recorder is a client.Tap writing the requests and the responses of each server to files in a directory.
+type Recorder struct {
+	dir   string
+	keys  *Keyring
+	files map[string]*recordFile
+	mu    sync.Mutex
+}
+
+var _ client.Tap = new(Recorder)
+
+// recordFile is an open recording file.
+type recordFile struct {
+	f     *os.File
+	keyID string
+	aead  cipher.AEAD
+	seq   uint64
+}
+
+// NewRecorder creates a Recorder writing to dir.
+// The files are encrypted with the current key of keys, or not encrypted if keys is nil.
+func NewRecorder(dir string, keys *Keyring) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		dir:   dir,
+		keys:  keys,
+		files: make(map[string]*recordFile),
+	}, nil
+}
+
+// TapWrite records the bytes written to the server at address.
+func (r *Recorder) TapWrite(address string, b []byte) {
+	r.record(address, "requests", b)
+}
+
+// TapRead records the bytes read from the server at address.
+func (r *Recorder) TapRead(address string, b []byte) {
+	r.record(address, "responses", b)
+}
+
+// Close closes the files.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for name, rf := range r.files {
+		if e := rf.f.Close(); e != nil {
+			err = e
+		}
+		delete(r.files, name)
+	}
+	return err
+}
+
+func (r *Recorder) record(address, direction string, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := sanitize(address) + "." + direction
+	rf := r.files[name]
+	if rf != nil && r.keys != nil {
+		if id, _ := r.keys.Current(); id != rf.keyID {
+			// the key was rotated.
+			rf.f.Close()
+			rf = nil
+		}
+	}
+	if rf == nil {
+		var err error
+		if rf, err = r.create(name); err != nil {
+			log.Debugf("rpc: record: %s", err.Error())
+			delete(r.files, name)
+			return
+		}
+		r.files[name] = rf
+	}
+	if err := rf.write(b); err != nil {
+		log.Debugf("rpc: record: %s", err.Error())
+	}
+}
+
+// create creates a recording file named after name, the current key and the time.
+func (r *Recorder) create(name string) (*recordFile, error) {
+	rf := new(recordFile)
+	var key []byte
+	if r.keys != nil {
+		rf.keyID, key = r.keys.Current()
+		if rf.keyID == "" {
+			return nil, fmt.Errorf("no current key to record %s", name)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if rf.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		name += "." + sanitize(rf.keyID)
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("%s.%d.rec", name, time.Now().UnixNano()))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	rf.f = f
+	if rf.aead != nil {
+		header := append([]byte(magic), version, byte(len(rf.keyID)))
+		header = append(header, rf.keyID...)
+		if _, err = f.Write(header); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return rf, nil
+}
+
+func (rf *recordFile) write(b []byte) error {
+	if rf.aead == nil {
+		_, err := rf.f.Write(b)
+		return err
+	}
+	chunk := make([]byte, 4+rf.aead.NonceSize(), 4+rf.aead.NonceSize()+len(b)+rf.aead.Overhead())
+	nonce := chunk[4:]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	chunk = rf.aead.Seal(chunk, nonce, b, chunkAD(rf.seq))
+	binary.BigEndian.PutUint32(chunk, uint32(len(chunk)-4))
+	rf.seq++
+	_, err := rf.f.Write(chunk)
+	return err
+}
+
+// NewReader returns a reader of the bytes recorded in r, decrypted with keys if the recording is encrypted.
+func NewReader(r io.Reader, keys *Keyring) (io.Reader, error) {
+	header := make([]byte, len(magic)+2)
+	n, err := io.ReadFull(r, header)
+	if err != nil || string(header[:len(magic)]) != magic {
+		// not encrypted.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return io.MultiReader(strings.NewReader(string(header[:n])), r), err
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("record: unsupported version %d", header[len(magic)])
+	}
+	keyID := make([]byte, header[len(magic)+1])
+	if _, err = io.ReadFull(r, keyID); err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("record: the recording is encrypted with key %q", keyID)
+	}
+	key, ok := keys.Get(string(keyID))
+	if !ok {
+		return nil, fmt.Errorf("%s %q", ErrUnknownKey.Error(), keyID)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead}, nil
+}
+
+// decryptReader decrypts the chunks of an encrypted recording.
+type decryptReader struct {
+	r    io.Reader
+	aead cipher.AEAD
+	seq  uint64
+	buf  []byte
+}
+
+func (d *decryptReader) Read(b []byte) (int, error) {
+	for len(d.buf) == 0 {
+		var size [4]byte
+		if _, err := io.ReadFull(d.r, size[:]); err != nil {
+			return 0, err
+		}
+		chunk := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(d.r, chunk); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		ns := d.aead.NonceSize()
+		if len(chunk) < ns {
+			return 0, io.ErrUnexpectedEOF
+		}
+		plain, err := d.aead.Open(nil, chunk[:ns], chunk[ns:], chunkAD(d.seq))
+		if err != nil {
+			return 0, fmt.Errorf("record: chunk %d: %s", d.seq, err.Error())
+		}
+		d.seq++
+		d.buf = plain
+	}
+	n := copy(b, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// chunkAD binds a chunk to its position, so chunks can not be reordered unnoticed.
+func chunkAD(seq uint64) []byte {
+	var ad [8]byte
+	binary.BigEndian.PutUint64(ad[:], seq)
+	return ad[:]
+}
+
+// sanitize makes s usable in a file name.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '.' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
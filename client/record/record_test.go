@@ -0,0 +1,97 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readRecording(t *testing.T, path string, keys *Keyring) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f, keys)
+	if err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+func TestEncryptedRecording(t *testing.T) {
+	dir := t.TempDir()
+	keys := NewKeyring()
+	if err := keys.Rotate("k1", bytes.Repeat([]byte{1}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := NewRecorder(dir, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.TapWrite("127.0.0.1:8080", []byte("secret "))
+	rec.TapWrite("127.0.0.1:8080", []byte("request"))
+	rec.TapRead("127.0.0.1:8080", []byte("response"))
+	if err = keys.Rotate("k2", bytes.Repeat([]byte{2}, 16)); err != nil {
+		t.Fatal(err)
+	}
+	rec.TapWrite("127.0.0.1:8080", []byte("after rotation"))
+	rec.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.rec"))
+	if len(files) != 3 {
+		t.Fatalf("expect 3 files, got %v", files)
+	}
+	expect := map[string]string{
+		"requests.k1":  "secret request",
+		"responses.k1": "response",
+		"requests.k2":  "after rotation",
+	}
+	for _, file := range files {
+		raw, _ := os.ReadFile(file)
+		if bytes.Contains(raw, []byte("secret")) || bytes.Contains(raw, []byte("rotation")) {
+			t.Fatalf("%s is not encrypted", file)
+		}
+		got, err := readRecording(t, file, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		for name, want := range expect {
+			if strings.Contains(file, name) {
+				found = true
+				if got != want {
+					t.Errorf("%s: expect %q, got %q", file, want, got)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("unexpected file %s", file)
+		}
+		if _, err = readRecording(t, file, NewKeyring()); err == nil {
+			t.Errorf("%s: expect an error without its key", file)
+		}
+	}
+}
+
+func TestPlainRecording(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.TapWrite("localhost:1", []byte("plain"))
+	rec.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.rec"))
+	if len(files) != 1 {
+		t.Fatalf("expect 1 file, got %v", files)
+	}
+	got, err := readRecording(t, files[0], nil)
+	if err != nil || got != "plain" {
+		t.Fatalf("expect plain, got %q, %v", got, err)
+	}
+}
@@ -16,6 +16,19 @@ type Selector interface {
 	List() []Invoker
 	//HandleFailed handle failed Invoker
 	HandleFailed(Invoker)
+	// HandleResult is called with the outcome of every call on an invoker it selected or listed,
+	// its error or nil and its latency, e.g. for health scoring, outlier ejection or adaptive balancing.
+	// Each try of a retried call is reported apart, before HandleFailed for a failure.
+	// For the invokers not of this package, an asynchronous call is complete once it is sent.
+	HandleResult(invoker Invoker, err error, latency time.Duration)
+}
+
+// FeedbackSelector is a Selector counting the calls in progress on its invokers, e.g. to prefer the less loaded servers.
+// Each call started is reported once complete to HandleResult.
+type FeedbackSelector interface {
+	Selector
+	// CallStarted is called when a call starts on invoker.
+	CallStarted(invoker Invoker)
 }
 
 // NewInvokerFunc the function to create a new Invoker.
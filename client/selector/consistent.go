@@ -0,0 +1,149 @@
+package selector
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+)
+
+// KeyFunc returns the key of a call of serviceMethod with args, e.g. the user ID of args.
+type KeyFunc func(serviceMethod string, args interface{}) string
+
+// ConsistentHashSelector sends the calls of the same key to the same server, e.g. for the affinity of a cache
+// or the shards of a service. The servers are placed on a hash ring in proportion to their weight,
+// so that only the keys of the servers that come or go move to other servers.
+// The keys of an unreachable server move to the next servers on the ring until it is reachable again.
+type ConsistentHashSelector struct {
+	// Servers are the servers, read by the first selection, see SetServers to change them.
+	Servers []Server
+	// KeyFunc returns the key of a call.
+	// If it is nil, the service method is the key.
+	KeyFunc KeyFunc
+	// Replicas is the number of the points of a server of weight 1 on the ring.
+	// If it is 0, 160 is used.
+	Replicas    int
+	DialTimeout time.Duration
+
+	servers weightedServers
+	ring    []ringPoint // sorted by hash
+	inited  bool
+	mu      sync.Mutex
+}
+
+// ringPoint is a point of a server on the hash ring.
+type ringPoint struct {
+	hash uint64
+	addr string
+}
+
+var _ client.Selector = new(ConsistentHashSelector)
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *ConsistentHashSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.mu.Lock()
+	s.servers.newInvokerFunc = newInvokerFunc
+	s.mu.Unlock()
+}
+
+// SetSelectMode is meaningless for ConsistentHashSelector because the key of a call selects the server.
+func (s *ConsistentHashSelector) SetSelectMode(_ client.SelectMode) {}
+
+// Select returns a rpc invoker of the server of the key of the call of the service method options[0] with args options[1],
+// or of the empty key without options.
+func (s *ConsistentHashSelector) Select(options ...interface{}) (client.Invoker, error) {
+	var key string
+	if len(options) > 0 {
+		serviceMethod, _ := options[0].(string)
+		var args interface{}
+		if len(options) > 1 {
+			args = options[1]
+		}
+		key = serviceMethod
+		if s.KeyFunc != nil {
+			key = s.KeyFunc(serviceMethod, args)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.inited {
+		s.reset(s.Servers)
+	}
+	n := len(s.ring)
+	h := hashKey(key)
+	first := sort.Search(n, func(i int) bool { return s.ring[i].hash >= h })
+	unreachable := make(map[string]bool)
+	for i := 0; i < n && len(unreachable) < len(s.servers.servers); i++ {
+		addr := s.ring[(first+i)%n].addr
+		if unreachable[addr] {
+			continue
+		}
+		if invoker := s.servers.invoker(addr); invoker != nil {
+			return invoker, nil
+		}
+		unreachable[addr] = true
+	}
+	return nil, ErrNoReachableServer
+}
+
+// SetServers replaces the servers.
+func (s *ConsistentHashSelector) SetServers(servers []Server) {
+	s.mu.Lock()
+	s.reset(servers)
+	s.mu.Unlock()
+}
+
+// List returns Invokers to all servers
+func (s *ConsistentHashSelector) List() []client.Invoker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers.list()
+}
+
+// HandleFailed handle failed Invoker
+func (s *ConsistentHashSelector) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	s.mu.Lock()
+	s.servers.remove(invoker)
+	s.mu.Unlock()
+}
+
+// HandleResult does nothing, the key of a call selects the server.
+func (s *ConsistentHashSelector) HandleResult(client.Invoker, error, time.Duration) {}
+
+// Close closes the invokers.
+func (s *ConsistentHashSelector) Close() error {
+	s.mu.Lock()
+	s.servers.close()
+	s.mu.Unlock()
+	return nil
+}
+
+// reset places the servers on the ring, s.mu is held.
+func (s *ConsistentHashSelector) reset(servers []Server) {
+	s.servers.dialTimeout = s.DialTimeout
+	s.servers.reset(servers)
+	replicas := s.Replicas
+	if replicas <= 0 {
+		replicas = 160
+	}
+	s.ring = s.ring[:0]
+	for _, server := range s.servers.servers {
+		for i := 0; i < replicas*server.weight; i++ {
+			s.ring = append(s.ring, ringPoint{hash: hashKey(server.addr + "#" + strconv.Itoa(i)), addr: server.addr})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	s.inited = true
+}
+
+// hashKey hashes with MD5 as ketama does, the hashes of similar keys are spread evenly on the ring.
+func hashKey(key string) uint64 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -49,3 +49,6 @@ func (s *DirectSelector) HandleFailed(invoker client.Invoker) {
 	invoker.Close()
 	s.invoker = nil // reset
 }
+
+// HandleResult is meaningless for DirectSelector because there is only one server.
+func (s *DirectSelector) HandleResult(client.Invoker, error, time.Duration) {}
@@ -0,0 +1,262 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// DNSSelector selects the servers a DNS name resolves to, e.g. a Kubernetes headless service or a Consul DNS name,
+// without the SDK of a registry. The name is resolved again periodically.
+//
+// Without Port, the SRV records of the name are looked up, and their priority and weight are honored:
+// the servers of the lowest priority are used while any of them is reachable,
+// and they are selected in proportion to their weight, unless with RoundRobin.
+// The records of weight 0 are only selected when all the records of their priority have weight 0.
+// With Port, the A and AAAA records of the name are looked up, and all the servers are equal.
+type DNSSelector struct {
+	// Network is the network of the servers.
+	// If it is empty, "tcp" is used.
+	Network string
+	// Name is the DNS name, e.g. "arith.default.svc.cluster.local".
+	Name string
+	// Service and Proto are the service and the protocol of the SRV records, as in net.LookupSRV,
+	// e.g. "rpc" and "tcp" look up "_rpc._tcp."+Name. If they are empty, the SRV records of Name are looked up.
+	Service string
+	Proto   string
+	// Port is the port of the servers. If it is not 0, Name is resolved to its A and AAAA records instead of SRV.
+	Port        int
+	DialTimeout time.Duration
+	// RefreshInterval is how long the servers are used before the name is resolved again.
+	// If it is 0, 30s is used.
+	RefreshInterval time.Duration
+	// Resolver resolves the name, net.DefaultResolver if nil.
+	Resolver *net.Resolver
+
+	newInvokerFunc client.NewInvokerFunc
+	selectMode     client.SelectMode
+	records        []*dnsRecord // sorted by priority
+	invokers       map[string]client.Invoker
+	failed         map[string]bool // addresses skipped until the name is resolved again
+	resolved       time.Time
+	refreshing     bool
+	mu             sync.Mutex
+}
+
+// dnsRecord is a server the name resolves to.
+type dnsRecord struct {
+	weightedAddr
+	priority uint16
+}
+
+var _ client.Selector = new(DNSSelector)
+
+// ErrNoAddress is returned when the name resolves to no reachable server.
+var ErrNoAddress = errors.New("rpc: the name resolves to no reachable address")
+
+// lookupTimeout is the timeout of resolving the name.
+const lookupTimeout = 10 * time.Second
+
+//SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *DNSSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.newInvokerFunc = newInvokerFunc
+}
+
+//SetSelectMode sets the algorithm of selecting a server among the ones of the lowest priority:
+// RoundRobin selects them in turn, WeightedRoundRobin in turn by weight, else they are selected randomly by weight.
+func (s *DNSSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.mu.Lock()
+	s.selectMode = selectMode
+	s.mu.Unlock()
+}
+
+//Select returns a rpc invoker of a reachable server of the lowest priority.
+func (s *DNSSelector) Select(options ...interface{}) (client.Invoker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(s.records); {
+		j := i
+		var candidates []*weightedAddr
+		for ; j < len(s.records) && s.records[j].priority == s.records[i].priority; j++ {
+			if !s.failed[s.records[j].addr] {
+				candidates = append(candidates, &s.records[j].weightedAddr)
+			}
+		}
+		for len(candidates) > 0 {
+			k := pickWeighted(candidates, s.selectMode)
+			if invoker := s.invoker(candidates[k].addr); invoker != nil {
+				return invoker, nil
+			}
+			candidates = append(candidates[:k], candidates[k+1:]...)
+		}
+		i = j
+	}
+	return nil, ErrNoAddress
+}
+
+//List returns Invokers to all servers
+func (s *DNSSelector) List() []client.Invoker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invokers := make([]client.Invoker, 0, len(s.invokers))
+	for _, invoker := range s.invokers {
+		if invoker.State() != client.Closed {
+			invokers = append(invokers, invoker)
+		}
+	}
+	return invokers
+}
+
+//HandleFailed handle failed Invoker, its server is skipped until the name is resolved again.
+func (s *DNSSelector) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == nil {
+		s.failed = make(map[string]bool)
+	}
+	for addr, i := range s.invokers {
+		if i == invoker {
+			delete(s.invokers, addr)
+			s.failed[addr] = true
+		}
+	}
+}
+
+// HandleResult does nothing, the results of the calls do not change the selection.
+func (s *DNSSelector) HandleResult(client.Invoker, error, time.Duration) {}
+
+// Close closes the invokers.
+func (s *DNSSelector) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr, invoker := range s.invokers {
+		invoker.Close()
+		delete(s.invokers, addr)
+	}
+	return nil
+}
+
+// invoker returns the invoker of addr, dialing it if needed, or nil if it is unreachable.
+func (s *DNSSelector) invoker(addr string) client.Invoker {
+	if invoker := s.invokers[addr]; invoker != nil && invoker.State() != client.Closed {
+		return invoker
+	}
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	invoker, err := s.newInvokerFunc(network, addr, s.DialTimeout)
+	if err != nil {
+		s.failed[addr] = true
+		return nil
+	}
+	s.invokers[addr] = invoker
+	return invoker
+}
+
+// refresh resolves the name the first time, and then in the background every RefreshInterval.
+func (s *DNSSelector) refresh() error {
+	if s.resolved.IsZero() {
+		records, err := s.resolve()
+		if err != nil {
+			return err
+		}
+		s.update(records)
+		return nil
+	}
+	interval := s.RefreshInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if s.refreshing || time.Since(s.resolved) < interval {
+		return nil
+	}
+	s.refreshing = true
+	go func() {
+		records, err := s.resolve()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.refreshing = false
+		if err != nil {
+			// keep the servers resolved before, until the next try.
+			log.Warnf("rpc: resolve %s: %s", s.Name, err.Error())
+			s.resolved = time.Now()
+			return
+		}
+		s.update(records)
+	}()
+	return nil
+}
+
+// resolve looks up the servers of the name.
+func (s *DNSSelector) resolve() ([]*dnsRecord, error) {
+	resolver := s.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	var records []*dnsRecord
+	if s.Port != 0 {
+		ips, err := resolver.LookupIPAddr(ctx, s.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			records = append(records, &dnsRecord{weightedAddr: weightedAddr{addr: net.JoinHostPort(ip.String(), strconv.Itoa(s.Port))}})
+		}
+		return records, nil
+	}
+	_, srvs, err := resolver.LookupSRV(ctx, s.Service, s.Proto, s.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, srv := range srvs {
+		records = append(records, &dnsRecord{
+			weightedAddr: weightedAddr{
+				addr:   net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))),
+				weight: int(srv.Weight),
+			},
+			priority: srv.Priority,
+		})
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].priority < records[j].priority
+	})
+	return records, nil
+}
+
+// update replaces the servers, and closes the invokers of the ones that are gone.
+func (s *DNSSelector) update(records []*dnsRecord) {
+	if s.invokers == nil {
+		s.invokers = make(map[string]client.Invoker)
+	}
+	s.records = records
+	s.failed = make(map[string]bool)
+	s.resolved = time.Now()
+	for addr, invoker := range s.invokers {
+		found := false
+		for _, r := range records {
+			if r.addr == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			invoker.Close()
+			delete(s.invokers, addr)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package selector
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// FileSelector selects the servers listed in a JSON or YAML file, e.g. written by a configuration management tool,
+// for the deployments without service discovery. The file is read again when it changes, and on SIGHUP.
+// If it cannot be read again, e.g. while it is written, the servers read before are kept.
+//
+// The file lists the addresses of the servers, "network@address" with tcp by default, and their weight, 1 by default:
+//
+//	{"servers": [{"address": "tcp@10.0.0.1:8972", "weight": 3}, {"address": "10.0.0.2:8972"}]}
+//
+// or in YAML, if its extension is .yaml or .yml:
+//
+//	servers:
+//	- address: tcp@10.0.0.1:8972
+//	  weight: 3
+//	- address: 10.0.0.2:8972
+//
+// RoundRobin selects the servers in turn, WeightedRoundRobin in turn by weight, else they are selected randomly by weight.
+type FileSelector struct {
+	// Path is the path of the file.
+	Path        string
+	DialTimeout time.Duration
+	// IgnoreSIGHUP does not read the file again on SIGHUP, which then keeps its default effect on the process.
+	IgnoreSIGHUP bool
+
+	servers weightedServers
+	started bool
+	watcher *fsnotify.Watcher
+	signals chan os.Signal
+	stop    chan struct{}
+	mu      sync.Mutex
+}
+
+// serverFile is the content of the file of a FileSelector.
+type serverFile struct {
+	Servers []Server `json:"servers" yaml:"servers"`
+}
+
+var _ client.Selector = new(FileSelector)
+
+// ErrNoServerListed is returned when no server listed in the file is reachable.
+var ErrNoServerListed = errors.New("rpc: no reachable server listed in the file")
+
+// reloadDelay gathers the changes of the file written in several steps.
+const reloadDelay = 100 * time.Millisecond
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *FileSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.mu.Lock()
+	s.servers.newInvokerFunc = newInvokerFunc
+	s.mu.Unlock()
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RandomSelect, RoundRobin or WeightedRoundRobin.
+func (s *FileSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.mu.Lock()
+	s.servers.selectMode = selectMode
+	s.mu.Unlock()
+}
+
+// Select returns a rpc invoker of a reachable server listed in the file.
+func (s *FileSelector) Select(options ...interface{}) (client.Invoker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	if invoker := s.servers.pick(); invoker != nil {
+		return invoker, nil
+	}
+	return nil, ErrNoServerListed
+}
+
+// List returns Invokers to all servers
+func (s *FileSelector) List() []client.Invoker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers.list()
+}
+
+// HandleFailed handle failed Invoker
+func (s *FileSelector) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	s.mu.Lock()
+	s.servers.remove(invoker)
+	s.mu.Unlock()
+}
+
+// HandleResult does nothing, the results of the calls do not change the selection.
+func (s *FileSelector) HandleResult(client.Invoker, error, time.Duration) {}
+
+// Close stops watching the file, and closes the invokers.
+func (s *FileSelector) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		close(s.stop)
+		if s.watcher != nil {
+			s.watcher.Close()
+			s.watcher = nil
+		}
+		if s.signals != nil {
+			signal.Stop(s.signals)
+			s.signals = nil
+		}
+		s.started = false
+	}
+	s.servers.close()
+	return nil
+}
+
+// start reads the file and starts watching it, unless it is done, s.mu is held.
+func (s *FileSelector) start() error {
+	if s.started {
+		return nil
+	}
+	if err := s.reload(); err != nil {
+		return err
+	}
+	s.started = true
+	s.stop = make(chan struct{})
+	// the directory is watched, since the tools often replace the file rather than write it.
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(s.Path)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Warnf("rpc: watch %s: %s, it is only read again on SIGHUP", s.Path, err.Error())
+		watcher = nil
+	}
+	s.watcher = watcher
+	if !s.IgnoreSIGHUP {
+		s.signals = make(chan os.Signal, 1)
+		signal.Notify(s.signals, syscall.SIGHUP)
+	}
+	go s.watch(watcher, s.signals, s.stop)
+	return nil
+}
+
+// watch reads the file again when it changes or on SIGHUP, until stop is closed.
+func (s *FileSelector) watch(watcher *fsnotify.Watcher, signals chan os.Signal, stop chan struct{}) {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watcher != nil {
+		events, errs = watcher.Events, watcher.Errors
+	}
+	name := filepath.Base(s.Path)
+	var changed <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			// a Kubernetes ConfigMap changes by its "..data" symbolic link.
+			if base := filepath.Base(ev.Name); base == name || strings.HasPrefix(base, "..") {
+				changed = time.After(reloadDelay)
+			}
+			continue
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+			} else {
+				log.Warnf("rpc: watch %s: %s", s.Path, err.Error())
+			}
+			continue
+		case <-signals:
+		case <-changed:
+			changed = nil
+		}
+		s.mu.Lock()
+		select {
+		case <-stop:
+		default:
+			if err := s.reload(); err != nil {
+				log.Warnf("rpc: %s, the servers are kept", err.Error())
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// reload reads the file, and closes the invokers of the servers no longer listed, s.mu is held.
+func (s *FileSelector) reload() error {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	var f serverFile
+	switch strings.ToLower(filepath.Ext(s.Path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &f)
+	default:
+		err = json.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return errors.New(s.Path + ": " + err.Error())
+	}
+	for _, server := range f.Servers {
+		if server.Address == "" {
+			return errors.New(s.Path + ": a server has no address")
+		}
+	}
+	s.servers.dialTimeout = s.DialTimeout
+	s.servers.reset(f.Servers)
+	log.Infof("rpc: read %d servers from %s", len(f.Servers), s.Path)
+	return nil
+}
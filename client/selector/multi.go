@@ -0,0 +1,86 @@
+package selector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+)
+
+// MultiSelector selects one of a static list of servers, e.g. the replicas of a service without a registry.
+// RoundRobin selects them in turn, WeightedRoundRobin in turn by weight, else they are selected randomly by weight.
+// An unreachable server is skipped, and dialed again by the next selections.
+type MultiSelector struct {
+	// Servers are the servers, read by the first selection.
+	Servers     []Server
+	DialTimeout time.Duration
+
+	servers weightedServers
+	inited  bool
+	mu      sync.Mutex
+}
+
+var _ client.Selector = new(MultiSelector)
+
+// ErrNoReachableServer is returned when none of the servers is reachable.
+var ErrNoReachableServer = errors.New("rpc: no reachable server")
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *MultiSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.mu.Lock()
+	s.servers.newInvokerFunc = newInvokerFunc
+	s.mu.Unlock()
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RandomSelect, RoundRobin or WeightedRoundRobin.
+func (s *MultiSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.mu.Lock()
+	s.servers.selectMode = selectMode
+	s.mu.Unlock()
+}
+
+// Select returns a rpc invoker of a reachable server.
+func (s *MultiSelector) Select(options ...interface{}) (client.Invoker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lazyInit()
+	if invoker := s.servers.pick(); invoker != nil {
+		return invoker, nil
+	}
+	return nil, ErrNoReachableServer
+}
+
+// List returns Invokers to all servers
+func (s *MultiSelector) List() []client.Invoker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers.list()
+}
+
+// HandleFailed handle failed Invoker
+func (s *MultiSelector) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	s.mu.Lock()
+	s.servers.remove(invoker)
+	s.mu.Unlock()
+}
+
+// HandleResult does nothing, the results of the calls do not change the selection.
+func (s *MultiSelector) HandleResult(client.Invoker, error, time.Duration) {}
+
+// Close closes the invokers.
+func (s *MultiSelector) Close() error {
+	s.mu.Lock()
+	s.servers.close()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MultiSelector) lazyInit() {
+	if !s.inited {
+		s.servers.dialTimeout = s.DialTimeout
+		s.servers.reset(s.Servers)
+		s.inited = true
+	}
+}
@@ -0,0 +1,179 @@
+package selector
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// P2CSelector balances the calls by the load of the servers, with the power of two choices:
+// it draws two servers at random, and selects the one whose latency, an exponentially weighted
+// moving average of the latency of its calls, times its calls in progress plus one, is the lowest.
+// A slower latency is taken into account at once, a faster one progressively, so that a server
+// slowing down is relieved at once, and the latency of a server left aside fades, so that it is tried again.
+// The client reports the calls, see client.FeedbackSelector.
+type P2CSelector struct {
+	// Servers are the servers, read by the first selection, their weight is not used.
+	Servers     []Server
+	DialTimeout time.Duration
+	// Decay is how long the average takes to forget most of a latency, the larger the smoother,
+	// and how long a server left aside takes to be tried again.
+	// If it is 0, 10s is used.
+	Decay time.Duration
+
+	servers weightedServers
+	loads   map[string]*serverLoad // address -> load
+	inited  bool
+	mu      sync.Mutex
+}
+
+// serverLoad is the load of a server.
+type serverLoad struct {
+	latency  float64   // the moving average, in nanoseconds
+	updated  time.Time // zero until a call is complete
+	inflight int
+}
+
+// defaultLatency is the latency of a server called but not measured yet.
+const defaultLatency = 30 * time.Millisecond
+
+var _ client.FeedbackSelector = new(P2CSelector)
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *P2CSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.mu.Lock()
+	s.servers.newInvokerFunc = newInvokerFunc
+	s.mu.Unlock()
+}
+
+// SetSelectMode is meaningless for P2CSelector because the load of the servers selects them.
+func (s *P2CSelector) SetSelectMode(_ client.SelectMode) {}
+
+// Select returns a rpc invoker of the less loaded of two reachable servers drawn at random.
+func (s *P2CSelector) Select(options ...interface{}) (client.Invoker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.inited {
+		s.reset(s.Servers)
+	}
+	candidates := append([]*weightedAddr(nil), s.servers.servers...)
+	for len(candidates) > 0 {
+		k := 0
+		if n := len(candidates); n > 1 {
+			i, j := rand.Intn(n), rand.Intn(n-1)
+			if j >= i {
+				j++
+			}
+			k = i
+			if now := time.Now(); s.cost(candidates[j].addr, now) < s.cost(candidates[i].addr, now) {
+				k = j
+			}
+		}
+		if invoker := s.servers.invoker(candidates[k].addr); invoker != nil {
+			return invoker, nil
+		}
+		candidates = append(candidates[:k], candidates[k+1:]...)
+	}
+	return nil, ErrNoReachableServer
+}
+
+// CallStarted counts the call in progress on invoker.
+func (s *P2CSelector) CallStarted(invoker client.Invoker) {
+	s.mu.Lock()
+	if load := s.loads[invoker.Address()]; load != nil {
+		load.inflight++
+	}
+	s.mu.Unlock()
+}
+
+// HandleResult averages the latency of the call on invoker, unless it was canceled by the caller.
+func (s *P2CSelector) HandleResult(invoker client.Invoker, err error, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	load := s.loads[invoker.Address()]
+	if load == nil {
+		return
+	}
+	if load.inflight > 0 {
+		load.inflight--
+	}
+	if rpcErr, ok := common.AsRPCError(err); ok && rpcErr.Type == common.ErrorTypeClientCanceled {
+		return
+	}
+	now := time.Now()
+	if l := float64(latency); load.updated.IsZero() || l > load.latency {
+		load.latency = l
+	} else {
+		w := s.decayed(load, now)
+		load.latency = load.latency*w + l*(1-w)
+	}
+	load.updated = now
+}
+
+// List returns Invokers to all servers
+func (s *P2CSelector) List() []client.Invoker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.servers.list()
+}
+
+// HandleFailed handle failed Invoker
+func (s *P2CSelector) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	s.mu.Lock()
+	s.servers.remove(invoker)
+	s.mu.Unlock()
+}
+
+// Close closes the invokers.
+func (s *P2CSelector) Close() error {
+	s.mu.Lock()
+	s.servers.close()
+	s.mu.Unlock()
+	return nil
+}
+
+// reset replaces the servers, s.mu is held.
+func (s *P2CSelector) reset(servers []Server) {
+	s.servers.dialTimeout = s.DialTimeout
+	s.servers.reset(servers)
+	loads := make(map[string]*serverLoad, len(s.servers.servers))
+	for _, server := range s.servers.servers {
+		// the invokers know their address without the network.
+		addr := server.addr[strings.IndexByte(server.addr, '@')+1:]
+		if load := s.loads[addr]; load != nil {
+			loads[addr] = load
+		} else {
+			loads[addr] = new(serverLoad)
+		}
+	}
+	s.loads = loads
+	s.inited = true
+}
+
+// cost returns the load of the server addr, s.mu is held.
+func (s *P2CSelector) cost(addr string, now time.Time) float64 {
+	load := s.loads[addr[strings.IndexByte(addr, '@')+1:]]
+	if !load.updated.IsZero() {
+		return load.latency * s.decayed(load, now) * float64(load.inflight+1)
+	}
+	// a server not measured yet is tried first, once.
+	if load.inflight == 0 {
+		return 0
+	}
+	return float64(defaultLatency) * float64(load.inflight+1)
+}
+
+// decayed returns the share of the latency of load still remembered at now.
+func (s *P2CSelector) decayed(load *serverLoad, now time.Time) float64 {
+	decay := s.Decay
+	if decay <= 0 {
+		decay = 10 * time.Second
+	}
+	return math.Exp(-float64(now.Sub(load.updated)) / float64(decay))
+}
@@ -0,0 +1,155 @@
+package selector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// TieredSelector sends all traffic to the Primary addresses.
+// Only when every primary address is unhealthy does it fail over to the Secondary addresses,
+// and it falls back to the primary tier automatically once a primary address recovers.
+type TieredSelector struct {
+	Network     string
+	Primary     []string
+	Secondary   []string
+	DialTimeout time.Duration
+	// RetryInterval is how long an unhealthy address is skipped before it is tried again.
+	// If it is 0, 10s is used.
+	RetryInterval time.Duration
+	// Clock is the source of the time of RetryInterval, e.g. the virtual clock of a test, see sim.Sim.
+	// If it is nil, common.SystemClock is used.
+	Clock          common.Clock
+	newInvokerFunc client.NewInvokerFunc
+	invokers       map[string]client.Invoker
+	unhealthy      map[string]time.Time
+	next           int
+	mu             sync.Mutex
+}
+
+var _ client.Selector = new(TieredSelector)
+
+// ErrNoHealthyAddress is returned when neither tier has a reachable address.
+var ErrNoHealthyAddress = errors.New("rpc: no healthy address in any tier")
+
+//SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *TieredSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.newInvokerFunc = newInvokerFunc
+}
+
+//SetSelectMode is meaningless for TieredSelector because addresses are used in turn.
+func (s *TieredSelector) SetSelectMode(_ client.SelectMode) {}
+
+//Select returns a rpc invoker from the primary tier, or from the secondary tier if all primaries are unhealthy.
+func (s *TieredSelector) Select(options ...interface{}) (client.Invoker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lazyInit()
+	if invoker := s.selectFrom(s.Primary); invoker != nil {
+		return invoker, nil
+	}
+	if invoker := s.selectFrom(s.Secondary); invoker != nil {
+		return invoker, nil
+	}
+	return nil, ErrNoHealthyAddress
+}
+
+//List returns Invokers of the currently active tier.
+func (s *TieredSelector) List() []client.Invoker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lazyInit()
+	if invokers := s.listFrom(s.Primary); len(invokers) > 0 {
+		return invokers
+	}
+	return s.listFrom(s.Secondary)
+}
+
+//HandleFailed handle failed Invoker and marks its address unhealthy.
+func (s *TieredSelector) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lazyInit()
+	addr := invoker.Address()
+	if s.invokers[addr] == invoker {
+		delete(s.invokers, addr)
+	}
+	s.unhealthy[addr] = s.now()
+}
+
+// HandleResult does nothing, the failures passed to HandleFailed mark the servers unhealthy.
+func (s *TieredSelector) HandleResult(client.Invoker, error, time.Duration) {}
+
+func (s *TieredSelector) lazyInit() {
+	if s.invokers == nil {
+		s.invokers = make(map[string]client.Invoker)
+		s.unhealthy = make(map[string]time.Time)
+	}
+}
+
+func (s *TieredSelector) retryInterval() time.Duration {
+	if s.RetryInterval > 0 {
+		return s.RetryInterval
+	}
+	return 10 * time.Second
+}
+
+func (s *TieredSelector) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock.Now()
+	}
+	return common.SystemClock.Now()
+}
+
+// healthy reports whether the address may be used.
+func (s *TieredSelector) healthy(addr string) bool {
+	t, ok := s.unhealthy[addr]
+	if !ok {
+		return true
+	}
+	if s.now().Sub(t) < s.retryInterval() {
+		return false
+	}
+	delete(s.unhealthy, addr)
+	return true
+}
+
+func (s *TieredSelector) selectFrom(addrs []string) client.Invoker {
+	n := len(addrs)
+	for i := 0; i < n; i++ {
+		addr := addrs[(s.next+i)%n]
+		if !s.healthy(addr) {
+			continue
+		}
+		invoker := s.invokers[addr]
+		if invoker == nil || invoker.State() == client.Closed {
+			var err error
+			invoker, err = s.newInvokerFunc(s.Network, addr, s.DialTimeout)
+			if err != nil {
+				s.unhealthy[addr] = s.now()
+				continue
+			}
+			s.invokers[addr] = invoker
+		}
+		s.next = (s.next + i + 1) % n
+		return invoker
+	}
+	return nil
+}
+
+func (s *TieredSelector) listFrom(addrs []string) []client.Invoker {
+	var invokers []client.Invoker
+	for _, addr := range addrs {
+		if !s.healthy(addr) {
+			continue
+		}
+		if invoker := s.invokers[addr]; invoker != nil && invoker.State() != client.Closed {
+			invokers = append(invokers, invoker)
+		}
+	}
+	return invokers
+}
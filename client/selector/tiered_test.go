@@ -0,0 +1,91 @@
+package selector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+// testInvoker is an invoker of address, without connection.
+type testInvoker struct {
+	address string
+	closed  bool
+}
+
+func (i *testInvoker) Call(string, interface{}, interface{}) *common.RPCError { return nil }
+func (i *testInvoker) Go(string, interface{}, interface{}, chan *client.Call) *client.Call {
+	return nil
+}
+func (i *testInvoker) Close() error                { i.closed = true; return nil }
+func (i *testInvoker) LastError() *common.RPCError { return nil }
+func (i *testInvoker) Address() string             { return i.address }
+
+func (i *testInvoker) State() client.InvokerState {
+	if i.closed {
+		return client.Closed
+	}
+	return client.Ready
+}
+
+// testNetwork dials the invokers of the addresses not down.
+type testNetwork map[string]bool
+
+func (down testNetwork) newInvoker(network, address string, dialTimeout time.Duration) (client.Invoker, error) {
+	if down[address] {
+		return nil, errors.New("connection refused")
+	}
+	return &testInvoker{address: address}, nil
+}
+
+func TestTieredSelector(t *testing.T) {
+	clock := sim.New(1)
+	down := testNetwork{}
+	s := &TieredSelector{
+		Primary:       []string{"primary"},
+		Secondary:     []string{"secondary"},
+		RetryInterval: time.Minute,
+		Clock:         clock,
+	}
+	s.SetNewInvokerFunc(down.newInvoker)
+
+	for _, test := range []struct {
+		name    string
+		advance time.Duration
+		down    []string
+		failed  bool // the invoker selected by the previous step fails
+		expect  string
+	}{
+		{name: "primary", expect: "primary"},
+		{name: "failover", failed: true, expect: "secondary"},
+		{name: "within the retry interval", advance: time.Minute - time.Second, expect: "secondary"},
+		{name: "fallback", advance: time.Second, expect: "primary"},
+		{name: "primary unreachable", failed: true, advance: time.Minute, down: []string{"primary"}, expect: "secondary"},
+		{name: "both unreachable", failed: true, down: []string{"primary", "secondary"}},
+	} {
+		if test.failed {
+			invoker, _ := s.Select()
+			s.HandleFailed(invoker)
+		}
+		clock.Advance(test.advance)
+		for _, address := range test.down {
+			down[address] = true
+		}
+		invoker, err := s.Select()
+		if test.expect == "" {
+			if err != ErrNoHealthyAddress {
+				t.Fatalf("%s: expect ErrNoHealthyAddress, got %v", test.name, err)
+			}
+			continue
+		}
+		if err != nil || invoker.Address() != test.expect {
+			t.Fatalf("%s: expect %s, got %v, %v", test.name, test.expect, invoker, err)
+		}
+		if list := s.List(); len(list) != 1 || list[0].Address() != test.expect {
+			t.Fatalf("%s: expect the tier of %s listed, got %v", test.name, test.expect, list)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package selector
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+)
+
+// Server is a server of a MultiSelector, or listed in the file of a FileSelector.
+type Server struct {
+	// Address is the address of the server as "network@address", the network is tcp by default.
+	Address string `json:"address" yaml:"address"`
+	// Weight is the share of the calls the server receives in proportion to the others.
+	// If it is 0, 1 is used.
+	Weight int `json:"weight" yaml:"weight"`
+}
+
+// weightedAddr is a server selected by weight.
+type weightedAddr struct {
+	addr    string
+	weight  int
+	current int // of the smooth weighted round robin
+}
+
+// pickWeighted returns the index of the candidate selected with selectMode:
+// RoundRobin selects them in turn, WeightedRoundRobin in turn by weight, else they are selected randomly by weight.
+// The candidates of weight 0 are only selected when all the candidates have weight 0.
+func pickWeighted(candidates []*weightedAddr, selectMode client.SelectMode) int {
+	total := 0
+	if selectMode != client.RoundRobin {
+		for _, r := range candidates {
+			total += r.weight
+		}
+	}
+	// without weights, all the candidates are equal.
+	uniform := total == 0
+	if uniform {
+		total = len(candidates)
+	}
+	weight := func(r *weightedAddr) int {
+		if uniform {
+			return 1
+		}
+		return r.weight
+	}
+	if selectMode == client.RoundRobin || selectMode == client.WeightedRoundRobin {
+		// the smooth weighted round robin of nginx.
+		best := 0
+		for i, r := range candidates {
+			r.current += weight(r)
+			if r.current > candidates[best].current {
+				best = i
+			}
+		}
+		candidates[best].current -= total
+		return best
+	}
+	n := rand.Intn(total)
+	for i, r := range candidates {
+		if n -= weight(r); n < 0 {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+// weightedServers is a static list of servers selected by weight, and the invokers to them.
+// The selectors using it hold their lock while calling its methods.
+type weightedServers struct {
+	newInvokerFunc client.NewInvokerFunc
+	selectMode     client.SelectMode
+	dialTimeout    time.Duration
+	servers        []*weightedAddr
+	invokers       map[string]client.Invoker
+}
+
+// reset replaces the servers, and closes the invokers of the servers no longer listed.
+func (w *weightedServers) reset(servers []Server) {
+	w.servers = make([]*weightedAddr, 0, len(servers))
+	listed := make(map[string]bool)
+	for _, server := range servers {
+		addr := server.Address
+		if !strings.Contains(addr, "@") {
+			addr = "tcp@" + addr
+		}
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		w.servers = append(w.servers, &weightedAddr{addr: addr, weight: weight})
+		listed[addr] = true
+	}
+	for addr, invoker := range w.invokers {
+		if !listed[addr] {
+			invoker.Close()
+			delete(w.invokers, addr)
+		}
+	}
+}
+
+// pick returns an invoker of a reachable server, or nil if none is.
+func (w *weightedServers) pick() client.Invoker {
+	candidates := append([]*weightedAddr(nil), w.servers...)
+	for len(candidates) > 0 {
+		k := pickWeighted(candidates, w.selectMode)
+		if invoker := w.invoker(candidates[k].addr); invoker != nil {
+			return invoker
+		}
+		candidates = append(candidates[:k], candidates[k+1:]...)
+	}
+	return nil
+}
+
+// invoker returns the invoker of addr, dialing it if needed, or nil if it is unreachable.
+func (w *weightedServers) invoker(addr string) client.Invoker {
+	if invoker := w.invokers[addr]; invoker != nil && invoker.State() != client.Closed {
+		return invoker
+	}
+	i := strings.IndexByte(addr, '@')
+	invoker, err := w.newInvokerFunc(addr[:i], addr[i+1:], w.dialTimeout)
+	if err != nil {
+		return nil
+	}
+	if w.invokers == nil {
+		w.invokers = make(map[string]client.Invoker)
+	}
+	w.invokers[addr] = invoker
+	return invoker
+}
+
+func (w *weightedServers) list() []client.Invoker {
+	invokers := make([]client.Invoker, 0, len(w.invokers))
+	for _, invoker := range w.invokers {
+		if invoker.State() != client.Closed {
+			invokers = append(invokers, invoker)
+		}
+	}
+	return invokers
+}
+
+// remove forgets the invoker, closed by the caller.
+func (w *weightedServers) remove(invoker client.Invoker) {
+	for addr, i := range w.invokers {
+		if i == invoker {
+			delete(w.invokers, addr)
+		}
+	}
+}
+
+// close closes the invokers.
+func (w *weightedServers) close() {
+	for addr, invoker := range w.invokers {
+		invoker.Close()
+		delete(w.invokers, addr)
+	}
+}
@@ -0,0 +1,121 @@
+// myrpc-dump pretty-prints a captured byte stream of one direction of a myrpc connection.
+//
+// Usage:
+//	myrpc-dump [-codec gob|json|bson] [-appoint] [-response] [-keys file] [file]
+//
+// It reads the standard input if file is omitted.
+// The recordings of the record package are decrypted with the keys of the -keys file,
+// one "id hex-key" per line.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/henrylee2cn/myrpc/client/record"
+	"github.com/henrylee2cn/myrpc/codec/dump"
+)
+
+func main() {
+	codec := flag.String("codec", "gob", "codec of the stream: "+strings.Join(dump.Codecs(), ", "))
+	appoint := flag.Bool("appoint", false, "the stream starts with the codec byte of the AppointCodecPlugin (requests only)")
+	response := flag.Bool("response", false, "the stream is server-to-client")
+	keysFile := flag.String("keys", "", "file of the keys of encrypted recordings")
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	var keys *record.Keyring
+	if *keysFile != "" {
+		var err error
+		if keys, err = readKeys(*keysFile); err != nil {
+			fatal(err)
+		}
+	}
+	in, err := record.NewReader(in, keys)
+	if err != nil {
+		fatal(err)
+	}
+	r := bufio.NewReader(in)
+
+	if *appoint {
+		name, err := dump.ReadAppointCodec(r)
+		if err != nil {
+			fatal(err)
+		}
+		*codec = name
+	}
+
+	var d *dump.Decoder
+	if *response {
+		d, err = dump.NewResponseDecoder(r, *codec)
+	} else {
+		d, err = dump.NewRequestDecoder(r, *codec)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Printf("codec: %s\n", d.Codec())
+	for {
+		frame, err := d.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("seq: %d\tmethod: %s\n", frame.Seq, frame.ServiceMethod)
+		if frame.Error != "" {
+			fmt.Printf("\terror: %q\n", frame.Error)
+		}
+		if frame.Body != nil {
+			b, _ := json.MarshalIndent(frame.Body, "\t", "  ")
+			fmt.Printf("\tbody: %s\n", b)
+		}
+	}
+}
+
+// readKeys reads the keys of encrypted recordings, one "id hex-key" per line.
+func readKeys(name string) (*record.Keyring, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	keys := record.NewKeyring()
+	for i, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expect \"id hex-key\"", name, i+1)
+		}
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, i+1, err.Error())
+		}
+		if err = keys.Add(fields[0], key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, i+1, err.Error())
+		}
+	}
+	return keys, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "myrpc-dump:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,37 @@
+// myrpc-echo runs the reference echo server of package conformance.
+//
+// Usage:
+//	myrpc-echo [-addr 127.0.0.1:8972] [-codec gob|json]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+	"github.com/henrylee2cn/myrpc/conformance"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8972", "listening address")
+	codec := flag.String("codec", "json", "codec: gob or json")
+	flag.Parse()
+
+	var codecFunc server.ServerCodecFunc
+	switch *codec {
+	case "gob":
+		codecFunc = gob.NewGobServerCodec
+	case "json":
+		codecFunc = jsonrpc.NewJSONRPCServerCodec
+	default:
+		fmt.Fprintln(os.Stderr, "myrpc-echo: unknown codec:", *codec)
+		os.Exit(2)
+	}
+	if err := conformance.NewEchoServer(codecFunc).Serve("tcp", *addr); err != nil {
+		fmt.Fprintln(os.Stderr, "myrpc-echo:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,63 @@
+// myrpc-gen generates a typed client of the HTTP gateway from an OpenAPI 3 document in JSON.
+//
+// Usage:
+//	myrpc-gen [-lang go|ts] [-package name] [-o file] [openapi.json]
+//
+// It reads the standard input if the document is omitted, and writes the standard output if -o is omitted.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/henrylee2cn/myrpc/gateway/openapi"
+)
+
+func main() {
+	lang := flag.String("lang", "go", "language of the client: go, ts")
+	pkg := flag.String("package", "client", "package name of the Go client")
+	out := flag.String("o", "", "output file")
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	doc, err := openapi.Parse(in)
+	if err != nil {
+		fatal(err)
+	}
+
+	var src []byte
+	switch *lang {
+	case "go":
+		src, err = openapi.GenerateGo(doc, *pkg)
+	case "ts":
+		src = openapi.GenerateTypeScript(doc)
+	default:
+		err = fmt.Errorf("unknown language %q", *lang)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err = os.WriteFile(*out, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "myrpc-gen:", err)
+	os.Exit(1)
+}
@@ -131,13 +131,8 @@ func newBsonDecoder(r io.Reader) *bsonDecoder {
 
 func (d *bsonDecoder) Decode(pv interface{}) (err error) {
 	var lbuf [4]byte
-	n, err := d.r.Read(lbuf[:])
-
-	if n != 4 {
-		err = fmt.Errorf("Corrupted BSON stream: could only read %d", n)
-		return
-	}
-	if err != nil {
+	// io.EOF at the end of the stream, io.ErrUnexpectedEOF within the length.
+	if _, err = io.ReadFull(d.r, lbuf[:]); err != nil {
 		return
 	}
 
@@ -149,7 +144,7 @@ func (d *bsonDecoder) Decode(pv interface{}) (err error) {
 	buf := make([]byte, length)
 	copy(buf[0:4], lbuf[:])
 
-	n, err = io.ReadFull(d.r, buf[4:])
+	n, err := io.ReadFull(d.r, buf[4:])
 	if err != nil {
 		return
 	}
@@ -0,0 +1,161 @@
+// Package dump decodes a captured byte stream of one direction of a myrpc connection,
+// to debug interop issues between implementations.
+package dump
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/rpc"
+
+	"github.com/henrylee2cn/myrpc/codec/bson"
+	"github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+	"github.com/henrylee2cn/myrpc/plugin/appoint_codec"
+)
+
+type (
+	// Frame is a decoded request or response.
+	Frame struct {
+		Seq           uint64
+		ServiceMethod string
+		// Error is the error of a response.
+		Error string
+		// Body is the decoded body, it is nil for an error response,
+		// or if the codec can't decode bodies without their types.
+		Body interface{}
+	}
+
+	// Decoder decodes frames from a byte stream.
+	Decoder struct {
+		codec    string
+		request  bool
+		server   rpc.ServerCodec
+		client   rpc.ClientCodec
+		genBody  bool
+		finished bool
+	}
+
+	codecFuncs struct {
+		server  func(io.ReadWriteCloser) rpc.ServerCodec
+		client  func(io.ReadWriteCloser) rpc.ClientCodec
+		genBody bool // whether the body can be decoded into an interface{}
+	}
+
+	readOnly struct {
+		io.Reader
+	}
+)
+
+var codecs = map[string]codecFuncs{
+	"gob":  {gob.NewGobServerCodec, gob.NewGobClientCodec, false},
+	"json": {jsonrpc.NewJSONRPCServerCodec, jsonrpc.NewJSONRPCClientCodec, true},
+	"bson": {bson.NewBsonServerCodec, bson.NewBsonClientCodec, true},
+}
+
+var appointCodecs = map[appoint_codec.CodecType]string{
+	appoint_codec.CODEC_TYPE_GOB:  "gob",
+	appoint_codec.CODEC_TYPE_JSON: "json",
+	appoint_codec.CODEC_TYPE_BSON: "bson",
+}
+
+// ErrUnknownCodec is returned when the codec is not supported by the decoder.
+var ErrUnknownCodec = errors.New("dump: unknown codec")
+
+// Codecs returns the names of the supported codecs.
+func Codecs() []string {
+	return []string{"gob", "json", "bson"}
+}
+
+// NewRequestDecoder returns a Decoder of the client-to-server stream r.
+func NewRequestDecoder(r io.Reader, codec string) (*Decoder, error) {
+	return newDecoder(r, codec, true)
+}
+
+// NewResponseDecoder returns a Decoder of the server-to-client stream r.
+func NewResponseDecoder(r io.Reader, codec string) (*Decoder, error) {
+	return newDecoder(r, codec, false)
+}
+
+// ReadAppointCodec reads the codec byte sent first by the AppointCodecPlugin,
+// and returns the codec name.
+func ReadAppointCodec(r *bufio.Reader) (string, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	name, ok := appointCodecs[appoint_codec.CodecType(b)]
+	if !ok {
+		return "", ErrUnknownCodec
+	}
+	return name, nil
+}
+
+func newDecoder(r io.Reader, codec string, request bool) (*Decoder, error) {
+	fns, ok := codecs[codec]
+	if !ok {
+		return nil, ErrUnknownCodec
+	}
+	d := &Decoder{
+		codec:   codec,
+		request: request,
+		genBody: fns.genBody,
+	}
+	if request {
+		d.server = fns.server(readOnly{r})
+	} else {
+		d.client = fns.client(readOnly{r})
+	}
+	return d, nil
+}
+
+// Codec returns the codec name.
+func (d *Decoder) Codec() string {
+	return d.codec
+}
+
+// Next decodes the next frame, it returns io.EOF at the end of the stream.
+func (d *Decoder) Next() (*Frame, error) {
+	if d.finished {
+		return nil, io.EOF
+	}
+	frame := new(Frame)
+	var body interface{}
+	if d.genBody {
+		body = &frame.Body
+	}
+	var err error
+	if d.request {
+		var req rpc.Request
+		if err = d.server.ReadRequestHeader(&req); err == nil {
+			frame.Seq, frame.ServiceMethod = req.Seq, req.ServiceMethod
+			err = d.server.ReadRequestBody(body)
+		}
+	} else {
+		var resp rpc.Response
+		if err = d.client.ReadResponseHeader(&resp); err == nil {
+			frame.Seq, frame.ServiceMethod, frame.Error = resp.Seq, resp.ServiceMethod, resp.Error
+			if resp.Error != "" {
+				// the body of an error is discarded, e.g. jsonrpc has none.
+				body = nil
+			}
+			err = d.client.ReadResponseBody(body)
+		}
+	}
+	if err != nil {
+		d.finished = true
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (readOnly) Write(b []byte) (int, error) {
+	return 0, errors.New("dump: write to a captured stream")
+}
+
+func (readOnly) Close() error {
+	return nil
+}
@@ -0,0 +1,120 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/rpc"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/plugin/appoint_codec"
+)
+
+// pipeConn reads from Reader and writes to Writer.
+type pipeConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (pipeConn) Close() error {
+	return nil
+}
+
+// frames are the requests captured, the response of each one replying its body, or Error if it is not empty.
+var frames = []Frame{
+	{Seq: 1, ServiceMethod: "/arith/echo", Body: "hello"},
+	{Seq: 2, ServiceMethod: "/arith/div", Body: "1/0", Error: "divide by zero"},
+}
+
+// capture returns the request and the response streams of frames, written by the codec.
+func capture(t *testing.T, codec string) (requests, responses []byte) {
+	fns := codecs[codec]
+	var reqBuf, respBuf bytes.Buffer
+	c := fns.client(pipeConn{Writer: &reqBuf})
+	for _, frame := range frames {
+		if err := c.WriteRequest(&rpc.Request{Seq: frame.Seq, ServiceMethod: frame.ServiceMethod}, frame.Body); err != nil {
+			t.Fatalf("%s: %v", codec, err)
+		}
+	}
+	requests = append([]byte(nil), reqBuf.Bytes()...)
+	s := fns.server(pipeConn{Reader: &reqBuf, Writer: &respBuf})
+	for _, frame := range frames {
+		req := new(rpc.Request)
+		var body interface{}
+		if err := s.ReadRequestHeader(req); err != nil {
+			t.Fatalf("%s: %v", codec, err)
+		}
+		s.ReadRequestBody(&body)
+		if frame.Error != "" {
+			body = struct{}{}
+		}
+		if err := s.WriteResponse(&rpc.Response{Seq: req.Seq, ServiceMethod: req.ServiceMethod, Error: frame.Error}, body); err != nil {
+			t.Fatalf("%s: %v", codec, err)
+		}
+	}
+	return requests, respBuf.Bytes()
+}
+
+func TestDecoder(t *testing.T) {
+	for _, codec := range Codecs() {
+		requests, responses := capture(t, codec)
+		for _, test := range []struct {
+			name    string
+			stream  []byte
+			decoder func(io.Reader, string) (*Decoder, error)
+		}{
+			{"requests", requests, NewRequestDecoder},
+			{"responses", responses, NewResponseDecoder},
+			// a stream cut in the middle of a frame ends with the frames complete.
+			{"truncated", responses[:len(responses)-4], NewResponseDecoder},
+		} {
+			d, err := test.decoder(bytes.NewReader(test.stream), codec)
+			if err != nil || d.Codec() != codec {
+				t.Fatalf("%s %s: expect a decoder, got %v", codec, test.name, err)
+			}
+			expect := frames
+			if test.name == "truncated" {
+				expect = frames[:1]
+			}
+			for _, frame := range expect {
+				got, err := d.Next()
+				if err != nil {
+					t.Fatalf("%s %s: expect the frame %d, got %v", codec, test.name, frame.Seq, err)
+				}
+				if got.Seq != frame.Seq || test.name == "requests" && got.ServiceMethod != frame.ServiceMethod ||
+					test.name != "requests" && got.Error != frame.Error {
+					t.Fatalf("%s %s: expect the frame %+v, got %+v", codec, test.name, frame, got)
+				}
+				// only the codecs whose bodies carry their types decode them, bson decoding a string as bytes.
+				decoded := test.name == "requests" || frame.Error == ""
+				if body := fmt.Sprintf("%s", got.Body); codecs[codec].genBody && decoded && body != frame.Body ||
+					(!codecs[codec].genBody || !decoded) && got.Body != nil {
+					t.Fatalf("%s %s: expect the body of the frame %d, got %v", codec, test.name, frame.Seq, got.Body)
+				}
+			}
+			if _, err := d.Next(); err != io.EOF {
+				t.Fatalf("%s %s: expect io.EOF at the end of the stream, got %v", codec, test.name, err)
+			}
+		}
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	if _, err := NewRequestDecoder(bytes.NewReader(nil), "xml"); err != ErrUnknownCodec {
+		t.Fatalf("expect ErrUnknownCodec, got %v", err)
+	}
+	for _, test := range []struct {
+		b     byte
+		codec string
+		err   error
+	}{
+		{byte(appoint_codec.CODEC_TYPE_JSON), "json", nil},
+		{byte(appoint_codec.CODEC_TYPE_GOB), "gob", nil},
+		{0xff, "", ErrUnknownCodec},
+	} {
+		if codec, err := ReadAppointCodec(bufio.NewReader(bytes.NewReader([]byte{test.b}))); codec != test.codec || err != test.err {
+			t.Fatalf("expect %q, %v for the byte %d, got %q, %v", test.codec, test.err, test.b, codec, err)
+		}
+	}
+}
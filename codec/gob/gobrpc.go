@@ -6,8 +6,32 @@ import (
 	"io"
 	"log"
 	"net/rpc"
+	"reflect"
 )
 
+// response is the header of a response, rpc.Response with the NoBody flag.
+// A client of a previous version, which expects a body after each header, can not read the responses without body.
+type response struct {
+	ServiceMethod string
+	Seq           uint64
+	Error         string
+	// NoBody is set when the body is omitted because it is empty,
+	// i.e. the reply is a struct{} of an ack-only method, or the response is an error.
+	NoBody bool
+}
+
+// isEmpty reports whether body encodes nothing, i.e. is an empty struct or a pointer to one.
+func isEmpty(body interface{}) bool {
+	t := reflect.TypeOf(body)
+	if t == nil {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t.Size() == 0
+}
+
 type gobServerCodec struct {
 	rwc    io.ReadWriteCloser
 	dec    *gob.Decoder
@@ -35,7 +59,13 @@ func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
 }
 
 func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
-	if err = c.enc.Encode(r); err != nil {
+	header := response{
+		ServiceMethod: r.ServiceMethod,
+		Seq:           r.Seq,
+		Error:         r.Error,
+		NoBody:        isEmpty(body),
+	}
+	if err = c.enc.Encode(&header); err != nil {
 		if c.encBuf.Flush() == nil {
 			// Gob couldn't encode the header. Should not happen, so if it does,
 			// shut down the connection to signal that the connection is broken.
@@ -44,6 +74,9 @@ func (c *gobServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err e
 		}
 		return
 	}
+	if header.NoBody {
+		return c.encBuf.Flush()
+	}
 	if err = c.enc.Encode(body); err != nil {
 		if c.encBuf.Flush() == nil {
 			// Was a gob problem encoding the body but the header has been written.
@@ -70,6 +103,7 @@ type gobClientCodec struct {
 	dec    *gob.Decoder
 	enc    *gob.Encoder
 	encBuf *bufio.Writer
+	resp   response
 }
 
 func NewGobClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
@@ -93,10 +127,21 @@ func (c *gobClientCodec) WriteRequest(r *rpc.Request, body interface{}) (err err
 }
 
 func (c *gobClientCodec) ReadResponseHeader(r *rpc.Response) error {
-	return c.dec.Decode(r)
+	// gob leaves the zero fields, which are not sent, as they are.
+	c.resp = response{}
+	if err := c.dec.Decode(&c.resp); err != nil {
+		return err
+	}
+	r.ServiceMethod = c.resp.ServiceMethod
+	r.Seq = c.resp.Seq
+	r.Error = c.resp.Error
+	return nil
 }
 
 func (c *gobClientCodec) ReadResponseBody(body interface{}) error {
+	if c.resp.NoBody {
+		return nil
+	}
 	return c.dec.Decode(body)
 }
 
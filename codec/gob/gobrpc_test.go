@@ -0,0 +1,52 @@
+package gob
+
+import (
+	"bytes"
+	"io"
+	"net/rpc"
+	"testing"
+)
+
+type bufferConn struct {
+	bytes.Buffer
+}
+
+func (*bufferConn) Close() error {
+	return nil
+}
+
+func TestNoBody(t *testing.T) {
+	type reply struct {
+		C int
+	}
+	conn := new(bufferConn)
+	s := NewGobServerCodec(conn)
+	s.WriteResponse(&rpc.Response{ServiceMethod: "/queue/ack", Seq: 1}, &struct{}{})
+	s.WriteResponse(&rpc.Response{ServiceMethod: "/arith/mul", Seq: 2}, &reply{C: 56})
+	s.WriteResponse(&rpc.Response{ServiceMethod: "/arith/div", Seq: 3, Error: "divide by zero"}, struct{}{})
+
+	c := NewGobClientCodec(conn)
+	var resp rpc.Response
+	if err := c.ReadResponseHeader(&resp); err != nil || resp.Seq != 1 {
+		t.Fatalf("unexpected header: %+v, %v", resp, err)
+	}
+	if err := c.ReadResponseBody(&struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadResponseHeader(&resp); err != nil || resp.Seq != 2 || resp.Error != "" {
+		t.Fatalf("unexpected header: %+v, %v", resp, err)
+	}
+	var r reply
+	if err := c.ReadResponseBody(&r); err != nil || r.C != 56 {
+		t.Fatalf("unexpected body: %+v, %v", r, err)
+	}
+	if err := c.ReadResponseHeader(&resp); err != nil || resp.Seq != 3 || resp.Error != "divide by zero" {
+		t.Fatalf("unexpected header: %+v, %v", resp, err)
+	}
+	if err := c.ReadResponseBody(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadResponseHeader(&resp); err != io.EOF {
+		t.Fatalf("expect io.EOF, got %v", err)
+	}
+}
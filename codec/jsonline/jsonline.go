@@ -0,0 +1,167 @@
+// Package jsonline implements a newline-delimited JSON codec,
+// each request or response is one JSON object per line, header and body together:
+//	request:  {"seq":1,"method":"/arith/mul","params":{"A":7,"B":8}}
+//	response: {"seq":1,"method":"/arith/mul","error":"","result":{"C":56}}
+// It makes it trivial to write thin clients in scripting languages.
+package jsonline
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/rpc"
+	"sync"
+)
+
+type (
+	request struct {
+		Seq    uint64          `json:"seq"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	response struct {
+		Seq    uint64          `json:"seq"`
+		Method string          `json:"method"`
+		Error  string          `json:"error,omitempty"`
+		Result json.RawMessage `json:"result"`
+	}
+
+	serverCodec struct {
+		rwc  io.ReadWriteCloser
+		dec  *json.Decoder
+		req  request
+		enc  *json.Encoder
+		buf  *bufio.Writer
+		lock sync.Mutex
+	}
+
+	clientCodec struct {
+		rwc  io.ReadWriteCloser
+		dec  *json.Decoder
+		resp response
+		enc  *json.Encoder
+		buf  *bufio.Writer
+		lock sync.Mutex
+	}
+)
+
+var null = json.RawMessage("null")
+
+// NewJSONLineServerCodec creates a newline-delimited JSON ServerCodec.
+func NewJSONLineServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	buf := bufio.NewWriter(conn)
+	return &serverCodec{
+		rwc: conn,
+		dec: json.NewDecoder(conn),
+		enc: json.NewEncoder(buf),
+		buf: buf,
+	}
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	c.req = request{}
+	if err := c.dec.Decode(&c.req); err != nil {
+		return err
+	}
+	r.Seq = c.req.Seq
+	r.ServiceMethod = c.req.Method
+	return nil
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	if body == nil || c.req.Params == nil {
+		return nil
+	}
+	return json.Unmarshal(c.req.Params, body)
+}
+
+// ReadRequestBodyRaw returns the params of the request, so that server.Server.LazyBody applies to the codec.
+func (c *serverCodec) ReadRequestBodyRaw() ([]byte, error) {
+	return c.req.Params, nil
+}
+
+// DecodeRequestBody decodes params returned by ReadRequestBodyRaw.
+func (c *serverCodec) DecodeRequestBody(raw []byte, body interface{}) error {
+	if body == nil || raw == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, body)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	resp := response{
+		Seq:    r.Seq,
+		Method: r.ServiceMethod,
+		Error:  r.Error,
+		Result: null,
+	}
+	if r.Error == "" {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		resp.Result = b
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.enc.Encode(&resp); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c *serverCodec) Close() error {
+	return c.rwc.Close()
+}
+
+// NewJSONLineClientCodec creates a newline-delimited JSON ClientCodec.
+func NewJSONLineClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+	buf := bufio.NewWriter(conn)
+	return &clientCodec{
+		rwc: conn,
+		dec: json.NewDecoder(conn),
+		enc: json.NewEncoder(buf),
+		buf: buf,
+	}
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req := request{
+		Seq:    r.Seq,
+		Method: r.ServiceMethod,
+		Params: b,
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.enc.Encode(&req); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+	c.resp = response{}
+	if err := c.dec.Decode(&c.resp); err != nil {
+		return err
+	}
+	r.Seq = c.resp.Seq
+	r.ServiceMethod = c.resp.Method
+	r.Error = c.resp.Error
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	if body == nil || c.resp.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(c.resp.Result, body)
+}
+
+func (c *clientCodec) Close() error {
+	return c.rwc.Close()
+}
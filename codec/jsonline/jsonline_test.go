@@ -0,0 +1,180 @@
+package jsonline
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+func TestJSONLineCodec(t *testing.T) {
+	srv := server.NewServer(server.Server{})
+	srv.NamedRegister("arith", codec.Service)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListenerCodec(lis, NewJSONLineServerCodec)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, `{"seq":1,"method":"/arith/mul","params":{"A":7,"B":8}}`+"\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(line) != `{"seq":1,"method":"/arith/mul","result":{"C":56}}` {
+		t.Fatalf("unexpected response: %s", line)
+	}
+}
+
+type rejectPlugin struct {
+	raw  []byte
+	args *codec.Args
+}
+
+func (p *rejectPlugin) Name() string {
+	return "rejectPlugin"
+}
+
+func (p *rejectPlugin) PostReadRequestBody(ctx *server.Context, body interface{}) error {
+	p.raw = ctx.RawBody()
+	p.args = body.(*codec.Args)
+	if ctx.Query().Get("reject") != "" {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+func TestJSONLineLazyBody(t *testing.T) {
+	srv := server.NewServer(server.Server{LazyBody: true})
+	p := new(rejectPlugin)
+	srv.PluginContainer.Add(p)
+	srv.NamedRegister("arith", codec.Service)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListenerCodec(lis, NewJSONLineServerCodec)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	call := func(request string) string {
+		io.WriteString(conn, request+"\n")
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(line)
+	}
+
+	line := call(`{"seq":1,"method":"/arith/mul?reject=1","params":{"A":7,"B":8}}`)
+	if !strings.Contains(line, "rejected") {
+		t.Fatalf("unexpected response: %s", line)
+	}
+	if string(p.raw) != `{"A":7,"B":8}` || p.args.A != 0 {
+		t.Fatalf("body decoded before the service: raw %s, args %+v", p.raw, p.args)
+	}
+
+	line = call(`{"seq":2,"method":"/arith/mul","params":{"A":7,"B":8}}`)
+	if line != `{"seq":2,"method":"/arith/mul","result":{"C":56}}` {
+		t.Fatalf("unexpected response: %s", line)
+	}
+
+	line = call(`{"seq":3,"method":"/arith/mul","params":{"A":"x"}}`)
+	if !strings.Contains(line, "ReadRequestBody") {
+		t.Fatalf("unexpected response: %s", line)
+	}
+}
+
+type proxyPlugin struct {
+	upstream *client.Client
+}
+
+func (p *proxyPlugin) Name() string {
+	return "proxyPlugin"
+}
+
+func (p *proxyPlugin) RouteRequest(ctx *server.Context) (server.RouteHandler, error) {
+	switch ctx.Path() {
+	case "/denied":
+		return nil, errors.New("denied")
+	case "/cached":
+		return func(ctx *server.Context, body []byte) (interface{}, error) {
+			return json.RawMessage(`{"C":1}`), nil
+		}, nil
+	}
+	if !strings.HasPrefix(ctx.Path(), "/arith/") {
+		return nil, nil
+	}
+	return func(ctx *server.Context, body []byte) (interface{}, error) {
+		var reply json.RawMessage
+		err := p.upstream.Call(ctx.ServiceMethod(), json.RawMessage(body), &reply).Err()
+		return reply, err
+	}, nil
+}
+
+func TestJSONLineRoute(t *testing.T) {
+	upstream := server.NewServer(server.Server{})
+	upstream.NamedRegister("arith", codec.Service)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go upstream.ServeListenerCodec(lis, NewJSONLineServerCodec)
+	c := client.NewClient(client.Client{ClientCodecFunc: NewJSONLineClientCodec},
+		&selector.DirectSelector{Network: "tcp", Address: lis.Addr().String()})
+	defer c.Close()
+
+	// the proxy registers no service.
+	proxy := server.NewServer(server.Server{})
+	proxy.PluginContainer.Add(&proxyPlugin{upstream: c})
+	lis, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go proxy.ServeListenerCodec(lis, NewJSONLineServerCodec)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	call := func(request string) string {
+		io.WriteString(conn, request+"\n")
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(line)
+	}
+
+	if line := call(`{"seq":1,"method":"/arith/mul","params":{"A":7,"B":8}}`); line != `{"seq":1,"method":"/arith/mul","result":{"C":56}}` {
+		t.Fatalf("unexpected response: %s", line)
+	}
+	if line := call(`{"seq":2,"method":"/cached","params":{"A":7,"B":8}}`); line != `{"seq":2,"method":"/cached","result":{"C":1}}` {
+		t.Fatalf("unexpected response: %s", line)
+	}
+	if line := call(`{"seq":3,"method":"/denied","params":{"A":7,"B":8}}`); !strings.Contains(line, "RouteRequest(proxyPlugin): denied") {
+		t.Fatalf("unexpected response: %s", line)
+	}
+	if line := call(`{"seq":4,"method":"/arith/error","params":{}}`); !strings.Contains(line, "Service Panic") {
+		t.Fatalf("unexpected response: %s", line)
+	}
+}
@@ -0,0 +1,231 @@
+// Package resp implements a ServerCodec speaking the Redis protocol (RESP),
+// so that existing redis clients in any language can invoke simple services.
+// Each selected service method is exposed as a redis command:
+//	srv.ServeListenerCodec(lis, resp.NewRESPServerCodecFunc(map[string]string{
+//		"MUL": "/arith/mul",
+//	}))
+//	$ redis-cli MUL '{"A":7,"B":8}'
+//	"{\"C\":56}"
+// The first command argument is the request body: it is used as is for string and []byte
+// arguments, all arguments are used for []string arguments, otherwise it is decoded as JSON.
+// Replies of string, []byte and integer types are sent as such, others are encoded as JSON.
+// PING is answered by the codec itself.
+package resp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type serverCodec struct {
+	rwc      io.ReadWriteCloser
+	r        *bufio.Reader
+	w        *bufio.Writer
+	commands map[string]string
+	args     [][]byte // arguments of the current request
+	seq      uint64   // seq of the next request
+
+	// responses are written in request order, as redis clients expect.
+	lock    sync.Mutex
+	next    uint64
+	pending map[uint64][]byte
+}
+
+// NewRESPServerCodecFunc returns a ServerCodecFunc exposing the services
+// of commands, which maps redis command names to service method paths.
+func NewRESPServerCodecFunc(commands map[string]string) server.ServerCodecFunc {
+	upper := make(map[string]string, len(commands))
+	for cmd, path := range commands {
+		upper[strings.ToUpper(cmd)] = path
+	}
+	return func(conn io.ReadWriteCloser) rpc.ServerCodec {
+		return &serverCodec{
+			rwc:      conn,
+			r:        bufio.NewReader(conn),
+			w:        bufio.NewWriter(conn),
+			commands: upper,
+			pending:  make(map[uint64][]byte),
+		}
+	}
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		args, err := c.readCommand()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		seq := c.seq
+		c.seq++
+		cmd := strings.ToUpper(string(args[0]))
+		if cmd == "PING" {
+			if err = c.reply(seq, []byte("+PONG\r\n")); err != nil {
+				return err
+			}
+			continue
+		}
+		path, ok := c.commands[cmd]
+		if !ok {
+			if err = c.reply(seq, errorReply("unknown command '"+cmd+"'")); err != nil {
+				return err
+			}
+			continue
+		}
+		r.Seq = seq
+		r.ServiceMethod = path
+		c.args = args[1:]
+		return nil
+	}
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	if body == nil || len(c.args) == 0 {
+		return nil
+	}
+	switch b := body.(type) {
+	case *string:
+		*b = string(c.args[0])
+	case *[]byte:
+		*b = c.args[0]
+	case *[]string:
+		for _, arg := range c.args {
+			*b = append(*b, string(arg))
+		}
+	default:
+		return json.Unmarshal(c.args[0], body)
+	}
+	return nil
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	if r.Error != "" {
+		// strip the error type byte.
+		return c.reply(r.Seq, errorReply(r.Error[1:]))
+	}
+	b, err := valueReply(body)
+	if err != nil {
+		return err
+	}
+	return c.reply(r.Seq, b)
+}
+
+func (c *serverCodec) Close() error {
+	return c.rwc.Close()
+}
+
+// reply writes the reply of seq after the replies of the previous requests.
+func (c *serverCodec) reply(seq uint64, b []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending[seq] = b
+	for {
+		b, ok := c.pending[c.next]
+		if !ok {
+			break
+		}
+		delete(c.pending, c.next)
+		c.next++
+		if _, err := c.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return c.w.Flush()
+}
+
+// readCommand reads a RESP array of bulk strings, or an inline command.
+func (c *serverCodec) readCommand() ([][]byte, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		var args [][]byte
+		for _, f := range strings.Fields(string(line)) {
+			args = append(args, []byte(f))
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil {
+		return nil, errors.New("resp: invalid array length")
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		line, err = c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("resp: expect a bulk string")
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 {
+			return nil, errors.New("resp: invalid bulk string length")
+		}
+		arg := make([]byte, size+2)
+		if _, err = io.ReadFull(c.r, arg); err != nil {
+			return nil, err
+		}
+		args = append(args, arg[:size])
+	}
+	return args, nil
+}
+
+func (c *serverCodec) readLine() ([]byte, error) {
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(line), "\r\n")), nil
+}
+
+func errorReply(msg string) []byte {
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+	return []byte("-ERR " + msg + "\r\n")
+}
+
+func bulkReply(b []byte) []byte {
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(b), b))
+}
+
+func valueReply(body interface{}) ([]byte, error) {
+	v := reflect.ValueOf(body)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return []byte("$-1\r\n"), nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return []byte("$-1\r\n"), nil
+	case reflect.String:
+		return bulkReply([]byte(v.String())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []byte(":" + strconv.FormatInt(v.Int(), 10) + "\r\n"), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []byte(":" + strconv.FormatUint(v.Uint(), 10) + "\r\n"), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return bulkReply(v.Bytes()), nil
+		}
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return bulkReply(b), nil
+}
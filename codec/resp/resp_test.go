@@ -0,0 +1,45 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+func TestRESPCodec(t *testing.T) {
+	srv := server.NewServer(server.Server{})
+	srv.NamedRegister("arith", codec.Service)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListenerCodec(lis, NewRESPServerCodecFunc(map[string]string{
+		"mul": "/arith/mul",
+	}))
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "PING\r\n*2\r\n$3\r\nMUL\r\n$13\r\n{\"A\":7,\"B\":8}\r\nFOO\r\n")
+	r := bufio.NewReader(conn)
+	for _, expect := range []string{
+		"+PONG\r\n",
+		"$8\r\n",
+		"{\"C\":56}\r\n",
+		"-ERR unknown command 'FOO'\r\n",
+	} {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expect {
+			t.Fatalf("expect %q, got %q", expect, line)
+		}
+	}
+}
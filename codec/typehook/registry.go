@@ -0,0 +1,101 @@
+package typehook
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+var (
+	names = make(map[reflect.Type]string)
+	types = make(map[string]reflect.Type)
+)
+
+// Typed is the encoding of an interface value holding a registered type:
+// the name of the concrete type, and its JSON, inline for the JSON codecs.
+// A nil interface value has an empty Type.
+type Typed struct {
+	Type  string
+	Value json.RawMessage
+}
+
+var typedType = reflect.TypeOf(Typed{})
+
+// RegisterName registers the concrete type of value under name, like gob.RegisterName but for any codec.
+// The interface values, e.g. of struct fields, whose type may hold a registered type are encoded as a Typed,
+// so that polymorphic arguments and replies are decoded into their concrete type.
+// It is usually called in an init function, by both the server and the client.
+func RegisterName(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	mu.Lock()
+	defer mu.Unlock()
+	if other, ok := types[name]; ok && other != t {
+		panic(fmt.Sprintf("typehook: registering duplicate types for %q: %s != %s", name, other, t))
+	}
+	if other, ok := names[t]; ok && other != name {
+		panic(fmt.Sprintf("typehook: registering duplicate names for %s: %q != %q", t, other, name))
+	}
+	names[t] = name
+	types[name] = t
+	mirrors = make(map[reflect.Type]reflect.Type)
+}
+
+// holdsRegistered reports whether the interface type t may hold a registered type.
+func holdsRegistered(t reflect.Type) bool {
+	for registered := range names {
+		if registered.Implements(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// toTyped encodes the interface value v.
+func toTyped(v reflect.Value) (reflect.Value, error) {
+	if v.IsNil() {
+		return reflect.ValueOf(Typed{}), nil
+	}
+	concrete := v.Elem()
+	mu.RLock()
+	name, ok := names[concrete.Type()]
+	mu.RUnlock()
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("typehook: type %s is not registered", concrete.Type())
+	}
+	mv, err := toMirror(concrete, mirrorOf(concrete.Type()))
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	b, err := json.Marshal(mv.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(Typed{Type: name, Value: b}), nil
+}
+
+// fromTyped decodes typed into the interface value v.
+func fromTyped(typed Typed, v reflect.Value) error {
+	if typed.Type == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	mu.RLock()
+	t, ok := types[typed.Type]
+	mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("typehook: name %q is not registered", typed.Type)
+	}
+	if !t.AssignableTo(v.Type()) {
+		return fmt.Errorf("typehook: type %s of %q is not assignable to %s", t, typed.Type, v.Type())
+	}
+	mv := reflect.New(mirrorOf(t))
+	if err := json.Unmarshal(typed.Value, mv.Interface()); err != nil {
+		return err
+	}
+	concrete := reflect.New(t).Elem()
+	if err := fromMirror(mv.Elem(), concrete); err != nil {
+		return err
+	}
+	v.Set(concrete)
+	return nil
+}
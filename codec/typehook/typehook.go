@@ -0,0 +1,390 @@
+// Package typehook lets custom marshal and unmarshal functions be registered for types
+// such as time.Time, decimal.Decimal or uuid.UUID, and applies them consistently
+// with any reflection-based codec, e.g. gob, JSON or msgpack, so that services need no wrapper struct per codec:
+//
+//	typehook.Register(decimal.Decimal{}, typehook.Hook{
+//		Marshal:   func(v interface{}) ([]byte, error) { return []byte(v.(decimal.Decimal).String()), nil },
+//		Unmarshal: func(data []byte, v interface{}) error { return v.(*decimal.Decimal).UnmarshalText(data) },
+//	})
+//	srv := server.NewServer(server.Server{ServerCodecFunc: typehook.NewServerCodec(codecGob.NewGobServerCodec)})
+//
+// The wrapped codecs encode a mirror of each body, where the values of the registered types,
+// including in struct fields, pointers, slices, arrays and map values, are replaced by the bytes of their Marshal.
+// The bytes are a JSON string for the JSON codecs, and a byte string for the others.
+// The interface values holding a type registered by RegisterName are replaced by a Typed.
+// Map keys and recursive types are encoded as they are.
+package typehook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"unicode/utf8"
+)
+
+// Hook marshals and unmarshals the values of a type.
+type Hook struct {
+	// Marshal returns the encoding of v, which is a value of the type.
+	Marshal func(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v, which is a pointer to the type.
+	// It is not called for an empty data, the value is then left zero.
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var (
+	mu      sync.RWMutex
+	hooks   = make(map[reflect.Type]Hook)
+	mirrors = make(map[reflect.Type]reflect.Type)
+)
+
+// Register registers hook for the type of value, it is usually called in an init function.
+func Register(value interface{}, hook Hook) {
+	if hook.Marshal == nil || hook.Unmarshal == nil {
+		panic("typehook: Register with a nil Marshal or Unmarshal")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	hooks[reflect.TypeOf(value)] = hook
+	mirrors = make(map[reflect.Type]reflect.Type)
+}
+
+// Value is the encoding of a value of a registered type.
+type Value []byte
+
+var valueType = reflect.TypeOf(Value(nil))
+
+// MarshalJSON encodes v as a JSON string, v must be valid UTF-8.
+func (v Value) MarshalJSON() ([]byte, error) {
+	if !utf8.Valid(v) {
+		return nil, fmt.Errorf("typehook: %q is not UTF-8, which a JSON string requires", []byte(v))
+	}
+	return json.Marshal(string(v))
+}
+
+// UnmarshalJSON decodes a JSON string, or keeps any other JSON value as is, e.g. a number.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*v = Value(s)
+		return nil
+	}
+	if string(data) == "null" {
+		*v = nil
+		return nil
+	}
+	*v = append((*v)[:0], data...)
+	return nil
+}
+
+// mirrorOf returns the type encoded instead of t, t itself if no registered type is reached.
+func mirrorOf(t reflect.Type) reflect.Type {
+	mu.RLock()
+	m, ok := mirrors[t]
+	mu.RUnlock()
+	if ok {
+		return m
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	m = mirrorLocked(t, make(map[reflect.Type]bool))
+	mirrors[t] = m
+	return m
+}
+
+// mirrorLocked returns the mirror type of t, the inner types are not cached
+// since their mirror depends on the types being visited.
+func mirrorLocked(t reflect.Type, visiting map[reflect.Type]bool) (m reflect.Type) {
+	if _, ok := hooks[t]; ok {
+		return valueType
+	}
+	if visiting[t] {
+		// a recursive type is encoded as it is.
+		return t
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	m = t
+	switch t.Kind() {
+	case reflect.Ptr:
+		if elem := mirrorLocked(t.Elem(), visiting); elem != t.Elem() {
+			m = reflect.PtrTo(elem)
+		}
+	case reflect.Slice:
+		if elem := mirrorLocked(t.Elem(), visiting); elem != t.Elem() {
+			m = reflect.SliceOf(elem)
+		}
+	case reflect.Array:
+		if elem := mirrorLocked(t.Elem(), visiting); elem != t.Elem() {
+			m = reflect.ArrayOf(t.Len(), elem)
+		}
+	case reflect.Map:
+		if elem := mirrorLocked(t.Elem(), visiting); elem != t.Elem() {
+			m = reflect.MapOf(t.Key(), elem)
+		}
+	case reflect.Struct:
+		m = mirrorStruct(t, visiting)
+	case reflect.Interface:
+		if holdsRegistered(t) {
+			m = typedType
+		}
+	}
+	return m
+}
+
+// mirrorStruct returns a struct of the exported fields of t, with mirrored types,
+// or t if no field is mirrored or if reflect.StructOf does not support t, e.g. for embedded types with methods.
+func mirrorStruct(t reflect.Type, visiting map[reflect.Type]bool) (m reflect.Type) {
+	var (
+		fields  []reflect.StructField
+		changed bool
+	)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		mt := mirrorLocked(f.Type, visiting)
+		changed = changed || mt != f.Type
+		fields = append(fields, reflect.StructField{Name: f.Name, Type: mt, Tag: f.Tag, Anonymous: f.Anonymous})
+	}
+	if !changed {
+		return t
+	}
+	defer func() {
+		if recover() != nil {
+			m = t
+		}
+	}()
+	return reflect.StructOf(fields)
+}
+
+func hookOf(t reflect.Type) Hook {
+	mu.RLock()
+	defer mu.RUnlock()
+	return hooks[t]
+}
+
+// toMirror converts v to a value of its mirror type m.
+func toMirror(v reflect.Value, m reflect.Type) (reflect.Value, error) {
+	t := v.Type()
+	if t == m {
+		return v, nil
+	}
+	if m == valueType {
+		b, err := hookOf(t).Marshal(v.Interface())
+		return reflect.ValueOf(Value(b)), err
+	}
+	if m == typedType && t.Kind() == reflect.Interface {
+		return toTyped(v)
+	}
+	mv := reflect.New(m).Elem()
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return mv, nil
+		}
+		elem, err := toMirror(v.Elem(), m.Elem())
+		if err != nil {
+			return mv, err
+		}
+		mv.Set(reflect.New(m.Elem()))
+		mv.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return mv, nil
+			}
+			mv.Set(reflect.MakeSlice(m, v.Len(), v.Len()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem, err := toMirror(v.Index(i), m.Elem())
+			if err != nil {
+				return mv, err
+			}
+			mv.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return mv, nil
+		}
+		mv.Set(reflect.MakeMapWithSize(m, v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := toMirror(iter.Value(), m.Elem())
+			if err != nil {
+				return mv, err
+			}
+			mv.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Struct:
+		j := 0
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			field, err := toMirror(v.Field(i), m.Field(j).Type)
+			if err != nil {
+				return mv, err
+			}
+			mv.Field(j).Set(field)
+			j++
+		}
+	}
+	return mv, nil
+}
+
+// fromMirror sets v, which is settable, from mv, a value of its mirror type.
+func fromMirror(mv, v reflect.Value) error {
+	t := v.Type()
+	if mv.Type() == t {
+		v.Set(mv)
+		return nil
+	}
+	if mv.Type() == valueType {
+		if mv.Len() == 0 {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return hookOf(t).Unmarshal(mv.Bytes(), v.Addr().Interface())
+	}
+	if mv.Type() == typedType && t.Kind() == reflect.Interface {
+		return fromTyped(mv.Interface().(Typed), v)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		if mv.IsNil() {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return fromMirror(mv.Elem(), v.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice {
+			if mv.IsNil() {
+				v.Set(reflect.Zero(t))
+				return nil
+			}
+			v.Set(reflect.MakeSlice(t, mv.Len(), mv.Len()))
+		}
+		for i := 0; i < mv.Len(); i++ {
+			if err := fromMirror(mv.Index(i), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if mv.IsNil() {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		v.Set(reflect.MakeMapWithSize(t, mv.Len()))
+		iter := mv.MapRange()
+		for iter.Next() {
+			elem := reflect.New(t.Elem()).Elem()
+			if err := fromMirror(iter.Value(), elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Struct:
+		j := 0
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			if err := fromMirror(mv.Field(j), v.Field(i)); err != nil {
+				return err
+			}
+			j++
+		}
+	}
+	return nil
+}
+
+// encodable returns the body to encode instead of body.
+func encodable(body interface{}) (interface{}, error) {
+	if body == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(body)
+	m := mirrorOf(v.Type())
+	if m == v.Type() {
+		return body, nil
+	}
+	mv, err := toMirror(v, m)
+	if err != nil {
+		return nil, err
+	}
+	return mv.Interface(), nil
+}
+
+// decode decodes a body into the pointer body, with the decode function of the wrapped codec.
+func decode(body interface{}, decode func(interface{}) error) error {
+	if body == nil {
+		return decode(nil)
+	}
+	v := reflect.ValueOf(body)
+	m := mirrorOf(v.Type())
+	if m == v.Type() || v.Kind() != reflect.Ptr || v.IsNil() {
+		return decode(body)
+	}
+	mv := reflect.New(m.Elem())
+	if err := decode(mv.Interface()); err != nil {
+		return err
+	}
+	return fromMirror(mv.Elem(), v.Elem())
+}
+
+type (
+	serverCodec struct {
+		rpc.ServerCodec
+	}
+	clientCodec struct {
+		rpc.ClientCodec
+	}
+)
+
+// NewServerCodec wraps the server codecs of codecFunc to apply the registered hooks.
+func NewServerCodec(codecFunc func(io.ReadWriteCloser) rpc.ServerCodec) func(io.ReadWriteCloser) rpc.ServerCodec {
+	return func(conn io.ReadWriteCloser) rpc.ServerCodec {
+		return &serverCodec{codecFunc(conn)}
+	}
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	return decode(body, c.ServerCodec.ReadRequestBody)
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	body, err := encodable(body)
+	if err != nil {
+		return err
+	}
+	return c.ServerCodec.WriteResponse(r, body)
+}
+
+// NewClientCodec wraps the client codecs of codecFunc to apply the registered hooks.
+func NewClientCodec(codecFunc func(io.ReadWriteCloser) rpc.ClientCodec) func(io.ReadWriteCloser) rpc.ClientCodec {
+	return func(conn io.ReadWriteCloser) rpc.ClientCodec {
+		return &clientCodec{codecFunc(conn)}
+	}
+}
+
+func (c *clientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	body, err := encodable(body)
+	if err != nil {
+		return err
+	}
+	return c.ClientCodec.WriteRequest(r, body)
+}
+
+func (c *clientCodec) ReadResponseBody(body interface{}) error {
+	return decode(body, c.ClientCodec.ReadResponseBody)
+}
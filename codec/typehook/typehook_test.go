@@ -0,0 +1,175 @@
+package typehook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+
+	msgpackrpc "github.com/hashicorp/net-rpc-msgpackrpc"
+
+	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+)
+
+// Money has no exported field, so no codec can encode it without a hook.
+type Money struct {
+	cents int64
+}
+
+type Order struct {
+	ID     int
+	Total  Money
+	Refund *Money
+	Lines  []Money
+	ByItem map[string]Money
+}
+
+func init() {
+	Register(Money{}, Hook{
+		Marshal: func(v interface{}) ([]byte, error) {
+			m := v.(Money)
+			return []byte(fmt.Sprintf("%d.%02d", m.cents/100, m.cents%100)), nil
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			var units, cents int64
+			if _, err := fmt.Sscanf(string(data), "%d.%d", &units, &cents); err != nil {
+				return err
+			}
+			v.(*Money).cents = units*100 + cents
+			return nil
+		},
+	})
+}
+
+func roundTrip(t *testing.T, newServerCodec func(io.ReadWriteCloser) rpc.ServerCodec, newClientCodec func(io.ReadWriteCloser) rpc.ClientCodec, args, reply interface{}) {
+	c, s := net.Pipe()
+	client := NewClientCodec(newClientCodec)(c)
+	server := NewServerCodec(newServerCodec)(s)
+	defer client.Close()
+	defer server.Close()
+
+	go client.WriteRequest(&rpc.Request{ServiceMethod: "Order.Echo", Seq: 1}, args)
+	var req rpc.Request
+	if err := server.ReadRequestHeader(&req); err != nil {
+		t.Fatal(err)
+	}
+	decoded := reflect.New(reflect.TypeOf(args).Elem())
+	if err := server.ReadRequestBody(decoded.Interface()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Interface(), args) {
+		t.Fatalf("server decoded %+v, expect %+v", decoded.Elem().Interface(), reflect.ValueOf(args).Elem().Interface())
+	}
+
+	go server.WriteResponse(&rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}, decoded.Interface())
+	var resp rpc.Response
+	if err := client.ReadResponseHeader(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReadResponseBody(reply); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reply, args) {
+		t.Fatalf("client decoded %+v, expect %+v", reflect.ValueOf(reply).Elem().Interface(), reflect.ValueOf(args).Elem().Interface())
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	order := &Order{
+		ID:     7,
+		Total:  Money{1234},
+		Refund: &Money{99},
+		Lines:  []Money{{1000}, {234}},
+		ByItem: map[string]Money{"book": {1000}},
+	}
+	t.Run("gob", func(t *testing.T) {
+		roundTrip(t, codecGob.NewGobServerCodec, codecGob.NewGobClientCodec, order, new(Order))
+	})
+	t.Run("json", func(t *testing.T) {
+		roundTrip(t, jsonrpc.NewJSONRPCServerCodec, jsonrpc.NewJSONRPCClientCodec, order, new(Order))
+	})
+	t.Run("msgpack", func(t *testing.T) {
+		roundTrip(t, msgpackrpc.NewServerCodec, msgpackrpc.NewClientCodec, order, new(Order))
+	})
+	t.Run("top-level", func(t *testing.T) {
+		roundTrip(t, jsonrpc.NewJSONRPCServerCodec, jsonrpc.NewJSONRPCClientCodec, &Money{5}, new(Money))
+	})
+}
+
+func TestJSONString(t *testing.T) {
+	body, err := encodable(&Order{Total: Money{1234}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"Total":"12.34"`) {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+}
+
+type (
+	Shape interface {
+		Area() float64
+	}
+	Circle struct {
+		R float64
+	}
+	Rect struct {
+		W, H  float64
+		Price Money
+	}
+	Drawing struct {
+		Name   string
+		Main   Shape
+		Shapes []Shape
+		None   Shape
+	}
+)
+
+func (c Circle) Area() float64 { return 3 * c.R * c.R }
+
+func (r *Rect) Area() float64 { return r.W * r.H }
+
+func init() {
+	RegisterName("circle", Circle{})
+	RegisterName("rect", &Rect{})
+}
+
+func TestInterfaces(t *testing.T) {
+	drawing := &Drawing{
+		Name:   "d",
+		Main:   Circle{R: 2},
+		Shapes: []Shape{&Rect{W: 2, H: 3, Price: Money{150}}, Circle{R: 1}},
+	}
+	t.Run("gob", func(t *testing.T) {
+		roundTrip(t, codecGob.NewGobServerCodec, codecGob.NewGobClientCodec, drawing, new(Drawing))
+	})
+	t.Run("json", func(t *testing.T) {
+		roundTrip(t, jsonrpc.NewJSONRPCServerCodec, jsonrpc.NewJSONRPCClientCodec, drawing, new(Drawing))
+	})
+	t.Run("msgpack", func(t *testing.T) {
+		roundTrip(t, msgpackrpc.NewServerCodec, msgpackrpc.NewClientCodec, drawing, new(Drawing))
+	})
+
+	body, err := encodable(drawing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(body)
+	if !strings.Contains(string(b), `"Main":{"Type":"circle","Value":{"R":2}}`) {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+
+	type unregistered struct{ Shape }
+	if _, err = encodable(&Drawing{Main: &unregistered{}}); err == nil {
+		t.Fatal("expect an error for an unregistered type")
+	}
+}
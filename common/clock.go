@@ -0,0 +1,56 @@
+package common
+
+import "time"
+
+// Clock is the source of the time of the timeouts, retries and backoffs, see client.Client.Clock and server.Server.Clock,
+// so that the tests advance a virtual time instead of sleeping, e.g. with sim.Sim.
+// The deadlines of the connections are enforced by the network, in real time, whatever the Clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a Timer sending the current time on its channel after d.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc calls f in its own goroutine after d, the channel of the Timer returned is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event of a Clock, as time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, it returns false if it has already fired or been stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// Sleep pauses the current goroutine for d on clock.
+func Sleep(clock Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-clock.NewTimer(d).C()
+}
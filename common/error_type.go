@@ -1,9 +1,19 @@
 package common
 
+import (
+	"errors"
+)
+
 // RPCError call error
 type RPCError struct {
-	Type  ErrorType
+	Type ErrorType
+	// Code is the application code of a service error, see NewCodeError.
+	Code  int
 	Error string
+	// Details holds the optional values describing a service error, see NewCodeError.
+	Details map[string]string
+	// Causes holds the sub-errors, e.g. the failures of each invoker in Broadcast mode.
+	Causes []error
 }
 
 // NewRPCError creates rpc error.
@@ -14,6 +24,47 @@ func NewRPCError(errorType ErrorType, errMsg string) *RPCError {
 	}
 }
 
+// NewCodeError returns an error for a service method to return, which the client receives
+// as an RPCError of type ErrorTypeServerService with code, msg and details, see ErrorMessage.
+func NewCodeError(code int, msg string, details map[string]string) error {
+	return (&RPCError{
+		Type:    ErrorTypeServerService,
+		Code:    code,
+		Error:   msg,
+		Details: details,
+	}).Err()
+}
+
+// Err returns the RPCError as an error value, or nil if e is nil.
+// The returned error unwraps to Causes, so errors.Is and errors.As can inspect them.
+func (e *RPCError) Err() error {
+	if e == nil {
+		return nil
+	}
+	return &rpcErrorValue{rpcErr: e}
+}
+
+// AsRPCError finds the first RPCError in err's chain.
+func AsRPCError(err error) (*RPCError, bool) {
+	var v *rpcErrorValue
+	if errors.As(err, &v) {
+		return v.rpcErr, true
+	}
+	return nil, false
+}
+
+type rpcErrorValue struct {
+	rpcErr *RPCError
+}
+
+func (v *rpcErrorValue) Error() string {
+	return v.rpcErr.Error
+}
+
+func (v *rpcErrorValue) Unwrap() []error {
+	return v.rpcErr.Causes
+}
+
 // ErrorType error type
 type ErrorType int8
 
@@ -35,6 +86,16 @@ const (
 	ErrorTypeClientPreReadResponseBody
 	ErrorTypeClientReadResponseBody
 	ErrorTypeClientPostReadResponseBody
+	// ErrorTypeClientCanceled means the context of the call is done, its error is the cause.
+	ErrorTypeClientCanceled
+	// ErrorTypeClientCircuitOpen means the call is rejected because the circuit of the server is open, see client.Breaker.
+	ErrorTypeClientCircuitOpen
+	// ErrorTypeClientConnectionLost means the connection to the server is lost while the call is pending,
+	// e.g. it is closed by the server or the reader of the responses panics, the error of the reader is a cause.
+	ErrorTypeClientConnectionLost
+	// ErrorTypeClientMessageTooLarge means the response exceeds client.Client.MaxResponseBodySize,
+	// the connection is closed.
+	ErrorTypeClientMessageTooLarge
 )
 
 // RPC Server error type codes.
@@ -51,6 +112,13 @@ const (
 	ErrorTypeServerService
 	ErrorTypeServerPreWriteResponse
 	ErrorTypeServerWriteResponse
+	// ErrorTypeServerMemoryLimit means the request exceeds the memory budget of the server, see server.Server.MaxRequestMemory.
+	ErrorTypeServerMemoryLimit
+	// ErrorTypeServerOverloaded means the request is shed because the server is overloaded, see server.Watchdog.
+	ErrorTypeServerOverloaded
+	// ErrorTypeServerMessageTooLarge means the request exceeds server.Server.MaxRequestBodySize,
+	// the connection is closed once the error is replied.
+	ErrorTypeServerMessageTooLarge
 )
 
 // ErrShutdown returns an error with message: 'connection is shut down'
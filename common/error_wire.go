@@ -0,0 +1,60 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// structuredErrorMark starts the message of a response error carrying a code or details,
+// a plain message never starts with it.
+const structuredErrorMark = "\x00"
+
+// structuredError is the JSON of a response error carrying a code or details, following structuredErrorMark.
+type structuredError struct {
+	Code    int               `json:"code,omitempty"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// ErrorMessage returns the structured message of err sent in a response error, after the byte of its type.
+// It is err.Error(), unless err holds an RPCError with a Code or Details, see NewCodeError,
+// in which case it is structuredErrorMark followed by the JSON {"code":1,"message":"...","details":{...}},
+// the message being err.Error(), e.g. with the name of the plugin returning it.
+// The older clients, which do not parse it, show a NUL byte followed by the JSON.
+func ErrorMessage(err error) string {
+	rpcErr, ok := AsRPCError(err)
+	if !ok || (rpcErr.Code == 0 && len(rpcErr.Details) == 0) {
+		return err.Error()
+	}
+	b, e := json.Marshal(&structuredError{
+		Code:    rpcErr.Code,
+		Message: err.Error(),
+		Details: rpcErr.Details,
+	})
+	if e != nil {
+		return err.Error()
+	}
+	return structuredErrorMark + string(b)
+}
+
+// EncodeErrorType encodes t as the first byte of a response error, see ParseResponseError.
+func EncodeErrorType(t ErrorType) string {
+	return string([]byte{byte(t)})
+}
+
+// ParseResponseError decodes a response error sent by the server:
+// the byte of its type followed by the message, see ErrorMessage.
+func ParseResponseError(errMsg string) *RPCError {
+	if errMsg == "" {
+		return NewRPCError(ErrorTypeUnknown, "")
+	}
+	rpcErr := NewRPCError(ErrorType(errMsg[0]), errMsg[1:])
+	if len(rpcErr.Error) == 0 || rpcErr.Error[:1] != structuredErrorMark {
+		return rpcErr
+	}
+	var s structuredError
+	if json.Unmarshal([]byte(rpcErr.Error[1:]), &s) != nil {
+		return rpcErr
+	}
+	rpcErr.Code, rpcErr.Error, rpcErr.Details = s.Code, s.Message, s.Details
+	return rpcErr
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"fmt"
 	"runtime"
+	"strings"
 )
 
 var (
@@ -18,6 +19,8 @@ var (
 	ErrPluginAlreadyExists = NewError("Cannot use the same plugin again, '%s' is already exists")
 	// ErrPluginActivate returns an error with message: 'While trying to activate plugin '+plugin name'. Trace: +specific error'
 	ErrPluginActivate = NewError("While trying to activate plugin '%s'. Trace: %s")
+	// ErrPluginPanic returns an error with message: 'The plugin '+plugin name' panicked in +hook: +panic'
+	ErrPluginPanic = NewError("The plugin '%s' panicked in %s: %s")
 	// ErrPluginRemoveNoPlugins returns an error with message: 'No plugins are registed yet, you cannot remove a plugin from an empty list!'
 	ErrPluginRemoveNoPlugins = NewError("No plugins are registed yet, you cannot remove a plugin from an empty list!")
 	// ErrPluginRemoveEmptyName returns an error with message: 'Plugin with an empty name cannot be removed'
@@ -26,17 +29,31 @@ var (
 	ErrPluginRemoveNotFound = NewError("Cannot remove a plugin which doesn't exists")
 	// ErrInvalidPath  returns an error with message: 'The service name '+name' invalid, need to meet '/^[a-zA-Z0-9_\.\-/]*$/'
 	ErrInvalidPath = NewError("The service name '%s' invalid, need to meet '/^[a-zA-Z0-9_\\.\\-/]*$/'")
+	// ErrInvalidName returns an error with message: 'The service name '+name' invalid, need to match '+pattern''
+	ErrInvalidName = NewError("The service name '%s' invalid, need to match '%s'")
 	// ErrServiceAlreadyExists returns an error with message: 'Cannot activate the same service again, '+service name' is already exists'
 	ErrServiceAlreadyExists = NewError("Cannot use the same service again, '%s' is already exists")
+	// ErrReservedPath returns an error with message: 'The service path '+path' is reserved for the built-in services'
+	ErrReservedPath = NewError("The service path '%s' is reserved for the built-in services")
+	// ErrArgTypeRejected returns an error with message: 'The argument type '+type' is rejected: +errMsg'
+	ErrArgTypeRejected = NewError("The argument type '%s' is rejected: %s")
+	// ErrMessageTooLarge returns an error with message: 'The message exceeds the maximum size of +size bytes'
+	ErrMessageTooLarge = NewError("The message exceeds the maximum size of %s bytes")
 
 	// RegisterPlugin returns an error with message: 'RegisterPlugin(+plugin name): +errMsg'
 	ErrRegisterPlugin = NewError("RegisterPlugin(%s): %s")
+	// RegisterServicePlugin returns an error with message: 'RegisterService(+plugin name): +errMsg'
+	ErrRegisterServicePlugin = NewError("RegisterService(%s): %s")
 	// PostConnAccept returns an error with message: 'PostConnAccept(+plugin name): +errMsg'
 	ErrPostConnAccept = NewError("PostConnAccept(%s): %s")
+	// PostDisconnect returns an error with message: 'PostDisconnect(+plugin name): +errMsg'
+	ErrPostDisconnect = NewError("PostDisconnect(%s): %s")
 	// ErrPreReadRequestHeader returns an error with message: 'PreReadRequestHeader(+plugin name): +errMsg'
 	ErrPreReadRequestHeader = NewError("PreReadRequestHeader(%s): %s")
 	// ErrPostReadRequestHeader returns an error with message: 'PostReadRequestHeader(+plugin name): +errMsg'
 	ErrPostReadRequestHeader = NewError("PostReadRequestHeader(%s): %s")
+	// ErrRouteRequest returns an error with message: 'RouteRequest(+plugin name): +errMsg'
+	ErrRouteRequest = NewError("RouteRequest(%s): %s")
 	// ErrPreReadRequestBody returns an error with message: 'PreReadRequestBody(+plugin name): +errMsg'
 	ErrPreReadRequestBody = NewError("PreReadRequestBody(%s): %s")
 	// ErrPostReadRequestBody returns an error with message: 'PostReadRequestBody(+plugin name): +errMsg'
@@ -56,10 +73,27 @@ var (
 	ErrPreReadResponseBody = NewError("PreReadResponseBody(%s): %s")
 	// ErrPostReadResponseBody returns an error with message: 'PostReadResponseBody(+plugin name): +errMsg'
 	ErrPostReadResponseBody = NewError("PostReadResponseBody(%s): %s")
+	// ErrRewriteRequest returns an error with message: 'RewriteRequest(+plugin name): +errMsg'
+	ErrRewriteRequest = NewError("RewriteRequest(%s): %s")
 	// ErrPreWriteRequest returns an error with message: 'PreWriteRequest(+plugin name): +errMsg'
 	ErrPreWriteRequest = NewError("PreWriteRequest(%s): %s")
 	// ErrPostWriteRequest returns an error with message: 'PostWriteRequest(+plugin name): +errMsg'
 	ErrPostWriteRequest = NewError("PostWriteRequest(%s): %s")
+
+	// ErrQueueFull returns an error with message: 'The request queue is full'
+	ErrQueueFull = NewError("The request queue is full")
+	// ErrQueueTimeout returns an error with message: 'Timeout waiting in the request queue: +errMsg'
+	ErrQueueTimeout = NewError("Timeout waiting in the request queue: %s")
+	// ErrQueueDropped returns an error with message: 'Dropped from the request queue by a newer request'
+	ErrQueueDropped = NewError("Dropped from the request queue by a newer request")
+	// ErrClientClosed returns an error with message: 'The client is closed'
+	ErrClientClosed = NewError("The client is closed")
+	// ErrCircuitOpen returns an error with message: 'The circuit of the server '+address' is open'
+	ErrCircuitOpen = NewError("The circuit of the server '%s' is open")
+	// ErrConnectionLost returns an error with message: 'The connection to the server '+address' is lost: +errMsg'
+	ErrConnectionLost = NewError("The connection to the server '%s' is lost: %s")
+	// ErrConnClosed returns an error with message: 'The connection is closed'
+	ErrConnClosed = NewError("The connection is closed")
 )
 
 // Error holds the error
@@ -77,9 +111,36 @@ func (e *Error) Error() string {
 	return e.message
 }
 
-// Format returns a formatted new error based on the arguments
+// Format returns a formatted new error based on the arguments.
+// The new error unwraps to e and to the arguments of type error,
+// so errors.Is(err, e) reports true.
 func (e *Error) Format(args ...interface{}) error {
-	return fmt.Errorf(e.message, args...)
+	errs := []error{e}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	return &formatError{
+		message: fmt.Sprintf(e.message, args...),
+		errs:    errs,
+	}
+}
+
+// formatError is a formatted Error
+type formatError struct {
+	message string
+	errs    []error
+}
+
+// Error returns the formatted message
+func (e *formatError) Error() string {
+	return e.message
+}
+
+// Unwrap returns the original Error and the error arguments
+func (e *formatError) Unwrap() []error {
+	return e.errs
 }
 
 // Append appends a error message
@@ -141,7 +202,53 @@ func (e *MultiError) Error() string {
 	// return fmt.Sprintf("%v", e.errors)
 }
 
+// Errors returns the errors held
+func (e *MultiError) Errors() []error {
+	return e.errors
+}
+
+// Unwrap returns the errors held, so errors.Is and errors.As can match any of them
+func (e *MultiError) Unwrap() []error {
+	return e.errors
+}
+
 // NewMultiError creates and returns an Error with error splice
 func NewMultiError(errors []error) *MultiError {
 	return &MultiError{errors: errors}
 }
+
+// RegisterError is an error of the registration of a service or of a group, with where it failed.
+type RegisterError struct {
+	// Groups are the prefixes of the nested groups, the outermost first.
+	Groups []string
+	// Service is the name of the service, empty for an error of a group.
+	Service string
+	// Path is the service path failing, or empty.
+	Path string
+	// Plugin is the name of the plugin that rejected the service, named by Err too, or empty.
+	Plugin string
+	Err    error
+}
+
+// Error returns the message of Err prefixed with the groups, the service and the path
+func (e *RegisterError) Error() string {
+	var where []string
+	if len(e.Groups) > 0 {
+		where = append(where, "group '"+strings.Join(e.Groups, "/")+"'")
+	}
+	if e.Service != "" {
+		where = append(where, "service '"+e.Service+"'")
+	}
+	if e.Path != "" {
+		where = append(where, "path '"+e.Path+"'")
+	}
+	if len(where) == 0 {
+		return e.Err.Error()
+	}
+	return strings.Join(where, ", ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns Err
+func (e *RegisterError) Unwrap() error {
+	return e.Err
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -12,3 +13,78 @@ func TestMultiError(t *testing.T) {
 	})
 	fmt.Println(mult)
 }
+
+func TestMultiErrorIs(t *testing.T) {
+	mult := NewMultiError([]error{
+		ErrServiceAlreadyExists.Format("/a/b"),
+		ErrRegisterPlugin.Format("p", ErrAccessDenied),
+	})
+	if !errors.Is(mult, ErrServiceAlreadyExists) {
+		t.Fatal("expect errors.Is(mult, ErrServiceAlreadyExists) to be true")
+	}
+	if !errors.Is(mult, ErrAccessDenied) {
+		t.Fatal("expect errors.Is(mult, ErrAccessDenied) to be true")
+	}
+	if errors.Is(mult, ErrShutdown) {
+		t.Fatal("expect errors.Is(mult, ErrShutdown) to be false")
+	}
+	var e *Error
+	if !errors.As(mult, &e) || e != ErrServiceAlreadyExists {
+		t.Fatal("expect errors.As(mult, *Error) to find ErrServiceAlreadyExists")
+	}
+}
+
+func TestRPCErrorCauses(t *testing.T) {
+	rpcErr := &RPCError{
+		Type:   ErrorTypeUnknown,
+		Error:  "some invokers return Error",
+		Causes: []error{ErrShutdown},
+	}
+	err := rpcErr.Err()
+	if !errors.Is(err, ErrShutdown) {
+		t.Fatal("expect errors.Is(err, ErrShutdown) to be true")
+	}
+	if e, ok := AsRPCError(err); !ok || e != rpcErr {
+		t.Fatal("expect AsRPCError to return the RPCError")
+	}
+}
+
+func TestResponseErrorCode(t *testing.T) {
+	details := map[string]string{"sku": "a1"}
+	errMsg := EncodeErrorType(ErrorTypeServerService) + ErrorMessage(NewCodeError(42, "out of stock", details))
+	rpcErr := ParseResponseError(errMsg)
+	if rpcErr.Type != ErrorTypeServerService || rpcErr.Code != 42 || rpcErr.Error != "out of stock" || rpcErr.Details["sku"] != "a1" {
+		t.Fatalf("unexpected RPCError: %+v", rpcErr)
+	}
+
+	errMsg = EncodeErrorType(ErrorTypeServerService) + ErrorMessage(errors.New("boom"))
+	rpcErr = ParseResponseError(errMsg)
+	if rpcErr.Type != ErrorTypeServerService || rpcErr.Code != 0 || rpcErr.Error != "boom" || rpcErr.Details != nil {
+		t.Fatalf("unexpected RPCError: %+v", rpcErr)
+	}
+}
+
+func TestRegisterError(t *testing.T) {
+	err := &RegisterError{
+		Groups:  []string{"v1", "admin"},
+		Service: "Arith",
+		Path:    "/v1/admin/arith/mul",
+		Plugin:  "auth",
+		Err:     ErrRegisterPlugin.Format("auth", ErrAccessDenied),
+	}
+	expected := "group 'v1/admin', service 'Arith', path '/v1/admin/arith/mul': RegisterPlugin(auth): Access denied!"
+	if err.Error() != expected {
+		t.Fatalf("expect %q, got %q", expected, err.Error())
+	}
+	mult := NewMultiError([]error{err})
+	if !errors.Is(mult, ErrAccessDenied) {
+		t.Fatal("expect errors.Is(mult, ErrAccessDenied) to be true")
+	}
+	var e *RegisterError
+	if !errors.As(mult, &e) || e.Plugin != "auth" {
+		t.Fatal("expect errors.As(mult, *RegisterError) to find the error of the plugin")
+	}
+	if err := (&RegisterError{Err: ErrShutdown}); err.Error() != ErrShutdown.Error() {
+		t.Fatalf("expect %q, got %q", ErrShutdown.Error(), err.Error())
+	}
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"net"
+	"strconv"
+)
+
+// LimitedConn is a net.Conn whose reads fail with ErrMessageTooLarge beyond a budget, set for each message,
+// so that a peer announcing a huge length in a message does not make the codec allocate it, the codecs reading
+// in chunks what they are sent, e.g. gob.
+// The codecs buffer their reads, so the bytes read ahead are counted for the message being read.
+// It is not safe for concurrent reads.
+type LimitedConn struct {
+	net.Conn
+	max       int64
+	remaining int64
+	exceeded  bool
+}
+
+// NewLimitedConn returns conn, whose reads are not limited until Limit.
+func NewLimitedConn(conn net.Conn) *LimitedConn {
+	return &LimitedConn{Conn: conn}
+}
+
+// Limit sets the budget of the next reads to max bytes, before a message is read.
+// If max is 0, the reads are not limited.
+func (c *LimitedConn) Limit(max int64) {
+	c.max = max
+	c.remaining = max
+	c.exceeded = false
+}
+
+// Exceeded reports whether a read failed since Limit, the budget being spent.
+func (c *LimitedConn) Exceeded() bool {
+	return c.exceeded
+}
+
+// Read reads up to the budget left, it fails with ErrMessageTooLarge once it is spent.
+func (c *LimitedConn) Read(b []byte) (int, error) {
+	if c.max <= 0 {
+		return c.Conn.Read(b)
+	}
+	if c.remaining <= 0 {
+		c.exceeded = true
+		return 0, ErrMessageTooLarge.Format(strconv.FormatInt(c.max, 10))
+	}
+	if int64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.Conn.Read(b)
+	c.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"context"
+	"net/url"
+)
+
+// metadataKey is the key of the metadata in a context.Context.
+type metadataKey struct{}
+
+// WithMetadata returns a copy of ctx carrying the metadata key=value, in addition to the metadata of ctx.
+// The client calls made with the context forward its metadata to the server, in the query of the service method,
+// e.g. a transaction ID, see client.Client.CallContext.
+func WithMetadata(ctx context.Context, key, value string) context.Context {
+	md := make(url.Values)
+	for k, v := range MetadataFromContext(ctx) {
+		md[k] = v
+	}
+	md.Set(key, value)
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext returns the metadata of ctx, which must not be modified, or nil if there is none.
+func MetadataFromContext(ctx context.Context) url.Values {
+	md, _ := ctx.Value(metadataKey{}).(url.Values)
+	return md
+}
+
+// AddQuery adds query to the query of serviceMethod, in URL format, overriding its keys.
+func AddQuery(serviceMethod string, query url.Values) string {
+	if len(query) == 0 {
+		return serviceMethod
+	}
+	u, err := url.Parse(serviceMethod)
+	if err != nil {
+		return serviceMethod
+	}
+	q := u.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
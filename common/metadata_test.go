@@ -0,0 +1,29 @@
+package common
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	ctx := WithMetadata(context.Background(), "xid", "1")
+	ctx2 := WithMetadata(ctx, "tenant", "a")
+	if md := MetadataFromContext(ctx); len(md) != 1 || md.Get("xid") != "1" {
+		t.Fatalf("unexpected metadata: %v", md)
+	}
+	if md := MetadataFromContext(ctx2); len(md) != 2 || md.Get("xid") != "1" || md.Get("tenant") != "a" {
+		t.Fatalf("unexpected metadata: %v", md)
+	}
+
+	for serviceMethod, expect := range map[string]string{
+		"/arith/mul":          "/arith/mul?tenant=a&xid=1",
+		"/arith/mul?xid=0&x=": "/arith/mul?tenant=a&x=&xid=1",
+	} {
+		if got := AddQuery(serviceMethod, MetadataFromContext(ctx2)); got != expect {
+			t.Errorf("AddQuery(%q) = %q, expect %q", serviceMethod, got, expect)
+		}
+	}
+	if got := AddQuery("/arith/mul", nil); got != "/arith/mul" {
+		t.Errorf("unexpected AddQuery without query: %q", got)
+	}
+}
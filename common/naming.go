@@ -0,0 +1,89 @@
+package common
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// NamingStrategy decides the names of the services and how they map to the segments of the service paths.
+type NamingStrategy interface {
+	// ObjectName returns the name of the service of the receiver rcvr registered without a name.
+	ObjectName(rcvr interface{}) string
+	// Segment returns the path segment of the name of a service, a group or a method, e.g. "arith_v2" for "ArithV2".
+	Segment(name string) string
+	// CheckSname returns an error if sname is not a valid name of a service or a group.
+	CheckSname(sname string) error
+}
+
+// DefaultNaming is the naming of the servers that set none, the zero Naming.
+var DefaultNaming NamingStrategy = Naming{}
+
+// Naming is a NamingStrategy configured by its fields, the zero value names the receivers after their type,
+// maps the names to snake case and accepts the ASCII letters and digits, '_', '.' and '-'.
+type Naming struct {
+	// Case maps the names to the path segments, e.g. KebabString or strings.ToLower.
+	// If it is nil, SnakeString is used.
+	Case func(name string) string
+	// PackagePrefix prefixes the names of the receivers with the name of their package, e.g. "codec.Arith",
+	// so that the types of the same name in several packages are told apart.
+	// The parts of the names between dots are then mapped one by one, e.g. "codec.arith".
+	PackagePrefix bool
+	// Pattern matches the valid names, e.g. `^[\p{L}\p{N}_\.\-]*$` to accept the letters and digits of any script,
+	// or a stricter one. If it is nil, `^[a-zA-Z0-9_\.\-]*$` is used.
+	Pattern *regexp.Regexp
+}
+
+var _ NamingStrategy = Naming{}
+
+// ObjectName returns the name of the type of rcvr, or of the function rcvr.
+func (n Naming) ObjectName(rcvr interface{}) string {
+	v := reflect.ValueOf(rcvr)
+	if v.Type().Kind() == reflect.Func {
+		// the name of a function already holds its package path.
+		return runtime.FuncForPC(v.Pointer()).Name()
+	}
+	t := reflect.Indirect(v).Type()
+	if n.PackagePrefix {
+		if pkg := t.PkgPath(); pkg != "" {
+			return pkg[strings.LastIndexByte(pkg, '/')+1:] + "." + t.Name()
+		}
+	}
+	return t.Name()
+}
+
+// Segment maps name with Case.
+func (n Naming) Segment(name string) string {
+	mapCase := n.Case
+	if mapCase == nil {
+		mapCase = SnakeString
+	}
+	if !n.PackagePrefix {
+		return mapCase(name)
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = mapCase(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// CheckSname returns ErrInvalidPath, or ErrInvalidName with a Pattern, if sname does not match the pattern.
+func (n Naming) CheckSname(sname string) error {
+	if n.Pattern == nil {
+		if !nameRegexp.MatchString(sname) {
+			return ErrInvalidPath.Format(sname)
+		}
+		return nil
+	}
+	if !n.Pattern.MatchString(sname) {
+		return ErrInvalidName.Format(sname, n.Pattern.String())
+	}
+	return nil
+}
+
+// KebabString converts the accepted string to a kebab string (XxYy to xx-yy)
+func KebabString(s string) string {
+	return separateWords(s, '-')
+}
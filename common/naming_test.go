@@ -0,0 +1,51 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+type ArithV2 struct{}
+
+func TestNaming(t *testing.T) {
+	var n Naming
+	if name := n.ObjectName(new(ArithV2)); name != "ArithV2" {
+		t.Fatalf("unexpected name %s", name)
+	}
+	if s := n.Segment("ArithV2"); s != "arith_v2" {
+		t.Fatalf("unexpected segment %s", s)
+	}
+	if err := n.CheckSname("arith.v2-beta_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.CheckSname("算术"); err == nil {
+		t.Fatal("expect an error")
+	}
+
+	n = Naming{
+		Case:          KebabString,
+		PackagePrefix: true,
+		Pattern:       regexp.MustCompile(`^[\p{L}\p{N}_\.\-]*$`),
+	}
+	if name := n.ObjectName(ArithV2{}); name != "common.ArithV2" {
+		t.Fatalf("unexpected name %s", name)
+	}
+	if name := n.ObjectName(log.Infof); !strings.HasSuffix(name, "/log.Infof") {
+		t.Fatalf("unexpected name %s", name)
+	}
+	if s := n.Segment("common.ArithV2"); s != "common.arith-v2" {
+		t.Fatalf("unexpected segment %s", s)
+	}
+	if s := n.Segment("_"); s != "_" {
+		t.Fatalf("unexpected segment %s", s)
+	}
+	if err := n.CheckSname("算术"); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.CheckSname("a/b"); err == nil || !strings.Contains(err.Error(), n.Pattern.String()) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
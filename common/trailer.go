@@ -0,0 +1,28 @@
+package common
+
+import (
+	"net/url"
+	"strings"
+)
+
+// TrailerSeparator separates the service method of a response header from its trailer,
+// the URL-encoded metadata computed after the reply, e.g. "/arith/mul#elapsed=3ms".
+const TrailerSeparator = "#"
+
+// JoinTrailer appends the trailer to the service method of a response header.
+func JoinTrailer(serviceMethod string, trailer url.Values) string {
+	if len(trailer) == 0 {
+		return serviceMethod
+	}
+	return serviceMethod + TrailerSeparator + trailer.Encode()
+}
+
+// SplitTrailer splits the service method of a response header from its trailer, which is nil if there is none.
+func SplitTrailer(serviceMethod string) (string, url.Values) {
+	i := strings.Index(serviceMethod, TrailerSeparator)
+	if i < 0 {
+		return serviceMethod, nil
+	}
+	trailer, _ := url.ParseQuery(serviceMethod[i+len(TrailerSeparator):])
+	return serviceMethod[:i], trailer
+}
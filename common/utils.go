@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"net"
 	"net/http"
-	"reflect"
 	"regexp"
 	"runtime"
 	"strings"
@@ -13,6 +12,14 @@ import (
 // Connected can connect to RPC service using HTTP CONNECT to rpcPath.
 const Connected = "200 Connected to Go RPC"
 
+// CancelServiceMethod is the service method of the request a client sends to cancel its call of the same Seq,
+// once the context of the call is done. The body of the request is empty, and the server does not respond.
+const CancelServiceMethod = "/.cancel"
+
+// RequestIDKey is the query key of the ID a client gives to the copies of a request, e.g. the hedged requests
+// of client.Failbackup, so that a server executes them once, see server.Server.DedupWindow.
+const RequestIDKey = "_rid"
+
 func RealRemoteAddr(req *http.Request) string {
 	var ip string
 	if ip = req.Header.Get("X-Real-IP"); len(ip) == 0 {
@@ -25,15 +32,20 @@ func RealRemoteAddr(req *http.Request) string {
 
 // SnakeString converts the accepted string to a snake string (XxYy to xx_yy)
 func SnakeString(s string) string {
+	return separateWords(s, '_')
+}
+
+// separateWords converts the accepted string to lower case, with sep before the upper case letters starting a word.
+func separateWords(s string, sep byte) string {
 	data := make([]byte, 0, len(s)*2)
 	j := false
 	num := len(s)
 	for i := 0; i < num; i++ {
 		d := s[i]
 		if i > 0 && d >= 'A' && d <= 'Z' && j {
-			data = append(data, '_')
+			data = append(data, sep)
 		}
-		if d != '_' {
+		if d != sep {
 			j = true
 		}
 		data = append(data, d)
@@ -66,22 +78,16 @@ func CamelString(s string) string {
 	return string(data[:])
 }
 
-// ObjectName gets the type name of the object
+// ObjectName gets the type name of the object, with DefaultNaming
 func ObjectName(i interface{}) string {
-	v := reflect.ValueOf(i)
-	if v.Type().Kind() == reflect.Func {
-		return runtime.FuncForPC(v.Pointer()).Name()
-	}
-	return reflect.Indirect(v).Type().Name()
+	return DefaultNaming.ObjectName(i)
 }
 
 var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_\.\-]*$`)
 
+// CheckSname checks the service name, with DefaultNaming
 func CheckSname(sname string) error {
-	if !nameRegexp.MatchString(sname) {
-		return ErrInvalidPath.Format(sname)
-	}
-	return nil
+	return DefaultNaming.CheckSname(sname)
 }
 
 // PanicTrace trace panic stack info.
@@ -0,0 +1,100 @@
+package conformance
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec/bson"
+	"github.com/henrylee2cn/myrpc/codec/colfer"
+	"github.com/henrylee2cn/myrpc/codec/gencode"
+	"github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/codec/jsonline"
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+	"github.com/henrylee2cn/myrpc/codec/protobuf"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+var closeCodecs = []struct {
+	name   string
+	server server.ServerCodecFunc
+	client client.ClientCodecFunc
+	// body is a reply the codec encodes without reading a request first, nil if it needs a generated type
+	// or the request, e.g. json replies the id of the request.
+	body interface{}
+}{
+	{"gob", gob.NewGobServerCodec, gob.NewGobClientCodec, "hello"},
+	{"json", jsonrpc.NewJSONRPCServerCodec, jsonrpc.NewJSONRPCClientCodec, nil},
+	{"jsonline", jsonline.NewJSONLineServerCodec, jsonline.NewJSONLineClientCodec, "hello"},
+	{"bson", bson.NewBsonServerCodec, bson.NewBsonClientCodec, "hello"},
+	{"gencode", gencode.NewGencodeServerCodec, gencode.NewGencodeClientCodec, nil},
+	{"colfer", colfer.NewServerCodec, colfer.NewClientCodec, nil},
+	{"protobuf", protobuf.NewProtobufServerCodec, protobuf.NewProtobufClientCodec, nil},
+}
+
+// readAll reads what the peer writes until it closes the connection.
+func readAll(conn net.Conn) <-chan []byte {
+	c := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(conn)
+		c <- b
+	}()
+	return c
+}
+
+func TestServerCodecConnClose(t *testing.T) {
+	for _, codec := range closeCodecs {
+		c1, c2 := net.Pipe()
+		read := readAll(c2)
+		conn := server.NewServerCodecConn(c1)
+		conn.SetServerCodec(codec.server)
+		if codec.body != nil {
+			// the held response is flushed before the connection is closed.
+			conn.Cork()
+			if err := conn.WriteResponse(&rpc.Response{ServiceMethod: EchoPath, Seq: 1}, codec.body); err != nil {
+				t.Fatalf("%s: WriteResponse: %v", codec.name, err)
+			}
+		}
+		if err := conn.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", codec.name, err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Fatalf("%s: second Close: %v", codec.name, err)
+		}
+		if b := <-read; codec.body != nil && len(b) == 0 {
+			t.Fatalf("%s: the held response is not flushed", codec.name)
+		}
+		if !conn.IsBroken() {
+			t.Fatalf("%s: a closed connection is not broken", codec.name)
+		}
+		err := conn.WriteResponse(&rpc.Response{ServiceMethod: EchoPath, Seq: 2}, codec.body)
+		if !errors.Is(err, common.ErrConnClosed) {
+			t.Fatalf("%s: WriteResponse after Close: %v", codec.name, err)
+		}
+	}
+}
+
+func TestClientCodecConnClose(t *testing.T) {
+	for _, codec := range closeCodecs {
+		c1, c2 := net.Pipe()
+		read := readAll(c2)
+		conn := client.NewClientCodecConn(c1)
+		conn.SetClientCodec(codec.client)
+		if err := conn.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", codec.name, err)
+		}
+		if err := conn.Close(); err != nil {
+			t.Fatalf("%s: second Close: %v", codec.name, err)
+		}
+		// the connection is closed, not only the codec.
+		<-read
+		err := conn.WriteRequest(&rpc.Request{ServiceMethod: EchoPath, Seq: 1}, codec.body)
+		if !errors.Is(err, common.ErrConnClosed) {
+			t.Fatalf("%s: WriteRequest after Close: %v", codec.name, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package conformance specifies the wire behavior of myrpc in code,
+// and provides a reference echo server to validate client implementations in other languages.
+//
+// The wire behavior is:
+//	- Handshake: none over raw TCP/KCP. Over HTTP, the client sends HTTPConnectRequest
+//	  and the server answers HTTPConnectResponse before switching to RPC.
+//	  If the AppointCodecPlugin is used, the client sends one codec byte first.
+//	- Framing and header fields: those of the codec (e.g. net/rpc/jsonrpc for "json"),
+//	  a request header has a ServiceMethod and a Seq, a response header echoes both.
+//	- ServiceMethod: a URI, the path is the snake-cased group/service/method names,
+//	  the query carries optional parameters, e.g. "/echo/echo?key=value".
+//	- Error encoding: a non-empty response Error, whose first byte is the common.ErrorType
+//	  of the server-side failure, followed by the message. The body of such a response is empty.
+//	  If server.Server.StructuredErrors is set, as by the reference server, an error
+//	  carrying a code or details, see common.NewCodeError, has a message made of
+//	  a NUL byte followed by the JSON {"code":1,"message":"...","details":{"key":"value"}}.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+const (
+	// HTTPConnectRequest is the request line sent by a client to switch an HTTP connection to RPC,
+	// %s is the RPC path, rpc.DefaultRPCPath by default.
+	HTTPConnectRequest = "CONNECT %s HTTP/1.0\n\n"
+	// HTTPConnectResponse is the answer of the server to HTTPConnectRequest.
+	HTTPConnectResponse = "HTTP/1.0 " + common.Connected + "\n\n"
+
+	// EchoPath replies the string argument.
+	EchoPath = "/echo/echo"
+	// EchoStructPath replies the EchoArgs argument.
+	EchoStructPath = "/echo/echo_struct"
+	// FailPath fails with the string argument as message.
+	FailPath = "/echo/fail"
+	// FailCodePath fails with the Int, String and Map of the EchoArgs argument as code, message and details.
+	FailCodePath = "/echo/fail_code"
+)
+
+type (
+	// Echo is the service of the reference server.
+	Echo struct{}
+
+	// EchoArgs is the struct argument of EchoStructPath.
+	EchoArgs struct {
+		Int    int
+		String string
+		Bytes  []byte
+		Map    map[string]string
+	}
+)
+
+// Echo replies arg.
+func (*Echo) Echo(arg string, reply *string) error {
+	*reply = arg
+	return nil
+}
+
+// EchoStruct replies arg.
+func (*Echo) EchoStruct(arg *EchoArgs, reply *EchoArgs) error {
+	*reply = *arg
+	return nil
+}
+
+// Fail returns arg as error.
+func (*Echo) Fail(arg string, reply *string) error {
+	return errors.New(arg)
+}
+
+// FailCode returns the code, message and details of arg as error.
+func (*Echo) FailCode(arg *EchoArgs, reply *string) error {
+	return common.NewCodeError(arg.Int, arg.String, arg.Map)
+}
+
+// NewEchoServer returns the reference server with the Echo service registered, sending structured errors.
+func NewEchoServer(codecFunc server.ServerCodecFunc) *server.Server {
+	srv := server.NewServer(server.Server{
+		ServerCodecFunc:  codecFunc,
+		StructuredErrors: true,
+	})
+	srv.Register(new(Echo))
+	return srv
+}
+
+// EncodeError encodes a response error as the server sends it.
+func EncodeError(errorType common.ErrorType, msg string) string {
+	return common.EncodeErrorType(errorType) + msg
+}
+
+// DecodeError decodes a response error sent by the server, see common.ParseResponseError
+// to decode the code and details of a service error too.
+func DecodeError(s string) (common.ErrorType, string, error) {
+	if len(s) == 0 {
+		return 0, "", fmt.Errorf("conformance: empty error")
+	}
+	return common.ErrorType(s[0]), s[1:], nil
+}
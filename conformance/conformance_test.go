@@ -0,0 +1,146 @@
+package conformance
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+func startEchoServer(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewEchoServer(jsonrpc.NewJSONRPCServerCodec)
+	go srv.ServeListener(lis)
+	return lis.Addr().String()
+}
+
+func dial(t *testing.T, addr string) rpc.ClientCodec {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonrpc.NewJSONRPCClientCodec(conn)
+}
+
+func call(t *testing.T, c rpc.ClientCodec, seq uint64, serviceMethod string, args, reply interface{}) *rpc.Response {
+	if err := c.WriteRequest(&rpc.Request{Seq: seq, ServiceMethod: serviceMethod}, args); err != nil {
+		t.Fatal(err)
+	}
+	resp := new(rpc.Response)
+	if err := c.ReadResponseHeader(resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" {
+		// the body of an error response is empty.
+		reply = nil
+	}
+	if err := c.ReadResponseBody(reply); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestEcho(t *testing.T) {
+	c := dial(t, startEchoServer(t))
+	defer c.Close()
+
+	var reply string
+	resp := call(t, c, 7, EchoPath+"?key=value", "hello", &reply)
+	if resp.Error != "" || reply != "hello" || resp.Seq != 7 {
+		t.Fatalf("unexpected response: %+v, reply: %q", resp, reply)
+	}
+
+	args := &EchoArgs{Int: 1, String: "a", Bytes: []byte("b"), Map: map[string]string{"c": "d"}}
+	var structReply EchoArgs
+	resp = call(t, c, 8, EchoStructPath, args, &structReply)
+	if resp.Error != "" || !reflect.DeepEqual(*args, structReply) {
+		t.Fatalf("unexpected response: %+v, reply: %+v", resp, structReply)
+	}
+}
+
+func TestErrorEncoding(t *testing.T) {
+	c := dial(t, startEchoServer(t))
+	defer c.Close()
+
+	var reply string
+	resp := call(t, c, 1, FailPath, "boom", &reply)
+	if resp.Error != EncodeError(common.ErrorTypeServerService, "boom") {
+		t.Fatalf("unexpected error: %q", resp.Error)
+	}
+
+	resp = call(t, c, 2, "/echo/not_found", "x", &reply)
+	errorType, _, err := DecodeError(resp.Error)
+	if err != nil || errorType != common.ErrorTypeServerNotFoundService {
+		t.Fatalf("unexpected error: %q", resp.Error)
+	}
+
+	args := &EchoArgs{Int: 42, String: "out of stock", Map: map[string]string{"sku": "a1"}}
+	resp = call(t, c, 3, FailCodePath, args, &reply)
+	rpcErr := common.ParseResponseError(resp.Error)
+	if rpcErr.Type != common.ErrorTypeServerService || rpcErr.Code != 42 ||
+		rpcErr.Error != "out of stock" || !reflect.DeepEqual(rpcErr.Details, args.Map) {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+}
+
+type denyPlugin struct{}
+
+func (denyPlugin) Name() string {
+	return "deny"
+}
+
+func (denyPlugin) PostReadRequestHeader(ctx *server.Context) error {
+	return common.NewCodeError(403, "denied", map[string]string{"path": ctx.Path()})
+}
+
+func TestPluginErrorCode(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewEchoServer(jsonrpc.NewJSONRPCServerCodec)
+	srv.PluginContainer.Add(denyPlugin{})
+	go srv.ServeListener(lis)
+	c := dial(t, lis.Addr().String())
+	defer c.Close()
+
+	var reply string
+	resp := call(t, c, 1, EchoPath, "hello", &reply)
+	rpcErr := common.ParseResponseError(resp.Error)
+	if rpcErr.Type != common.ErrorTypeServerPostReadRequestHeader || rpcErr.Code != 403 ||
+		rpcErr.Error != "PostReadRequestHeader(deny): denied" || rpcErr.Details["path"] != EchoPath {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewEchoServer(jsonrpc.NewJSONRPCServerCodec)
+	go srv.ServeByMux(lis, http.NewServeMux())
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, fmt.Sprintf(HTTPConnectRequest, rpc.DefaultRPCPath))
+	r := bufio.NewReader(conn)
+	b := make([]byte, len(HTTPConnectResponse))
+	if _, err := io.ReadFull(r, b); err != nil || string(b) != HTTPConnectResponse {
+		t.Fatalf("unexpected handshake response: %q, %v", b, err)
+	}
+}
@@ -0,0 +1,144 @@
+package conformance
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// maxSize is the MaxRequestBodySize and the MaxResponseBodySize of the tests,
+// far below the size of the body they announce.
+const maxSize = 1024
+
+var limitCodecs = []struct {
+	name   string
+	server server.ServerCodecFunc
+	client client.ClientCodecFunc
+	// replied is whether the server replies an oversized request, i.e. the codec reads its header apart from its body,
+	// while json reads the id of the request with its params, so the connection is closed without reply.
+	replied bool
+}{
+	{"gob", gob.NewGobServerCodec, gob.NewGobClientCodec, true},
+	{"json", jsonrpc.NewJSONRPCServerCodec, jsonrpc.NewJSONRPCClientCodec, false},
+}
+
+// disconnectPlugin sends the stats of the connections once they are closed.
+type disconnectPlugin chan *server.ConnStats
+
+func (disconnectPlugin) Name() string { return "disconnect" }
+
+func (p disconnectPlugin) PostDisconnect(conn server.ServerCodecConn) error {
+	p <- conn.Stats()
+	return nil
+}
+
+// truncatedConn sends only the first n bytes written, and drops the others,
+// so that the peer fails only if it stops reading at maxSize rather than waiting for the length announced.
+type truncatedConn struct {
+	net.Conn
+	n int
+}
+
+func (c *truncatedConn) Write(b []byte) (int, error) {
+	written := len(b)
+	if len(b) > c.n {
+		b = b[:c.n]
+	}
+	c.n -= len(b)
+	if _, err := c.Conn.Write(b); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// hugeBody is a body of 1MB, of which 16 * maxSize bytes are sent.
+var hugeBody = strings.Repeat("x", 1<<20)
+
+func TestMaxRequestBodySize(t *testing.T) {
+	for _, codec := range limitCodecs {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := NewEchoServer(codec.server)
+		srv.MaxRequestBodySize = maxSize
+		disconnected := make(disconnectPlugin, 1)
+		srv.PluginContainer.Add(disconnected)
+		go srv.ServeListener(lis)
+
+		conn, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := codec.client(&truncatedConn{Conn: conn, n: 16 * maxSize})
+		c.WriteRequest(&rpc.Request{ServiceMethod: EchoPath, Seq: 1}, hugeBody)
+		resp := new(rpc.Response)
+		if codec.replied {
+			if err := c.ReadResponseHeader(resp); err != nil {
+				t.Fatalf("%s: expect the oversized request to be replied, got %v", codec.name, err)
+			}
+			c.ReadResponseBody(nil)
+			errorType, msg, _ := DecodeError(resp.Error)
+			if errorType != common.ErrorTypeServerMessageTooLarge || !strings.Contains(msg, "exceeds the maximum size of 1024 bytes") {
+				t.Fatalf("%s: expect a message too large error, got %q", codec.name, resp.Error)
+			}
+		}
+		// the rest of the request is not read, the connection is closed.
+		if err := c.ReadResponseHeader(resp); err == nil {
+			t.Fatalf("%s: expect the connection to be closed after the oversized request", codec.name)
+		}
+		if stats := <-disconnected; stats.BytesRead() > maxSize {
+			t.Fatalf("%s: expect the server to stop reading at %d bytes, read %d", codec.name, maxSize, stats.BytesRead())
+		}
+		c.Close()
+		lis.Close()
+	}
+}
+
+func TestMaxResponseBodySize(t *testing.T) {
+	for _, codec := range limitCodecs {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the server announces a huge reply to each call, but sends only its beginning.
+		go func(serverCodec server.ServerCodecFunc) {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					c := serverCodec(&truncatedConn{Conn: conn, n: 16 * maxSize})
+					req := new(rpc.Request)
+					if c.ReadRequestHeader(req) != nil || c.ReadRequestBody(nil) != nil {
+						return
+					}
+					c.WriteResponse(&rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}, hugeBody)
+					io.Copy(io.Discard, conn)
+				}()
+			}
+		}(codec.server)
+
+		c := client.NewClient(client.Client{ClientCodecFunc: codec.client, MaxResponseBodySize: maxSize},
+			&selector.DirectSelector{Network: "tcp", Address: lis.Addr().String()})
+		var reply string
+		rpcErr := c.Call(EchoPath, "hello", &reply)
+		if rpcErr == nil || rpcErr.Type != common.ErrorTypeClientMessageTooLarge ||
+			!strings.Contains(rpcErr.Error, "exceeds the maximum size of 1024 bytes") {
+			t.Fatalf("%s: expect a message too large error, got %v", codec.name, rpcErr)
+		}
+		c.Close()
+		lis.Close()
+	}
+}
@@ -0,0 +1,217 @@
+// Package contract tests the contract between the client stubs of users' services and their server:
+// it serves the registered services over the in-memory network, calls every method with
+// random argument values, and reports the codec and type mismatches, e.g. in CI:
+//
+//	func TestContract(t *testing.T) {
+//		srv := server.NewServer(server.Server{})
+//		srv.Register(new(Arith))
+//		h := &contract.Harness{Server: srv, Stubs: map[string]contract.Stub{"/arith/mul": mulStub}}
+//		h.Run(t)
+//	}
+//
+// A call fails the contract if the server decodes other arguments than those sent,
+// if the client decodes another reply than the one sent, or if the call fails elsewhere than in the service.
+// An error returned by the service itself, e.g. for an invalid argument, is accepted.
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// Stub calls a service method through a client stub, args is a value of the registered argument type.
+type Stub func(c *client.Client, args interface{}) (reply interface{}, rpcErr *common.RPCError)
+
+// Harness checks the contract of the services registered on Server.
+type Harness struct {
+	// Server has the services under test registered, with the server codec and plugins of production.
+	Server *server.Server
+	// ClientCodecFunc is the codec of the client, the gob codec if nil.
+	ClientCodecFunc client.ClientCodecFunc
+	// Stubs maps the service paths, e.g. "/arith/mul", to the client stubs under test.
+	// The other methods are called by Client.Call with a reply of the registered type.
+	Stubs map[string]Stub
+	// Iterations is the number of calls per method, 20 if 0.
+	Iterations int
+	// Seed seeds the random argument values, the current time if 0.
+	// It is reported with the failures to replay them.
+	Seed int64
+}
+
+// Failure is a call breaking the contract.
+type Failure struct {
+	Path string
+	Args interface{}
+	// Reason describes the mismatch or the error of the call.
+	Reason string
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s(%s): %s", f.Path, format(f.Args), f.Reason)
+}
+
+var addrSeq uint64
+
+// Run checks the contract and reports the failures to t.
+func (h *Harness) Run(t *testing.T) {
+	t.Helper()
+	failures, err := h.Check()
+	if err != nil {
+		t.Fatalf("contract: %s", err.Error())
+	}
+	for _, f := range failures {
+		t.Errorf("contract: %s (seed %d)", f.Error(), h.Seed)
+	}
+}
+
+// Check calls every method of Server and returns the failures.
+// It adds a plugin to Server for good, so a Server is checked once.
+func (h *Harness) Check() ([]Failure, error) {
+	if h.Iterations <= 0 {
+		h.Iterations = 20
+	}
+	if h.Seed == 0 {
+		h.Seed = time.Now().UnixNano()
+	}
+	rec := new(recorder)
+	if err := h.Server.PluginContainer.Add(rec); err != nil {
+		return nil, err
+	}
+
+	address := "contract-" + strconv.FormatUint(atomic.AddUint64(&addrSeq, 1), 10)
+	lis, err := memnet.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	defer lis.Close()
+	go h.Server.ServeListener(lis)
+
+	c := client.NewClient(client.Client{
+		ClientCodecFunc: h.ClientCodecFunc,
+		MaxTry:          1,
+	}, &selector.DirectSelector{
+		Network:     memnet.Network,
+		Address:     address,
+		DialTimeout: 5 * time.Second,
+	})
+	defer c.Close()
+
+	r := rand.New(rand.NewSource(h.Seed))
+	var failures []Failure
+	for _, info := range h.Server.ServiceInfos() {
+		stub := h.Stubs[info.Path]
+		if stub == nil {
+			stub = callStub(info.Path, info.ReplyType)
+		}
+		for i := 0; i < h.Iterations; i++ {
+			args := newValue(info.ArgType, r, 0).Interface()
+			rec.reset(args)
+			reply, rpcErr := stub(c, args)
+			argsMismatch, sent := rec.result()
+			if argsMismatch != "" {
+				failures = append(failures, Failure{Path: info.Path, Args: args, Reason: argsMismatch})
+				continue
+			}
+			if rpcErr != nil {
+				if rpcErr.Type != common.ErrorTypeServerService {
+					failures = append(failures, Failure{
+						Path:   info.Path,
+						Args:   args,
+						Reason: fmt.Sprintf("error type %d: %s", rpcErr.Type, rpcErr.Error),
+					})
+				}
+				continue
+			}
+			if reply != nil && !equal(reflect.ValueOf(reply), reflect.ValueOf(sent)) {
+				failures = append(failures, Failure{
+					Path:   info.Path,
+					Args:   args,
+					Reason: fmt.Sprintf("client decoded reply %s, server sent %s", format(reply), format(sent)),
+				})
+			}
+		}
+	}
+	return failures, nil
+}
+
+// callStub returns the Stub calling path by Client.Call, with a new reply of replyType,
+// or without decoding the reply if replyType is nil.
+func callStub(path string, replyType reflect.Type) Stub {
+	for replyType != nil && replyType.Kind() == reflect.Ptr {
+		replyType = replyType.Elem()
+	}
+	return func(c *client.Client, args interface{}) (interface{}, *common.RPCError) {
+		if replyType == nil {
+			return nil, c.Call(path, args, nil)
+		}
+		reply := reflect.New(replyType).Interface()
+		return reply, c.Call(path, args, reply)
+	}
+}
+
+// recorder is a server plugin comparing the decoded arguments with those sent,
+// and recording the reply sent.
+type recorder struct {
+	mu       sync.Mutex
+	args     interface{}
+	mismatch string
+	reply    interface{}
+}
+
+var (
+	_ server.IPostReadRequestBodyPlugin = new(recorder)
+	_ server.IPreWriteResponsePlugin    = new(recorder)
+)
+
+func (r *recorder) Name() string {
+	return "ContractPlugin"
+}
+
+func (r *recorder) reset(args interface{}) {
+	r.mu.Lock()
+	r.args, r.mismatch, r.reply = args, "", nil
+	r.mu.Unlock()
+}
+
+func (r *recorder) result() (string, interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mismatch, r.reply
+}
+
+func (r *recorder) PostReadRequestBody(ctx *server.Context, body interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !equal(reflect.ValueOf(body), reflect.ValueOf(r.args)) {
+		r.mismatch = fmt.Sprintf("server decoded args %s", format(body))
+	}
+	return nil
+}
+
+func (r *recorder) PreWriteResponse(ctx *server.Context, body interface{}) error {
+	r.mu.Lock()
+	r.reply = body
+	r.mu.Unlock()
+	return nil
+}
+
+// format formats v as JSON, or with %+v if it is not JSON-encodable.
+func format(v interface{}) string {
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("%+v", v)
+}
@@ -0,0 +1,103 @@
+package contract
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec/jsonrpc"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type (
+	Args struct {
+		A, B  int
+		Tags  []string
+		Attrs map[string]float64
+		Next  *Args
+	}
+	Reply struct {
+		C    int
+		Tags []string
+	}
+	Arith struct{}
+)
+
+func (*Arith) Mul(args *Args, reply *Reply) error {
+	reply.C = args.A * args.B
+	reply.Tags = args.Tags
+	return nil
+}
+
+func (*Arith) Div(args *Args, reply *Reply) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	reply.C = args.A / args.B
+	return nil
+}
+
+func (*Arith) Echo(arg string, reply *string) error {
+	*reply = arg
+	return nil
+}
+
+func newServer(codecFunc server.ServerCodecFunc) *server.Server {
+	srv := server.NewServer(server.Server{ServerCodecFunc: codecFunc})
+	srv.Register(new(Arith))
+	return srv
+}
+
+func TestHarness(t *testing.T) {
+	(&Harness{Server: newServer(nil)}).Run(t)
+	(&Harness{
+		Server:          newServer(jsonrpc.NewJSONRPCServerCodec),
+		ClientCodecFunc: jsonrpc.NewJSONRPCClientCodec,
+		Seed:            1,
+	}).Run(t)
+}
+
+func TestStubMismatch(t *testing.T) {
+	// the stub decodes the reply into an outdated type.
+	type oldReply struct {
+		C string
+	}
+	h := &Harness{
+		Server:          newServer(jsonrpc.NewJSONRPCServerCodec),
+		ClientCodecFunc: jsonrpc.NewJSONRPCClientCodec,
+		Stubs: map[string]Stub{
+			"/arith/mul": func(c *client.Client, args interface{}) (interface{}, *common.RPCError) {
+				reply := new(oldReply)
+				return reply, c.Call("/arith/mul", args, reply)
+			},
+		},
+		Iterations: 3,
+	}
+	failures, err := h.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 3 {
+		t.Fatalf("expect 3 failures, got %v", failures)
+	}
+	for _, f := range failures {
+		if f.Path != "/arith/mul" || !strings.Contains(f.Reason, "error type") {
+			t.Fatalf("unexpected failure: %s", f.Error())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a := &Args{A: 1, Tags: []string{}, Next: &Args{}}
+	b := &Args{A: 1}
+	if !equal(reflect.ValueOf(a), reflect.ValueOf(b)) {
+		t.Fatal("expect empty and nil values to be equal")
+	}
+	b.Attrs = map[string]float64{"x": 1}
+	if equal(reflect.ValueOf(a), reflect.ValueOf(b)) {
+		t.Fatal("expect different values")
+	}
+}
@@ -0,0 +1,144 @@
+package contract
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+// maxDepth bounds the nesting of the generated values, e.g. of recursive types.
+const maxDepth = 4
+
+var runes = []rune("abcXYZ019 _-/\"\\\n\té世🙂")
+
+// newValue returns a random value of t.
+// The fields that the codecs do not carry, i.e. unexported fields, interfaces, channels and functions, are left zero.
+func newValue(t reflect.Type, r *rand.Rand, depth int) reflect.Value {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(r.Uint64()) >> uint(r.Intn(64)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(r.Uint64() >> uint(r.Intn(64)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(r.NormFloat64() * 1e6)
+	case reflect.Complex64, reflect.Complex128:
+		v.SetComplex(complex(r.NormFloat64(), r.NormFloat64()))
+	case reflect.String:
+		s := make([]rune, r.Intn(9))
+		for i := range s {
+			s[i] = runes[r.Intn(len(runes))]
+		}
+		v.SetString(string(s))
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).Set(newValue(t.Elem(), r, depth+1))
+		}
+	case reflect.Slice:
+		if depth >= maxDepth || r.Intn(4) == 0 {
+			break
+		}
+		n := 1 + r.Intn(3)
+		v.Set(reflect.MakeSlice(t, n, n))
+		for i := 0; i < n; i++ {
+			v.Index(i).Set(newValue(t.Elem(), r, depth+1))
+		}
+	case reflect.Map:
+		if depth >= maxDepth || r.Intn(4) == 0 {
+			break
+		}
+		v.Set(reflect.MakeMap(t))
+		for n := 1 + r.Intn(3); n > 0; n-- {
+			v.SetMapIndex(newValue(t.Key(), r, depth+1), newValue(t.Elem(), r, depth+1))
+		}
+	case reflect.Ptr:
+		// the argument itself must not be nil.
+		if depth >= maxDepth || (depth > 0 && r.Intn(4) == 0) {
+			break
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(newValue(t.Elem(), r, depth+1))
+		v.Set(p)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				v.Field(i).Set(newValue(t.Field(i).Type, r, depth+1))
+			}
+		}
+	}
+	return v
+}
+
+// equal reports whether a and b are the same on the wire:
+// only the exported fields are compared, a nil pointer equals a pointer to the zero value,
+// and a nil slice or map equals an empty one.
+func equal(a, b reflect.Value) bool {
+	a, b = indirect(a), indirect(b)
+	if !a.IsValid() || !b.IsValid() {
+		return isZero(a) && isZero(b)
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Array, reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equal(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			if !equal(a.MapIndex(k), b.MapIndex(k)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if a.Type().Field(i).PkgPath == "" && !equal(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// indirect dereferences the pointers and interfaces of v, it returns the zero Value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isZero(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	return equal(v, reflect.Zero(v.Type()))
+}
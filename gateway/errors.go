@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// DefaultStatusCodes maps the error types of the calls to HTTP status codes,
+// Gateway.StatusCodes overrides it. Unlisted types map to 500 Internal Server Error.
+var DefaultStatusCodes = map[common.ErrorType]int{
+	common.ErrorTypeServerReadRequestHeader:     http.StatusBadRequest,
+	common.ErrorTypeServerInvalidServiceMethod:  http.StatusNotFound,
+	common.ErrorTypeServerNotFoundService:       http.StatusNotFound,
+	common.ErrorTypeServerReadRequestBody:       http.StatusBadRequest,
+	common.ErrorTypeServerPreReadRequestHeader:  http.StatusForbidden,
+	common.ErrorTypeServerPostReadRequestHeader: http.StatusForbidden,
+	common.ErrorTypeServerPreReadRequestBody:    http.StatusForbidden,
+	common.ErrorTypeServerPostReadRequestBody:   http.StatusForbidden,
+	common.ErrorTypeServerServicePanic:          http.StatusInternalServerError,
+	common.ErrorTypeServerService:               http.StatusInternalServerError,
+	common.ErrorTypeServerPreWriteResponse:      http.StatusInternalServerError,
+	common.ErrorTypeServerWriteResponse:         http.StatusBadGateway,
+	common.ErrorTypeServerMemoryLimit:           http.StatusServiceUnavailable,
+	common.ErrorTypeServerOverloaded:            http.StatusServiceUnavailable,
+	common.ErrorTypeServerMessageTooLarge:       http.StatusRequestEntityTooLarge,
+}
+
+var errorTypeNames = map[common.ErrorType]string{
+	common.ErrorTypeUnknown:                     "Unknown",
+	common.ErrorTypeServerPreReadRequestHeader:  "PreReadRequestHeader",
+	common.ErrorTypeServerReadRequestHeader:     "ReadRequestHeader",
+	common.ErrorTypeServerInvalidServiceMethod:  "InvalidServiceMethod",
+	common.ErrorTypeServerNotFoundService:       "NotFoundService",
+	common.ErrorTypeServerPostReadRequestHeader: "PostReadRequestHeader",
+	common.ErrorTypeServerPreReadRequestBody:    "PreReadRequestBody",
+	common.ErrorTypeServerReadRequestBody:       "ReadRequestBody",
+	common.ErrorTypeServerPostReadRequestBody:   "PostReadRequestBody",
+	common.ErrorTypeServerServicePanic:          "ServicePanic",
+	common.ErrorTypeServerService:               "Service",
+	common.ErrorTypeServerPreWriteResponse:      "PreWriteResponse",
+	common.ErrorTypeServerWriteResponse:         "WriteResponse",
+	common.ErrorTypeServerMemoryLimit:           "MemoryLimit",
+	common.ErrorTypeServerOverloaded:            "Overloaded",
+	common.ErrorTypeServerMessageTooLarge:       "MessageTooLarge",
+}
+
+type (
+	// errorEnvelope is the JSON body of the error responses:
+	//	{"error":{"status":404,"type":"NotFoundService","message":"can't find service '/a/b'"}}
+	// type is only set for the errors of the calls, code and details for the errors carrying them,
+	// see common.NewCodeError and server.Server.StructuredErrors.
+	errorEnvelope struct {
+		Error errorDetail `json:"error"`
+	}
+
+	errorDetail struct {
+		Status  int               `json:"status"`
+		Type    string            `json:"type,omitempty"`
+		Message string            `json:"message"`
+		Code    int               `json:"code,omitempty"`
+		Details map[string]string `json:"details,omitempty"`
+	}
+)
+
+// statusOf returns the HTTP status code of rpcErr.
+func (g *Gateway) statusOf(rpcErr *common.RPCError) int {
+	if g.StatusFunc != nil {
+		if status := g.StatusFunc(rpcErr); status != 0 {
+			return status
+		}
+	}
+	if status, ok := g.StatusCodes[rpcErr.Type]; ok {
+		return status
+	}
+	if status, ok := DefaultStatusCodes[rpcErr.Type]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// rpcErrorDetail returns the error detail of rpcErr.
+func (g *Gateway) rpcErrorDetail(rpcErr *common.RPCError) errorDetail {
+	return errorDetail{
+		Status:  g.statusOf(rpcErr),
+		Type:    errorTypeNames[rpcErr.Type],
+		Message: rpcErr.Error,
+		Code:    rpcErr.Code,
+		Details: rpcErr.Details,
+	}
+}
+
+// writeRPCError writes the error of a call.
+func (g *Gateway) writeRPCError(w http.ResponseWriter, rpcErr *common.RPCError) {
+	writeErrorDetail(w, g.rpcErrorDetail(rpcErr))
+}
+
+// writeError writes an error of the gateway itself.
+func writeError(w http.ResponseWriter, status int, errMsg string) {
+	writeErrorDetail(w, errorDetail{Status: status, Message: errMsg})
+}
+
+func writeErrorDetail(w http.ResponseWriter, detail errorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(detail.Status)
+	json.NewEncoder(w).Encode(&errorEnvelope{Error: detail})
+}
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// CachePolicy makes the GET requests of a route cacheable.
+type CachePolicy struct {
+	// CacheControl is the Cache-Control header of the replies, e.g. "public, max-age=60".
+	CacheControl string
+}
+
+// cachePolicy returns the cache policy of the route of r.
+func (g *Gateway) cachePolicy(r *http.Request) (CachePolicy, bool) {
+	if r.Method != "GET" || g.Cache == nil {
+		return CachePolicy{}, false
+	}
+	policy, ok := g.Cache[servicePathOf(r, g.Prefix)]
+	return policy, ok
+}
+
+// etagOf returns a strong ETag of the reply.
+func etagOf(reply []byte) string {
+	sum := sha256.Sum256(reply)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch reports whether the If-None-Match header matches etag, using the weak comparison.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCacheable writes the reply with its ETag and Cache-Control headers,
+// or 304 Not Modified if the client already has it.
+func writeCacheable(w http.ResponseWriter, r *http.Request, policy CachePolicy, reply []byte) {
+	etag := etagOf(reply)
+	h := w.Header()
+	h.Set("ETag", etag)
+	if policy.CacheControl != "" {
+		h.Set("Cache-Control", policy.CacheControl)
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatch(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	w.Write(reply)
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// FieldsParam is the query parameter selecting the fields of the reply, e.g.
+//
+//	?fields=name,address.city,items.id
+//
+// A dotted path selects a nested field, and a path through an array applies to each element.
+// The parameter is removed from the query before the call.
+const FieldsParam = "fields"
+
+// fieldMask is a tree of the selected fields, a nil subtree selects the whole field.
+type fieldMask map[string]fieldMask
+
+// parseFieldMask parses a comma separated list of dotted paths.
+func parseFieldMask(fields string) fieldMask {
+	mask := fieldMask{}
+	for _, path := range strings.Split(fields, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		m := mask
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			sub, ok := m[name]
+			if i == len(names)-1 {
+				// the whole field, it includes any narrower path.
+				m[name] = nil
+				break
+			}
+			if ok && sub == nil {
+				// the whole field is already selected.
+				break
+			}
+			if sub == nil {
+				sub = fieldMask{}
+				m[name] = sub
+			}
+			m = sub
+		}
+	}
+	return mask
+}
+
+// apply prunes the JSON value v to the fields of mask.
+func (mask fieldMask) apply(v interface{}) interface{} {
+	if mask == nil {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(mask))
+		for name, sub := range mask {
+			if fv, ok := v[name]; ok {
+				pruned[name] = sub.apply(fv)
+			}
+		}
+		return pruned
+	case []interface{}:
+		for i, ev := range v {
+			v[i] = mask.apply(ev)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// pruneFields returns the reply reduced to the fields selected by the fields parameter.
+func pruneFields(reply json.RawMessage, fields string) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(reply, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(parseFieldMask(fields).apply(v))
+}
@@ -0,0 +1,197 @@
+// Package gateway exposes the services of a server.Server as JSON over HTTP,
+// for browsers and other HTTP consumers:
+//
+//	POST /prefix/arith/mul?key=value
+//	{"A":7,"B":8}
+//
+// is answered with the JSON of the reply, or with a JSON error:
+//
+//	{"error":"divide by zero"}
+//
+// The calls are served in-process, the server needs no listener.
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/rpc"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/codec/jsonline"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// Gateway is an http.Handler that translates HTTP requests into calls of Server.
+type Gateway struct {
+	Server *server.Server
+	// Prefix is stripped from the URL path to get the service path.
+	Prefix string
+	// SSE enables the Server-Sent Events mode for the requests accepting text/event-stream.
+	SSE bool
+	// LongPoll parks each request until its reply is ready or PollTimeout elapses,
+	// in which case it is answered with 202 Accepted and a cursor in the X-Poll-Cursor header.
+	// Repeating the request with that header resumes the wait, until the reply is delivered.
+	// It suits networks whose proxies cut long-lived connections.
+	LongPoll bool
+	// PollTimeout is how long a request is parked, 30s if 0.
+	// An unclaimed reply is dropped after twice PollTimeout.
+	PollTimeout time.Duration
+	// Cache maps the paths of the cacheable read methods, e.g. "/user/get", to their cache policy.
+	// Their GET replies carry an ETag computed from the reply, If-None-Match is answered with 304.
+	Cache map[string]CachePolicy
+	// StatusCodes overrides the HTTP status codes of DefaultStatusCodes.
+	StatusCodes map[common.ErrorType]int
+	// StatusFunc, if it is not nil, returns the HTTP status code of a failed call,
+	// e.g. by the message of a service error, or 0 to use StatusCodes.
+	StatusFunc func(rpcErr *common.RPCError) int
+	// Plugins are called for each request, see IPreCallPlugin.
+	Plugins plugin.PluginContainer
+	polls   pollTable
+}
+
+var _ http.Handler = new(Gateway)
+
+// ServeHTTP serves a GET or POST request, the body of a POST request is the JSON of the argument.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, g.Prefix) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !doPreCall(g.Plugins.GetAll(), w, r, servicePathOf(r, g.Prefix)) {
+		return
+	}
+	args, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if g.LongPoll {
+		if cursor := r.Header.Get(PollCursorHeader); cursor != "" {
+			g.resumePoll(w, r, cursor)
+			return
+		}
+	}
+	serviceMethod := serviceMethodOf(r, g.Prefix)
+	if g.SSE && acceptsEventStream(r) {
+		g.serveSSE(w, r, serviceMethod, args)
+		return
+	}
+	if g.LongPoll {
+		g.startPoll(w, r, serviceMethod, args)
+		return
+	}
+	reply, rpcErr := g.call(r, serviceMethod, args)
+	g.writeReply(w, r, reply, rpcErr)
+}
+
+// writeReply writes the JSON reply, or the error if rpcErr is not nil.
+func (g *Gateway) writeReply(w http.ResponseWriter, r *http.Request, reply json.RawMessage, rpcErr *common.RPCError) {
+	if rpcErr != nil {
+		g.writeRPCError(w, rpcErr)
+		return
+	}
+	if policy, ok := g.cachePolicy(r); ok {
+		writeCacheable(w, r, policy, reply)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply)
+}
+
+// call calls serviceMethod with the JSON args and returns the JSON reply.
+func (g *Gateway) call(r *http.Request, serviceMethod string, args []byte) (json.RawMessage, *common.RPCError) {
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = []byte("null")
+	}
+	var req bytes.Buffer
+	err := jsonline.NewJSONLineClientCodec(&bufferRWC{w: &req}).
+		WriteRequest(&rpc.Request{ServiceMethod: serviceMethod}, json.RawMessage(args))
+	if err != nil {
+		return nil, common.NewRPCError(common.ErrorTypeServerReadRequestBody, err.Error())
+	}
+	addr := &server.MessageAddr{Net: "http", Addr: r.RemoteAddr}
+	data, err := g.Server.ServeMessage(jsonline.NewJSONLineServerCodec, addr, req.Bytes())
+	if err != nil {
+		log.Debugf("rpc: gateway: %s", err.Error())
+	}
+	c := jsonline.NewJSONLineClientCodec(&bufferRWC{r: bytes.NewReader(data)})
+	var resp rpc.Response
+	if err = c.ReadResponseHeader(&resp); err != nil {
+		if err == io.EOF && len(data) == 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, common.NewRPCError(common.ErrorTypeServerWriteResponse, err.Error())
+	}
+	if resp.Error != "" {
+		return nil, common.ParseResponseError(resp.Error)
+	}
+	var reply json.RawMessage
+	if err = c.ReadResponseBody(&reply); err != nil {
+		return nil, common.NewRPCError(common.ErrorTypeServerWriteResponse, err.Error())
+	}
+	if fields := r.URL.Query().Get(FieldsParam); fields != "" {
+		if reply, err = pruneFields(reply, fields); err != nil {
+			return nil, common.NewRPCError(common.ErrorTypeServerWriteResponse, err.Error())
+		}
+	}
+	return reply, nil
+}
+
+// servicePathOf returns the service path of r, without prefix and query.
+func servicePathOf(r *http.Request, prefix string) string {
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// serviceMethodOf returns the service method URI of r, without prefix.
+func serviceMethodOf(r *http.Request, prefix string) string {
+	serviceMethod := servicePathOf(r, prefix)
+	query := r.URL.Query()
+	if _, ok := query[FieldsParam]; ok {
+		query.Del(FieldsParam)
+		if rawQuery := query.Encode(); rawQuery != "" {
+			serviceMethod += "?" + rawQuery
+		}
+	} else if r.URL.RawQuery != "" {
+		serviceMethod += "?" + r.URL.RawQuery
+	}
+	return serviceMethod
+}
+
+// bufferRWC is an io.ReadWriteCloser of a single encoded message.
+type bufferRWC struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (b *bufferRWC) Read(p []byte) (int, error) {
+	if b.r == nil {
+		return 0, io.EOF
+	}
+	return b.r.Read(p)
+}
+
+func (b *bufferRWC) Write(p []byte) (int, error) {
+	if b.w == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return b.w.Write(p)
+}
+
+func (b *bufferRWC) Close() error {
+	return nil
+}
@@ -0,0 +1,282 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type Arith struct{}
+
+type Args struct {
+	A, B int
+}
+
+type Reply struct {
+	C int
+}
+
+func (Arith) Mul(args *Args, reply *Reply) error {
+	reply.C = args.A * args.B
+	return nil
+}
+
+func (Arith) Div(args *Args, reply *Reply) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	reply.C = args.A / args.B
+	return nil
+}
+
+func (Arith) Slow(d *time.Duration, reply *Reply) error {
+	time.Sleep(*d)
+	return nil
+}
+
+func newTestGateway(g *Gateway) *httptest.Server {
+	srv := server.NewServer(server.Server{})
+	srv.NamedRegister("arith", new(Arith))
+	g.Server = srv
+	return httptest.NewServer(g)
+}
+
+func post(t *testing.T, url, body string, header ...string) (*http.Response, string) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestGateway(t *testing.T) {
+	ts := newTestGateway(&Gateway{Prefix: "/api"})
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL+"/api/arith/mul", `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusOK || body != `{"C":56}` {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = post(t, ts.URL+"/api/arith/mul?fields=D", `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusOK || body != `{}` {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = post(t, ts.URL+"/api/arith/div", `{"A":7,"B":0}`)
+	if resp.StatusCode != http.StatusInternalServerError || !strings.Contains(body, "divide by zero") {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = post(t, ts.URL+"/api/arith/nope", `{}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestGatewaySSE(t *testing.T) {
+	ts := newTestGateway(&Gateway{SSE: true})
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL+"/arith/mul", `{"A":7,"B":8}`, "Accept", "text/event-stream")
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+	expect := "event: reply\ndata: {\"C\":56}\n\nevent: end\ndata: \n\n"
+	if body != expect {
+		t.Fatalf("expect %q, got %q", expect, body)
+	}
+}
+
+func TestGatewayLongPoll(t *testing.T) {
+	ts := newTestGateway(&Gateway{LongPoll: true, PollTimeout: 50 * time.Millisecond})
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL+"/arith/mul", `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusOK || body != `{"C":56}` {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = post(t, ts.URL+"/arith/slow", `120000000`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+	cursor := resp.Header.Get(PollCursorHeader)
+	if cursor == "" {
+		t.Fatal("no poll cursor")
+	}
+	for i := 0; ; i++ {
+		resp, body = post(t, ts.URL+"/arith/slow", "", PollCursorHeader, cursor)
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if resp.StatusCode != http.StatusAccepted || resp.Header.Get(PollCursorHeader) != cursor || i > 10 {
+			t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+		}
+	}
+	if body != `{"C":0}` {
+		t.Fatalf("unexpected reply: %s", body)
+	}
+
+	resp, _ = post(t, ts.URL+"/arith/slow", "", PollCursorHeader, cursor)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect the delivered cursor to be gone, got %d", resp.StatusCode)
+	}
+}
+
+func TestPruneFields(t *testing.T) {
+	reply := `{"name":"a","age":3,"address":{"city":"x","zip":"1"},"items":[{"id":1,"v":2},{"id":3,"v":4}]}`
+	cases := map[string]string{
+		"name":                 `{"name":"a"}`,
+		"name,address.city":    `{"address":{"city":"x"},"name":"a"}`,
+		"items.id":             `{"items":[{"id":1},{"id":3}]}`,
+		"address.city,address": `{"address":{"city":"x","zip":"1"}}`,
+		"address,address.city": `{"address":{"city":"x","zip":"1"}}`,
+		"nope":                 `{}`,
+	}
+	for fields, expect := range cases {
+		pruned, err := pruneFields([]byte(reply), fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pruned) != expect {
+			t.Errorf("fields=%s: expect %s, got %s", fields, expect, pruned)
+		}
+	}
+}
+
+func TestGatewayETag(t *testing.T) {
+	ts := newTestGateway(&Gateway{Cache: map[string]CachePolicy{
+		"/arith/mul": {CacheControl: "public, max-age=60"},
+	}})
+	defer ts.Close()
+
+	get := func(ifNoneMatch string) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+"/arith/mul", strings.NewReader(`{"A":7,"B":8}`))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	resp := get("")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" || resp.Header.Get("Cache-Control") != "public, max-age=60" {
+		t.Fatalf("unexpected response: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp = get(`"other", W/` + etag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expect 304, got %d", resp.StatusCode)
+	}
+	if resp = get(`"other"`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestSignedURLPlugin(t *testing.T) {
+	p := NewSignedURLPlugin([]byte("secret"), "/arith/mul")
+	g := &Gateway{Prefix: "/api"}
+	g.Plugins.Add(p)
+	ts := newTestGateway(g)
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL+"/api/arith/mul", `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	signed, err := p.Sign(ts.URL+"/api/arith/mul?fields=C", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body = post(t, signed, `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusOK || body != `{"C":56}` {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = post(t, strings.Replace(signed, "fields=C", "fields=D", 1), `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	expired, _ := p.Sign(ts.URL+"/api/arith/mul", -time.Minute)
+	resp, body = post(t, expired, `{"A":7,"B":8}`)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "expired") {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = post(t, ts.URL+"/api/arith/div", `{"A":8,"B":2}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestThrottlePlugin(t *testing.T) {
+	p := NewThrottlePlugin(Limit{Rate: 1, Burst: 2})
+	p.SetLimit("vip", Limit{Rate: 100, Burst: 10})
+	g := new(Gateway)
+	g.Plugins.Add(p)
+	ts := newTestGateway(g)
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, body := post(t, ts.URL+"/arith/mul", `{"A":7,"B":8}`, APIKeyHeader, "basic")
+		if i < 2 && resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+		}
+		if i == 2 && (resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1") {
+			t.Fatalf("unexpected response: %d %v %s", resp.StatusCode, resp.Header, body)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		resp, body := post(t, ts.URL+"/arith/mul", `{"A":7,"B":8}`, APIKeyHeader, "vip")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+		}
+	}
+}
+
+func TestGatewayErrorMapping(t *testing.T) {
+	ts := newTestGateway(&Gateway{
+		StatusCodes: map[common.ErrorType]int{common.ErrorTypeServerNotFoundService: http.StatusNotImplemented},
+		StatusFunc: func(rpcErr *common.RPCError) int {
+			if rpcErr.Error == "divide by zero" {
+				return http.StatusBadRequest
+			}
+			return 0
+		},
+	})
+	defer ts.Close()
+
+	resp, body := post(t, ts.URL+"/arith/div", `{"A":7,"B":0}`)
+	expect := `{"error":{"status":400,"type":"Service","message":"divide by zero"}}` + "\n"
+	if resp.StatusCode != http.StatusBadRequest || body != expect {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+	resp, body = post(t, ts.URL+"/arith/nope", `{}`)
+	if resp.StatusCode != http.StatusNotImplemented || !strings.Contains(body, `"type":"NotFoundService"`) {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// PollCursorHeader carries the cursor of a parked call, see Gateway.LongPoll.
+const PollCursorHeader = "X-Poll-Cursor"
+
+// pollTable holds the calls still running after their poll timed out.
+type pollTable struct {
+	mu   sync.Mutex
+	jobs map[string]*pollJob
+}
+
+// pollJob is a call answered by long polling.
+type pollJob struct {
+	reply  json.RawMessage
+	rpcErr *common.RPCError
+	done   chan struct{}
+	// expire is when the result is dropped if nobody polls for it.
+	expire time.Time
+}
+
+func (g *Gateway) pollTimeout() time.Duration {
+	if g.PollTimeout > 0 {
+		return g.PollTimeout
+	}
+	return 30 * time.Second
+}
+
+// startPoll runs a call and parks the request until it completes or the poll timeout elapses,
+// in which case it answers 202 Accepted with a cursor to resume the wait.
+func (g *Gateway) startPoll(w http.ResponseWriter, r *http.Request, serviceMethod string, args []byte) {
+	job := &pollJob{done: make(chan struct{})}
+	go func() {
+		job.reply, job.rpcErr = g.call(r, serviceMethod, args)
+		close(job.done)
+	}()
+	g.waitPoll(w, r, "", job)
+}
+
+// resumePoll parks the request until the call of cursor completes or the poll timeout elapses.
+func (g *Gateway) resumePoll(w http.ResponseWriter, r *http.Request, cursor string) {
+	g.polls.mu.Lock()
+	job := g.polls.jobs[cursor]
+	g.polls.mu.Unlock()
+	if job == nil {
+		writeError(w, http.StatusNotFound, "unknown or expired poll cursor")
+		return
+	}
+	g.waitPoll(w, r, cursor, job)
+}
+
+func (g *Gateway) waitPoll(w http.ResponseWriter, r *http.Request, cursor string, job *pollJob) {
+	timer := time.NewTimer(g.pollTimeout())
+	defer timer.Stop()
+	select {
+	case <-job.done:
+		if cursor != "" {
+			g.polls.mu.Lock()
+			delete(g.polls.jobs, cursor)
+			g.polls.mu.Unlock()
+		}
+		g.writeReply(w, r, job.reply, job.rpcErr)
+	case <-timer.C:
+		if cursor == "" {
+			cursor = g.parkPoll(job)
+		} else {
+			g.polls.mu.Lock()
+			job.expire = time.Now().Add(2 * g.pollTimeout())
+			g.polls.mu.Unlock()
+		}
+		w.Header().Set(PollCursorHeader, cursor)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"cursor": cursor})
+	}
+}
+
+// parkPoll stores job for the later polls and returns its cursor.
+func (g *Gateway) parkPoll(job *pollJob) string {
+	var b [16]byte
+	rand.Read(b[:])
+	cursor := hex.EncodeToString(b[:])
+	now := time.Now()
+	g.polls.mu.Lock()
+	defer g.polls.mu.Unlock()
+	if g.polls.jobs == nil {
+		g.polls.jobs = make(map[string]*pollJob)
+	}
+	for c, j := range g.polls.jobs {
+		if now.After(j.expire) {
+			delete(g.polls.jobs, c)
+		}
+	}
+	job.expire = now.Add(2 * g.pollTimeout())
+	g.polls.jobs[cursor] = job
+	return cursor
+}
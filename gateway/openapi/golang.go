@@ -0,0 +1,246 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+)
+
+// GenerateGo returns the source of a Go client of the gateway described by doc.
+func GenerateGo(doc *Document, pkg string) ([]byte, error) {
+	g := &goGen{doc: doc}
+	for _, name := range doc.SchemaNames() {
+		g.declare(camel(name, true), doc.Components.Schemas[name])
+	}
+	var methods bytes.Buffer
+	for _, m := range doc.Methods() {
+		g.method(&methods, m)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by myrpc-gen from an OpenAPI document. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString(goImports)
+	b.Write(g.types.Bytes())
+	b.WriteString(goClient)
+	b.Write(methods.Bytes())
+	return format.Source(b.Bytes())
+}
+
+type goGen struct {
+	doc   *Document
+	types bytes.Buffer
+}
+
+// declare writes the declaration of the named type of s.
+func (g *goGen) declare(name string, s *Schema) {
+	if s.Description != "" {
+		fmt.Fprintf(&g.types, "// %s %s\n", name, oneLine(s.Description))
+	}
+	if !isObject(s) {
+		fmt.Fprintf(&g.types, "type %s %s\n\n", name, g.typeOf(s, name))
+		return
+	}
+	fmt.Fprintf(&g.types, "type %s struct {\n", name)
+	var inline []func()
+	for _, prop := range s.propertyNames() {
+		ps := s.Properties[prop]
+		field := camel(prop, true)
+		if isObject(ps) && ps.Ref == "" {
+			sub := name + field
+			inline = append(inline, func() { g.declare(sub, ps) })
+		}
+		if ps.Description != "" {
+			fmt.Fprintf(&g.types, "\t// %s %s\n", field, oneLine(ps.Description))
+		}
+		tag := prop
+		if !s.isRequired(prop) {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&g.types, "\t%s %s `json:%s`\n", field, g.typeOf(ps, name+field), strconv.Quote(tag))
+	}
+	g.types.WriteString("}\n\n")
+	for _, f := range inline {
+		f()
+	}
+}
+
+// typeOf returns the Go type of s, hint names the inline object types.
+func (g *goGen) typeOf(s *Schema, hint string) string {
+	if s == nil {
+		return "json.RawMessage"
+	}
+	if s.Ref != "" {
+		return camel(s.refName(), true)
+	}
+	switch s.Type {
+	case "object":
+		if len(s.Properties) > 0 {
+			return hint
+		}
+		if add := s.additional(); add != nil {
+			return "map[string]" + g.typeOf(add, hint+"Value")
+		}
+		return "map[string]interface{}"
+	case "array":
+		return "[]" + g.typeOf(s.Items, hint+"Item")
+	case "string":
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	default:
+		return "interface{}"
+	}
+}
+
+// isStruct reports whether the Go type of s is a struct.
+func (g *goGen) isStruct(s *Schema) bool {
+	if s != nil && s.Ref != "" {
+		if ref, ok := g.doc.Components.Schemas[s.refName()]; ok {
+			return isObject(ref)
+		}
+	}
+	return false
+}
+
+func (g *goGen) method(b *bytes.Buffer, m *Method) {
+	name := camel(m.Name, true)
+	if m.Args != nil && m.Args.Ref == "" && isObject(m.Args) {
+		g.declare(name+"Args", m.Args)
+	}
+	if m.Reply != nil && m.Reply.Ref == "" && isObject(m.Reply) {
+		g.declare(name+"Reply", m.Reply)
+	}
+	params := "ctx context.Context"
+	argsExpr := "nil"
+	if m.Args != nil && m.HTTPMethod != "GET" {
+		argsType := g.typeOf(m.Args, name+"Args")
+		if g.isStruct(m.Args) || (m.Args.Ref == "" && isObject(m.Args)) {
+			argsType = "*" + argsType
+		}
+		params += ", args " + argsType
+		argsExpr = "args"
+	}
+	if m.Summary != "" {
+		fmt.Fprintf(b, "// %s %s\n", name, oneLine(m.Summary))
+	} else {
+		fmt.Fprintf(b, "// %s calls %s %s.\n", name, m.HTTPMethod, m.Path)
+	}
+	if m.Reply == nil {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) error {\n", name, params)
+		fmt.Fprintf(b, "\treturn c.call(ctx, %q, %q, %s, nil)\n}\n\n", m.HTTPMethod, m.Path, argsExpr)
+		return
+	}
+	replyType := g.typeOf(m.Reply, name+"Reply")
+	if g.isStruct(m.Reply) || (m.Reply.Ref == "" && isObject(m.Reply)) {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) (*%s, error) {\n", name, params, replyType)
+		fmt.Fprintf(b, "\treply := new(%s)\n", replyType)
+		fmt.Fprintf(b, "\treturn reply, c.call(ctx, %q, %q, %s, reply)\n}\n\n", m.HTTPMethod, m.Path, argsExpr)
+		return
+	}
+	fmt.Fprintf(b, "func (c *Client) %s(%s) (%s, error) {\n", name, params, replyType)
+	fmt.Fprintf(b, "\tvar reply %s\n", replyType)
+	fmt.Fprintf(b, "\terr := c.call(ctx, %q, %q, %s, &reply)\n", m.HTTPMethod, m.Path, argsExpr)
+	b.WriteString("\treturn reply, err\n}\n\n")
+}
+
+// isObject reports whether s is an object with properties.
+func isObject(s *Schema) bool {
+	return s != nil && s.Type == "object" && len(s.Properties) > 0
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+const goImports = `import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+`
+
+const goClient = `// Client calls the gateway at BaseURL.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is added to each request, e.g. the API key.
+	Header http.Header
+}
+
+// NewClient returns a Client of the gateway at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Header:     make(http.Header),
+	}
+}
+
+// Error is an error response of the gateway.
+type Error struct {
+	Status  int    ` + "`json:\"status\"`" + `
+	Type    string ` + "`json:\"type\"`" + `
+	Message string ` + "`json:\"message\"`" + `
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("%d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Type, e.Message)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, args, reply interface{}) error {
+	var body bytes.Buffer
+	if method != "GET" {
+		if err := json.NewEncoder(&body).Encode(args); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var envelope struct {
+			Error *Error ` + "`json:\"error\"`" + `
+		}
+		if json.NewDecoder(resp.Body).Decode(&envelope) != nil || envelope.Error == nil {
+			return &Error{Status: resp.StatusCode, Message: resp.Status}
+		}
+		return envelope.Error
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+`
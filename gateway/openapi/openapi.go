@@ -0,0 +1,193 @@
+// Package openapi generates typed HTTP gateway clients from an OpenAPI 3 document
+// describing the gateway routes, in Go and TypeScript.
+//
+// Each operation is a gateway call: its JSON request body is the argument,
+// its JSON 200 response is the reply, and the errors use the gateway error envelope.
+// The supported schemas are the JSON types, arrays, maps and $ref to components/schemas.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type (
+	// Document is the subset of an OpenAPI 3 document used by the generators.
+	Document struct {
+		Paths      map[string]map[string]*Operation `json:"paths"`
+		Components struct {
+			Schemas map[string]*Schema `json:"schemas"`
+		} `json:"components"`
+	}
+
+	// Operation is an operation of a path.
+	Operation struct {
+		OperationID string           `json:"operationId"`
+		Summary     string           `json:"summary"`
+		RequestBody *Body            `json:"requestBody"`
+		Responses   map[string]*Body `json:"responses"`
+	}
+
+	// Body is a request body or a response.
+	Body struct {
+		Content map[string]struct {
+			Schema *Schema `json:"schema"`
+		} `json:"content"`
+	}
+
+	// Schema is a JSON schema.
+	Schema struct {
+		Ref         string             `json:"$ref"`
+		Type        string             `json:"type"`
+		Format      string             `json:"format"`
+		Description string             `json:"description"`
+		Properties  map[string]*Schema `json:"properties"`
+		Required    []string           `json:"required"`
+		Items       *Schema            `json:"items"`
+		// AdditionalProperties is a schema or a boolean.
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+
+	// Method is a gateway call described by an operation.
+	Method struct {
+		// Name is the operationId, or the path in camel case.
+		Name       string
+		HTTPMethod string
+		Path       string
+		Summary    string
+		Args       *Schema
+		Reply      *Schema
+	}
+)
+
+// Parse reads an OpenAPI 3 document in JSON.
+func Parse(r io.Reader) (*Document, error) {
+	doc := new(Document)
+	if err := json.NewDecoder(r).Decode(doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("openapi: no paths")
+	}
+	return doc, nil
+}
+
+// Methods returns the gateway calls of doc, sorted by path.
+func (doc *Document) Methods() []*Method {
+	var methods []*Method
+	for path, item := range doc.Paths {
+		for httpMethod, op := range item {
+			httpMethod = strings.ToUpper(httpMethod)
+			if httpMethod != "GET" && httpMethod != "POST" {
+				continue
+			}
+			m := &Method{
+				Name:       op.OperationID,
+				HTTPMethod: httpMethod,
+				Path:       path,
+				Summary:    op.Summary,
+				Args:       op.RequestBody.schema(),
+				Reply:      op.Responses["200"].schema(),
+			}
+			if m.Name == "" {
+				m.Name = camel(path, false)
+			}
+			methods = append(methods, m)
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].Path != methods[j].Path {
+			return methods[i].Path < methods[j].Path
+		}
+		return methods[i].HTTPMethod < methods[j].HTTPMethod
+	})
+	return methods
+}
+
+// SchemaNames returns the names of the component schemas, sorted.
+func (doc *Document) SchemaNames() []string {
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// schema returns the JSON schema of the body, or nil.
+func (b *Body) schema() *Schema {
+	if b == nil {
+		return nil
+	}
+	if c, ok := b.Content["application/json"]; ok {
+		return c.Schema
+	}
+	return nil
+}
+
+// refName returns the component name of a $ref.
+func (s *Schema) refName() string {
+	return s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+}
+
+// additional returns the schema of the additional properties, or nil.
+func (s *Schema) additional() *Schema {
+	raw := strings.TrimSpace(string(s.AdditionalProperties))
+	if !strings.HasPrefix(raw, "{") {
+		return nil
+	}
+	sub := new(Schema)
+	if json.Unmarshal(s.AdditionalProperties, sub) != nil {
+		return nil
+	}
+	return sub
+}
+
+// propertyNames returns the property names of s, sorted.
+func (s *Schema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Schema) isRequired(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// camel converts a path or a property name to camel case, e.g. "/user/get_name" to "userGetName".
+func camel(s string, upper bool) string {
+	var b strings.Builder
+	next := upper
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			next = b.Len() > 0 || upper
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('_')
+		}
+		if next {
+			r = unicode.ToUpper(r)
+			next = false
+		} else if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package openapi
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func parseTestdata(t *testing.T) *Document {
+	f, err := os.Open("testdata/arith.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	doc, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestGenerateGo(t *testing.T) {
+	src, err := GenerateGo(parseTestdata(t), "arith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"package arith",
+		"type Args struct {",
+		"A int64 `json:\"A\"`",
+		"Tags []string `json:\"tags,omitempty\"`",
+		"func (c *Client) ArithMul(ctx context.Context, args *Args) (*Reply, error) {",
+		"func (c *Client) Sum(ctx context.Context, args []int64) (int64, error) {",
+		"func (c *Client) ArithStats(ctx context.Context) (*ArithStatsReply, error) {",
+		"ByMethod map[string]float64",
+		"Last     ArithStatsReplyLast",
+		"type ArithStatsReplyLast struct {",
+	} {
+		if !strings.Contains(string(src), expect) {
+			t.Errorf("expect %q in:\n%s", expect, src)
+		}
+	}
+}
+
+func TestGenerateTypeScript(t *testing.T) {
+	src := string(GenerateTypeScript(parseTestdata(t)))
+	for _, expect := range []string{
+		"export interface Args {\n  A: number;\n  B: number;\n}",
+		"tags?: string[];",
+		"arithMul(args: Args, init?: RequestInit): Promise<Reply> {",
+		`return this.call("POST", "/arith/mul", args, init);`,
+		"sum(args: number[], init?: RequestInit): Promise<number> {",
+		"arithStats(init?: RequestInit): Promise<{\n    by_method?: Record<string, number>;",
+	} {
+		if !strings.Contains(src, expect) {
+			t.Errorf("expect %q in:\n%s", expect, src)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GenerateTypeScript returns the source of a TypeScript client of the gateway described by doc,
+// it uses fetch.
+func GenerateTypeScript(doc *Document) []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by myrpc-gen from an OpenAPI document. DO NOT EDIT.\n\n")
+	for _, name := range doc.SchemaNames() {
+		s := doc.Components.Schemas[name]
+		if s.Description != "" {
+			fmt.Fprintf(&b, "/** %s */\n", oneLine(s.Description))
+		}
+		if isObject(s) {
+			fmt.Fprintf(&b, "export interface %s %s\n\n", camel(name, true), tsType(s, ""))
+		} else {
+			fmt.Fprintf(&b, "export type %s = %s;\n\n", camel(name, true), tsType(s, ""))
+		}
+	}
+	b.WriteString(tsClient)
+	for _, m := range doc.Methods() {
+		name := camel(m.Name, false)
+		params := ""
+		args := "undefined"
+		if m.Args != nil && m.HTTPMethod != "GET" {
+			params = "args: " + tsType(m.Args, "  ") + ", "
+			args = "args"
+		}
+		reply := "void"
+		if m.Reply != nil {
+			reply = tsType(m.Reply, "  ")
+		}
+		b.WriteString("\n")
+		if m.Summary != "" {
+			fmt.Fprintf(&b, "  /** %s */\n", oneLine(m.Summary))
+		}
+		fmt.Fprintf(&b, "  %s(%sinit?: RequestInit): Promise<%s> {\n", name, params, reply)
+		fmt.Fprintf(&b, "    return this.call(%q, %q, %s, init);\n", m.HTTPMethod, m.Path, args)
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// tsType returns the TypeScript type of s, indent is the indentation of the enclosing declaration.
+func tsType(s *Schema, indent string) string {
+	if s == nil {
+		return "unknown"
+	}
+	if s.Ref != "" {
+		return camel(s.refName(), true)
+	}
+	switch s.Type {
+	case "object":
+		if len(s.Properties) > 0 {
+			var b strings.Builder
+			b.WriteString("{\n")
+			for _, prop := range s.propertyNames() {
+				ps := s.Properties[prop]
+				if ps.Description != "" {
+					fmt.Fprintf(&b, "%s  /** %s */\n", indent, oneLine(ps.Description))
+				}
+				optional := "?"
+				if s.isRequired(prop) {
+					optional = ""
+				}
+				fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, tsName(prop), optional, tsType(ps, indent+"  "))
+			}
+			b.WriteString(indent + "}")
+			return b.String()
+		}
+		if add := s.additional(); add != nil {
+			return "Record<string, " + tsType(add, indent) + ">"
+		}
+		return "Record<string, unknown>"
+	case "array":
+		item := tsType(s.Items, indent)
+		if strings.ContainsAny(item, " |") {
+			item = "(" + item + ")"
+		}
+		return item + "[]"
+	case "string":
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	default:
+		return "unknown"
+	}
+}
+
+// tsName quotes the property name if it is not an identifier.
+func tsName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
+
+const tsClient = `/** An error response of the gateway. */
+export class GatewayError extends Error {
+  constructor(public status: number, public type: string, message: string) {
+    super(message);
+  }
+}
+
+/** Calls the gateway at baseURL. */
+export class Client {
+  /** headers are added to each request, e.g. the API key. */
+  constructor(public baseURL: string, public headers: Record<string, string> = {}) {
+    this.baseURL = baseURL.replace(/\/+$/, "");
+  }
+
+  private async call<T>(method: string, path: string, args: unknown, init?: RequestInit): Promise<T> {
+    const resp = await fetch(this.baseURL + path, {
+      ...init,
+      method,
+      headers: { ...this.headers, "Content-Type": "application/json" },
+      body: method === "GET" ? undefined : JSON.stringify(args === undefined ? null : args),
+    });
+    if (!resp.ok) {
+      let envelope: { error?: { status: number; type?: string; message: string } } = {};
+      try {
+        envelope = await resp.json();
+      } catch (e) {
+        // not an error envelope.
+      }
+      const err = envelope.error;
+      throw new GatewayError(resp.status, (err && err.type) || "", err ? err.message : resp.statusText);
+    }
+    if (resp.status === 204) {
+      return undefined as unknown as T;
+    }
+    return (await resp.json()) as T;
+  }
+`
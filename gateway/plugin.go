@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/henrylee2cn/myrpc/plugin"
+)
+
+type (
+	//IPreCallPlugin is called for each HTTP request before it is translated into a call.
+	// path is the service path of the request, without Prefix and query.
+	// If it returns an error, the request is refused, with the status code of the error if it is an *Error.
+	// It may rewrite r, e.g. to remove query parameters meant for the gateway only.
+	IPreCallPlugin interface {
+		PreCall(w http.ResponseWriter, r *http.Request, path string) error
+	}
+
+	// Error is an error with the HTTP status code of the response.
+	Error struct {
+		Status  int
+		Message string
+	}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// doPreCall runs the IPreCallPlugins, it writes the refusal if one of them returns an error.
+func doPreCall(plugins []plugin.IPlugin, w http.ResponseWriter, r *http.Request, path string) bool {
+	for _, p := range plugins {
+		if p, ok := p.(IPreCallPlugin); ok {
+			if err := p.PreCall(w, r, path); err != nil {
+				status := http.StatusForbidden
+				if e, ok := err.(*Error); ok {
+					status = e.Status
+				}
+				writeError(w, status, err.Error())
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// acceptsEventStream reports whether r accepts Server-Sent Events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header["Accept"] {
+		if strings.Contains(accept, "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveSSE answers a call as a Server-Sent Events stream:
+//
+//	event: reply
+//	data: {"C":56}
+//
+//	event: end
+//	data:
+//
+// Each reply is a "reply" event, a failure is an "error" event, and "end" closes the stream.
+// The services reply once, so a call currently produces a single reply event.
+func (g *Gateway) serveSSE(w http.ResponseWriter, r *http.Request, serviceMethod string, args []byte) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "streaming unsupported")
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ew := &eventWriter{w: w, flusher: flusher}
+	reply, rpcErr := g.call(r, serviceMethod, args)
+	if rpcErr != nil {
+		data, _ := json.Marshal(&errorEnvelope{Error: g.rpcErrorDetail(rpcErr)})
+		ew.send("error", data)
+	} else {
+		ew.send("reply", reply)
+	}
+	ew.send("end", nil)
+}
+
+// eventWriter writes Server-Sent Events.
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (ew *eventWriter) send(event string, data []byte) error {
+	var b strings.Builder
+	b.WriteString("event: ")
+	b.WriteString(event)
+	b.WriteString("\n")
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	if _, err := ew.w.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	ew.flusher.Flush()
+	return nil
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// APIKeyHeader is the default header carrying the API key of a request.
+const APIKeyHeader = "X-API-Key"
+
+// Limit is a token bucket rate limit.
+type Limit struct {
+	// Rate is the number of requests per second.
+	Rate float64
+	// Burst is the maximum number of requests at once, 1 if 0.
+	Burst int
+}
+
+// ThrottlePlugin limits the request rate of each API key at the gateway,
+// independently of any limiter of the RPC server.
+// Throttled requests are refused with 429 Too Many Requests and a Retry-After header.
+// The requests without API key are limited per client IP.
+type ThrottlePlugin struct {
+	// KeyHeader is the header carrying the API key, APIKeyHeader if empty.
+	KeyHeader string
+	limit     Limit
+	limits    map[string]Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+var _ IPreCallPlugin = new(ThrottlePlugin)
+
+// bucket is the token bucket of a key.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewThrottlePlugin creates a ThrottlePlugin applying limit to each API key.
+func NewThrottlePlugin(limit Limit) *ThrottlePlugin {
+	return &ThrottlePlugin{
+		limit:   limit,
+		limits:  make(map[string]Limit),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Name returns plugin name.
+func (p *ThrottlePlugin) Name() string {
+	return "ThrottlePlugin"
+}
+
+// SetLimit overrides the limit of the API key.
+func (p *ThrottlePlugin) SetLimit(key string, limit Limit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limits[key] = limit
+	delete(p.buckets, "key:"+key)
+}
+
+// PreCall takes a token from the bucket of the API key of r.
+func (p *ThrottlePlugin) PreCall(w http.ResponseWriter, r *http.Request, path string) error {
+	keyHeader := p.KeyHeader
+	if keyHeader == "" {
+		keyHeader = APIKeyHeader
+	}
+	apiKey := r.Header.Get(keyHeader)
+	p.mu.Lock()
+	limit, ok := p.limits[apiKey]
+	if !ok || apiKey == "" {
+		limit = p.limit
+	}
+	var key string
+	if apiKey != "" {
+		key = "key:" + apiKey
+	} else {
+		key = "ip:" + clientIP(r)
+	}
+	wait := p.take(key, limit, time.Now())
+	p.mu.Unlock()
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return &Error{Status: http.StatusTooManyRequests, Message: "too many requests"}
+	}
+	return nil
+}
+
+// take takes a token from the bucket of key,
+// it returns how long to wait for the next token if the bucket is empty.
+func (p *ThrottlePlugin) take(key string, limit Limit, now time.Time) time.Duration {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	b, ok := p.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		p.buckets[key] = b
+		p.sweep(now)
+	} else if limit.Rate > 0 {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	if limit.Rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// sweep drops the buckets idle for more than a minute, at most once a minute.
+func (p *ThrottlePlugin) sweep(now time.Time) {
+	if now.Sub(p.lastSweep) < time.Minute {
+		return
+	}
+	p.lastSweep = now
+	for key, b := range p.buckets {
+		if now.Sub(b.last) > time.Minute {
+			delete(p.buckets, key)
+		}
+	}
+}
+
+// clientIP returns the IP of the remote address of r.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// The timing of Await.
+var (
+	// AwaitWait is the Wait of the status requests of Await.
+	AwaitWait = 10 * time.Second
+	// AwaitMinBackoff and AwaitMaxBackoff bound the delay before Await retries a status request that failed.
+	AwaitMinBackoff = 100 * time.Millisecond
+	AwaitMaxBackoff = 5 * time.Second
+)
+
+// Await waits for the job id, submitted through c, to finish, and decodes its result into result, unless it is nil.
+// The error of a Failed or Canceled job is of type common.ErrorTypeServerService.
+// The status requests that fail on the client side, e.g. because the connection broke, are retried with an exponential backoff,
+// until ctx is done.
+func Await(ctx context.Context, c *client.Client, id string, result interface{}) *common.RPCError {
+	backoff := AwaitMinBackoff
+	for {
+		var status Status
+		rpcErr := c.CallContext(ctx, StatusPath, &StatusArgs{ID: id, Wait: AwaitWait}, &status)
+		switch {
+		case rpcErr == nil:
+			backoff = AwaitMinBackoff
+		case rpcErr.Type > 0 || rpcErr.Type == common.ErrorTypeClientCanceled:
+			return rpcErr
+		default:
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return &common.RPCError{
+					Type:   common.ErrorTypeClientCanceled,
+					Error:  ctx.Err().Error(),
+					Causes: []error{ctx.Err()},
+				}
+			case <-timer.C:
+			}
+			if backoff *= 2; backoff > AwaitMaxBackoff {
+				backoff = AwaitMaxBackoff
+			}
+			continue
+		}
+
+		switch status.State {
+		case Done:
+			if result == nil {
+				return nil
+			}
+			if err := json.Unmarshal(status.Result, result); err != nil {
+				return common.NewRPCError(common.ErrorTypeClientReadResponseBody, err.Error())
+			}
+			return nil
+		case Failed:
+			return common.NewRPCError(common.ErrorTypeServerService, status.Error)
+		case Canceled:
+			return common.NewRPCError(common.ErrorTypeServerService, "jobs: job "+id+" canceled")
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Package jobs runs long-running jobs on a server: a service method submits a job and replies its ID at once,
+// and the client awaits the job through the "/_/jobs/status" service.
+//
+//	mgr := new(jobs.Manager)
+//	srv.Internal().NamedRegister(jobs.ServiceName, mgr)
+//
+//	func (r *Report) Export(args *ExportArgs, id *string) error {
+//		*id = mgr.Submit(func(ctx context.Context, progress func(float64)) (interface{}, error) {
+//			...
+//		})
+//		return nil
+//	}
+//
+// and on the client:
+//
+//	var id string
+//	c.Call("/report/export", args, &id)
+//	var url string
+//	rpcErr := jobs.Await(ctx, c, id, &url)
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ServiceName is the name under which a Manager is registered among the built-in services of the server,
+// so that its services are "/_/jobs/status" and "/_/jobs/cancel".
+const ServiceName = "jobs"
+
+// The paths of the services of a Manager.
+const (
+	StatusPath = "/_/" + ServiceName + "/status"
+	CancelPath = "/_/" + ServiceName + "/cancel"
+)
+
+// State is the state of a job.
+type State int
+
+const (
+	// Running means the job is in progress.
+	Running State = iota
+	// Done means the job succeeded, its result is available.
+	Done
+	// Failed means the job returned an error.
+	Failed
+	// Canceled means the job was canceled before it finished.
+	Canceled
+)
+
+var stateStrs = [...]string{
+	"Running",
+	"Done",
+	"Failed",
+	"Canceled",
+}
+
+func (s State) String() string {
+	return stateStrs[s]
+}
+
+type (
+	// Func is the function of a job. It reports its progress, in [0, 1], with progress,
+	// and returns its result, which must be JSON-encodable.
+	// ctx is canceled when the job is canceled.
+	Func func(ctx context.Context, progress func(float64)) (interface{}, error)
+
+	// Status is the reply of the "/jobs/status" service.
+	Status struct {
+		ID       string
+		State    State
+		Progress float64
+		// Error is the error of a Failed job.
+		Error string
+		// Result is the JSON of the result of a Done job.
+		Result []byte
+	}
+
+	// StatusArgs is the args of the "/jobs/status" service.
+	StatusArgs struct {
+		ID string
+		// Wait, if it is not 0, holds the reply of a Running job until it progresses or for Wait,
+		// so that clients are notified without polling.
+		Wait time.Duration
+	}
+
+	// Manager runs the jobs, and serves their status once registered.
+	Manager struct {
+		// TTL is how long a finished job is kept for its status.
+		// If 0, 10 minutes is used.
+		TTL time.Duration
+		// MaxWait bounds the Wait of the status requests.
+		// If 0, 30s is used.
+		MaxWait time.Duration
+
+		jobs map[string]*job
+		mu   sync.Mutex
+	}
+
+	job struct {
+		status  Status
+		changed chan struct{} // closed and replaced when status changes
+		cancel  context.CancelFunc
+	}
+)
+
+// ErrNotFound is returned for an unknown or expired job.
+var ErrNotFound = errors.New("jobs: job not found")
+
+// Submit starts fn in a new goroutine, and returns the ID of its job.
+func (m *Manager) Submit(fn Func) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{changed: make(chan struct{}), cancel: cancel}
+	j.status.ID = newID()
+	m.mu.Lock()
+	if m.jobs == nil {
+		m.jobs = make(map[string]*job)
+	}
+	m.jobs[j.status.ID] = j
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result, err := fn(ctx, func(progress float64) {
+			m.update(j, func(s *Status) {
+				s.Progress = progress
+			})
+		})
+		var b []byte
+		if err == nil {
+			b, err = json.Marshal(result)
+		}
+		m.update(j, func(s *Status) {
+			switch {
+			case s.State != Running:
+			case err != nil:
+				s.State = Failed
+				s.Error = err.Error()
+			default:
+				s.State = Done
+				s.Progress = 1
+				s.Result = b
+			}
+		})
+		ttl := m.TTL
+		if ttl <= 0 {
+			ttl = 10 * time.Minute
+		}
+		time.AfterFunc(ttl, func() {
+			m.mu.Lock()
+			delete(m.jobs, j.status.ID)
+			m.mu.Unlock()
+		})
+	}()
+	return j.status.ID
+}
+
+// update changes the status of a Running job, and notifies the waiting status requests.
+func (m *Manager) update(j *job, change func(*Status)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j.status.State != Running {
+		return
+	}
+	change(&j.status)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Status is the "/jobs/status" service, it replies the status of the job args.ID.
+func (m *Manager) Status(ctx context.Context, args *StatusArgs, reply *Status) error {
+	m.mu.Lock()
+	j, ok := m.jobs[args.ID]
+	if !ok {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	status, changed := j.status, j.changed
+	m.mu.Unlock()
+
+	if status.State == Running && args.Wait > 0 {
+		wait := args.Wait
+		maxWait := m.MaxWait
+		if maxWait <= 0 {
+			maxWait = 30 * time.Second
+		}
+		if wait > maxWait {
+			wait = maxWait
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		m.mu.Lock()
+		status = j.status
+		m.mu.Unlock()
+	}
+	*reply = status
+	return nil
+}
+
+// Cancel is the "/jobs/cancel" service, it cancels the job id, and replies whether it was Running.
+func (m *Manager) Cancel(id string, reply *bool) error {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	m.update(j, func(s *Status) {
+		s.State = Canceled
+		*reply = true
+	})
+	j.cancel()
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type Report struct {
+	mgr     *Manager
+	release chan struct{}
+}
+
+func (r *Report) Export(rows int, id *string) error {
+	*id = r.mgr.Submit(func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		if rows < 0 {
+			return nil, errors.New("negative rows")
+		}
+		progress(0.5)
+		select {
+		case <-r.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return []int{rows, rows * 2}, nil
+	})
+	return nil
+}
+
+var servers int
+
+func newClient(t *testing.T) (*client.Client, *Report) {
+	servers++
+	address := "jobs-" + strconv.Itoa(servers)
+	mgr := new(Manager)
+	report := &Report{mgr: mgr, release: make(chan struct{})}
+	srv := server.NewServer(server.Server{})
+	srv.Internal().NamedRegister(ServiceName, mgr)
+	srv.Register(report)
+	go srv.Serve("mem", address)
+	time.Sleep(10 * time.Millisecond)
+	c := client.NewClient(client.Client{}, &selector.DirectSelector{Network: "mem", Address: address})
+	t.Cleanup(func() { c.Close() })
+	return c, report
+}
+
+func TestAwait(t *testing.T) {
+	c, report := newClient(t)
+
+	var id string
+	if rpcErr := c.Call("/report/export", 3, &id); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	var status Status
+	if rpcErr := c.Call(StatusPath, &StatusArgs{ID: id, Wait: time.Second}, &status); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if status.State != Running || status.Progress != 0.5 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { close(report.release) })
+	var result []int
+	if rpcErr := Await(context.Background(), c, id, &result); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if len(result) != 2 || result[1] != 6 {
+		t.Fatalf("unexpected result: %v", result)
+	}
+
+	if rpcErr := c.Call("/report/export", -1, &id); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	rpcErr := Await(context.Background(), c, id, nil)
+	if rpcErr == nil || rpcErr.Type != common.ErrorTypeServerService || rpcErr.Error != "negative rows" {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+
+	rpcErr = Await(context.Background(), c, "unknown", nil)
+	if rpcErr == nil || rpcErr.Error != ErrNotFound.Error() {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c, _ := newClient(t)
+
+	var id string
+	if rpcErr := c.Call("/report/export", 3, &id); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rpcErr := Await(ctx, c, id, nil)
+	if rpcErr == nil || !errors.Is(rpcErr.Err(), context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+
+	var running bool
+	if rpcErr = c.Call(CancelPath, id, &running); rpcErr != nil || !running {
+		t.Fatalf("unexpected cancel: %v, %v", running, rpcErr)
+	}
+	rpcErr = Await(context.Background(), c, id, nil)
+	if rpcErr == nil || rpcErr.Type != common.ErrorTypeServerService {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+}
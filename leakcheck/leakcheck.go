@@ -0,0 +1,101 @@
+// Package leakcheck detects the goroutines leaked by a test, e.g. the readers of the invokers of a client
+// not closed, or the goroutines waiting for a call stranded:
+//
+//	func TestCall(t *testing.T) {
+//		defer leakcheck.Check(t)()
+//		c := client.NewClient(client.Client{}, sel)
+//		defer c.Close()
+//		...
+//	}
+//
+// The deferred functions run in reverse order, so the client is closed before the goroutines are checked.
+package leakcheck
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Timeout is how long the function returned by Check waits for the goroutines to exit.
+var Timeout = 5 * time.Second
+
+// ignored are the functions of the goroutines of the runtime and of the testing package.
+var ignored = []string{
+	"testing.tRunner(",
+	"testing.(*M).",
+	"testing.runTests(",
+	"testing.(*T).Run(",
+	"runtime.ensureSigM(",
+	"os/signal.signal_recv(",
+	"os/signal.loop(",
+	"created by runtime.gc",
+	"created by os/signal.Notify",
+}
+
+// Check snapshots the goroutines running, and returns a function reporting to t as errors
+// those started since and still running once Timeout passes, with their stack.
+func Check(t testing.TB) func() {
+	before := Goroutines()
+	return func() {
+		t.Helper()
+		var leaked []string
+		deadline := time.Now().Add(Timeout)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range Goroutines() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		sort.Strings(leaked)
+		for _, stack := range leaked {
+			t.Errorf("leakcheck: leaked goroutine: %s", stack)
+		}
+	}
+}
+
+// Goroutines returns the stacks of the goroutines running, keyed by their header, e.g. "goroutine 7",
+// except the current goroutine and those of the runtime and of the testing package.
+func Goroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := strings.Split(string(buf), "\n\n")
+	goroutines := make(map[string]string, len(stacks))
+	// the first stack is the current goroutine.
+	for _, stack := range stacks[1:] {
+		stack = strings.TrimSpace(stack)
+		if stack == "" || isIgnored(stack) {
+			continue
+		}
+		header := stack
+		if i := strings.Index(stack, " ["); i > 0 {
+			header = stack[:i]
+		}
+		goroutines[header] = stack
+	}
+	return goroutines
+}
+
+func isIgnored(stack string) bool {
+	for _, f := range ignored {
+		if strings.Contains(stack, f) {
+			return true
+		}
+	}
+	return false
+}
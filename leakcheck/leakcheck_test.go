@@ -0,0 +1,127 @@
+package leakcheck
+
+import (
+	"io"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// recorder records the errors reported by Check.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, format)
+}
+
+func TestCheck(t *testing.T) {
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 100 * time.Millisecond
+
+	r := &recorder{TB: t}
+	stop := make(chan struct{})
+	done := Check(r)
+	go func() { <-stop }()
+	done()
+	if len(r.errors) != 1 {
+		t.Fatalf("got %d leaks, want 1", len(r.errors))
+	}
+
+	close(stop)
+	r.errors = nil
+	done = Check(r)
+	go func() {}()
+	done()
+	if len(r.errors) != 0 {
+		t.Fatalf("got %d leaks, want 0", len(r.errors))
+	}
+}
+
+type Arith struct{}
+
+type Args struct {
+	A, B int
+}
+
+func (Arith) Mul(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+// panicCodec is a gob codec panicking on reading the response bodies, or on writing the requests.
+type panicCodec struct {
+	rpc.ClientCodec
+	write bool
+}
+
+func (c *panicCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	if c.write {
+		panic("write")
+	}
+	return c.ClientCodec.WriteRequest(r, body)
+}
+
+func (c *panicCodec) ReadResponseBody(body interface{}) error {
+	if !c.write {
+		panic("read")
+	}
+	return c.ClientCodec.ReadResponseBody(body)
+}
+
+func TestInvokerPanic(t *testing.T) {
+	for _, test := range []struct {
+		address string
+		write   bool
+		typ     common.ErrorType
+	}{
+		{"leakcheck-read", false, common.ErrorTypeClientConnectionLost},
+		{"leakcheck-write", true, common.ErrorTypeClientWriteRequest},
+	} {
+		t.Run(test.address, func(t *testing.T) {
+			lis, err := memnet.Listen(test.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			srv := server.NewServer(server.Server{})
+			srv.Register(new(Arith))
+			go srv.ServeListener(lis)
+			// the server keeps serving once the listener is closed, its connections must exit.
+			defer Check(t)()
+
+			c := client.NewClient(client.Client{
+				ClientCodecFunc: func(conn io.ReadWriteCloser) rpc.ClientCodec {
+					return &panicCodec{ClientCodec: codecGob.NewGobClientCodec(conn), write: test.write}
+				},
+				MaxTry: 1,
+			}, &selector.DirectSelector{
+				Network:     memnet.Network,
+				Address:     test.address,
+				DialTimeout: time.Second,
+			})
+			defer c.Close()
+
+			var reply int
+			rpcErr := c.Call("/arith/mul", &Args{7, 8}, &reply)
+			if rpcErr == nil || rpcErr.Type != test.typ {
+				t.Fatalf("got error %v, want type %d", rpcErr, test.typ)
+			}
+			if test.typ == common.ErrorTypeClientConnectionLost && !strings.Contains(rpcErr.Error, test.address) {
+				t.Fatalf("got error %q, want the address", rpcErr.Error)
+			}
+		})
+	}
+}
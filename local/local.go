@@ -0,0 +1,134 @@
+// Package local calls the services of a server living in the same process, e.g. in a modular monolith,
+// skipping the network, the encoding and the connection-level plugins, see server.Server.Invoke.
+//
+//	c := client.NewClient(client.Client{}, &local.Invoker{Server: srv})
+//	c.Call("/arith/mul", args, &reply)
+package local
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// Invoker is a client.Invoker calling the services of Server in process.
+// It is also the client.Selector of itself, for client.NewClient.
+type Invoker struct {
+	Server *server.Server
+	// Plugins runs the plugins of Server that see the calls, see server.Server.Invoke.
+	Plugins bool
+	// Copy copies args and the reply with gob, so that the client and the service method do not share them,
+	// as over the network.
+	Copy bool
+}
+
+var _ client.Invoker = new(Invoker)
+
+// Call invokes the named function, waits for it to complete, and returns its error status.
+func (inv *Invoker) Call(serviceMethod string, args interface{}, reply interface{}) *common.RPCError {
+	if !inv.Copy {
+		return inv.Server.Invoke(serviceMethod, args, reply, inv.Plugins)
+	}
+	if args != nil {
+		copied := reflect.New(reflect.TypeOf(args))
+		if err := copyValue(copied.Interface(), args); err != nil {
+			return common.NewRPCError(common.ErrorTypeClientWriteRequest, err.Error())
+		}
+		args = copied.Elem().Interface()
+	}
+	replyv := reflect.ValueOf(reply)
+	if replyv.Kind() != reflect.Ptr || replyv.IsNil() {
+		return inv.Server.Invoke(serviceMethod, args, reply, inv.Plugins)
+	}
+	result := reflect.New(replyv.Type().Elem())
+	if rpcErr := inv.Server.Invoke(serviceMethod, args, result.Interface(), inv.Plugins); rpcErr != nil {
+		return rpcErr
+	}
+	if err := copyValue(reply, result.Interface()); err != nil {
+		return common.NewRPCError(common.ErrorTypeClientReadResponseBody, err.Error())
+	}
+	return nil
+}
+
+// copyValue copies src into the pointer dst with gob.
+func copyValue(dst, src interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(src); err != nil {
+		return err
+	}
+	return gob.NewDecoder(&buf).Decode(dst)
+}
+
+// Go invokes the function asynchronously, see client.Invoker.
+func (inv *Invoker) Go(serviceMethod string, args interface{}, reply interface{}, done chan *client.Call) *client.Call {
+	call := &client.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+	}
+	if done == nil {
+		done = make(chan *client.Call, 10) // buffered.
+	} else if cap(done) == 0 {
+		log.Panic("rpc: done channel is unbuffered")
+	}
+	call.Done = done
+	go func() {
+		call.Error = inv.Call(serviceMethod, args, reply)
+		select {
+		case call.Done <- call:
+		default:
+			log.Debug("rpc: discarding Call reply due to insufficient Done chan capacity")
+		}
+	}()
+	return call
+}
+
+// Close does nothing, there is no connection.
+func (inv *Invoker) Close() error {
+	return nil
+}
+
+// State returns client.Ready, there is no connection.
+func (inv *Invoker) State() client.InvokerState {
+	return client.Ready
+}
+
+// LastError returns nil, there is no connection.
+func (inv *Invoker) LastError() *common.RPCError {
+	return nil
+}
+
+// Address returns server.LocalAddr.
+func (inv *Invoker) Address() string {
+	return server.LocalAddr
+}
+
+var _ client.Selector = new(Invoker)
+
+// SetSelectMode is meaningless for Invoker because there is only one invoker.
+func (inv *Invoker) SetSelectMode(client.SelectMode) {}
+
+// SetNewInvokerFunc is meaningless for Invoker because there is no connection.
+func (inv *Invoker) SetNewInvokerFunc(client.NewInvokerFunc) {}
+
+// Select returns inv.
+func (inv *Invoker) Select(options ...interface{}) (client.Invoker, error) {
+	return inv, nil
+}
+
+// List returns inv.
+func (inv *Invoker) List() []client.Invoker {
+	return []client.Invoker{inv}
+}
+
+// HandleFailed does nothing, there is no connection to fail.
+func (inv *Invoker) HandleFailed(client.Invoker) {}
+
+// HandleResult does nothing, there is only one invoker.
+func (inv *Invoker) HandleResult(client.Invoker, error, time.Duration) {}
@@ -0,0 +1,119 @@
+package local
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type Args struct {
+	A, B int
+	Seen bool
+}
+
+type Arith struct{}
+
+func (*Arith) Mul(args *Args, reply *int) error {
+	args.Seen = true
+	*reply = args.A * args.B
+	return nil
+}
+
+func (*Arith) Div(args Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+type denyPlugin struct {
+	remoteAddr string
+}
+
+func (*denyPlugin) Name() string {
+	return "denyPlugin"
+}
+
+func (p *denyPlugin) PostReadRequestHeader(ctx *server.Context) error {
+	p.remoteAddr = ctx.RemoteAddr()
+	if ctx.Query().Get("deny") != "" {
+		return errors.New("denied")
+	}
+	return nil
+}
+
+func newServer() (*server.Server, *denyPlugin) {
+	srv := server.NewServer(server.Server{})
+	p := new(denyPlugin)
+	srv.PluginContainer.Add(p)
+	srv.Register(new(Arith))
+	return srv, p
+}
+
+func TestInvoker(t *testing.T) {
+	srv, p := newServer()
+	c := client.NewClient(client.Client{}, &Invoker{Server: srv})
+
+	args := &Args{A: 6, B: 7}
+	var reply int
+	if rpcErr := c.Call("/arith/mul?deny=1", args, &reply); rpcErr != nil || reply != 42 {
+		t.Fatalf("unexpected result: %d, %v", reply, rpcErr)
+	}
+	if !args.Seen {
+		t.Fatal("expect args shared with the service method")
+	}
+	if p.remoteAddr != "" {
+		t.Fatal("expect no plugin run")
+	}
+	if rpcErr := c.Call("/arith/div", Args{A: 6, B: 2}, &reply); rpcErr != nil || reply != 3 {
+		t.Fatalf("unexpected result: %d, %v", reply, rpcErr)
+	}
+	if rpcErr := c.Call("/arith/div", &Args{A: 6}, &reply); rpcErr == nil || rpcErr.Type != common.ErrorTypeServerService {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+	if rpcErr := c.Call("/arith/add", args, &reply); rpcErr == nil || rpcErr.Type != common.ErrorTypeServerNotFoundService {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+	if rpcErr := c.Call("/arith/mul", "6*7", &reply); rpcErr == nil || rpcErr.Type != common.ErrorTypeServerReadRequestBody {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+
+	call := <-c.Go("/arith/mul", &Args{A: 2, B: 3}, &reply, nil).Done
+	if call.Error != nil || reply != 6 {
+		t.Fatalf("unexpected result: %d, %v", reply, call.Error)
+	}
+}
+
+func TestPluginsAndCopy(t *testing.T) {
+	srv, p := newServer()
+	c := client.NewClient(client.Client{}, &Invoker{Server: srv, Plugins: true, Copy: true})
+
+	args := &Args{A: 6, B: 7}
+	var reply int
+	if rpcErr := c.Call("/arith/mul", args, &reply); rpcErr != nil || reply != 42 {
+		t.Fatalf("unexpected result: %d, %v", reply, rpcErr)
+	}
+	if args.Seen {
+		t.Fatal("expect args copied")
+	}
+	if p.remoteAddr != server.LocalAddr {
+		t.Fatalf("unexpected remote address: %q", p.remoteAddr)
+	}
+	if rpcErr := c.Call("/arith/mul?deny=1", args, &reply); rpcErr == nil || rpcErr.Type != common.ErrorTypeServerPostReadRequestHeader {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+}
+
+func BenchmarkInvoker(b *testing.B) {
+	srv, _ := newServer()
+	inv := &Invoker{Server: srv}
+	args := &Args{A: 6, B: 7}
+	var reply int
+	for i := 0; i < b.N; i++ {
+		inv.Call("/arith/mul", args, &reply)
+	}
+}
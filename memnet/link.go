@@ -0,0 +1,129 @@
+package memnet
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Link shapes one direction of the connections of a Listener, e.g. to exercise deadlines and timeouts
+// over a realistic network in tests.
+type Link struct {
+	// Latency delays the bytes written before they can be read.
+	Latency time.Duration
+	// Bandwidth, if it is not 0, is the number of bytes transmitted per second,
+	// the writes block while the bytes before are transmitted.
+	Bandwidth int
+}
+
+// linkQueueSize is the number of writes in flight on a link before the writes block.
+const linkQueueSize = 256
+
+// shape returns c writing over link, or c if link does not shape it.
+func shape(c net.Conn, link Link) net.Conn {
+	if link.Latency <= 0 && link.Bandwidth <= 0 {
+		return c
+	}
+	sc := &shapedConn{
+		Conn:   c,
+		link:   link,
+		queue:  make(chan segment, linkQueueSize),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go sc.pump()
+	return sc
+}
+
+// segment is the bytes of a write, readable at a given time.
+type segment struct {
+	b  []byte
+	at time.Time
+}
+
+// shapedConn is a conn the writes of which are queued, and written to the pipe once they pass the link.
+// The writes being buffered, the write deadlines are ignored. The bytes in flight are lost on Close.
+type shapedConn struct {
+	net.Conn
+	link   Link
+	mu     sync.Mutex // serializes the writes
+	free   time.Time  // when the bytes written are transmitted
+	queue  chan segment
+	closed chan struct{}
+	once   sync.Once
+	done   chan struct{} // closed once pump exits
+	err    error         // why pump exited
+}
+
+// Write blocks until b is transmitted, if Bandwidth is set, and returns while b is in flight.
+func (c *shapedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.free.Before(now) {
+		c.free = now
+	}
+	if c.link.Bandwidth > 0 {
+		c.free = c.free.Add(time.Duration(len(b)) * time.Second / time.Duration(c.link.Bandwidth))
+		if wait := c.free.Sub(now); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-c.done:
+				timer.Stop()
+				return 0, c.err
+			}
+		}
+	}
+	seg := segment{b: append([]byte(nil), b...), at: c.free.Add(c.link.Latency)}
+	select {
+	case c.queue <- seg:
+		return len(b), nil
+	case <-c.done:
+		return 0, c.err
+	}
+}
+
+// pump writes the segments queued to the pipe once they are readable, until Close or a write fails.
+func (c *shapedConn) pump() {
+	defer close(c.done)
+	for {
+		var seg segment
+		select {
+		case <-c.closed:
+			c.err = net.ErrClosed
+			return
+		case seg = <-c.queue:
+		}
+		if wait := time.Until(seg.at); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-c.closed:
+				timer.Stop()
+				c.err = net.ErrClosed
+				return
+			}
+		}
+		if _, err := c.Conn.Write(seg.b); err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// SetDeadline sets the read deadline, see shapedConn.
+func (c *shapedConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline does nothing, see shapedConn.
+func (c *shapedConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Close closes the conn, the bytes in flight are lost.
+func (c *shapedConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
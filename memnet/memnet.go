@@ -0,0 +1,158 @@
+// Package memnet provides an in-memory network, to run servers and clients in one process
+// without sockets, e.g. in tests. Its connections are net.Pipe pairs, its network name is "mem"
+// and any string is an address:
+//
+//	go srv.Serve("mem", "arith")
+//	c := client.NewClient(client.Client{}, &selector.DirectSelector{Network: "mem", Address: "arith"})
+package memnet
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Network is the name of the in-memory network.
+const Network = "mem"
+
+var (
+	mu        sync.Mutex
+	listeners = make(map[string]*Listener)
+	dialSeq   uint64
+)
+
+// Addr is an address of the in-memory network.
+type Addr string
+
+// Network returns "mem".
+func (a Addr) Network() string {
+	return Network
+}
+
+func (a Addr) String() string {
+	return string(a)
+}
+
+// Listener is a net.Listener of the in-memory network.
+type Listener struct {
+	// DialHook, if it is not nil, is called with the client end of each dialed connection,
+	// and returns the connection handed to the dialer, or an error to refuse it, e.g. to inject faults.
+	// It must be set before the listener is dialed.
+	DialHook func(conn net.Conn) (net.Conn, error)
+	// Upstream shapes the bytes written by the clients, Downstream those written by the server, see Link.
+	// They must be set before the listener is dialed.
+	Upstream, Downstream Link
+	addr                 Addr
+	conns                chan net.Conn
+	done                 chan struct{}
+	once                 sync.Once
+}
+
+var _ net.Listener = new(Listener)
+
+// Listen announces on the in-memory address, which must not be in use.
+func Listen(address string) (*Listener, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := listeners[address]; ok {
+		return nil, fmt.Errorf("memnet: address %q already in use", address)
+	}
+	l := &Listener{
+		addr:  Addr(address),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	listeners[address] = l
+	return l, nil
+}
+
+// Accept waits for and returns the next connection to the listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, &net.OpError{Op: "accept", Net: Network, Addr: l.addr, Err: net.ErrClosed}
+	}
+}
+
+// Close closes the listener and frees its address.
+// The accepted connections are not closed.
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		mu.Lock()
+		delete(listeners, string(l.addr))
+		mu.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+// Addr returns the listener's network address.
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Dial connects to the listener of address.
+func Dial(address string) (net.Conn, error) {
+	return DialTimeout(address, 0)
+}
+
+// DialTimeout is like Dial but gives up waiting for the listener to accept after timeout,
+// a timeout of 0 means no timeout.
+func DialTimeout(address string, timeout time.Duration) (net.Conn, error) {
+	mu.Lock()
+	l, ok := listeners[address]
+	mu.Unlock()
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: Network, Addr: Addr(address), Err: fmt.Errorf("connection refused")}
+	}
+	local := Addr(address + "#" + strconv.FormatUint(atomic.AddUint64(&dialSeq, 1), 10))
+	c, s := net.Pipe()
+	dialed := shape(&conn{Conn: c, local: local, remote: l.addr}, l.Upstream)
+	accepted := shape(&conn{Conn: s, local: l.addr, remote: local}, l.Downstream)
+	if l.DialHook != nil {
+		hooked, err := l.DialHook(dialed)
+		if err != nil {
+			dialed.Close()
+			accepted.Close()
+			return nil, &net.OpError{Op: "dial", Net: Network, Addr: l.addr, Err: err}
+		}
+		dialed = hooked
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case l.conns <- accepted:
+		return dialed, nil
+	case <-l.done:
+		dialed.Close()
+		accepted.Close()
+		return nil, &net.OpError{Op: "dial", Net: Network, Addr: l.addr, Err: fmt.Errorf("connection refused")}
+	case <-expired:
+		dialed.Close()
+		accepted.Close()
+		return nil, &net.OpError{Op: "dial", Net: Network, Addr: l.addr, Err: fmt.Errorf("i/o timeout")}
+	}
+}
+
+// conn is a net.Pipe end reporting the in-memory addresses.
+type conn struct {
+	net.Conn
+	local, remote Addr
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,120 @@
+package memnet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDial(t *testing.T) {
+	l, err := Listen("TestDial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err = Listen("TestDial"); err == nil {
+		t.Fatal("expect an error for an address in use")
+	}
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+	c, err := Dial("TestDial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.RemoteAddr().String() != "TestDial" || c.RemoteAddr().Network() != Network {
+		t.Fatalf("unexpected remote address: %v", c.RemoteAddr())
+	}
+	if _, err = c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err = io.ReadFull(c, b); err != nil || string(b) != "ping" {
+		t.Fatalf("unexpected echo: %q, %v", b, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	l, err := Listen("TestClose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DialTimeout("TestClose", 10*time.Millisecond); err == nil {
+		t.Fatal("expect a timeout without Accept")
+	}
+	l.Close()
+	if _, err = l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("unexpected Accept error: %v", err)
+	}
+	if _, err = Dial("TestClose"); err == nil {
+		t.Fatal("expect an error for a closed listener")
+	}
+	// the address is free again.
+	l, err = Listen("TestClose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+}
+
+func TestLink(t *testing.T) {
+	l, err := Listen("TestLink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.Upstream = Link{Latency: 50 * time.Millisecond, Bandwidth: 100 << 10}
+	l.Downstream = Link{Latency: 50 * time.Millisecond}
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+	c, err := Dial("TestLink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	if _, err = c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err = io.ReadFull(c, b); err != nil || string(b) != "ping" {
+		t.Fatalf("unexpected echo: %q, %v", b, err)
+	}
+	if rtt := time.Since(start); rtt < 100*time.Millisecond {
+		t.Fatalf("unexpected round trip time: %s", rtt)
+	}
+
+	// 20KB take 200ms to transmit upstream.
+	start = time.Now()
+	go c.Write(make([]byte, 20<<10))
+	if _, err = io.ReadFull(c, make([]byte, 20<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("unexpected transfer time: %s", elapsed)
+	}
+
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	c.Write([]byte("late"))
+	if _, err = c.Read(b); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("unexpected error of a read past the deadline: %v", err)
+	}
+}
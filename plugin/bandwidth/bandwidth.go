@@ -0,0 +1,227 @@
+package bandwidth
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// Limit is a token bucket limit of the bytes transferred.
+type Limit struct {
+	// Rate is the number of bytes per second, 0 for no limit.
+	Rate float64
+	// Burst is the maximum number of bytes at once.
+	// If it is 0, the bytes of 100ms at Rate are used, 4KB at least.
+	Burst int
+}
+
+// BandwidthPlugin throttles the bytes read and written by the connections, e.g. to cap bulk transfers
+// so that they do not saturate a shared NIC or an egress budget.
+// The limits of each connection apply with those of all the connections together, the strictest delaying.
+// The reads and the writes wait for the tokens of the bytes, so the peer is slowed down by TCP flow control.
+// The limits are read once, when the first connection is wrapped.
+type BandwidthPlugin struct {
+	// ConnRead and ConnWrite limit the bytes read and written by each connection.
+	ConnRead, ConnWrite Limit
+	// Read and Write limit the bytes read and written by all the connections together.
+	Read, Write Limit
+
+	once        sync.Once
+	read, write *bucket
+}
+
+// NewBandwidthPlugin creates a BandwidthPlugin limiting each connection to conn,
+// and all of them to global, in both directions.
+func NewBandwidthPlugin(conn, global Limit) *BandwidthPlugin {
+	return &BandwidthPlugin{
+		ConnRead:  conn,
+		ConnWrite: conn,
+		Read:      global,
+		Write:     global,
+	}
+}
+
+var _ plugin.IPlugin = new(BandwidthPlugin)
+
+// Name return name of this plugin.
+func (p *BandwidthPlugin) Name() string {
+	return "BandwidthPlugin"
+}
+
+var _ server.IPostConnAcceptPlugin = new(BandwidthPlugin)
+
+// PostConnAccept wraps the conn with the limits.
+// Used by servers.
+func (p *BandwidthPlugin) PostConnAccept(codecConn server.ServerCodecConn) error {
+	codecConn.SetConn(p.wrap(codecConn.GetConn()))
+	return nil
+}
+
+var _ client.IPostConnectedPlugin = new(BandwidthPlugin)
+
+// PostConnected wraps the conn with the limits.
+// Used by clients.
+func (p *BandwidthPlugin) PostConnected(codecConn client.ClientCodecConn) error {
+	codecConn.SetConn(p.wrap(codecConn.GetConn()))
+	return nil
+}
+
+// wrap returns conn throttled by the limits, or conn if there is none.
+func (p *BandwidthPlugin) wrap(conn net.Conn) net.Conn {
+	p.once.Do(func() {
+		p.read = newBucket(p.Read)
+		p.write = newBucket(p.Write)
+	})
+	tc := &throttledConn{
+		Conn:   conn,
+		read:   buckets(newBucket(p.ConnRead), p.read),
+		write:  buckets(newBucket(p.ConnWrite), p.write),
+		closed: make(chan struct{}),
+	}
+	if tc.read == nil && tc.write == nil {
+		return conn
+	}
+	tc.readChunk = chunk(tc.read)
+	tc.writeChunk = chunk(tc.write)
+	return tc
+}
+
+// bucket is a token bucket, a token per byte.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// newBucket returns the bucket of l, full, or nil if l has no limit.
+func newBucket(l Limit) *bucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = l.Rate / 10
+		if burst < 4096 {
+			burst = 4096
+		}
+	}
+	return &bucket{rate: l.Rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take takes n tokens, at most burst, and returns how long to wait for them.
+// The tokens missing are owed, so that the bytes taken later wait for them too.
+func (b *bucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// buckets returns those of bs that are not nil, or nil if they all are.
+func buckets(bs ...*bucket) []*bucket {
+	var r []*bucket
+	for _, b := range bs {
+		if b != nil {
+			r = append(r, b)
+		}
+	}
+	return r
+}
+
+// chunk returns the maximum number of bytes transferred at once, the smallest burst of bs, or 0 if bs is empty.
+func chunk(bs []*bucket) int {
+	n := 0
+	for _, b := range bs {
+		if burst := int(b.burst); n == 0 || burst < n {
+			n = burst
+		}
+	}
+	return n
+}
+
+// throttledConn is a net.Conn waiting for the tokens of its buckets before writing, and after reading.
+type throttledConn struct {
+	net.Conn
+	read, write           []*bucket
+	readChunk, writeChunk int
+	closed                chan struct{}
+	closeOnce             sync.Once
+}
+
+// Read reads at most a chunk of bytes, and waits for their tokens before returning.
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if c.readChunk > 0 && len(b) > c.readChunk {
+		b = b[:c.readChunk]
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.wait(c.read, n)
+	}
+	return n, err
+}
+
+// Write writes b by chunks, waiting for the tokens of each first.
+func (c *throttledConn) Write(b []byte) (int, error) {
+	if c.writeChunk == 0 {
+		return c.Conn.Write(b)
+	}
+	written := 0
+	for len(b) > 0 {
+		p := b
+		if len(p) > c.writeChunk {
+			p = p[:c.writeChunk]
+		}
+		if !c.wait(c.write, len(p)) {
+			return written, net.ErrClosed
+		}
+		n, err := c.Conn.Write(p)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// wait takes n tokens from bs, and waits for them. It reports false if the conn is closed meanwhile.
+func (c *throttledConn) wait(bs []*bucket, n int) bool {
+	var delay time.Duration
+	for _, b := range bs {
+		if d := b.take(n); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.closed:
+		return false
+	}
+}
+
+// Close closes the conn, the reads and the writes waiting return at once.
+func (c *throttledConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,68 @@
+package bandwidth
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWriteLimit(t *testing.T) {
+	c, s := net.Pipe()
+	p := &BandwidthPlugin{ConnWrite: Limit{Rate: 100 << 10, Burst: 10 << 10}}
+	conn := p.wrap(c)
+	go io.Copy(io.Discard, s)
+	start := time.Now()
+	// 10KB pass at once, the 20KB left take 200ms.
+	if _, err := conn.Write(make([]byte, 30<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("unexpected duration of the write: %s", elapsed)
+	}
+}
+
+func TestGlobalLimit(t *testing.T) {
+	p := &BandwidthPlugin{Read: Limit{Rate: 100 << 10, Burst: 10 << 10}}
+	start := time.Now()
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		c, s := net.Pipe()
+		conn := p.wrap(s)
+		go c.Write(make([]byte, 15<<10))
+		go func() {
+			_, err := io.ReadFull(conn, make([]byte, 15<<10))
+			done <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the connections share the bucket: 10KB pass at once, the 20KB left take 200ms.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("unexpected duration of the reads: %s", elapsed)
+	}
+}
+
+func TestCloseWhileWaiting(t *testing.T) {
+	c, s := net.Pipe()
+	p := &BandwidthPlugin{ConnWrite: Limit{Rate: 1, Burst: 1}}
+	conn := p.wrap(c)
+	go io.Copy(io.Discard, s)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+	if _, err := conn.Write([]byte("abc")); err == nil {
+		t.Fatal("the write did not fail once the conn is closed")
+	}
+}
+
+func TestNoLimit(t *testing.T) {
+	c, _ := net.Pipe()
+	if conn := new(BandwidthPlugin).wrap(c); conn != c {
+		t.Fatal("the conn is wrapped without limit")
+	}
+}
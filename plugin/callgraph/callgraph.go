@@ -0,0 +1,159 @@
+// Package callgraph measures the downstream calls of the services per caller→callee edge,
+// e.g. to chart which dependency of which service times out, without instrumenting the services.
+//
+// The same CallGraphPlugin is added to the server and to the clients of the downstream services:
+//
+//	g := new(callgraph.CallGraphPlugin)
+//	srv.PluginContainer.Add(g)
+//	stock := client.NewClient(client.Client{}, selector)
+//	stock.PluginContainer.Add(g)
+//	http.Handle("/debug/callgraph", g)
+//
+// The server side propagates the path of each request to its context, so that the calls made with it,
+// e.g. by the service methods taking a context.Context, are tagged with their caller:
+//
+//	func (o *Order) Create(ctx context.Context, args *Args, reply *Reply) error {
+//		return stock.CallContext(ctx, "/stock/reserve", args.Items, nil).Err() // edge /order/create→/stock/reserve
+//	}
+//
+// The caller travels downstream in the "caller" query parameter of the service methods.
+package callgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// QueryCaller is the query parameter of the service methods that holds the path of the calling service.
+const QueryCaller = "caller"
+
+// Edge is the measure of the calls of a callee service by a caller service.
+type Edge struct {
+	// Caller is the path of the service that made the calls, or "" for the calls not made by a service.
+	Caller string `json:"caller"`
+	// Callee is the path of the service called.
+	Callee string `json:"callee"`
+	Calls  uint64 `json:"calls"`
+	// Errors is the number of calls that failed, timeouts included.
+	Errors uint64 `json:"errors"`
+	// Timeouts is the number of calls that failed past their deadline.
+	Timeouts     uint64        `json:"timeouts"`
+	TotalLatency time.Duration `json:"total_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+}
+
+// CallGraphPlugin is a server and client plugin that measures the downstream calls per caller→callee edge.
+type CallGraphPlugin struct {
+	edges map[[2]string]*Edge
+	mu    sync.Mutex
+}
+
+var _ plugin.IPlugin = new(CallGraphPlugin)
+
+// Name returns plugin name.
+func (p *CallGraphPlugin) Name() string {
+	return "CallGraphPlugin"
+}
+
+var _ server.IPostReadRequestHeaderPlugin = new(CallGraphPlugin)
+
+// PostReadRequestHeader propagates the path of the request as the caller of the calls made with its context.
+func (p *CallGraphPlugin) PostReadRequestHeader(ctx *server.Context) error {
+	ctx.Propagate(QueryCaller, ctx.Path())
+	return nil
+}
+
+var _ client.IPostCallPlugin = new(CallGraphPlugin)
+
+// PostCall measures the call on the edge from the caller of ctx to the service called.
+func (p *CallGraphPlugin) PostCall(ctx context.Context, serviceMethod string, elapsed time.Duration, rpcErr *common.RPCError) {
+	caller := common.MetadataFromContext(ctx).Get(QueryCaller)
+	callee := serviceMethod
+	if i := strings.IndexByte(callee, '?'); i >= 0 {
+		callee = callee[:i]
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.edges == nil {
+		p.edges = make(map[[2]string]*Edge)
+	}
+	key := [2]string{caller, callee}
+	edge := p.edges[key]
+	if edge == nil {
+		edge = &Edge{Caller: caller, Callee: callee}
+		p.edges[key] = edge
+	}
+	edge.Calls++
+	edge.TotalLatency += elapsed
+	if elapsed > edge.MaxLatency {
+		edge.MaxLatency = elapsed
+	}
+	if rpcErr != nil {
+		edge.Errors++
+		if isTimeout(rpcErr) {
+			edge.Timeouts++
+		}
+	}
+}
+
+// isTimeout reports whether the call failed past its deadline, of its context or of its connection.
+func isTimeout(rpcErr *common.RPCError) bool {
+	return errors.Is(rpcErr.Err(), context.DeadlineExceeded) || strings.Contains(rpcErr.Error, "timeout")
+}
+
+// Edges returns the edges measured, sorted by caller and callee.
+func (p *CallGraphPlugin) Edges() []Edge {
+	p.mu.Lock()
+	edges := make([]Edge, 0, len(p.edges))
+	for _, edge := range p.edges {
+		edges = append(edges, *edge)
+	}
+	p.mu.Unlock()
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Caller != edges[j].Caller {
+			return edges[i].Caller < edges[j].Caller
+		}
+		return edges[i].Callee < edges[j].Callee
+	})
+	return edges
+}
+
+// Reset forgets the edges measured.
+func (p *CallGraphPlugin) Reset() {
+	p.mu.Lock()
+	p.edges = nil
+	p.mu.Unlock()
+}
+
+// ServeHTTP exports the edges, in JSON, or in the DOT language of Graphviz with the "format=dot" query parameter.
+func (p *CallGraphPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	edges := p.Edges()
+	if r.URL.Query().Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		fmt.Fprintln(w, "digraph callgraph {")
+		for _, edge := range edges {
+			caller := edge.Caller
+			if caller == "" {
+				caller = "client"
+			}
+			fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", caller, edge.Callee,
+				fmt.Sprintf("%d calls, %d errors, %d timeouts", edge.Calls, edge.Errors, edge.Timeouts))
+		}
+		fmt.Fprintln(w, "}")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(edges)
+}
@@ -0,0 +1,107 @@
+package callgraph
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type Stock struct{}
+
+func (*Stock) Reserve(items int, ok *bool) error {
+	*ok = true
+	return nil
+}
+
+func (*Stock) Slow(items int, ok *bool) error {
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
+
+type Order struct {
+	stock *client.Client
+}
+
+func (o *Order) Create(ctx context.Context, items int, ok *bool) error {
+	return o.stock.CallContext(ctx, "/stock/reserve", items, ok).Err()
+}
+
+func (o *Order) Hurry(ctx context.Context, items int, ok *bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	return o.stock.CallContext(ctx, "/stock/slow", items, ok).Err()
+}
+
+var addrCounter int32
+
+func serve(g *CallGraphPlugin, rcvr interface{}) *client.Client {
+	address := fmt.Sprintf("callgraph-%d", atomic.AddInt32(&addrCounter, 1))
+	srv := server.NewServer(server.Server{})
+	srv.PluginContainer.Add(g)
+	srv.Register(rcvr)
+	go srv.Serve("mem", address)
+	time.Sleep(10 * time.Millisecond)
+	c := client.NewClient(client.Client{}, &selector.DirectSelector{Network: "mem", Address: address})
+	c.PluginContainer.Add(g)
+	return c
+}
+
+func TestCallGraph(t *testing.T) {
+	g := new(CallGraphPlugin)
+	stock := serve(g, new(Stock))
+	defer stock.Close()
+	order := serve(g, &Order{stock: stock})
+	defer order.Close()
+
+	var ok bool
+	for i := 0; i < 2; i++ {
+		if rpcErr := order.Call("/order/create", 2, &ok); rpcErr != nil || !ok {
+			t.Fatalf("unexpected result: %v, %v", ok, rpcErr)
+		}
+	}
+	if rpcErr := order.Call("/order/hurry", 2, &ok); rpcErr == nil {
+		t.Fatal("expected a timeout")
+	}
+
+	edges := g.Edges()
+	if len(edges) != 4 {
+		t.Fatalf("unexpected edges: %+v", edges)
+	}
+	expect := []struct {
+		caller, callee          string
+		calls, errors, timeouts uint64
+	}{
+		{"", "/order/create", 2, 0, 0},
+		{"", "/order/hurry", 1, 1, 0},
+		{"/order/create", "/stock/reserve", 2, 0, 0},
+		{"/order/hurry", "/stock/slow", 1, 1, 1},
+	}
+	for i, e := range expect {
+		edge := edges[i]
+		if edge.Caller != e.caller || edge.Callee != e.callee || edge.Calls != e.calls ||
+			edge.Errors != e.errors || edge.Timeouts != e.timeouts {
+			t.Fatalf("unexpected edge %d: %+v", i, edge)
+		}
+		if edge.MaxLatency <= 0 || edge.TotalLatency < edge.MaxLatency {
+			t.Fatalf("unexpected latency of edge %d: %+v", i, edge)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/debug/callgraph?format=dot", nil))
+	if !strings.Contains(w.Body.String(), `"/order/hurry" -> "/stock/slow" [label="1 calls, 1 errors, 1 timeouts"];`) {
+		t.Fatalf("unexpected graph:\n%s", w.Body.String())
+	}
+	g.Reset()
+	if len(g.Edges()) != 0 {
+		t.Fatal("edges not reset")
+	}
+}
@@ -0,0 +1,132 @@
+package compression
+
+import (
+	"bufio"
+	"compress/flate"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// DictCompressionPlugin compresses each message with flate and a preset dictionary,
+// e.g. built from typical payloads, which greatly improves the ratio of small structured messages.
+// The client sends the ID of its dictionary when connecting,
+// the server closes the connection if it has no dictionary with that ID.
+type DictCompressionPlugin struct {
+	dicts  map[byte][]byte
+	dictID byte
+}
+
+// NewDictCompressionPlugin creates a DictCompressionPlugin.
+// The servers accept any of dicts, the clients use the dictionary dictID of dicts.
+func NewDictCompressionPlugin(dicts map[byte][]byte, dictID byte) *DictCompressionPlugin {
+	return &DictCompressionPlugin{dicts: dicts, dictID: dictID}
+}
+
+var _ plugin.IPlugin = new(DictCompressionPlugin)
+
+// Name return name of this plugin.
+func (p *DictCompressionPlugin) Name() string {
+	return "DictCompressionPlugin"
+}
+
+var _ server.IPostConnAcceptPlugin = new(DictCompressionPlugin)
+
+// PostConnAccept wraps the conn, the dictionary ID is read with the first request.
+// Used by servers.
+func (p *DictCompressionPlugin) PostConnAccept(codecConn server.ServerCodecConn) error {
+	codecConn.SetConn(newDictConn(codecConn.GetConn(), p.dicts, nil))
+	return nil
+}
+
+var _ client.IPostConnectedPlugin = new(DictCompressionPlugin)
+
+// PostConnected sends the dictionary ID and wraps the conn.
+// Used by clients.
+func (p *DictCompressionPlugin) PostConnected(codecConn client.ClientCodecConn) error {
+	dict, ok := p.dicts[p.dictID]
+	if !ok {
+		return fmt.Errorf("compression dictionary %d not found", p.dictID)
+	}
+	conn := codecConn.GetConn()
+	if _, err := conn.Write([]byte{p.dictID}); err != nil {
+		return err
+	}
+	codecConn.SetConn(newDictConn(conn, nil, dict))
+	return nil
+}
+
+// dictConn compresses each Write as a message with a preset dictionary.
+type dictConn struct {
+	net.Conn
+	dicts map[byte][]byte // only for servers, until the dictionary ID is read
+	dict  []byte
+	br    *bufio.Reader
+	fr    io.ReadCloser
+	fw    *flate.Writer
+}
+
+func newDictConn(conn net.Conn, dicts map[byte][]byte, dict []byte) *dictConn {
+	return &dictConn{
+		Conn:  conn,
+		dicts: dicts,
+		dict:  dict,
+		br:    bufio.NewReader(conn),
+	}
+}
+
+func (c *dictConn) Read(b []byte) (int, error) {
+	if c.dict == nil {
+		id, err := c.br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		dict, ok := c.dicts[id]
+		if !ok {
+			c.Conn.Close()
+			return 0, fmt.Errorf("rpc: compression dictionary %d not found", id)
+		}
+		c.dict = dict
+	}
+	for {
+		if c.fr == nil {
+			// the bufio.Reader is an io.ByteReader, so flate reads no further than the message.
+			c.fr = flate.NewReaderDict(c.br, c.dict)
+		}
+		n, err := c.fr.Read(b)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			// the next Read gets io.EOF again.
+			return n, nil
+		}
+		// end of the message, wait for the next one.
+		if _, err = c.br.Peek(1); err != nil {
+			return 0, err
+		}
+		c.fr.(flate.Resetter).Reset(c.br, c.dict)
+	}
+}
+
+func (c *dictConn) Write(b []byte) (int, error) {
+	if c.fw == nil {
+		// the messages are small, the best compression makes the most of the dictionary.
+		fw, err := flate.NewWriterDict(c.Conn, flate.BestCompression, c.dict)
+		if err != nil {
+			return 0, err
+		}
+		c.fw = fw
+	} else {
+		c.fw.Reset(c.Conn)
+	}
+	n, err := c.fw.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.fw.Close()
+}
@@ -0,0 +1,72 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestDictConn(t *testing.T) {
+	dict := []byte(`{"seq":,"method":"/arith/mul","params":{"A":,"B":}}`)
+	dicts := map[byte][]byte{1: dict}
+	c, s := net.Pipe()
+	client := newDictConn(c, nil, dict)
+	server := newDictConn(s, dicts, nil)
+
+	msgs := []string{
+		`{"seq":1,"method":"/arith/mul","params":{"A":7,"B":8}}`,
+		`{"seq":2,"method":"/arith/mul","params":{"A":1,"B":2}}`,
+	}
+	go func() {
+		c.Write([]byte{1})
+		for _, msg := range msgs {
+			client.Write([]byte(msg))
+		}
+		c.Close()
+	}()
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != msgs[0]+msgs[1] {
+		t.Fatalf("unexpected messages: %s", got)
+	}
+}
+
+func TestDictConnUnknownID(t *testing.T) {
+	c, s := net.Pipe()
+	server := newDictConn(s, map[byte][]byte{1: []byte("x")}, nil)
+	go c.Write([]byte{2})
+	if _, err := server.Read(make([]byte, 8)); err == nil {
+		t.Fatal("expect an error for an unknown dictionary")
+	}
+}
+
+func TestDictRatio(t *testing.T) {
+	dict := []byte(`{"seq":,"method":"/user/get","params":{"name":"","email":"","address":{"city":""}}}`)
+	msg := []byte(`{"seq":42,"method":"/user/get","params":{"name":"bob","email":"bob@example.com","address":{"city":"x"}}}`)
+	size := func(dict []byte) int {
+		var buf bytes.Buffer
+		c, _ := net.Pipe()
+		w := &dictConn{Conn: writeConn{c, &buf}, dict: dict}
+		if dict == nil {
+			w.dict = []byte{}
+		}
+		w.Write(msg)
+		return buf.Len()
+	}
+	if with, without := size(dict), size(nil); with >= without {
+		t.Fatalf("expect the dictionary to help: %d >= %d", with, without)
+	}
+}
+
+// writeConn is a net.Conn writing to w.
+type writeConn struct {
+	net.Conn
+	w io.Writer
+}
+
+func (c writeConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
@@ -0,0 +1,176 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// NegotiatedCompressionPlugin negotiates the compression of each connection, so that the clients and the servers
+// need not be configured with the same CompressType: the client sends the types it supports when connecting,
+// and the server answers the first of them it supports too, or CompressNone.
+// The servers serve the clients without the plugin uncompressed.
+type NegotiatedCompressionPlugin struct {
+	// CompressTypes are the types supported, the client's in order of preference.
+	CompressTypes []CompressType
+	// Timeout is how long a client waits for the answer of the server.
+	// If it is 0, 5s is used.
+	Timeout time.Duration
+}
+
+// NewNegotiatedCompressionPlugin creates a NegotiatedCompressionPlugin supporting compressTypes.
+func NewNegotiatedCompressionPlugin(compressTypes ...CompressType) *NegotiatedCompressionPlugin {
+	return &NegotiatedCompressionPlugin{CompressTypes: compressTypes}
+}
+
+// negotiationMagic starts the offer of a client, no codec starts a stream with a zero byte.
+var negotiationMagic = []byte("\x00rpc-compress")
+
+var _ plugin.IPlugin = new(NegotiatedCompressionPlugin)
+
+// Name return name of this plugin.
+func (p *NegotiatedCompressionPlugin) Name() string {
+	return "NegotiatedCompressionPlugin"
+}
+
+var _ server.IPostConnAcceptPlugin = new(NegotiatedCompressionPlugin)
+
+// PostConnAccept wraps the conn, the offer of the client is read and answered with the first request.
+// Used by servers.
+func (p *NegotiatedCompressionPlugin) PostConnAccept(codecConn server.ServerCodecConn) error {
+	codecConn.SetConn(&negotiatedConn{Conn: codecConn.GetConn(), compressTypes: p.CompressTypes})
+	return nil
+}
+
+var _ client.IPostConnectedPlugin = new(NegotiatedCompressionPlugin)
+
+// PostConnected sends the offer, waits for the answer of the server and wraps the conn.
+// Used by clients.
+func (p *NegotiatedCompressionPlugin) PostConnected(codecConn client.ClientCodecConn) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	conn := codecConn.GetConn()
+	compressType, err := offer(conn, p.CompressTypes, timeout)
+	if err != nil {
+		return err
+	}
+	codecConn.SetConn(NewCompressConn(conn, compressType))
+	return nil
+}
+
+// offer sends compressTypes to the server, and returns the one it answers.
+func offer(conn net.Conn, compressTypes []CompressType, timeout time.Duration) (CompressType, error) {
+	if len(compressTypes) > 255 {
+		return CompressNone, fmt.Errorf("compression: too many types offered: %d", len(compressTypes))
+	}
+	msg := append(append([]byte{}, negotiationMagic...), byte(len(compressTypes)))
+	for _, t := range compressTypes {
+		msg = append(msg, byte(t))
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(msg); err != nil {
+		return CompressNone, err
+	}
+	var answer [1]byte
+	if _, err := io.ReadFull(conn, answer[:]); err != nil {
+		return CompressNone, err
+	}
+	compressType := CompressType(answer[0])
+	if compressType != CompressNone && !contains(compressTypes, compressType) {
+		return CompressNone, fmt.Errorf("compression: the server answered the type %d not offered", compressType)
+	}
+	return compressType, nil
+}
+
+// negotiatedConn answers the offer of the client on its first Read or Write, then compresses with the type answered.
+type negotiatedConn struct {
+	net.Conn
+	compressTypes []CompressType
+	once          sync.Once
+	conn          net.Conn // once negotiated
+	err           error
+}
+
+func (c *negotiatedConn) Read(b []byte) (int, error) {
+	c.once.Do(c.negotiate)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(b)
+}
+
+func (c *negotiatedConn) Write(b []byte) (int, error) {
+	c.once.Do(c.negotiate)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Write(b)
+}
+
+// negotiate reads the offer of the client and answers it, a client without offer is served uncompressed.
+func (c *negotiatedConn) negotiate() {
+	br := bufio.NewReader(c.Conn)
+	conn := &bufferedConn{Conn: c.Conn, r: br}
+	magic, err := br.Peek(len(negotiationMagic))
+	if err != nil && len(magic) == 0 {
+		c.err = err
+		return
+	}
+	if !bytes.Equal(magic, negotiationMagic) {
+		c.conn = conn
+		return
+	}
+	br.Discard(len(negotiationMagic))
+	n, err := br.ReadByte()
+	if err != nil {
+		c.err = err
+		return
+	}
+	offered := make([]byte, n)
+	if _, err = io.ReadFull(br, offered); err != nil {
+		c.err = err
+		return
+	}
+	compressType := CompressNone
+	for _, t := range offered {
+		if contains(c.compressTypes, CompressType(t)) {
+			compressType = CompressType(t)
+			break
+		}
+	}
+	if _, err = c.Conn.Write([]byte{byte(compressType)}); err != nil {
+		c.err = err
+		return
+	}
+	c.conn = NewCompressConn(conn, compressType)
+}
+
+// bufferedConn is a net.Conn reading from r, which buffers the reads of the Conn.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func contains(compressTypes []CompressType, compressType CompressType) bool {
+	for _, t := range compressTypes {
+		if t == compressType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package compression
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	c, s := net.Pipe()
+	server := &negotiatedConn{Conn: s, compressTypes: []CompressType{CompressSnappy, CompressFlate}}
+	msg := `{"seq":1,"method":"/arith/mul","params":{"A":7,"B":8}}`
+	result := make(chan error, 1)
+	go func() {
+		compressType, err := offer(c, []CompressType{CompressLZ4, CompressFlate, CompressSnappy}, time.Second)
+		if err == nil && compressType != CompressFlate {
+			t.Errorf("unexpected type answered: %d", compressType)
+		}
+		if err == nil {
+			_, err = NewCompressConn(c, compressType).Write([]byte(msg))
+		}
+		result <- err
+	}()
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != msg {
+		t.Fatalf("unexpected message: %s", got)
+	}
+}
+
+func TestNegotiateNone(t *testing.T) {
+	c, s := net.Pipe()
+	server := &negotiatedConn{Conn: s}
+	go server.Read(make([]byte, 8))
+	compressType, err := offer(c, []CompressType{CompressFlate}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressType != CompressNone {
+		t.Fatalf("unexpected type answered: %d", compressType)
+	}
+}
+
+func TestNegotiateWithoutOffer(t *testing.T) {
+	c, s := net.Pipe()
+	server := &negotiatedConn{Conn: s, compressTypes: []CompressType{CompressFlate}}
+	msg := `{"seq":1,"method":"/arith/mul","params":{"A":7,"B":8}}`
+	go func() {
+		c.Write([]byte(msg))
+		c.Close()
+	}()
+	got, err := io.ReadAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != msg {
+		t.Fatalf("unexpected message: %s", got)
+	}
+}
@@ -0,0 +1,85 @@
+// Package netrpc lets a client talk to the plain net/rpc servers, easing the migration to myrpc.
+//
+//	c := client.NewClient(client.Client{}, &selector.DirectSelector{Network: "tcp", Address: "127.0.0.1:1234"})
+//	c.PluginContainer.Add(new(netrpc.NetRPCPlugin))
+//	// calls "Arith.Mul"
+//	c.Call("/arith/mul", args, &reply)
+package netrpc
+
+import (
+	"errors"
+	"net/rpc"
+	"strings"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/plugin"
+)
+
+// NetRPCPlugin rewrites the requests of a client for a net/rpc server, and types the errors of the responses.
+type NetRPCPlugin struct {
+	// ServiceMethod maps the service method of a call to the net/rpc one.
+	// If it is nil, ServiceMethod is used.
+	ServiceMethod func(serviceMethod string) (string, error)
+	// Args, if it is not nil, wraps the args of a call, e.g. into the struct expected by the net/rpc method.
+	// It is given the service method of the call, before mapping.
+	Args func(serviceMethod string, args interface{}) (interface{}, error)
+}
+
+// ServiceMethod maps a service method in URL format to the net/rpc "Service.Method",
+// e.g. "/arith/mul" and "/v1/arith/mul?x=1" to "Arith.Mul".
+func ServiceMethod(serviceMethod string) (string, error) {
+	p := serviceMethod
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	if len(segments) < 2 {
+		return "", errors.New("no service in " + serviceMethod)
+	}
+	service, method := segments[len(segments)-2], segments[len(segments)-1]
+	return common.CamelString(service) + "." + common.CamelString(method), nil
+}
+
+var _ plugin.IPlugin = new(NetRPCPlugin)
+
+// Name returns plugin name.
+func (p *NetRPCPlugin) Name() string {
+	return "NetRPCPlugin"
+}
+
+var _ client.IRewriteRequestPlugin = new(NetRPCPlugin)
+
+// RewriteRequest maps the service method and wraps the args of the call.
+func (p *NetRPCPlugin) RewriteRequest(serviceMethod string, args interface{}) (string, interface{}, error) {
+	var err error
+	if p.Args != nil {
+		if args, err = p.Args(serviceMethod, args); err != nil {
+			return "", nil, err
+		}
+	}
+	mapping := p.ServiceMethod
+	if mapping == nil {
+		mapping = ServiceMethod
+	}
+	if serviceMethod, err = mapping(serviceMethod); err != nil {
+		return "", nil, err
+	}
+	return serviceMethod, args, nil
+}
+
+var _ client.IPostReadResponseHeaderPlugin = new(NetRPCPlugin)
+
+// PostReadResponseHeader prefixes the error of the response with its error type,
+// which net/rpc servers do not send.
+func (p *NetRPCPlugin) PostReadResponseHeader(resp *rpc.Response) error {
+	if resp.Error == "" {
+		return nil
+	}
+	errorType := common.ErrorTypeServerService
+	if strings.HasPrefix(resp.Error, "rpc: can't find ") {
+		errorType = common.ErrorTypeServerNotFoundService
+	}
+	resp.Error = string([]byte{byte(errorType)}) + resp.Error
+	return nil
+}
@@ -0,0 +1,79 @@
+package netrpc
+
+import (
+	"errors"
+	"net/rpc"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/memnet"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith struct{}
+
+func (*Arith) Mul(args *Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (*Arith) Div(args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func TestServiceMethod(t *testing.T) {
+	for serviceMethod, expect := range map[string]string{
+		"/arith/mul":          "Arith.Mul",
+		"/v1/arith/mul?x=1":   "Arith.Mul",
+		"/user_info/get_user": "UserInfo.GetUser",
+	} {
+		if got, err := ServiceMethod(serviceMethod); err != nil || got != expect {
+			t.Errorf("ServiceMethod(%q) = %q, %v, expect %q", serviceMethod, got, err, expect)
+		}
+	}
+	if _, err := ServiceMethod("/mul"); err == nil {
+		t.Error("expect an error for a service method without service")
+	}
+}
+
+func TestNetRPCPlugin(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(new(Arith))
+	lis, err := memnet.Listen("netrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go srv.Accept(lis)
+
+	c := client.NewClient(client.Client{MaxTry: 1}, &selector.DirectSelector{Network: memnet.Network, Address: "netrpc"})
+	defer c.Close()
+	c.PluginContainer.Add(&NetRPCPlugin{
+		Args: func(_ string, args interface{}) (interface{}, error) {
+			ab := args.([2]int)
+			return &Args{A: ab[0], B: ab[1]}, nil
+		},
+	})
+
+	var reply int
+	if rpcErr := c.Call("/arith/mul", [2]int{6, 7}, &reply); rpcErr != nil || reply != 42 {
+		t.Fatalf("unexpected result: %d, %v", reply, rpcErr)
+	}
+	rpcErr := c.Call("/arith/div", [2]int{1, 0}, &reply)
+	if rpcErr == nil || rpcErr.Type != common.ErrorTypeServerService || rpcErr.Error != "divide by zero" {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+	rpcErr = c.Call("/arith/add", [2]int{1, 0}, &reply)
+	if rpcErr == nil || rpcErr.Type != common.ErrorTypeServerNotFoundService {
+		t.Fatalf("unexpected error: %+v", rpcErr)
+	}
+}
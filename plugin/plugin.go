@@ -1,7 +1,12 @@
 package plugin
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
 	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
 )
 
 type (
@@ -20,8 +25,67 @@ type (
 )
 
 // PluginContainer implements IPluginContainer interface.
+// The panics of the plugins are recovered by the extension points, see Recover.
 type PluginContainer struct {
 	Plugins []IPlugin
+	// MaxPanics, if it is not 0, is the number of panics of a plugin after which it is disabled,
+	// its hooks being no longer called, e.g. so that a plugin broken by a deployment does not fail every request.
+	MaxPanics int
+
+	// the panics and the disabled plugins are keyed by their index in Plugins, not by their name,
+	// so that the unnamed plugins are told apart.
+	panics    map[int]int
+	disabled  map[int]bool
+	ndisabled int32      // the number of plugins disabled, so that Enabled is cheap while there is none
+	mu        sync.Mutex // protects panics and disabled
+}
+
+// Enabled reports whether the hooks of the plugin p.Plugins[i] are called,
+// i.e. it is not disabled by its panics, see MaxPanics.
+func (p *PluginContainer) Enabled(i int) bool {
+	if atomic.LoadInt32(&p.ndisabled) == 0 {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.disabled[i]
+}
+
+// Run calls fn, the hook of the plugin p.Plugins[i], and returns its error,
+// or the error of its panic, see Recover, e.g. for the extension points collecting the errors of every plugin.
+func (p *PluginContainer) Run(hook string, i int, fn func() error) (err error) {
+	defer p.Recover(hook, &i, &err)
+	return fn()
+}
+
+// Recover recovers the panic of the hook of the plugin p.Plugins[*i], it is deferred by the extension points.
+// It logs the panic with its stack, counts it against MaxPanics, and sets *err, if err is not nil,
+// to an error naming the plugin, so that the request fails as if the hook had returned it.
+func (p *PluginContainer) Recover(hook string, i *int, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	name := p.Plugins[*i].Name()
+	log.Criticalf("rpc: plugin %s panicked in %s: %v\n[PANIC]\n%s\n", name, hook, r, common.PanicTrace(4))
+	if err != nil {
+		*err = common.ErrPluginPanic.Format(name, hook, fmt.Sprint(r))
+	}
+	if p.MaxPanics <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.panics == nil {
+		p.panics = make(map[int]int)
+		p.disabled = make(map[int]bool)
+	}
+	p.panics[*i]++
+	if p.panics[*i] >= p.MaxPanics && !p.disabled[*i] {
+		p.disabled[*i] = true
+		atomic.AddInt32(&p.ndisabled, 1)
+		log.Errorf("rpc: plugin %s is disabled after %d panics", name, p.panics[*i])
+	}
 }
 
 // Add adds a plugin.
@@ -65,10 +129,41 @@ func (p *PluginContainer) Remove(pluginName string) error {
 	}
 
 	p.Plugins = append(p.Plugins[:indexToRemove], p.Plugins[indexToRemove+1:]...)
+	p.removed(indexToRemove)
 
 	return nil
 }
 
+// removed forgets the panics of the plugin removed at index, and shifts those of the following plugins.
+func (p *PluginContainer) removed(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.panics == nil {
+		return
+	}
+	panics, disabled := make(map[int]int), make(map[int]bool)
+	for i, n := range p.panics {
+		switch {
+		case i < index:
+			panics[i] = n
+		case i > index:
+			panics[i-1] = n
+		}
+	}
+	for i := range p.disabled {
+		switch {
+		case i < index:
+			disabled[i] = true
+		case i > index:
+			disabled[i-1] = true
+		}
+	}
+	if p.disabled[index] {
+		atomic.AddInt32(&p.ndisabled, -1)
+	}
+	p.panics, p.disabled = panics, disabled
+}
+
 // GetName returns the name of a plugin, if no GetName() implemented it returns an empty string ""
 func (p *PluginContainer) GetName(plugin IPlugin) string {
 	return plugin.Name()
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+type namedPlugin string
+
+func (p namedPlugin) Name() string { return string(p) }
+
+// hook runs the hook of the plugin p.Plugins[i] as the extension points do, panicking with "boom" if fail.
+func hook(p *PluginContainer, i int, fail bool) error {
+	return p.Run("Test", i, func() error {
+		if fail {
+			panic("boom")
+		}
+		return nil
+	})
+}
+
+func TestRecover(t *testing.T) {
+	p := new(PluginContainer)
+	p.Add(namedPlugin("broken"))
+	err := hook(p, 0, true)
+	if !errors.Is(err, common.ErrPluginPanic) {
+		t.Fatalf("expect ErrPluginPanic, got %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "'broken'") || !strings.Contains(msg, "Test") || !strings.Contains(msg, "boom") {
+		t.Fatalf("expect the error to name the plugin, the hook and the panic, got %q", msg)
+	}
+	if !p.Enabled(0) {
+		t.Fatal("expect the plugin to stay enabled without MaxPanics")
+	}
+}
+
+func TestMaxPanics(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPanics int
+		panics    int
+		disabled  bool
+	}{
+		{"no limit", 0, 5, false},
+		{"below", 3, 2, false},
+		{"reached", 3, 3, true},
+		{"beyond", 1, 2, true},
+	}
+	for _, test := range tests {
+		p := &PluginContainer{MaxPanics: test.maxPanics}
+		// the unnamed plugins are told apart.
+		p.Add(namedPlugin(""), namedPlugin(""))
+		for n := 0; n < test.panics; n++ {
+			hook(p, 0, true)
+		}
+		if p.Enabled(0) == test.disabled {
+			t.Fatalf("%s: expect the plugin disabled %v after %d panics", test.name, test.disabled, test.panics)
+		}
+		if !p.Enabled(1) {
+			t.Fatalf("%s: expect the other unnamed plugin to be enabled", test.name)
+		}
+	}
+}
+
+func TestRemoveDisabled(t *testing.T) {
+	p := &PluginContainer{MaxPanics: 1}
+	p.Add(namedPlugin("a"), namedPlugin("b"), namedPlugin("c"))
+	hook(p, 2, true)
+	if p.Enabled(2) {
+		t.Fatal("expect c to be disabled")
+	}
+	p.Remove("a")
+	if !p.Enabled(0) || p.Enabled(1) {
+		t.Fatal("expect the panics of c to follow it once a is removed")
+	}
+	p.Remove("c")
+	if !p.Enabled(0) || !p.Enabled(1) {
+		t.Fatal("expect the panics of c to be forgotten once it is removed")
+	}
+}
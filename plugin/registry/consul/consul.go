@@ -0,0 +1,146 @@
+// Package consul registers the services of a server into Consul with a health check, and discovers them on the client side.
+//
+// Each service path is registered as an instance of the Consul service ServiceName, tagged with the path,
+// with the metadata of the service, e.g. "version=2&weight=10", as Consul metadata.
+// The health check is either a TTL check renewed by ConsulRegisterPlugin, or an HTTP check of CheckHTTP by Consul:
+//
+//	p := &consul.ConsulRegisterPlugin{ServiceAddress: "tcp@10.0.0.1:8972"}
+//	srv.PluginContainer.Add(p)
+//	server.SetShutdown(0, p.Close)
+//
+// ConsulSelector watches the passing instances, so that the servers failing their check are dropped at once,
+// and Consul deregisters them after DeregisterAfter:
+//
+//	c := client.NewClient(client.Client{}, new(consul.ConsulSelector))
+//
+// The servers are selected in proportion to the "weight" metadata of their services, 1 by default.
+//
+// Both use the HTTP API of the Consul agent, so that no Consul client library is needed.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultAddress is the address of the Consul agent when Address is empty.
+	DefaultAddress = "http://127.0.0.1:8500"
+	// DefaultServiceName is the Consul service of the service paths when ServiceName is empty.
+	DefaultServiceName = "myrpc"
+	// MetaAddress is the Consul metadata holding the server address as "network@address".
+	MetaAddress = "rpc_address"
+)
+
+type (
+	// agent calls the HTTP API of a Consul agent.
+	agent struct {
+		address string
+		token   string
+		client  *http.Client
+	}
+
+	agentCheck struct {
+		CheckID                        string
+		TTL                            string `json:",omitempty"`
+		HTTP                           string `json:",omitempty"`
+		Interval                       string `json:",omitempty"`
+		DeregisterCriticalServiceAfter string
+	}
+
+	agentService struct {
+		ID      string
+		Service string `json:",omitempty"`
+		Name    string `json:",omitempty"`
+		Tags    []string
+		Address string
+		Port    int
+		Meta    map[string]string
+		Check   *agentCheck `json:",omitempty"`
+	}
+
+	serviceEntry struct {
+		Service agentService
+	}
+)
+
+func newAgent(address, token string) *agent {
+	if address == "" {
+		address = DefaultAddress
+	}
+	return &agent{address: strings.TrimSuffix(address, "/"), token: token, client: new(http.Client)}
+}
+
+// do sends the request of the API path, decodes its reply unless it is nil, and returns the X-Consul-Index of the reply.
+func (a *agent) do(ctx context.Context, method, path string, query url.Values, request, reply interface{}) (uint64, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return 0, err
+		}
+	}
+	u := a.address + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if a.token != "" {
+		req.Header.Set("X-Consul-Token", a.token)
+	}
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return 0, errors.New("consul: " + path + ": " + resp.Status + " " + strings.TrimSpace(string(msg)))
+	}
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if reply == nil {
+		return index, nil
+	}
+	return index, json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// register registers or updates the service instance.
+func (a *agent) register(ctx context.Context, service *agentService) error {
+	_, err := a.do(ctx, "PUT", "/v1/agent/service/register", nil, service, nil)
+	return err
+}
+
+// deregister removes the service instance.
+func (a *agent) deregister(ctx context.Context, id string) error {
+	_, err := a.do(ctx, "PUT", "/v1/agent/service/deregister/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+// pass marks the TTL check as passing.
+func (a *agent) pass(ctx context.Context, checkID string) error {
+	_, err := a.do(ctx, "PUT", "/v1/agent/check/pass/"+url.PathEscape(checkID), nil, nil, nil)
+	return err
+}
+
+// health returns the passing instances of the service once the index of the service is past index,
+// or after wait, and the index of the reply.
+func (a *agent) health(ctx context.Context, name string, index uint64, wait string) ([]serviceEntry, uint64, error) {
+	query := url.Values{"passing": {"1"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", wait)
+	}
+	var entries []serviceEntry
+	index, err := a.do(ctx, "GET", "/v1/health/service/"+url.PathEscape(name), query, nil, &entries)
+	return entries, index, err
+}
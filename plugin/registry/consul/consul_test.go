@@ -0,0 +1,210 @@
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/plugin/registry/internal/registrytest"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// fakeConsul serves the part of the HTTP API of a Consul agent used by the package.
+type fakeConsul struct {
+	services map[string]*agentService // ID ->
+	passing  map[string]bool          // check ID ->
+	index    uint64
+	changed  chan struct{}
+	mu       sync.Mutex
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		services: make(map[string]*agentService),
+		passing:  make(map[string]bool),
+		index:    1,
+		changed:  make(chan struct{}),
+	}
+}
+
+// change bumps the index and wakes the blocking queries, f.mu is held.
+func (f *fakeConsul) change() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var service agentService
+		if err := json.NewDecoder(r.Body).Decode(&service); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.services[service.ID] = &service
+		// Consul gets the HTTP check at once, the TTL check is critical until it is passed.
+		f.passing[service.Check.CheckID] = service.Check.HTTP != ""
+		f.change()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		delete(f.services, id)
+		delete(f.passing, "service:"+id)
+		f.change()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/agent/check/pass/")
+		if _, ok := f.passing[id]; !ok {
+			http.Error(w, "Unknown check ID", http.StatusNotFound)
+			return
+		}
+		if !f.passing[id] {
+			f.passing[id] = true
+			f.change()
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		for index >= f.index {
+			changed := f.changed
+			f.mu.Unlock()
+			select {
+			case <-changed:
+				f.mu.Lock()
+			case <-r.Context().Done():
+				f.mu.Lock()
+				return
+			}
+		}
+		entries := []serviceEntry{}
+		for _, service := range f.services {
+			if service.Name == name && f.passing[service.Check.CheckID] {
+				s := *service
+				s.Service, s.Name, s.Check = s.Name, "", nil
+				entries = append(entries, serviceEntry{Service: s})
+			}
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		json.NewEncoder(w).Encode(entries)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fail makes the check of the service instances of the server address critical, and reports whether it has any.
+func (f *fakeConsul) fail(serviceAddress string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found := false
+	for _, service := range f.services {
+		if service.Meta[MetaAddress] == serviceAddress {
+			f.passing[service.Check.CheckID] = false
+			found = true
+		}
+	}
+	f.change()
+	return found
+}
+
+// serve starts a server of the service name announced by p.
+func serve(t *testing.T, p *ConsulRegisterPlugin, name string) *ConsulRegisterPlugin {
+	registrytest.Serve(t, memnet.Network, name, func(serviceAddress string) server.IPlugin {
+		p.ServiceAddress = serviceAddress
+		return p
+	}, "version=2")
+	return p
+}
+
+func TestTTLCheck(t *testing.T) {
+	f := newFakeConsul()
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	p := serve(t, &ConsulRegisterPlugin{Address: ts.URL, CheckInterval: 300 * time.Millisecond}, "arith")
+	defer p.Close()
+	f.mu.Lock()
+	service := f.services["myrpc-"+p.ServiceAddress+"/arith/mul"]
+	f.mu.Unlock()
+	if service == nil || service.Meta["version"] != "2" || service.Check.TTL != "300ms" {
+		t.Fatalf("unexpected registration: %+v", service)
+	}
+
+	s := &ConsulSelector{Address: ts.URL}
+	defer s.Close()
+	c := client.NewClient(client.Client{}, s)
+	args := &codec.Args{A: 7, B: 8}
+	var reply codec.Reply
+	// the check is passed by the plugin.
+	registrytest.WaitFor(t, func() bool {
+		return c.Call("/arith/mul", args, &reply) == nil
+	})
+	if reply.C != 56 {
+		t.Fatalf("unexpected result: %v", reply.C)
+	}
+
+	// a server failing its check is dropped, until it passes again.
+	if !f.fail(p.ServiceAddress) {
+		t.Fatal("service not found")
+	}
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith/mul")
+		return err == registry.ErrNoServer
+	})
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith/mul")
+		return err == nil
+	})
+
+	// the services lost by the agent are registered again.
+	f.mu.Lock()
+	f.services = make(map[string]*agentService)
+	f.passing = make(map[string]bool)
+	f.change()
+	f.mu.Unlock()
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith/mul")
+		return err == nil
+	})
+
+	// a closed server is deregistered.
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith/mul")
+		return err == registry.ErrNoServer
+	})
+}
+
+func TestHTTPCheck(t *testing.T) {
+	f := newFakeConsul()
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	p := serve(t, &ConsulRegisterPlugin{Address: ts.URL, ServiceName: "arith", CheckHTTP: "http://10.0.0.1:8080/health"}, "arith")
+	defer p.Close()
+	f.mu.Lock()
+	service := f.services["arith-"+p.ServiceAddress+"/arith/mul"]
+	f.mu.Unlock()
+	if service == nil || service.Check.HTTP == "" || service.Check.Interval != "10s" || service.Check.TTL != "" {
+		t.Fatalf("unexpected registration: %+v", service)
+	}
+
+	s := &ConsulSelector{Address: ts.URL, ServiceName: "arith"}
+	defer s.Close()
+	c := client.NewClient(client.Client{}, s)
+	var reply codec.Reply
+	if rpcErr := c.Call("/arith/mul", &codec.Args{A: 7, B: 8}, &reply); rpcErr != nil || reply.C != 56 {
+		t.Fatalf("unexpected result: %v, %v", reply.C, rpcErr)
+	}
+}
@@ -0,0 +1,182 @@
+package consul
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// ConsulRegisterPlugin is a server plugin that registers the services into Consul, with a health check.
+type ConsulRegisterPlugin struct {
+	// Address is the URL of the Consul agent.
+	// If it is empty, DefaultAddress is used.
+	Address string
+	// Token is the ACL token of the requests, if any.
+	Token string
+	// ServiceName is the Consul service of the service paths.
+	// If it is empty, DefaultServiceName is used.
+	ServiceName string
+	// ServiceAddress is the address the clients dial, as "network@address", e.g. "tcp@10.0.0.1:8972".
+	ServiceAddress string
+	// CheckHTTP, if it is not empty, is the URL Consul gets every CheckInterval, the services are healthy while it replies 2xx.
+	// Otherwise the services have a TTL check of CheckInterval, that the plugin passes while the server runs.
+	CheckHTTP string
+	// CheckInterval is the interval of the HTTP check, or the TTL of the TTL check.
+	// If it is 0, 10s is used.
+	CheckInterval time.Duration
+	// DeregisterAfter is how long the check of the services may be critical before Consul deregisters them,
+	// e.g. when the server crashed.
+	// If it is 0, 1m is used.
+	DeregisterAfter time.Duration
+
+	agent    *agent
+	services map[string]*agentService // ID -> service
+	stop     context.CancelFunc
+	mu       sync.Mutex
+}
+
+var _ plugin.IPlugin = new(ConsulRegisterPlugin)
+
+// Name returns plugin name.
+func (p *ConsulRegisterPlugin) Name() string {
+	return "ConsulRegisterPlugin"
+}
+
+var _ server.IRegisterPlugin = new(ConsulRegisterPlugin)
+
+// Register registers the service path nodePath, with the address and the metadata of the server, into Consul.
+func (p *ConsulRegisterPlugin) Register(nodePath string, rcvr interface{}, metadata ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.agent == nil {
+		p.agent = newAgent(p.Address, p.Token)
+		p.services = make(map[string]*agentService)
+	}
+	service := p.newService(nodePath, metadata)
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval())
+	defer cancel()
+	if err := p.agent.register(ctx, service); err != nil {
+		return err
+	}
+	p.services[service.ID] = service
+	if p.stop == nil && p.CheckHTTP == "" {
+		var passCtx context.Context
+		passCtx, p.stop = context.WithCancel(context.Background())
+		go p.passChecks(passCtx)
+	}
+	return nil
+}
+
+// newService returns the Consul service instance of the service path.
+func (p *ConsulRegisterPlugin) newService(nodePath string, metadata []string) *agentService {
+	name := p.ServiceName
+	if name == "" {
+		name = DefaultServiceName
+	}
+	meta := make(map[string]string)
+	for _, m := range metadata {
+		values, err := url.ParseQuery(m)
+		if err != nil {
+			log.Warnf("rpc: consul: invalid metadata %q of %s: %s", m, nodePath, err.Error())
+			continue
+		}
+		for k := range values {
+			meta[k] = values.Get(k)
+		}
+	}
+	meta[MetaAddress] = p.ServiceAddress
+	service := &agentService{
+		ID:   name + "-" + p.ServiceAddress + nodePath,
+		Name: name,
+		Tags: []string{nodePath},
+		Meta: meta,
+	}
+	_, address := registry.SplitAddress(p.ServiceAddress)
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		service.Address = host
+		service.Port, _ = strconv.Atoi(port)
+	}
+	deregisterAfter := p.DeregisterAfter
+	if deregisterAfter <= 0 {
+		deregisterAfter = time.Minute
+	}
+	service.Check = &agentCheck{
+		CheckID:                        "service:" + service.ID,
+		DeregisterCriticalServiceAfter: deregisterAfter.String(),
+	}
+	if p.CheckHTTP != "" {
+		service.Check.HTTP = p.CheckHTTP
+		service.Check.Interval = p.interval().String()
+	} else {
+		service.Check.TTL = p.interval().String()
+	}
+	return service
+}
+
+func (p *ConsulRegisterPlugin) interval() time.Duration {
+	if p.CheckInterval > 0 {
+		return p.CheckInterval
+	}
+	return 10 * time.Second
+}
+
+// passChecks passes the TTL checks of the services until ctx is done,
+// and registers them again if Consul has lost them, e.g. after the agent restarted.
+func (p *ConsulRegisterPlugin) passChecks(ctx context.Context) {
+	ticker := time.NewTicker(p.interval() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		callCtx, cancel := context.WithTimeout(ctx, p.interval()/3)
+		p.mu.Lock()
+		for _, service := range p.services {
+			err := p.agent.pass(callCtx, service.Check.CheckID)
+			if err != nil && callCtx.Err() == nil {
+				if err = p.agent.register(callCtx, service); err == nil {
+					err = p.agent.pass(callCtx, service.Check.CheckID)
+				}
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Warnf("rpc: consul: pass the check of %s: %s", service.ID, err.Error())
+			}
+		}
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+// Close deregisters the services from Consul, e.g. with server.SetShutdown.
+func (p *ConsulRegisterPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval())
+	defer cancel()
+	var errs []error
+	for id := range p.services {
+		if err := p.agent.deregister(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+		delete(p.services, id)
+	}
+	if len(errs) > 0 {
+		return common.NewMultiError(errs)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package consul
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+)
+
+// ConsulSelector selects the healthy servers registered into Consul by ConsulRegisterPlugin.
+// It watches the passing instances of the service, so that the servers that come, go or fail their check
+// are used or dropped at once.
+type ConsulSelector struct {
+	// Address is the URL of the Consul agent.
+	// If it is empty, DefaultAddress is used.
+	Address string
+	// Token is the ACL token of the requests, if any.
+	Token string
+	// ServiceName is the Consul service of the service paths.
+	// If it is empty, DefaultServiceName is used.
+	ServiceName string
+	DialTimeout time.Duration
+	// RetryInterval is how long to wait before watching again after the watch failed.
+	// If it is 0, 1s is used.
+	RetryInterval time.Duration
+
+	table registry.Table
+	agent *agent
+	stop  context.CancelFunc
+	mu    sync.Mutex // protects the start and the stop
+}
+
+var _ client.Selector = new(ConsulSelector)
+
+// watchWait is the wait of the blocking queries of the instances.
+const watchWait = "1m"
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *ConsulSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.table.SetNewInvokerFunc(newInvokerFunc)
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RoundRobin, WeightedRoundRobin or else RandomSelect.
+func (s *ConsulSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.table.SetSelectMode(selectMode)
+}
+
+// Select returns a rpc invoker of a healthy server of the service method options[0], or of any server without options.
+// It returns registry.ErrNoServer if none is registered.
+func (s *ConsulSelector) Select(options ...interface{}) (client.Invoker, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s.table.Select(options...)
+}
+
+// List returns Invokers to all servers
+func (s *ConsulSelector) List() []client.Invoker {
+	return s.table.List()
+}
+
+// HandleFailed handle failed Invoker
+func (s *ConsulSelector) HandleFailed(invoker client.Invoker) {
+	s.table.HandleFailed(invoker)
+}
+
+// HandleResult handle the result of a call
+func (s *ConsulSelector) HandleResult(invoker client.Invoker, err error, latency time.Duration) {
+	s.table.HandleResult(invoker, err, latency)
+}
+
+// Close stops watching Consul, and closes the invokers.
+func (s *ConsulSelector) Close() error {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.stop()
+		s.stop = nil
+	}
+	s.mu.Unlock()
+	return s.table.Close()
+}
+
+// start reads the instances and starts watching them, unless it is done.
+func (s *ConsulSelector) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	if s.agent == nil {
+		s.agent = newAgent(s.Address, s.Token)
+		s.table.DialTimeout = s.DialTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, index, err := s.agent.health(ctx, s.serviceName(), 0, watchWait)
+	if err != nil {
+		cancel()
+		return err
+	}
+	s.reset(entries)
+	s.stop = cancel
+	go s.watch(ctx, index)
+	return nil
+}
+
+func (s *ConsulSelector) serviceName() string {
+	if s.ServiceName == "" {
+		return DefaultServiceName
+	}
+	return s.ServiceName
+}
+
+// watch reads the instances whenever they change after index, until ctx is done.
+func (s *ConsulSelector) watch(ctx context.Context, index uint64) {
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = time.Second
+	}
+	for {
+		entries, newIndex, err := s.agent.health(ctx, s.serviceName(), index, watchWait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warnf("rpc: consul: watch the services: %s", err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+			continue
+		}
+		if newIndex < index {
+			// the index went backwards, e.g. the Consul servers were restored, start over.
+			newIndex = 0
+		}
+		s.reset(entries)
+		index = newIndex
+	}
+}
+
+// reset replaces the servers with the passing instances.
+func (s *ConsulSelector) reset(entries []serviceEntry) {
+	services := make(map[string]map[string]int)
+	for _, entry := range entries {
+		addr := entry.Service.Meta[MetaAddress]
+		if addr == "" {
+			addr = "tcp@" + net.JoinHostPort(entry.Service.Address, strconv.Itoa(entry.Service.Port))
+		}
+		weight, _ := strconv.Atoi(entry.Service.Meta["weight"])
+		for _, path := range entry.Service.Tags {
+			if services[path] == nil {
+				services[path] = make(map[string]int)
+			}
+			services[path][addr] = weight
+		}
+	}
+	s.table.ResetWeighted(services)
+}
@@ -0,0 +1,217 @@
+// Package etcd registers the services of a server into etcd, and discovers them on the client side.
+//
+// The services are registered by EtcdRegisterPlugin under the keys BasePath + service path + "/" + service address,
+// with the metadata of the service as value, e.g. "/myrpc/arith/mul/tcp@10.0.0.1:8972",
+// in a lease that is kept alive until the plugin is closed:
+//
+//	p := &etcd.EtcdRegisterPlugin{Endpoints: []string{"http://127.0.0.1:2379"}, ServiceAddress: "tcp@10.0.0.1:8972"}
+//	srv.PluginContainer.Add(p)
+//	server.SetShutdown(0, p.Close)
+//
+// EtcdSelector watches the keys, and selects the servers of the service method called:
+//
+//	c := client.NewClient(client.Client{}, &etcd.EtcdSelector{Endpoints: []string{"http://127.0.0.1:2379"}})
+//
+// The servers are selected in proportion to the "weight" metadata of their services, 1 by default.
+//
+// Both use the JSON gateway of the etcd v3 API, so that no etcd client library is needed.
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultBasePath is the key prefix of the services when BasePath is empty.
+const DefaultBasePath = "/myrpc"
+
+type (
+	// gateway calls the JSON gateway of the etcd v3 API.
+	gateway struct {
+		endpoints []string
+		next      uint32
+		client    *http.Client
+	}
+
+	keyValue struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	}
+
+	responseHeader struct {
+		Revision int64 `json:"revision,string"`
+	}
+
+	event struct {
+		Type string   `json:"type"`
+		KV   keyValue `json:"kv"`
+	}
+)
+
+// errNoEndpoint is returned when no etcd endpoint is configured.
+var errNoEndpoint = errors.New("etcd: no endpoint")
+
+func newGateway(endpoints []string) *gateway {
+	return &gateway{endpoints: endpoints, client: new(http.Client)}
+}
+
+// post sends the request of the API method to the endpoints in turn, until one replies.
+func (g *gateway) post(ctx context.Context, method string, request interface{}) (*http.Response, error) {
+	if len(g.endpoints) == 0 {
+		return nil, errNoEndpoint
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	n := atomic.AddUint32(&g.next, 1)
+	for i := range g.endpoints {
+		endpoint := g.endpoints[(int(n)+i)%len(g.endpoints)]
+		var req *http.Request
+		req, err = http.NewRequest("POST", strings.TrimSuffix(endpoint, "/")+"/v3/"+method, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		resp, err = g.client.Do(req.WithContext(ctx))
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			var reply struct {
+				Error string `json:"error"`
+			}
+			json.NewDecoder(resp.Body).Decode(&reply)
+			resp.Body.Close()
+			return nil, errors.New("etcd: " + method + ": " + resp.Status + " " + reply.Error)
+		}
+		return resp, nil
+	}
+	return nil, err
+}
+
+// call sends a unary request of the API method, and decodes its reply.
+func (g *gateway) call(ctx context.Context, method string, request, reply interface{}) error {
+	resp, err := g.post(ctx, method, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// grant creates a lease of ttl seconds.
+func (g *gateway) grant(ctx context.Context, ttl int64) (int64, error) {
+	var reply struct {
+		ID int64 `json:"ID,string"`
+	}
+	err := g.call(ctx, "lease/grant", struct {
+		TTL int64 `json:"TTL,string"`
+	}{ttl}, &reply)
+	return reply.ID, err
+}
+
+// keepAlive renews the lease, it reports false if the lease has expired.
+func (g *gateway) keepAlive(ctx context.Context, lease int64) (bool, error) {
+	var reply struct {
+		Result struct {
+			TTL int64 `json:"TTL,string"`
+		} `json:"result"`
+	}
+	err := g.call(ctx, "lease/keepalive", struct {
+		ID int64 `json:"ID,string"`
+	}{lease}, &reply)
+	return reply.Result.TTL > 0, err
+}
+
+// revoke revokes the lease, deleting its keys.
+func (g *gateway) revoke(ctx context.Context, lease int64) error {
+	return g.call(ctx, "lease/revoke", struct {
+		ID int64 `json:"ID,string"`
+	}{lease}, nil)
+}
+
+// put sets the key in the lease.
+func (g *gateway) put(ctx context.Context, key, value string, lease int64) error {
+	return g.call(ctx, "kv/put", struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+		Lease int64  `json:"lease,string"`
+	}{[]byte(key), []byte(value), lease}, nil)
+}
+
+// rangePrefix returns the keys with the prefix, and the revision they were read at.
+func (g *gateway) rangePrefix(ctx context.Context, prefix string) ([]keyValue, int64, error) {
+	var reply struct {
+		Header responseHeader `json:"header"`
+		KVs    []keyValue     `json:"kvs"`
+	}
+	err := g.call(ctx, "kv/range", struct {
+		Key      []byte `json:"key"`
+		RangeEnd []byte `json:"range_end"`
+	}{[]byte(prefix), prefixEnd(prefix)}, &reply)
+	return reply.KVs, reply.Header.Revision, err
+}
+
+// watchPrefix calls fn with the changes of the keys with the prefix from revision on,
+// until ctx is done or the watch fails.
+func (g *gateway) watchPrefix(ctx context.Context, prefix string, revision int64, fn func([]event)) error {
+	type createRequest struct {
+		Key           []byte `json:"key"`
+		RangeEnd      []byte `json:"range_end"`
+		StartRevision int64  `json:"start_revision,string"`
+	}
+	resp, err := g.post(ctx, "watch", struct {
+		CreateRequest createRequest `json:"create_request"`
+	}{createRequest{[]byte(prefix), prefixEnd(prefix), revision}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var reply struct {
+			Result struct {
+				Canceled bool    `json:"canceled"`
+				Events   []event `json:"events"`
+			} `json:"result"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&reply); err != nil {
+			return err
+		}
+		if reply.Error.Message != "" {
+			return errors.New("etcd: watch: " + reply.Error.Message)
+		}
+		if reply.Result.Canceled {
+			return errors.New("etcd: watch canceled")
+		}
+		if len(reply.Result.Events) > 0 {
+			fn(reply.Result.Events)
+		}
+	}
+}
+
+// prefixEnd returns the end of the range of the keys with the prefix.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
@@ -0,0 +1,231 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/plugin/registry/internal/registrytest"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// fakeEtcd serves the part of the JSON gateway of the etcd v3 API used by the package.
+type fakeEtcd struct {
+	kvs      map[string]fakeKV
+	lease    int64
+	leases   map[int64]bool
+	revision int64
+	watchers map[chan event]string // -> prefix
+	mu       sync.Mutex
+}
+
+type fakeKV struct {
+	value []byte
+	lease int64
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		kvs:      make(map[string]fakeKV),
+		leases:   make(map[int64]bool),
+		watchers: make(map[chan event]string),
+	}
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID            int64  `json:"ID,string"`
+		Key           []byte `json:"key"`
+		Value         []byte `json:"value"`
+		Lease         int64  `json:"lease,string"`
+		CreateRequest struct {
+			Key []byte `json:"key"`
+		} `json:"create_request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/v3/watch" {
+		f.watch(w, r, string(req.CreateRequest.Key))
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.lease++
+		f.leases[f.lease] = true
+		fmt.Fprintf(w, `{"ID":"%d","TTL":"10"}`, f.lease)
+	case "/v3/lease/keepalive":
+		if f.leases[req.ID] {
+			fmt.Fprintf(w, `{"result":{"ID":"%d","TTL":"10"}}`, req.ID)
+		} else {
+			fmt.Fprintf(w, `{"result":{"ID":"%d"}}`, req.ID)
+		}
+	case "/v3/lease/revoke":
+		delete(f.leases, req.ID)
+		for key, kv := range f.kvs {
+			if kv.lease == req.ID {
+				delete(f.kvs, key)
+				f.notify(event{Type: "DELETE", KV: keyValue{Key: []byte(key)}})
+			}
+		}
+		fmt.Fprint(w, `{}`)
+	case "/v3/kv/put":
+		f.kvs[string(req.Key)] = fakeKV{value: req.Value, lease: req.Lease}
+		f.notify(event{KV: keyValue{Key: req.Key, Value: req.Value}})
+		fmt.Fprint(w, `{}`)
+	case "/v3/kv/range":
+		var reply struct {
+			Header struct {
+				Revision int64 `json:"revision,string"`
+			} `json:"header"`
+			KVs []keyValue `json:"kvs"`
+		}
+		reply.Header.Revision = f.revision
+		for key, kv := range f.kvs {
+			if strings.HasPrefix(key, string(req.Key)) {
+				reply.KVs = append(reply.KVs, keyValue{Key: []byte(key), Value: kv.value})
+			}
+		}
+		json.NewEncoder(w).Encode(reply)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEtcd) notify(e event) {
+	f.revision++
+	for c, prefix := range f.watchers {
+		if strings.HasPrefix(string(e.KV.Key), prefix) {
+			c <- e
+		}
+	}
+}
+
+func (f *fakeEtcd) watch(w http.ResponseWriter, r *http.Request, prefix string) {
+	c := make(chan event, 100)
+	f.mu.Lock()
+	f.watchers[c] = prefix
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.watchers, c)
+		f.mu.Unlock()
+	}()
+	fmt.Fprint(w, `{"result":{"created":true}}`+"\n")
+	w.(http.Flusher).Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-c:
+			var reply struct {
+				Result struct {
+					Events []event `json:"events"`
+				} `json:"result"`
+			}
+			reply.Result.Events = []event{e}
+			enc.Encode(reply)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+// serve starts a server of the service name announced to the etcd at endpoint, with the TTL ttl.
+func serve(t *testing.T, endpoint, name string, ttl time.Duration) *EtcdRegisterPlugin {
+	p := &EtcdRegisterPlugin{Endpoints: []string{endpoint}, TTL: ttl}
+	registrytest.Serve(t, memnet.Network, name, func(serviceAddress string) server.IPlugin {
+		p.ServiceAddress = serviceAddress
+		return p
+	})
+	return p
+}
+
+func TestRegistry(t *testing.T) {
+	f := newFakeEtcd()
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	p1 := serve(t, ts.URL, "arith", 0)
+	defer p1.Close()
+	f.mu.Lock()
+	if _, ok := f.kvs["/myrpc/arith/mul/"+p1.ServiceAddress]; !ok {
+		t.Fatalf("service not registered: %v", f.kvs)
+	}
+	f.mu.Unlock()
+
+	s := &EtcdSelector{Endpoints: []string{ts.URL}}
+	defer s.Close()
+	c := client.NewClient(client.Client{}, s)
+	args := &codec.Args{A: 7, B: 8}
+	var reply codec.Reply
+	if rpcErr := c.Call("/arith/mul", args, &reply); rpcErr != nil || reply.C != 56 {
+		t.Fatalf("unexpected result: %v, %v", reply.C, rpcErr)
+	}
+	if _, err := s.Select("/arith2/mul"); err != registry.ErrNoServer {
+		t.Fatalf("expected ErrNoServer, got %v", err)
+	}
+
+	// a new server is watched.
+	p2 := serve(t, ts.URL, "arith2", 0)
+	registrytest.WaitFor(t, func() bool {
+		return c.Call("/arith2/mul", args, &reply) == nil
+	})
+	if reply.C != 56 {
+		t.Fatalf("unexpected result: %v", reply.C)
+	}
+
+	// a closed server is dropped.
+	if err := p2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith2/mul?x=1")
+		return err == registry.ErrNoServer
+	})
+	if len(s.List()) != 1 {
+		t.Fatalf("unexpected invokers: %v", s.List())
+	}
+}
+
+func TestReregister(t *testing.T) {
+	f := newFakeEtcd()
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	p := serve(t, ts.URL, "arith", time.Second) // renewed every 333ms
+	defer p.Close()
+
+	// the lease expires, e.g. after a network partition.
+	f.mu.Lock()
+	for lease := range f.leases {
+		delete(f.leases, lease)
+	}
+	f.kvs = make(map[string]fakeKV)
+	f.mu.Unlock()
+
+	registrytest.WaitFor(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_, ok := f.kvs["/myrpc/arith/mul/"+p.ServiceAddress]
+		return ok
+	})
+}
+
+func TestPrefixEnd(t *testing.T) {
+	if end := string(prefixEnd("/myrpc/")); end != "/myrpc0" {
+		t.Fatalf("unexpected end: %s", end)
+	}
+}
@@ -0,0 +1,150 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// EtcdRegisterPlugin is a server plugin that registers the services into etcd.
+type EtcdRegisterPlugin struct {
+	// Endpoints are the URLs of the etcd servers, e.g. "http://127.0.0.1:2379".
+	Endpoints []string
+	// BasePath is the key prefix of the services.
+	// If it is empty, DefaultBasePath is used.
+	BasePath string
+	// ServiceAddress is the address the clients dial, as "network@address", e.g. "tcp@10.0.0.1:8972".
+	ServiceAddress string
+	// TTL is the time to live of the keys if the server stops without Close, e.g. when it crashes.
+	// If it is 0, 10s is used.
+	TTL time.Duration
+
+	gateway  *gateway
+	services map[string]string // key -> metadata
+	lease    int64
+	stop     context.CancelFunc
+	mu       sync.Mutex
+}
+
+var _ plugin.IPlugin = new(EtcdRegisterPlugin)
+
+// Name returns plugin name.
+func (p *EtcdRegisterPlugin) Name() string {
+	return "EtcdRegisterPlugin"
+}
+
+var _ server.IRegisterPlugin = new(EtcdRegisterPlugin)
+
+// Register puts the service path nodePath, with the address and the metadata of the server, into etcd.
+func (p *EtcdRegisterPlugin) Register(nodePath string, rcvr interface{}, metadata ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.gateway == nil {
+		p.gateway = newGateway(p.Endpoints)
+		p.services = make(map[string]string)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.ttl())
+	defer cancel()
+	if p.lease == 0 {
+		lease, err := p.gateway.grant(ctx, int64(p.ttl()/time.Second))
+		if err != nil {
+			return err
+		}
+		p.lease = lease
+		var keepCtx context.Context
+		keepCtx, p.stop = context.WithCancel(context.Background())
+		go p.keepAlive(keepCtx)
+	}
+	key := basePath(p.BasePath) + nodePath + "/" + p.ServiceAddress
+	value := joinMetadata(metadata)
+	if err := p.gateway.put(ctx, key, value, p.lease); err != nil {
+		return err
+	}
+	p.services[key] = value
+	return nil
+}
+
+func (p *EtcdRegisterPlugin) ttl() time.Duration {
+	if p.TTL >= time.Second {
+		return p.TTL
+	}
+	return 10 * time.Second
+}
+
+// keepAlive renews the lease of the services until ctx is done,
+// and registers them again if the lease has expired, e.g. after a network partition.
+func (p *EtcdRegisterPlugin) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(p.ttl() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		callCtx, cancel := context.WithTimeout(ctx, p.ttl()/3)
+		p.mu.Lock()
+		alive, err := p.gateway.keepAlive(callCtx, p.lease)
+		if err == nil && !alive {
+			err = p.reregister(callCtx)
+		}
+		p.mu.Unlock()
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Warnf("rpc: etcd: keep the services alive: %s", err.Error())
+		}
+	}
+}
+
+// reregister puts the services into a new lease.
+func (p *EtcdRegisterPlugin) reregister(ctx context.Context) error {
+	lease, err := p.gateway.grant(ctx, int64(p.ttl()/time.Second))
+	if err != nil {
+		return err
+	}
+	p.lease = lease
+	for key, value := range p.services {
+		if err = p.gateway.put(ctx, key, value, lease); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes the services from etcd, e.g. with server.SetShutdown.
+func (p *EtcdRegisterPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lease == 0 {
+		return nil
+	}
+	p.stop()
+	ctx, cancel := context.WithTimeout(context.Background(), p.ttl())
+	defer cancel()
+	err := p.gateway.revoke(ctx, p.lease)
+	p.lease = 0
+	p.services = make(map[string]string)
+	return err
+}
+
+func basePath(path string) string {
+	if path == "" {
+		return DefaultBasePath
+	}
+	return strings.TrimSuffix(path, "/")
+}
+
+func joinMetadata(metadata []string) string {
+	var s []string
+	for _, m := range metadata {
+		if m != "" {
+			s = append(s, m)
+		}
+	}
+	return strings.Join(s, "&")
+}
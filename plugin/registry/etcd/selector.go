@@ -0,0 +1,171 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+)
+
+// EtcdSelector selects the servers registered into etcd by EtcdRegisterPlugin.
+// It watches the services, so that the servers that come and go are used or dropped at once.
+type EtcdSelector struct {
+	// Endpoints are the URLs of the etcd servers, e.g. "http://127.0.0.1:2379".
+	Endpoints []string
+	// BasePath is the key prefix of the services.
+	// If it is empty, DefaultBasePath is used.
+	BasePath    string
+	DialTimeout time.Duration
+	// RetryInterval is how long to wait before watching again after the watch failed.
+	// If it is 0, 1s is used.
+	RetryInterval time.Duration
+
+	table   registry.Table
+	gateway *gateway
+	stop    context.CancelFunc
+	mu      sync.Mutex // protects the start and the stop
+}
+
+var _ client.Selector = new(EtcdSelector)
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *EtcdSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.table.SetNewInvokerFunc(newInvokerFunc)
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RoundRobin, WeightedRoundRobin or else RandomSelect.
+func (s *EtcdSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.table.SetSelectMode(selectMode)
+}
+
+// Select returns a rpc invoker of a server of the service method options[0], or of any server without options.
+// It returns registry.ErrNoServer if none is registered.
+func (s *EtcdSelector) Select(options ...interface{}) (client.Invoker, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s.table.Select(options...)
+}
+
+// List returns Invokers to all servers
+func (s *EtcdSelector) List() []client.Invoker {
+	return s.table.List()
+}
+
+// HandleFailed handle failed Invoker
+func (s *EtcdSelector) HandleFailed(invoker client.Invoker) {
+	s.table.HandleFailed(invoker)
+}
+
+// HandleResult handle the result of a call
+func (s *EtcdSelector) HandleResult(invoker client.Invoker, err error, latency time.Duration) {
+	s.table.HandleResult(invoker, err, latency)
+}
+
+// Close stops watching etcd, and closes the invokers.
+func (s *EtcdSelector) Close() error {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.stop()
+		s.stop = nil
+	}
+	s.mu.Unlock()
+	return s.table.Close()
+}
+
+// start reads the services and starts watching them, unless it is done.
+func (s *EtcdSelector) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	if s.gateway == nil {
+		s.gateway = newGateway(s.Endpoints)
+		s.table.DialTimeout = s.DialTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	kvs, revision, err := s.gateway.rangePrefix(ctx, s.prefix())
+	if err != nil {
+		cancel()
+		return err
+	}
+	s.reset(kvs)
+	s.stop = cancel
+	go s.watch(ctx, revision)
+	return nil
+}
+
+func (s *EtcdSelector) prefix() string {
+	return basePath(s.BasePath) + "/"
+}
+
+// watch applies the changes of the services after revision until ctx is done,
+// reading the services again whenever the watch fails.
+func (s *EtcdSelector) watch(ctx context.Context, revision int64) {
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = time.Second
+	}
+	for {
+		err := s.gateway.watchPrefix(ctx, s.prefix(), revision+1, s.apply)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("rpc: etcd: watch the services: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		kvs, rev, err := s.gateway.rangePrefix(ctx, s.prefix())
+		if err != nil {
+			continue
+		}
+		s.reset(kvs)
+		revision = rev
+	}
+}
+
+// reset replaces the services with kvs.
+func (s *EtcdSelector) reset(kvs []keyValue) {
+	services := make(map[string]map[string]int)
+	for _, kv := range kvs {
+		if path, addr, ok := s.parseKey(string(kv.Key)); ok {
+			if services[path] == nil {
+				services[path] = make(map[string]int)
+			}
+			services[path][addr] = registry.Weight(string(kv.Value))
+		}
+	}
+	s.table.ResetWeighted(services)
+}
+
+// apply applies the changes of the services.
+func (s *EtcdSelector) apply(events []event) {
+	for _, e := range events {
+		path, addr, ok := s.parseKey(string(e.KV.Key))
+		if !ok {
+			continue
+		}
+		if e.Type == "DELETE" {
+			s.table.Remove(path, addr)
+		} else {
+			s.table.AddWeighted(path, addr, registry.Weight(string(e.KV.Value)))
+		}
+	}
+}
+
+// parseKey splits a key into the service path and the server address.
+func (s *EtcdSelector) parseKey(key string) (path, addr string, ok bool) {
+	key = strings.TrimPrefix(key, basePath(s.BasePath))
+	i := strings.LastIndexByte(key, '/')
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
@@ -0,0 +1,65 @@
+// Package registrytest provides the helpers shared by the tests of the registries.
+package registrytest
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+var addrCounter int32
+
+// Serve starts a server of codec.Service named name, on a new in-memory address if network is memnet.Network,
+// or on 127.0.0.1 if it is "tcp", and returns its service address, e.g. "mem@registrytest-1".
+// If announce is not nil, the server uses the plugin it returns for the service address.
+func Serve(t *testing.T, network, name string, announce func(serviceAddress string) server.IPlugin, metadata ...string) string {
+	var lis net.Listener
+	var err error
+	if network == memnet.Network {
+		lis, err = memnet.Listen(fmt.Sprintf("registrytest-%d", atomic.AddInt32(&addrCounter, 1)))
+	} else {
+		lis, err = net.Listen(network, "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceAddress := network + "@" + lis.Addr().String()
+	srv := server.NewServer(server.Server{})
+	if announce != nil {
+		srv.PluginContainer.Add(announce(serviceAddress))
+	}
+	srv.NamedRegister(name, codec.Service, metadata...)
+	go srv.ServeListener(lis)
+	return serviceAddress
+}
+
+// WaitFor waits until cond returns true, and fails t if it does not within 3 seconds.
+func WaitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Servers returns how many servers of the service method s selects.
+func Servers(s client.Selector, serviceMethod string) int {
+	seen := make(map[client.Invoker]bool)
+	for i := 0; i < 4; i++ {
+		invoker, err := s.Select(serviceMethod)
+		if err != nil {
+			return 0
+		}
+		seen[invoker] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,266 @@
+// Package kubernetes discovers the servers of a Kubernetes Service on the client side,
+// by watching its EndpointSlices, or its Endpoints, with the API server, as the pods come and go:
+//
+//	c := client.NewClient(client.Client{}, &kubernetes.KubernetesSelector{Service: "arith", Port: "rpc"})
+//
+// In a pod, the selector uses the service account of the pod, which must be allowed to list and watch
+// the endpointslices, or the endpoints, of the namespace. Elsewhere it uses a kubeconfig file.
+// It calls the REST API of the API server, so that no Kubernetes client library is needed.
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// serviceAccountDir holds the credentials of the service account of a pod, it is replaced by the tests.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// apiServer calls the REST API of a Kubernetes API server.
+type apiServer struct {
+	host      string
+	namespace string // of the pod or of the kubeconfig context
+	token     func() (string, error)
+	username  string
+	password  string
+	client    *http.Client
+}
+
+// inCluster returns the API server of the pod running the process, or nil if the process is not in a pod.
+func inCluster() (*apiServer, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, nil
+	}
+	tokenFile := filepath.Join(serviceAccountDir, "token")
+	if _, err := os.Stat(tokenFile); err != nil {
+		return nil, nil
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("kubernetes: no certificate in " + filepath.Join(serviceAccountDir, "ca.crt"))
+	}
+	namespace, _ := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	return &apiServer{
+		host:      "https://" + net.JoinHostPort(host, port),
+		namespace: strings.TrimSpace(string(namespace)),
+		// the token is read at each request, since it is rotated.
+		token:  readToken(tokenFile),
+		client: &http.Client{Transport: transport(&tls.Config{RootCAs: pool})},
+	}, nil
+}
+
+func readToken(file string) func() (string, error) {
+	return func() (string, error) {
+		token, err := ioutil.ReadFile(file)
+		return strings.TrimSpace(string(token)), err
+	}
+}
+
+func transport(config *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = config
+	return t
+}
+
+// kubeconfig is the part of a kubeconfig file used by the package.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string
+		Cluster struct {
+			Server                   string
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		}
+	}
+	Users []struct {
+		Name string
+		User struct {
+			Token                 string
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			Username              string
+			Password              string
+			Exec                  interface{}
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		}
+	}
+	Contexts []struct {
+		Name    string
+		Context struct {
+			Cluster   string
+			User      string
+			Namespace string
+		}
+	}
+}
+
+// kubeconfigPath returns the kubeconfig file of the user, the first one of $KUBECONFIG or ~/.kube/config.
+func kubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+// fromKubeconfig returns the API server of the current context of the kubeconfig file.
+func fromKubeconfig(file string) (*apiServer, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config kubeconfig
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.New("kubernetes: " + file + ": " + err.Error())
+	}
+	// the relative paths of the file are relative to its directory.
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(filepath.Dir(file), path)
+	}
+	api := new(apiServer)
+	tlsConfig := new(tls.Config)
+	found := false
+	for _, c := range config.Contexts {
+		if c.Name != config.CurrentContext {
+			continue
+		}
+		found = true
+		api.namespace = c.Context.Namespace
+		for _, cluster := range config.Clusters {
+			if cluster.Name != c.Context.Cluster {
+				continue
+			}
+			api.host = strings.TrimSuffix(cluster.Cluster.Server, "/")
+			tlsConfig.InsecureSkipVerify = cluster.Cluster.InsecureSkipTLSVerify
+			ca, err := readData(cluster.Cluster.CertificateAuthorityData, resolve(cluster.Cluster.CertificateAuthority))
+			if err != nil {
+				return nil, err
+			}
+			if ca != nil {
+				tlsConfig.RootCAs = x509.NewCertPool()
+				if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+					return nil, errors.New("kubernetes: no certificate authority in the cluster " + cluster.Name)
+				}
+			}
+		}
+		for _, user := range config.Users {
+			if user.Name != c.Context.User {
+				continue
+			}
+			u := user.User
+			if u.Exec != nil || u.AuthProvider != nil {
+				return nil, errors.New("kubernetes: the authentication plugins of the user " + user.Name + " are not supported")
+			}
+			switch {
+			case u.Token != "":
+				token := u.Token
+				api.token = func() (string, error) { return token, nil }
+			case u.TokenFile != "":
+				api.token = readToken(resolve(u.TokenFile))
+			}
+			api.username, api.password = u.Username, u.Password
+			cert, err := readData(u.ClientCertificateData, resolve(u.ClientCertificate))
+			if err != nil {
+				return nil, err
+			}
+			key, err := readData(u.ClientKeyData, resolve(u.ClientKey))
+			if err != nil {
+				return nil, err
+			}
+			if cert != nil && key != nil {
+				pair, err := tls.X509KeyPair(cert, key)
+				if err != nil {
+					return nil, err
+				}
+				tlsConfig.Certificates = []tls.Certificate{pair}
+			}
+		}
+	}
+	if !found || api.host == "" {
+		return nil, errors.New("kubernetes: no cluster for the current context " + config.CurrentContext + " of " + file)
+	}
+	api.client = &http.Client{Transport: transport(tlsConfig)}
+	return api, nil
+}
+
+// readData returns the base64 data, or else the content of file, or nil if both are empty.
+func readData(data, file string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
+
+// get sends a GET request of the API path, and returns the response if its status is 200.
+func (a *apiServer) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := a.host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if a.token != nil {
+		token, err := a.token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if a.username != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var status apiStatus
+		msg, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(msg, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(msg))
+		}
+		return nil, errors.New("kubernetes: " + path + ": " + resp.Status + " " + status.Message)
+	}
+	return resp, nil
+}
+
+// apiStatus is the status of a failed request, or of a failed watch.
+type apiStatus struct {
+	Code    int
+	Message string
+}
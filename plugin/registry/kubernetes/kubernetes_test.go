@@ -0,0 +1,282 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/plugin/registry/internal/registrytest"
+)
+
+// fakeAPI is an API server holding the EndpointSlices, or the Endpoints, of a namespace.
+type fakeAPI struct {
+	namespace string
+	path      string // of the resource
+	token     string
+	version   int
+	objects   map[string]interface{}
+	watches   []chan interface{}
+	mu        sync.Mutex
+}
+
+func newFakeAPI(namespace, resource, token string) *fakeAPI {
+	path := "/apis/discovery.k8s.io/v1/namespaces/" + namespace + "/endpointslices"
+	if resource == "endpoints" {
+		path = "/api/v1/namespaces/" + namespace + "/endpoints"
+	}
+	return &fakeAPI{namespace: namespace, path: path, token: token, objects: make(map[string]interface{})}
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(apiStatus{Code: 401, Message: "Unauthorized"})
+		return
+	}
+	if r.URL.Path != f.path {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiStatus{Code: 404, Message: "no " + r.URL.Path})
+		return
+	}
+	f.mu.Lock()
+	if r.URL.Query().Get("watch") == "" {
+		items := make([]interface{}, 0, len(f.objects))
+		for _, o := range f.objects {
+			items = append(items, o)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metadata": map[string]string{"resourceVersion": strconv.Itoa(f.version)},
+			"items":    items,
+		})
+		f.mu.Unlock()
+		return
+	}
+	events := make(chan interface{}, 10)
+	f.watches = append(f.watches, events)
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			enc.Encode(event)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+// send sends an event to the watches, with a new resource version for obj.
+func (f *fakeAPI) send(eventType, name string, obj map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version++
+	if eventType != "ERROR" {
+		obj["metadata"] = map[string]string{"name": name, "resourceVersion": strconv.Itoa(f.version)}
+		if eventType == "DELETED" {
+			delete(f.objects, name)
+		} else {
+			f.objects[name] = obj
+		}
+	}
+	for _, events := range f.watches {
+		events <- map[string]interface{}{"type": eventType, "object": obj}
+	}
+	if eventType == "ERROR" {
+		// the API server ends the watch after an error.
+		for _, events := range f.watches {
+			close(events)
+		}
+		f.watches = nil
+	}
+}
+
+func slice(port int, ready bool, ips ...string) map[string]interface{} {
+	var endpoints []interface{}
+	for _, ip := range ips {
+		endpoints = append(endpoints, map[string]interface{}{
+			"addresses":  []string{ip},
+			"conditions": map[string]bool{"ready": ready},
+		})
+	}
+	return map[string]interface{}{
+		"endpoints": endpoints,
+		"ports":     []interface{}{map[string]interface{}{"name": "metrics", "port": 9090}, map[string]interface{}{"name": "rpc", "port": port}},
+	}
+}
+
+// serve starts a server, and returns its port on 127.0.0.1.
+func serve(t *testing.T) int {
+	_, port, _ := net.SplitHostPort(registrytest.Serve(t, "tcp", "arith", nil))
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestEndpointSlices(t *testing.T) {
+	api := newFakeAPI("shop", "endpointslices", "secret")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := writeFile(t, dir, "config", fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+- name: other
+  cluster:
+    server: http://127.0.0.1:1
+- name: test
+  cluster:
+    server: %s
+users:
+- name: test
+  user:
+    tokenFile: token
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+    namespace: shop
+`, ts.URL))
+	writeFile(t, dir, "token", "secret\n")
+
+	port1, port2 := serve(t), serve(t)
+	api.send("ADDED", "arith-a", slice(port1, true, "127.0.0.1"))
+
+	s := &KubernetesSelector{Service: "arith", Port: "rpc", Kubeconfig: kubeconfig, RetryInterval: 10 * time.Millisecond}
+	defer s.Close()
+	c := client.NewClient(client.Client{}, s)
+	s.SetSelectMode(client.RoundRobin)
+	args := &codec.Args{A: 7, B: 8}
+	var reply codec.Reply
+	if err := c.Call("/arith/mul", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.C != 56 {
+		t.Fatalf("unexpected result: %v", reply.C)
+	}
+
+	// a pod comes.
+	api.send("ADDED", "arith-b", slice(port2, true, "127.0.0.1"))
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 2
+	})
+	// a pod is not ready.
+	api.send("MODIFIED", "arith-a", slice(port1, false, "127.0.0.1"))
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 1
+	})
+	invoker, err := s.Select()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := invoker.Address(); !strings.HasSuffix(addr, "127.0.0.1:"+strconv.Itoa(port2)) {
+		t.Fatalf("unexpected server %s", addr)
+	}
+
+	// the watch fails, the endpoints are listed again.
+	api.send("ERROR", "", map[string]interface{}{"code": 410, "message": "too old resource version"})
+	api.send("MODIFIED", "arith-a", slice(port1, true, "127.0.0.1"))
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 2
+	})
+
+	// the pods are gone.
+	api.send("DELETED", "arith-a", slice(port1, true))
+	api.send("DELETED", "arith-b", slice(port2, true))
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select()
+		return err == registry.ErrNoServer
+	})
+}
+
+func TestEndpointsInCluster(t *testing.T) {
+	api := newFakeAPI("shop", "endpoints", "pod-secret")
+	ts := httptest.NewTLSServer(api)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "serviceaccount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "token", "pod-secret")
+	writeFile(t, dir, "namespace", "shop")
+	writeFile(t, dir, "ca.crt", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})))
+	defer func(dir string) { serviceAccountDir = dir }(serviceAccountDir)
+	serviceAccountDir = dir
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(ts.URL, "https://"))
+	os.Setenv("KUBERNETES_SERVICE_HOST", host)
+	os.Setenv("KUBERNETES_SERVICE_PORT", port)
+	defer os.Unsetenv("KUBERNETES_SERVICE_HOST")
+	defer os.Unsetenv("KUBERNETES_SERVICE_PORT")
+
+	srvPort := serve(t)
+	api.send("ADDED", "arith", map[string]interface{}{
+		"subsets": []interface{}{map[string]interface{}{
+			"addresses": []interface{}{map[string]string{"ip": "127.0.0.1"}},
+			"ports":     []interface{}{map[string]interface{}{"name": "rpc", "port": srvPort}},
+		}},
+	})
+
+	s := &KubernetesSelector{Service: "arith", Endpoints: true}
+	defer s.Close()
+	c := client.NewClient(client.Client{}, s)
+	var reply codec.Reply
+	if err := c.Call("/arith/mul", &codec.Args{A: 3, B: 4}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.C != 12 {
+		t.Fatalf("unexpected result: %v", reply.C)
+	}
+
+	api.send("DELETED", "arith", map[string]interface{}{})
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select()
+		return err == registry.ErrNoServer
+	})
+}
+
+func TestUnauthorized(t *testing.T) {
+	api := newFakeAPI("default", "endpointslices", "secret")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+	s := &KubernetesSelector{Service: "arith", api: &apiServer{host: ts.URL, client: http.DefaultClient}}
+	defer s.Close()
+	client.NewClient(client.Client{}, s)
+	_, err := s.Select()
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized Unauthorized") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
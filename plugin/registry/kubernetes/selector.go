@@ -0,0 +1,386 @@
+package kubernetes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+)
+
+// KubernetesSelector selects the ready pods of a Kubernetes Service.
+// It watches the EndpointSlices of the Service, or its Endpoints, so that the pods that come, go,
+// or are not ready are used or dropped at once. All the pods serve all the service methods.
+type KubernetesSelector struct {
+	// Service is the name of the Kubernetes Service.
+	Service string
+	// Namespace is the namespace of the Service.
+	// If it is empty, the namespace of the pod, or of the kubeconfig context, or else "default" is used.
+	Namespace string
+	// Port is the name of the port of the Service, e.g. "rpc", or a port number.
+	// If it is empty, the first port of the endpoints is used.
+	Port string
+	// Network is the network of the servers.
+	// If it is empty, "tcp" is used.
+	Network string
+	// Kubeconfig is the path of the kubeconfig file used out of a pod.
+	// If it is empty, the service account of the pod is used in a pod,
+	// and else the first file of $KUBECONFIG, or ~/.kube/config.
+	Kubeconfig string
+	// Endpoints watches the Endpoints of the Service rather than its EndpointSlices, for the clusters before 1.21.
+	Endpoints   bool
+	DialTimeout time.Duration
+	// RetryInterval is how long to wait before watching again after the watch failed.
+	// If it is 0, 1s is used.
+	RetryInterval time.Duration
+
+	table registry.Table
+	api   *apiServer
+	stop  context.CancelFunc
+	mu    sync.Mutex // protects the start and the stop
+}
+
+var _ client.Selector = new(KubernetesSelector)
+
+type (
+	objectMeta struct {
+		Name            string
+		ResourceVersion string
+	}
+
+	endpointPort struct {
+		Name string
+		Port int
+	}
+
+	// endpointSlice is an EndpointSlice of the discovery.k8s.io/v1 API.
+	endpointSlice struct {
+		Metadata  objectMeta
+		Endpoints []struct {
+			Addresses  []string
+			Conditions struct {
+				Ready *bool
+			}
+		}
+		Ports []endpointPort
+	}
+
+	// endpoints is an Endpoints of the v1 API.
+	endpoints struct {
+		Metadata objectMeta
+		Subsets  []struct {
+			Addresses []struct {
+				IP string
+			}
+			Ports []endpointPort
+		}
+	}
+
+	objectList struct {
+		Metadata objectMeta
+		Items    []json.RawMessage
+	}
+
+	watchEvent struct {
+		Type   string
+		Object json.RawMessage
+	}
+)
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *KubernetesSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.table.SetNewInvokerFunc(newInvokerFunc)
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RoundRobin, WeightedRoundRobin or else RandomSelect.
+func (s *KubernetesSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.table.SetSelectMode(selectMode)
+}
+
+// Select returns a rpc invoker of a ready pod of the Service.
+// It returns registry.ErrNoServer if none is ready.
+func (s *KubernetesSelector) Select(options ...interface{}) (client.Invoker, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	// all the pods serve all the service methods.
+	return s.table.Select()
+}
+
+// List returns Invokers to all servers
+func (s *KubernetesSelector) List() []client.Invoker {
+	return s.table.List()
+}
+
+// HandleFailed handle failed Invoker
+func (s *KubernetesSelector) HandleFailed(invoker client.Invoker) {
+	s.table.HandleFailed(invoker)
+}
+
+// HandleResult handle the result of a call
+func (s *KubernetesSelector) HandleResult(invoker client.Invoker, err error, latency time.Duration) {
+	s.table.HandleResult(invoker, err, latency)
+}
+
+// Close stops watching the Service, and closes the invokers.
+func (s *KubernetesSelector) Close() error {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.stop()
+		s.stop = nil
+	}
+	s.mu.Unlock()
+	return s.table.Close()
+}
+
+// start lists the endpoints and starts watching them, unless it is done.
+func (s *KubernetesSelector) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	if s.api == nil {
+		api, err := s.connect()
+		if err != nil {
+			return err
+		}
+		s.api = api
+		s.table.DialTimeout = s.DialTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	objects, version, err := s.list(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	s.stop = cancel
+	go s.watch(ctx, objects, version)
+	return nil
+}
+
+// connect returns the API server of the pod, or else of the kubeconfig file.
+func (s *KubernetesSelector) connect() (*apiServer, error) {
+	if s.Kubeconfig == "" {
+		api, err := inCluster()
+		if api != nil || err != nil {
+			return api, err
+		}
+	}
+	file := s.Kubeconfig
+	if file == "" {
+		if file = kubeconfigPath(); file == "" {
+			return nil, errors.New("kubernetes: neither in a pod nor with a kubeconfig file")
+		}
+	}
+	return fromKubeconfig(file)
+}
+
+func (s *KubernetesSelector) namespace() string {
+	switch {
+	case s.Namespace != "":
+		return s.Namespace
+	case s.api.namespace != "":
+		return s.api.namespace
+	}
+	return "default"
+}
+
+// resource returns the API path and the query of the objects of the Service.
+func (s *KubernetesSelector) resource() (string, url.Values) {
+	namespace := url.PathEscape(s.namespace())
+	if s.Endpoints {
+		return "/api/v1/namespaces/" + namespace + "/endpoints", url.Values{"fieldSelector": {"metadata.name=" + s.Service}}
+	}
+	return "/apis/discovery.k8s.io/v1/namespaces/" + namespace + "/endpointslices",
+		url.Values{"labelSelector": {"kubernetes.io/service-name=" + s.Service}}
+}
+
+// list reads the objects of the Service, i.e. the name of each EndpointSlice or Endpoints -> its server addresses,
+// and returns them with the resource version to watch them from.
+func (s *KubernetesSelector) list(ctx context.Context) (map[string][]string, string, error) {
+	path, query := s.resource()
+	resp, err := s.api.get(ctx, path, query)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	var list objectList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", err
+	}
+	objects := make(map[string][]string)
+	for _, item := range list.Items {
+		if err = s.apply(objects, "ADDED", item); err != nil {
+			return nil, "", err
+		}
+	}
+	s.reset(objects)
+	return objects, list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes of the objects after version, until ctx is done.
+func (s *KubernetesSelector) watch(ctx context.Context, objects map[string][]string, version string) {
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = time.Second
+	}
+	for {
+		var err error
+		version, err = s.watchOnce(ctx, objects, version)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// the API server ends the watches after a while, watch again.
+			continue
+		}
+		log.Warnf("rpc: kubernetes: watch the endpoints of %s: %s", s.Service, err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		// the changes may be lost, or too old to watch, start over.
+		if listed, listedVersion, err := s.list(ctx); err == nil {
+			objects, version = listed, listedVersion
+		} else {
+			version = ""
+		}
+	}
+}
+
+// watchOnce applies the changes of the objects after version until the watch ends,
+// and returns the version to watch them from.
+func (s *KubernetesSelector) watchOnce(ctx context.Context, objects map[string][]string, version string) (string, error) {
+	if version == "" {
+		return "", errors.New("no resource version to watch from")
+	}
+	path, query := s.resource()
+	query.Set("watch", "1")
+	query.Set("resourceVersion", version)
+	query.Set("allowWatchBookmarks", "true")
+	resp, err := s.api.get(ctx, path, query)
+	if err != nil {
+		return version, err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var event watchEvent
+		if err = decoder.Decode(&event); err != nil {
+			// the watch ended.
+			return version, nil
+		}
+		if event.Type == "ERROR" {
+			var status apiStatus
+			json.Unmarshal(event.Object, &status)
+			return version, errors.New(status.Message)
+		}
+		var meta struct {
+			Metadata objectMeta
+		}
+		if err = json.Unmarshal(event.Object, &meta); err != nil {
+			return version, err
+		}
+		version = meta.Metadata.ResourceVersion
+		if event.Type == "BOOKMARK" {
+			continue
+		}
+		if err = s.apply(objects, event.Type, event.Object); err != nil {
+			return version, err
+		}
+		if ctx.Err() != nil {
+			// closed meanwhile.
+			return version, nil
+		}
+		s.reset(objects)
+	}
+}
+
+// apply applies the change of an object to objects.
+func (s *KubernetesSelector) apply(objects map[string][]string, eventType string, raw json.RawMessage) error {
+	var addrs []string
+	var name string
+	if s.Endpoints {
+		var o endpoints
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return err
+		}
+		name = o.Metadata.Name
+		for _, subset := range o.Subsets {
+			port := s.port(subset.Ports)
+			for _, address := range subset.Addresses {
+				if port != 0 {
+					addrs = append(addrs, net.JoinHostPort(address.IP, strconv.Itoa(port)))
+				}
+			}
+		}
+	} else {
+		var o endpointSlice
+		if err := json.Unmarshal(raw, &o); err != nil {
+			return err
+		}
+		name = o.Metadata.Name
+		port := s.port(o.Ports)
+		for _, endpoint := range o.Endpoints {
+			// a nil condition means ready.
+			if port == 0 || (endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready) {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				addrs = append(addrs, net.JoinHostPort(address, strconv.Itoa(port)))
+			}
+		}
+	}
+	if eventType == "DELETED" {
+		delete(objects, name)
+	} else {
+		objects[name] = addrs
+	}
+	return nil
+}
+
+// port returns the port of the servers among the ports of the endpoints, or 0.
+func (s *KubernetesSelector) port(ports []endpointPort) int {
+	if s.Port == "" {
+		if len(ports) == 0 {
+			return 0
+		}
+		return ports[0].Port
+	}
+	for _, p := range ports {
+		if p.Name == s.Port {
+			return p.Port
+		}
+	}
+	if port, err := strconv.Atoi(s.Port); err == nil {
+		return port
+	}
+	return 0
+}
+
+// reset replaces the servers with the addresses of the objects.
+func (s *KubernetesSelector) reset(objects map[string][]string) {
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	var addrs []string
+	for _, objectAddrs := range objects {
+		for _, addr := range objectAddrs {
+			addrs = append(addrs, network+"@"+addr)
+		}
+	}
+	sort.Strings(addrs)
+	s.table.Reset(map[string][]string{"": addrs})
+}
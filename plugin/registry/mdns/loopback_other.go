@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package mdns
+
+import "net"
+
+// setMulticastLoopback is not supported, the servers and the clients on the same host do not hear each other.
+func setMulticastLoopback(c *net.UDPConn) {}
@@ -0,0 +1,21 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package mdns
+
+import (
+	"net"
+	"syscall"
+)
+
+// setMulticastLoopback loops the messages sent to the group back to the host,
+// which net.ListenMulticastUDP disables.
+func setMulticastLoopback(c *net.UDPConn) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return
+	}
+	raw.Control(func(fd uintptr) {
+		syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 1)
+	})
+}
@@ -0,0 +1,97 @@
+// Package mdns discovers the servers on the local network with multicast DNS and DNS-SD (zeroconf),
+// e.g. for small LAN deployments and IoT devices, without any registry to run nor address to configure:
+//
+//	srv.PluginContainer.Add(&mdns.MDNSRegisterPlugin{ServiceAddress: "tcp@:8972"})
+//	c := client.NewClient(client.Client{}, new(mdns.MDNSSelector))
+//
+// Each server is an instance of the DNS-SD service type, "_myrpc._tcp" by default, in the "local." domain.
+// It answers the queries of the service type with a PTR record of its instance, the SRV record of its host and port,
+// the A and AAAA records of its host, and a TXT record per service path, "path=/arith/mul",
+// besides the TXT record of its network, "network=tcp". The servers are announced over IPv4.
+package mdns
+
+import (
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultService is the DNS-SD service type of the servers.
+const DefaultService = "_myrpc._tcp"
+
+const (
+	domain = "local."
+	// servicesName is the name of the DNS-SD query of all the service types.
+	servicesName = "_services._dns-sd._udp." + domain
+	// cacheFlush is the bit of the class of the records that are unique to their owner, e.g. SRV.
+	cacheFlush = 1 << 15
+	// maxMessageSize is the maximum size of a mDNS message.
+	maxMessageSize = 9000
+	// defaultTTL is the default TTL of the records.
+	defaultTTL = 2 * time.Minute
+)
+
+// groupAddr is the address of the mDNS group, it is replaced by the tests.
+var groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// packetConn is a socket joined to the mDNS group.
+type packetConn interface {
+	ReadFrom(b []byte) (int, net.Addr, error)
+	// WriteTo sends b to the group.
+	WriteTo(b []byte) error
+	Close() error
+}
+
+// listen joins the mDNS group on ifi, or on the interface chosen by the system if it is nil.
+// It is replaced by the tests.
+var listen = func(ifi *net.Interface) (packetConn, error) {
+	c, err := net.ListenMulticastUDP("udp4", ifi, groupAddr)
+	if err != nil {
+		return nil, err
+	}
+	// the servers and the clients on the same host hear each other.
+	setMulticastLoopback(c)
+	return &udpConn{c}, nil
+}
+
+type udpConn struct {
+	*net.UDPConn
+}
+
+func (c *udpConn) WriteTo(b []byte) error {
+	_, err := c.UDPConn.WriteTo(b, groupAddr)
+	return err
+}
+
+// serviceName returns the DNS name of the service type, DefaultService if it is empty.
+func serviceName(service string) string {
+	if service == "" {
+		service = DefaultService
+	}
+	return strings.TrimSuffix(service, ".") + "." + domain
+}
+
+// hostLabel returns the first label of the host name.
+func hostLabel() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "myrpc"
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	return host
+}
+
+// header returns the header of a record of name.
+func header(name string, class dnsmessage.Class, ttl time.Duration) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: name, Class: class, TTL: uint32(ttl / time.Second)}
+}
+
+// sameName reports whether the DNS names are equal, they are case-insensitive.
+func sameName(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
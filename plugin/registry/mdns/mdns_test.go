@@ -0,0 +1,174 @@
+package mdns
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/plugin/registry/internal/registrytest"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// fakeGroup is a multicast group in memory, the messages are looped back to their sender.
+type fakeGroup struct {
+	conns map[*fakeConn]bool
+	mu    sync.Mutex
+}
+
+type fakeConn struct {
+	group    *fakeGroup
+	messages chan []byte
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (g *fakeGroup) listen(ifi *net.Interface) (packetConn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c := &fakeConn{group: g, messages: make(chan []byte, 100), closed: make(chan struct{})}
+	g.conns[c] = true
+	return c, nil
+}
+
+func (c *fakeConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, errors.New("closed")
+	case msg := <-c.messages:
+		return copy(b, msg), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: groupAddr.Port}, nil
+	}
+}
+
+func (c *fakeConn) WriteTo(b []byte) error {
+	c.group.mu.Lock()
+	defer c.group.mu.Unlock()
+	if !c.group.conns[c] {
+		return errors.New("closed")
+	}
+	for conn := range c.group.conns {
+		conn.messages <- append([]byte(nil), b...)
+	}
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.group.mu.Lock()
+	delete(c.group.conns, c)
+	c.group.mu.Unlock()
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func newFakeGroup() *fakeGroup {
+	g := &fakeGroup{conns: make(map[*fakeConn]bool)}
+	listen = g.listen
+	return g
+}
+
+// serve starts a server announced by p on 127.0.0.1.
+func serve(t *testing.T, p *MDNSRegisterPlugin) *MDNSRegisterPlugin {
+	registrytest.Serve(t, "tcp", "arith", func(serviceAddress string) server.IPlugin {
+		p.ServiceAddress = serviceAddress
+		return p
+	})
+	return p
+}
+
+func TestDiscovery(t *testing.T) {
+	newFakeGroup()
+	p1 := serve(t, &MDNSRegisterPlugin{Instance: "one"})
+	defer p1.Close()
+	time.Sleep(2 * announceDelay)
+
+	// the servers announced before answer the query.
+	s := &MDNSSelector{QueryInterval: 50 * time.Millisecond}
+	defer s.Close()
+	c := client.NewClient(client.Client{}, s)
+	s.SetSelectMode(client.RoundRobin)
+	args := &codec.Args{A: 7, B: 8}
+	var reply codec.Reply
+	if err := c.Call("/arith/mul", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.C != 56 {
+		t.Fatalf("unexpected result: %v", reply.C)
+	}
+	if _, err := s.Select("/arith/none"); err != registry.ErrNoServer {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a server comes.
+	p2 := serve(t, &MDNSRegisterPlugin{Instance: "two", TTL: time.Second})
+	defer p2.Close()
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 2
+	})
+
+	// a server says goodbye.
+	if err := p1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 1
+	})
+	invoker, err := s.Select("/arith/mul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(p2.ServiceAddress)
+	if invoker.Address() != "127.0.0.1:"+port {
+		t.Fatalf("unexpected server %s", invoker.Address())
+	}
+
+	// a server crashes, its records expire.
+	p2.mu.Lock()
+	p2.conn.Close()
+	p2.mu.Unlock()
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith/mul")
+		return err == registry.ErrNoServer
+	})
+}
+
+func TestServices(t *testing.T) {
+	newFakeGroup()
+	p := serve(t, &MDNSRegisterPlugin{Service: "_arith._tcp", Instance: "kitchen.pi"})
+	defer p.Close()
+	if p.instance != "kitchen-pi._arith._tcp.local." {
+		t.Fatalf("unexpected instance %s", p.instance)
+	}
+
+	// the selectors of other service types do not select it.
+	other := &MDNSSelector{WaitTimeout: 100 * time.Millisecond}
+	defer other.Close()
+	client.NewClient(client.Client{}, other)
+	if _, err := other.Select("/arith/mul"); err != registry.ErrNoServer {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &MDNSSelector{Service: "_arith._tcp"}
+	defer s.Close()
+	client.NewClient(client.Client{}, s)
+	invoker, err := s.Select("/arith/mul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(p.ServiceAddress)
+	if n, _ := strconv.Atoi(port); invoker.Address() != "127.0.0.1:"+port || n != int(p.port) {
+		t.Fatalf("unexpected server %s", invoker.Address())
+	}
+}
+
+func TestInvalidAddress(t *testing.T) {
+	newFakeGroup()
+	p := &MDNSRegisterPlugin{ServiceAddress: "tcp@localhost"}
+	if err := p.Register("/arith/mul", nil); err == nil {
+		t.Fatal("expect an error")
+	}
+}
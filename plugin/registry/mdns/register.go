@@ -0,0 +1,298 @@
+package mdns
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// MDNSRegisterPlugin is a server plugin that announces the services on the local network with multicast DNS.
+type MDNSRegisterPlugin struct {
+	// ServiceAddress is the address the clients dial, as "network@address", e.g. "tcp@:8972".
+	// If its host is empty or unspecified, the addresses of the network interfaces are announced.
+	ServiceAddress string
+	// Service is the DNS-SD service type, e.g. "_arith._tcp".
+	// If it is empty, DefaultService is used.
+	Service string
+	// Instance is the name of the server, unique among the servers of the service type on the local network.
+	// Its dots are replaced by hyphens. If it is empty, the host name followed by the port is used, e.g. "pi-8972".
+	Instance string
+	// Interface is the network interface the services are announced on.
+	// If it is nil, the system chooses it.
+	Interface *net.Interface
+	// TTL is how long the clients keep the server without hearing of it, e.g. when it crashes.
+	// If it is 0, 2m is used.
+	TTL time.Duration
+
+	conn      packetConn
+	network   string
+	port      uint16
+	ips       []net.IP
+	service   string // DNS name of the service type
+	instance  string // DNS name of the instance
+	host      string // DNS name of the host
+	paths     []string
+	timer     *time.Timer
+	announced int
+	mu        sync.Mutex
+}
+
+var _ plugin.IPlugin = new(MDNSRegisterPlugin)
+
+// Name returns plugin name.
+func (p *MDNSRegisterPlugin) Name() string {
+	return "MDNSRegisterPlugin"
+}
+
+// announceDelay gathers the announcements of the service paths registered together.
+const announceDelay = 50 * time.Millisecond
+
+var _ server.IRegisterPlugin = new(MDNSRegisterPlugin)
+
+// Register announces the service path nodePath, along with the service paths registered before.
+func (p *MDNSRegisterPlugin) Register(nodePath string, rcvr interface{}, metadata ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.resolve(); err != nil {
+			return err
+		}
+		c, err := listen(p.Interface)
+		if err != nil {
+			return err
+		}
+		p.conn = c
+		go p.serve(c)
+	}
+	for _, path := range p.paths {
+		if path == nodePath {
+			return nil
+		}
+	}
+	if len("path=")+len(nodePath) > 255 {
+		return errors.New("mdns: the service path " + nodePath + " is too long")
+	}
+	p.paths = append(p.paths, nodePath)
+	p.announced = 0
+	if p.timer == nil {
+		p.timer = time.AfterFunc(announceDelay, p.announce)
+	} else {
+		p.timer.Reset(announceDelay)
+	}
+	return nil
+}
+
+// resolve reads the network, the addresses and the names of the server.
+func (p *MDNSRegisterPlugin) resolve() error {
+	network, address := registry.SplitAddress(p.ServiceAddress)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.New("mdns: invalid ServiceAddress " + p.ServiceAddress + ": " + err.Error())
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || n == 0 {
+		return errors.New("mdns: invalid port of ServiceAddress " + p.ServiceAddress)
+	}
+	p.network, p.port = network, uint16(n)
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		p.ips = []net.IP{ip}
+	} else if host != "" && ip == nil {
+		if p.ips, err = net.LookupIP(host); err != nil {
+			return err
+		}
+	} else if p.ips, err = interfaceIPs(p.Interface); err != nil {
+		return err
+	}
+	label := hostLabel()
+	instance := p.Instance
+	if instance == "" {
+		instance = label + "-" + port
+	}
+	p.service = serviceName(p.Service)
+	p.instance = strings.Replace(instance, ".", "-", -1) + "." + p.service
+	p.host = label + "." + domain
+	return nil
+}
+
+// interfaceIPs returns the addresses of ifi, or of all the interfaces that are up if it is nil,
+// the loopback addresses only if there are no others.
+func interfaceIPs(ifi *net.Interface) ([]net.IP, error) {
+	ifis := []net.Interface{}
+	if ifi != nil {
+		ifis = append(ifis, *ifi)
+	} else {
+		var err error
+		if ifis, err = net.Interfaces(); err != nil {
+			return nil, err
+		}
+	}
+	var ips, loopback []net.IP
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if ipnet.IP.IsLoopback() {
+				loopback = append(loopback, ipnet.IP)
+			} else {
+				ips = append(ips, ipnet.IP)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		ips = loopback
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("mdns: no address to announce")
+	}
+	return ips, nil
+}
+
+// records returns the records of the server, p.mu is held.
+func (p *MDNSRegisterPlugin) records(ttl time.Duration) []dnsmessage.Resource {
+	unique := dnsmessage.ClassINET | cacheFlush
+	records := []dnsmessage.Resource{
+		&dnsmessage.PTRResource{ResourceHeader: header(p.service, dnsmessage.ClassINET, ttl), PTR: p.instance},
+		&dnsmessage.SRVResource{ResourceHeader: header(p.instance, unique, ttl), Port: p.port, Target: p.host},
+		&dnsmessage.TXTResource{ResourceHeader: header(p.instance, unique, ttl), Txt: "network=" + p.network},
+	}
+	for _, path := range p.paths {
+		records = append(records, &dnsmessage.TXTResource{ResourceHeader: header(p.instance, unique, ttl), Txt: "path=" + path})
+	}
+	for _, ip := range p.ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			r := &dnsmessage.AResource{ResourceHeader: header(p.host, unique, ttl)}
+			copy(r.A[:], ip4)
+			records = append(records, r)
+		} else {
+			r := &dnsmessage.AAAAResource{ResourceHeader: header(p.host, unique, ttl)}
+			copy(r.AAAA[:], ip)
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func (p *MDNSRegisterPlugin) ttl() time.Duration {
+	if p.TTL <= 0 {
+		return defaultTTL
+	}
+	return p.TTL
+}
+
+// send sends the records to the group, p.mu is held.
+func (p *MDNSRegisterPlugin) send(records []dnsmessage.Resource) error {
+	msg := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: records,
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	if len(b) > maxMessageSize {
+		return errors.New("mdns: too many service paths to announce")
+	}
+	return p.conn.WriteTo(b)
+}
+
+// announce sends the records unsolicited, twice a second apart as RFC 6762 asks.
+func (p *MDNSRegisterPlugin) announce() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return
+	}
+	if err := p.send(p.records(p.ttl())); err != nil {
+		log.Warnf("rpc: mdns: announce %s: %s", p.instance, err.Error())
+	}
+	if p.announced++; p.announced < 2 {
+		p.timer.Reset(time.Second)
+	}
+}
+
+// serve answers the queries of the service type, of the instance or of the host.
+func (p *MDNSRegisterPlugin) serve(c packetConn) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := c.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var parser dnsmessage.Parser
+		h, err := parser.Start(buf[:n])
+		if err != nil || h.Response {
+			continue
+		}
+		questions, err := parser.AllQuestions()
+		if err != nil {
+			continue
+		}
+		p.mu.Lock()
+		if p.conn != c {
+			p.mu.Unlock()
+			return
+		}
+		var answers []dnsmessage.Resource
+		all := false
+		for _, q := range questions {
+			switch {
+			case sameName(q.Name, servicesName) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+				answers = append(answers, &dnsmessage.PTRResource{
+					ResourceHeader: header(servicesName, dnsmessage.ClassINET, p.ttl()),
+					PTR:            p.service,
+				})
+			case sameName(q.Name, p.service) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL),
+				sameName(q.Name, p.instance) && (q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL),
+				sameName(q.Name, p.host) && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL):
+				all = true
+			}
+		}
+		if all {
+			answers = append(answers, p.records(p.ttl())...)
+		}
+		if len(answers) > 0 {
+			if err = p.send(answers); err != nil {
+				log.Warnf("rpc: mdns: answer a query: %s", err.Error())
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Close withdraws the services from the clients, e.g. with server.SetShutdown.
+func (p *MDNSRegisterPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	// the records of TTL 0 tell the clients to forget them.
+	err := p.send(p.records(0))
+	p.conn.Close()
+	p.conn = nil
+	p.paths = nil
+	return err
+}
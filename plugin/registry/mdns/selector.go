@@ -0,0 +1,372 @@
+package mdns
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+)
+
+// MDNSSelector selects the servers announced on the local network by MDNSRegisterPlugin.
+// It queries the servers of the service type periodically, and hears their announcements,
+// so that the servers that come or go are used or dropped at once.
+// The servers that crash are dropped once the TTL of their records expires.
+type MDNSSelector struct {
+	// Service is the DNS-SD service type, e.g. "_arith._tcp".
+	// If it is empty, DefaultService is used.
+	Service string
+	// Interface is the network interface the servers are queried on.
+	// If it is nil, the system chooses it.
+	Interface   *net.Interface
+	DialTimeout time.Duration
+	// QueryInterval is how often the servers are queried.
+	// If it is 0, 30s is used.
+	QueryInterval time.Duration
+	// WaitTimeout is how long the first selection waits for the servers to answer.
+	// If it is 0, 1s is used.
+	WaitTimeout time.Duration
+
+	table     registry.Table
+	conn      packetConn
+	stop      chan struct{}
+	ready     chan struct{} // closed by markReady once a server answered, or after WaitTimeout
+	markReady func()
+	instances map[string]*mdnsInstance // lower-case DNS name -> instance
+	hosts     map[string]*mdnsHost     // lower-case DNS name -> host
+	mu        sync.Mutex
+}
+
+// mdnsInstance is a server heard of.
+type mdnsInstance struct {
+	host    string
+	port    uint16
+	network string
+	paths   []string
+	source  net.IP // of its last message
+	expires time.Time
+}
+
+// mdnsHost is the host of servers heard of.
+type mdnsHost struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+var _ client.Selector = new(MDNSSelector)
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *MDNSSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.table.SetNewInvokerFunc(newInvokerFunc)
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RoundRobin, WeightedRoundRobin or else RandomSelect.
+func (s *MDNSSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.table.SetSelectMode(selectMode)
+}
+
+// Select returns a rpc invoker of a server of the service method options[0], or of any server without options.
+// It returns registry.ErrNoServer if none is heard of.
+func (s *MDNSSelector) Select(options ...interface{}) (client.Invoker, error) {
+	ready, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+	<-ready
+	return s.table.Select(options...)
+}
+
+// List returns Invokers to all servers
+func (s *MDNSSelector) List() []client.Invoker {
+	return s.table.List()
+}
+
+// HandleFailed handle failed Invoker
+func (s *MDNSSelector) HandleFailed(invoker client.Invoker) {
+	s.table.HandleFailed(invoker)
+}
+
+// HandleResult handle the result of a call
+func (s *MDNSSelector) HandleResult(invoker client.Invoker, err error, latency time.Duration) {
+	s.table.HandleResult(invoker, err, latency)
+}
+
+// Close stops querying the servers, and closes the invokers.
+func (s *MDNSSelector) Close() error {
+	s.mu.Lock()
+	if s.conn != nil {
+		close(s.stop)
+		s.conn.Close()
+		s.conn = nil
+		s.markReady()
+	}
+	s.mu.Unlock()
+	return s.table.Close()
+}
+
+// start joins the group and starts querying the servers, unless it is done.
+// It returns a channel closed once the servers had time to answer.
+func (s *MDNSSelector) start() (<-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		return s.ready, nil
+	}
+	c, err := listen(s.Interface)
+	if err != nil {
+		return nil, err
+	}
+	s.table.DialTimeout = s.DialTimeout
+	s.conn = c
+	s.stop = make(chan struct{})
+	ready, once := make(chan struct{}), new(sync.Once)
+	s.ready = ready
+	s.markReady = func() {
+		once.Do(func() { close(ready) })
+	}
+	s.instances = make(map[string]*mdnsInstance)
+	s.hosts = make(map[string]*mdnsHost)
+	wait := s.WaitTimeout
+	if wait <= 0 {
+		wait = time.Second
+	}
+	time.AfterFunc(wait, s.markReady)
+	go s.read(c)
+	go s.query(c, s.stop)
+	return s.ready, nil
+}
+
+// query queries the servers, and drops the ones whose records expired, every QueryInterval.
+func (s *MDNSSelector) query(c packetConn, stop chan struct{}) {
+	interval := s.QueryInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: serviceName(s.Service), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		log.Warnf("rpc: mdns: %s", err.Error())
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err = c.WriteTo(b); err != nil {
+			log.Warnf("rpc: mdns: query %s: %s", serviceName(s.Service), err.Error())
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		if s.conn == c {
+			s.update()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// read handles the answers of the servers.
+func (s *MDNSSelector) read(c packetConn) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, from, err := c.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var source net.IP
+		if addr, ok := from.(*net.UDPAddr); ok {
+			source = addr.IP
+		}
+		s.mu.Lock()
+		if s.conn != c {
+			s.mu.Unlock()
+			return
+		}
+		if s.handle(buf[:n], source) {
+			s.update()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// handle applies the records of a message to the servers, and reports whether any is of the service type.
+// s.mu is held.
+func (s *MDNSSelector) handle(msg []byte, source net.IP) bool {
+	var parser dnsmessage.Parser
+	h, err := parser.Start(msg)
+	if err != nil || !h.Response || parser.SkipAllQuestions() != nil {
+		return false
+	}
+	service := serviceName(s.Service)
+	now := time.Now()
+	changed := false
+	txts := make(map[string][]string)
+	ips := make(map[string][]net.IP)
+	ttls := make(map[string]time.Duration)
+	instance := func(name string, ttl time.Duration) *mdnsInstance {
+		key := strings.ToLower(name)
+		if ttl == 0 {
+			// a goodbye.
+			delete(s.instances, key)
+			return nil
+		}
+		in := s.instances[key]
+		if in == nil {
+			in = &mdnsInstance{network: "tcp"}
+			s.instances[key] = in
+		}
+		in.source = source
+		if expires := now.Add(ttl); expires.After(in.expires) {
+			in.expires = expires
+		}
+		return in
+	}
+	for {
+		r, err := nextRecord(&parser)
+		if err != nil {
+			break
+		}
+		if r == nil {
+			continue
+		}
+		hdr := r.Header()
+		ttl := time.Duration(hdr.TTL) * time.Second
+		name := strings.ToLower(hdr.Name)
+		switch r := r.(type) {
+		case *dnsmessage.PTRResource:
+			if sameName(hdr.Name, service) && strings.HasSuffix(strings.ToLower(r.PTR), "."+strings.ToLower(service)) {
+				instance(r.PTR, ttl)
+				changed = true
+			}
+		case *dnsmessage.SRVResource:
+			if strings.HasSuffix(name, "."+strings.ToLower(service)) {
+				if in := instance(hdr.Name, ttl); in != nil {
+					in.host, in.port = strings.ToLower(r.Target), r.Port
+				}
+				changed = true
+			}
+		case *dnsmessage.TXTResource:
+			if strings.HasSuffix(name, "."+strings.ToLower(service)) {
+				txts[name] = append(txts[name], r.Txt)
+				ttls[name] = ttl
+			}
+		case *dnsmessage.AResource:
+			ips[name] = append(ips[name], net.IP(append([]byte(nil), r.A[:]...)))
+			ttls[name] = ttl
+		case *dnsmessage.AAAAResource:
+			ips[name] = append(ips[name], net.IP(append([]byte(nil), r.AAAA[:]...)))
+			ttls[name] = ttl
+		}
+	}
+	// the records of a name in a message replace the ones heard before.
+	for name, txt := range txts {
+		in := instance(name, ttls[name])
+		changed = true
+		if in == nil {
+			continue
+		}
+		in.paths = nil
+		for _, t := range txt {
+			switch {
+			case strings.HasPrefix(t, "network="):
+				in.network = t[len("network="):]
+			case strings.HasPrefix(t, "path="):
+				in.paths = append(in.paths, t[len("path="):])
+			}
+		}
+	}
+	for name, hostIPs := range ips {
+		if ttls[name] == 0 {
+			delete(s.hosts, name)
+		} else {
+			s.hosts[name] = &mdnsHost{ips: hostIPs, expires: now.Add(ttls[name])}
+		}
+		changed = true
+	}
+	return changed
+}
+
+// nextRecord returns the next answer or additional record, nil if it is of another type.
+func nextRecord(parser *dnsmessage.Parser) (dnsmessage.Resource, error) {
+	hdr, err := parser.AnswerHeader()
+	if err == nil {
+		if !knownType(hdr.Type) {
+			return nil, parser.SkipAnswer()
+		}
+		return parser.Answer()
+	}
+	if err != dnsmessage.ErrSectionDone {
+		return nil, err
+	}
+	if err = parser.SkipAllAuthorities(); err != nil {
+		return nil, err
+	}
+	if hdr, err = parser.AdditionalHeader(); err != nil {
+		return nil, err
+	}
+	if !knownType(hdr.Type) {
+		return nil, parser.SkipAdditional()
+	}
+	return parser.Additional()
+}
+
+func knownType(t dnsmessage.Type) bool {
+	switch t {
+	case dnsmessage.TypePTR, dnsmessage.TypeSRV, dnsmessage.TypeTXT, dnsmessage.TypeA, dnsmessage.TypeAAAA:
+		return true
+	}
+	return false
+}
+
+// update drops the expired servers, and replaces the servers of the table, s.mu is held.
+func (s *MDNSSelector) update() {
+	now := time.Now()
+	services := make(map[string][]string)
+	for name, in := range s.instances {
+		if now.After(in.expires) {
+			delete(s.instances, name)
+			continue
+		}
+		host := s.hosts[in.host]
+		if host != nil && now.After(host.expires) {
+			delete(s.hosts, in.host)
+			host = nil
+		}
+		if host == nil || in.port == 0 || len(host.ips) == 0 {
+			continue
+		}
+		addr := in.network + "@" + net.JoinHostPort(pickIP(host.ips, in.source).String(), strconv.Itoa(int(in.port)))
+		for _, path := range in.paths {
+			services[path] = append(services[path], addr)
+		}
+	}
+	s.table.Reset(services)
+	if len(services) > 0 {
+		s.markReady()
+	}
+}
+
+// pickIP returns the address of a host the server was heard from, else its first IPv4 address.
+func pickIP(ips []net.IP, source net.IP) net.IP {
+	for _, ip := range ips {
+		if ip.Equal(source) {
+			return ip
+		}
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	return ips[0]
+}
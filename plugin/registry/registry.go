@@ -0,0 +1,295 @@
+// Package registry holds what the service registries, e.g. registry/etcd, registry/consul, registry/zookeeper and registry/mdns, have in common.
+package registry
+
+import (
+	"errors"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+)
+
+// Table is the servers of the service paths discovered in a registry, and the invokers to them.
+// It implements the selection of the selectors of the registries.
+type Table struct {
+	DialTimeout time.Duration
+
+	newInvokerFunc client.NewInvokerFunc
+	selectMode     client.SelectMode
+	services       map[string]map[string]int // service path -> server address -> weight
+	invokers       map[string]client.Invoker // server address -> invoker
+	current        map[string]int            // server address -> current weight of the smooth weighted round robin
+	next           int
+	mu             sync.Mutex
+}
+
+// ErrNoServer is returned when no server of the service method is registered.
+var ErrNoServer = errors.New("rpc: no server registered for the service")
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (t *Table) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	t.newInvokerFunc = newInvokerFunc
+}
+
+// SetSelectMode sets the algorithm of selecting a server: RoundRobin selects them in turn,
+// WeightedRoundRobin in turn by weight, else they are selected randomly by weight.
+func (t *Table) SetSelectMode(selectMode client.SelectMode) {
+	t.mu.Lock()
+	t.selectMode = selectMode
+	t.mu.Unlock()
+}
+
+// Select returns a rpc invoker of a server of the service method options[0], or of any server without options.
+func (t *Table) Select(options ...interface{}) (client.Invoker, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	addrs, weights := t.addresses(options...)
+	n := len(addrs)
+	if n == 0 {
+		return nil, ErrNoServer
+	}
+	var first int
+	switch t.selectMode {
+	case client.RoundRobin:
+		first = t.next % n
+		t.next++
+	case client.WeightedRoundRobin:
+		first = t.pickInTurn(addrs, weights)
+	default:
+		first = pickRandomly(weights)
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		addr := addrs[(first+i)%n]
+		invoker := t.invokers[addr]
+		if invoker != nil && invoker.State() != client.Closed {
+			return invoker, nil
+		}
+		network, address := SplitAddress(addr)
+		invoker, err = t.newInvokerFunc(network, address, t.DialTimeout)
+		if err == nil {
+			if t.invokers == nil {
+				t.invokers = make(map[string]client.Invoker)
+			}
+			t.invokers[addr] = invoker
+			return invoker, nil
+		}
+	}
+	return nil, err
+}
+
+// List returns Invokers to all servers
+func (t *Table) List() []client.Invoker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	invokers := make([]client.Invoker, 0, len(t.invokers))
+	for _, invoker := range t.invokers {
+		invokers = append(invokers, invoker)
+	}
+	return invokers
+}
+
+// HandleFailed handle failed Invoker
+func (t *Table) HandleFailed(invoker client.Invoker) {
+	invoker.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, i := range t.invokers {
+		if i == invoker {
+			delete(t.invokers, addr)
+		}
+	}
+}
+
+// HandleResult does nothing, the Table selects by the select mode only.
+func (t *Table) HandleResult(client.Invoker, error, time.Duration) {}
+
+// Reset replaces the servers of all the service paths, of weight 1.
+func (t *Table) Reset(services map[string][]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.services = make(map[string]map[string]int)
+	for path, addrs := range services {
+		for _, addr := range addrs {
+			t.add(path, addr, 1)
+		}
+	}
+	t.closeUnused()
+}
+
+// ResetWeighted replaces the servers of all the service paths, with their weight, e.g. read by Weight.
+func (t *Table) ResetWeighted(services map[string]map[string]int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.services = make(map[string]map[string]int)
+	for path, addrs := range services {
+		for addr, weight := range addrs {
+			t.add(path, addr, weight)
+		}
+	}
+	t.closeUnused()
+}
+
+// Add adds the server addr to the service path, of weight 1.
+func (t *Table) Add(path, addr string) {
+	t.AddWeighted(path, addr, 1)
+}
+
+// AddWeighted adds the server addr to the service path, or changes its weight.
+func (t *Table) AddWeighted(path, addr string, weight int) {
+	t.mu.Lock()
+	t.add(path, addr, weight)
+	t.mu.Unlock()
+}
+
+func (t *Table) add(path, addr string, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+	if t.services == nil {
+		t.services = make(map[string]map[string]int)
+	}
+	if t.services[path] == nil {
+		t.services[path] = make(map[string]int)
+	}
+	t.services[path][addr] = weight
+}
+
+// Remove removes the server addr from the service path, and closes its invoker if it serves no other path.
+func (t *Table) Remove(path, addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.services[path], addr)
+	if len(t.services[path]) == 0 {
+		delete(t.services, path)
+	}
+	t.closeUnused()
+}
+
+// Close closes the invokers.
+func (t *Table) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, invoker := range t.invokers {
+		invoker.Close()
+		delete(t.invokers, addr)
+	}
+	return nil
+}
+
+// closeUnused closes the invokers of the servers that are no longer registered.
+func (t *Table) closeUnused() {
+	used := func(addr string) bool {
+		for _, addrs := range t.services {
+			if _, ok := addrs[addr]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	for addr, invoker := range t.invokers {
+		if !used(addr) {
+			invoker.Close()
+			delete(t.invokers, addr)
+		}
+	}
+	for addr := range t.current {
+		if !used(addr) {
+			delete(t.current, addr)
+		}
+	}
+}
+
+// pickInTurn returns the index of the server selected in turn by weight, with the smooth weighted round robin of nginx.
+func (t *Table) pickInTurn(addrs []string, weights []int) int {
+	if t.current == nil {
+		t.current = make(map[string]int)
+	}
+	best, total := 0, 0
+	for i, addr := range addrs {
+		t.current[addr] += weights[i]
+		total += weights[i]
+		if t.current[addr] > t.current[addrs[best]] {
+			best = i
+		}
+	}
+	t.current[addrs[best]] -= total
+	return best
+}
+
+// pickRandomly returns the index of the server selected randomly by weight.
+func pickRandomly(weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	n := rand.Intn(total)
+	for i, w := range weights {
+		if n -= w; n < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// addresses returns the sorted addresses of the servers of the service method options[0],
+// or of all servers without options, and their weights.
+func (t *Table) addresses(options ...interface{}) ([]string, []int) {
+	set := make(map[string]int)
+	if serviceMethod, ok := firstString(options); ok {
+		if i := strings.IndexByte(serviceMethod, '?'); i >= 0 {
+			serviceMethod = serviceMethod[:i]
+		}
+		set = t.services[serviceMethod]
+	} else {
+		// a server of several service paths weighs the most of its weights.
+		for _, addrs := range t.services {
+			for addr, weight := range addrs {
+				if weight > set[addr] {
+					set[addr] = weight
+				}
+			}
+		}
+	}
+	addrs := make([]string, 0, len(set))
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	weights := make([]int, len(addrs))
+	for i, addr := range addrs {
+		weights[i] = set[addr]
+	}
+	return addrs, weights
+}
+
+func firstString(options []interface{}) (string, bool) {
+	if len(options) == 0 {
+		return "", false
+	}
+	s, ok := options[0].(string)
+	return s, ok
+}
+
+// Weight returns the weight in the metadata of a service, e.g. 10 in "version=2&weight=10", or 0 if there is none.
+func Weight(metadata string) int {
+	values, _ := url.ParseQuery(metadata)
+	weight, err := strconv.Atoi(values.Get("weight"))
+	if err != nil || weight < 0 {
+		return 0
+	}
+	return weight
+}
+
+// SplitAddress splits a server address "network@address" into network and address, the network is tcp by default.
+func SplitAddress(addr string) (network, address string) {
+	if i := strings.IndexByte(addr, '@'); i >= 0 {
+		return addr[:i], addr[i+1:]
+	}
+	return "tcp", addr
+}
@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/local"
+)
+
+func TestTable(t *testing.T) {
+	var dialed []string
+	table := new(Table)
+	table.SetSelectMode(client.RoundRobin)
+	table.SetNewInvokerFunc(func(network, address string, dialTimeout time.Duration) (client.Invoker, error) {
+		dialed = append(dialed, network+"@"+address)
+		return new(local.Invoker), nil
+	})
+	table.Reset(map[string][]string{
+		"/arith/mul": {"tcp@a:1", "b:2"},
+		"/arith/div": {"tcp@a:1"},
+	})
+
+	for i := 0; i < 4; i++ {
+		if _, err := table.Select("/arith/mul?x=1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(dialed)
+	if len(dialed) != 2 || dialed[0] != "tcp@a:1" || dialed[1] != "tcp@b:2" {
+		t.Fatalf("unexpected dials: %v", dialed)
+	}
+	if _, err := table.Select("/arith/add"); err != ErrNoServer {
+		t.Fatalf("expected ErrNoServer, got %v", err)
+	}
+
+	table.Remove("/arith/mul", "b:2")
+	if n := len(table.List()); n != 1 {
+		t.Fatalf("expected 1 invoker, got %d", n)
+	}
+	table.Remove("/arith/mul", "tcp@a:1")
+	if _, err := table.Select("/arith/mul"); err != ErrNoServer {
+		t.Fatalf("expected ErrNoServer, got %v", err)
+	}
+	if _, err := table.Select(); err != nil {
+		t.Fatalf("expected a server of /arith/div, got %v", err)
+	}
+}
+
+func TestTableWeighted(t *testing.T) {
+	invokers := make(map[client.Invoker]string)
+	table := new(Table)
+	table.SetNewInvokerFunc(func(network, address string, dialTimeout time.Duration) (client.Invoker, error) {
+		invoker := new(local.Invoker)
+		invokers[invoker] = address
+		return invoker, nil
+	})
+	table.ResetWeighted(map[string]map[string]int{
+		"/arith/mul": {"a:1": 3, "b:2": 0},
+	})
+	count := func() map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 8; i++ {
+			invoker, err := table.Select("/arith/mul")
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts[invokers[invoker]]++
+		}
+		return counts
+	}
+
+	table.SetSelectMode(client.WeightedRoundRobin)
+	if counts := count(); counts["a:1"] != 6 || counts["b:2"] != 2 {
+		t.Fatalf("unexpected selections: %v", counts)
+	}
+	table.SetSelectMode(client.RoundRobin)
+	if counts := count(); counts["a:1"] != 4 || counts["b:2"] != 4 {
+		t.Fatalf("unexpected selections: %v", counts)
+	}
+
+	table.AddWeighted("/arith/mul", "b:2", 7)
+	table.SetSelectMode(client.WeightedRoundRobin)
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		invoker, _ := table.Select("/arith/mul")
+		counts[invokers[invoker]]++
+	}
+	if counts["a:1"] != 3 || counts["b:2"] != 7 {
+		t.Fatalf("unexpected selections: %v", counts)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	for metadata, weight := range map[string]int{
+		"":                    0,
+		"version=2":           0,
+		"version=2&weight=10": 10,
+		"weight=-1":           0,
+		"weight=x":            0,
+	} {
+		if w := Weight(metadata); w != weight {
+			t.Errorf("Weight(%q) = %d, expected %d", metadata, w, weight)
+		}
+	}
+}
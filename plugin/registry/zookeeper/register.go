@@ -0,0 +1,136 @@
+package zookeeper
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// ZooKeeperRegisterPlugin is a server plugin that registers the services into ZooKeeper.
+type ZooKeeperRegisterPlugin struct {
+	// Servers are the addresses of the ZooKeeper servers, e.g. "127.0.0.1:2181".
+	Servers []string
+	// BasePath is the parent znode of the services.
+	// If it is empty, DefaultBasePath is used.
+	BasePath string
+	// ServiceAddress is the address the clients dial, as "network@address", e.g. "tcp@10.0.0.1:8972".
+	ServiceAddress string
+	// SessionTimeout is how long the services stay registered after the server is cut from ZooKeeper, e.g. when it crashes.
+	// If it is 0, 10s is used.
+	SessionTimeout time.Duration
+
+	conn  conn
+	nodes map[string][]byte // ephemeral znode -> metadata
+	mu    sync.Mutex
+}
+
+var _ plugin.IPlugin = new(ZooKeeperRegisterPlugin)
+
+// Name returns plugin name.
+func (p *ZooKeeperRegisterPlugin) Name() string {
+	return "ZooKeeperRegisterPlugin"
+}
+
+var _ server.IRegisterPlugin = new(ZooKeeperRegisterPlugin)
+
+// Register creates the ephemeral znode of the server under the znode of the service path nodePath,
+// with the metadata of the server.
+func (p *ZooKeeperRegisterPlugin) Register(nodePath string, rcvr interface{}, metadata ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		c, events, err := connect(p.Servers, sessionTimeout(p.SessionTimeout))
+		if err != nil {
+			return err
+		}
+		p.conn = c
+		p.nodes = make(map[string][]byte)
+		go p.restore(c, events)
+	}
+	parent := basePath(p.BasePath) + "/" + znodeName(nodePath)
+	if err := ensurePath(p.conn, parent); err != nil {
+		return err
+	}
+	node := parent + "/" + znodeName(p.ServiceAddress)
+	data := []byte(joinMetadata(metadata))
+	err := p.create(node, data)
+	if err == zk.ErrNodeExists {
+		// left by a previous session of the server that has not expired yet.
+		if err = p.conn.Delete(node, -1); err == nil || err == zk.ErrNoNode {
+			err = p.create(node, data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	p.nodes[node] = data
+	return nil
+}
+
+func (p *ZooKeeperRegisterPlugin) create(node string, data []byte) error {
+	_, err := p.conn.Create(node, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	return err
+}
+
+// restore creates again the znodes of the services whenever a session is established,
+// since they vanished if the previous session expired.
+func (p *ZooKeeperRegisterPlugin) restore(c conn, events <-chan zk.Event) {
+	for ev := range events {
+		if ev.Type != zk.EventSession || ev.State != zk.StateHasSession {
+			continue
+		}
+		p.mu.Lock()
+		if p.conn != c {
+			p.mu.Unlock()
+			return
+		}
+		for node, data := range p.nodes {
+			exists, _, err := c.Exists(node)
+			if err == nil && !exists {
+				err = ensurePath(c, node[:strings.LastIndexByte(node, '/')])
+				if err == nil {
+					err = p.create(node, data)
+				}
+			}
+			if err != nil && err != zk.ErrNodeExists {
+				log.Warnf("rpc: zookeeper: restore %s: %s", node, err.Error())
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Close removes the services from ZooKeeper, e.g. with server.SetShutdown.
+func (p *ZooKeeperRegisterPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	var err error
+	for node := range p.nodes {
+		if e := p.conn.Delete(node, -1); e != nil && e != zk.ErrNoNode {
+			err = e
+		}
+	}
+	p.conn.Close()
+	p.conn = nil
+	p.nodes = nil
+	return err
+}
+
+func joinMetadata(metadata []string) string {
+	var s []string
+	for _, m := range metadata {
+		if m != "" {
+			s = append(s, m)
+		}
+	}
+	return strings.Join(s, "&")
+}
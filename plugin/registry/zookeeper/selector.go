@@ -0,0 +1,252 @@
+package zookeeper
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+)
+
+// ZooKeeperSelector selects the servers registered into ZooKeeper by ZooKeeperRegisterPlugin.
+// It watches the znodes of the service paths, so that the servers that come or go are used or dropped at once.
+type ZooKeeperSelector struct {
+	// Servers are the addresses of the ZooKeeper servers, e.g. "127.0.0.1:2181".
+	Servers []string
+	// BasePath is the parent znode of the services.
+	// If it is empty, DefaultBasePath is used.
+	BasePath string
+	// SessionTimeout is the timeout of the session of the selector.
+	// If it is 0, 10s is used.
+	SessionTimeout time.Duration
+	DialTimeout    time.Duration
+	// RetryInterval is how long to wait before reading the znodes again after it failed.
+	// If it is 0, 1s is used.
+	RetryInterval time.Duration
+
+	table registry.Table
+	conn  conn
+	stop  chan struct{}
+	mu    sync.Mutex // protects the start and the stop
+
+	// owned by the watching goroutine once started.
+	events   chan watchEvent
+	services map[string][]string // znode name of the service path -> server addresses
+	gen      int                 // incremented when all the znodes are read again
+}
+
+// watchEvent is the event of a watch set when all the znodes were read gen times.
+type watchEvent struct {
+	zk.Event
+	gen int
+}
+
+var _ client.Selector = new(ZooKeeperSelector)
+
+// SetNewInvokerFunc sets the NewInvokerFunc.
+func (s *ZooKeeperSelector) SetNewInvokerFunc(newInvokerFunc client.NewInvokerFunc) {
+	s.table.SetNewInvokerFunc(newInvokerFunc)
+}
+
+// SetSelectMode sets the algorithm of selecting a server, RoundRobin, WeightedRoundRobin or else RandomSelect.
+func (s *ZooKeeperSelector) SetSelectMode(selectMode client.SelectMode) {
+	s.table.SetSelectMode(selectMode)
+}
+
+// Select returns a rpc invoker of a server of the service method options[0], or of any server without options.
+// It returns registry.ErrNoServer if none is registered.
+func (s *ZooKeeperSelector) Select(options ...interface{}) (client.Invoker, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s.table.Select(options...)
+}
+
+// List returns Invokers to all servers
+func (s *ZooKeeperSelector) List() []client.Invoker {
+	return s.table.List()
+}
+
+// HandleFailed handle failed Invoker
+func (s *ZooKeeperSelector) HandleFailed(invoker client.Invoker) {
+	s.table.HandleFailed(invoker)
+}
+
+// HandleResult handle the result of a call
+func (s *ZooKeeperSelector) HandleResult(invoker client.Invoker, err error, latency time.Duration) {
+	s.table.HandleResult(invoker, err, latency)
+}
+
+// Close stops watching ZooKeeper, and closes the invokers.
+func (s *ZooKeeperSelector) Close() error {
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+	return s.table.Close()
+}
+
+// start reads the znodes and starts watching them, unless it is done.
+func (s *ZooKeeperSelector) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	c, _, err := connect(s.Servers, sessionTimeout(s.SessionTimeout))
+	if err != nil {
+		return err
+	}
+	s.table.DialTimeout = s.DialTimeout
+	s.events = make(chan watchEvent)
+	s.services = make(map[string][]string)
+	stop := make(chan struct{})
+	if err = s.readBase(c, stop); err != nil {
+		close(stop)
+		c.Close()
+		return err
+	}
+	s.reset()
+	s.conn = c
+	s.stop = stop
+	go s.watch(c, stop)
+	return nil
+}
+
+// watch reads again the znodes whose watch fired, until stop is closed.
+func (s *ZooKeeperSelector) watch(c conn, stop chan struct{}) {
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = time.Second
+	}
+	base := basePath(s.BasePath)
+	for {
+		var ev watchEvent
+		select {
+		case <-stop:
+			return
+		case ev = <-s.events:
+		}
+		if ev.gen != s.gen {
+			// set before all the znodes were read again, and watched again.
+			continue
+		}
+		var err error
+		switch {
+		case ev.Type == zk.EventNotWatching:
+			// the watches are lost, e.g. the session expired.
+			err = ev.Err
+		case ev.Path == base:
+			err = s.readBase(c, stop)
+		default:
+			err = s.readService(c, stop, ev.Path[strings.LastIndexByte(ev.Path, '/')+1:])
+		}
+		for err != nil {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			log.Warnf("rpc: zookeeper: watch the services: %s", err.Error())
+			select {
+			case <-stop:
+				return
+			case <-time.After(retry):
+			}
+			// the watches that failed are unknown, read all the znodes again.
+			s.gen++
+			s.services = make(map[string][]string)
+			err = s.readBase(c, stop)
+		}
+		s.reset()
+	}
+}
+
+// readBase reads and watches the service paths, and the ones that are new.
+func (s *ZooKeeperSelector) readBase(c conn, stop chan struct{}) error {
+	base := basePath(s.BasePath)
+	names, _, ch, err := c.ChildrenW(base)
+	if err == zk.ErrNoNode {
+		// no server registered yet, watch the base to be created.
+		var exists bool
+		exists, _, ch, err = c.ExistsW(base)
+		if err == nil && exists {
+			return s.readBase(c, stop)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.forward(ch, stop)
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		found[name] = true
+		if _, ok := s.services[name]; ok {
+			continue
+		}
+		if err = s.readService(c, stop, name); err != nil {
+			return err
+		}
+	}
+	for name := range s.services {
+		if !found[name] {
+			delete(s.services, name)
+		}
+	}
+	return nil
+}
+
+// readService reads and watches the servers of the service path of the znode name.
+func (s *ZooKeeperSelector) readService(c conn, stop chan struct{}, name string) error {
+	names, _, ch, err := c.ChildrenW(basePath(s.BasePath) + "/" + name)
+	if err == zk.ErrNoNode {
+		// removed, the watch of the base reads the service paths again.
+		delete(s.services, name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.forward(ch, stop)
+	addrs := make([]string, len(names))
+	for i, name := range names {
+		addrs[i] = unescapeName(name)
+	}
+	s.services[name] = addrs
+	return nil
+}
+
+// forward sends the event of a watch to the watching goroutine.
+func (s *ZooKeeperSelector) forward(ch <-chan zk.Event, stop chan struct{}) {
+	gen := s.gen
+	go func() {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			select {
+			case s.events <- watchEvent{ev, gen}:
+			case <-stop:
+			}
+		case <-stop:
+		}
+	}()
+}
+
+// reset replaces the servers with the ones read.
+func (s *ZooKeeperSelector) reset() {
+	services := make(map[string][]string, len(s.services))
+	for name, addrs := range s.services {
+		services[unescapeName(name)] = addrs
+	}
+	s.table.Reset(services)
+}
@@ -0,0 +1,95 @@
+// Package zookeeper registers the services of a server into ZooKeeper, and discovers them on the client side,
+// for the deployments already running ZooKeeper, e.g. for Dubbo.
+//
+// Each service path is a persistent znode under BasePath, named after the escaped path like in Dubbo,
+// and each server of the service is an ephemeral znode under it, named after its escaped address,
+// with the metadata of the service as data, e.g. "/myrpc/%2Farith%2Fmul/tcp@10.0.0.1:8972".
+// The ephemeral znodes vanish with the session of the server, and are created again when it reconnects:
+//
+//	p := &zookeeper.ZooKeeperRegisterPlugin{Servers: []string{"127.0.0.1:2181"}, ServiceAddress: "tcp@10.0.0.1:8972"}
+//	srv.PluginContainer.Add(p)
+//	server.SetShutdown(0, p.Close)
+//
+// ZooKeeperSelector watches the znodes, and selects the servers of the service method called:
+//
+//	c := client.NewClient(client.Client{}, &zookeeper.ZooKeeperSelector{Servers: []string{"127.0.0.1:2181"}})
+package zookeeper
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// DefaultBasePath is the parent znode of the services when BasePath is empty.
+const DefaultBasePath = "/myrpc"
+
+// conn is the part of *zk.Conn used by the package.
+type conn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Exists(path string) (bool, *zk.Stat, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	Delete(path string, version int32) error
+	Close()
+}
+
+// connect connects to the ZooKeeper servers, it is replaced by the tests.
+var connect = func(servers []string, sessionTimeout time.Duration) (conn, <-chan zk.Event, error) {
+	c, events, err := zk.Connect(servers, sessionTimeout, zk.WithLogger(logger{}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, events, nil
+}
+
+// logger logs the messages of the ZooKeeper client with the log of myrpc.
+type logger struct{}
+
+func (logger) Printf(format string, args ...interface{}) {
+	log.Debugf("rpc: zookeeper: "+format, args...)
+}
+
+func basePath(path string) string {
+	if path == "" {
+		return DefaultBasePath
+	}
+	return strings.TrimSuffix(path, "/")
+}
+
+func sessionTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return 10 * time.Second
+}
+
+// ensurePath creates the persistent znodes of path that do not exist.
+func ensurePath(c conn, path string) error {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range segments {
+		p := "/" + strings.Join(segments[:i+1], "/")
+		if _, err := c.Create(p, nil, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// znodeName returns the escaped name of a service path or a server address.
+func znodeName(s string) string {
+	return url.PathEscape(s)
+}
+
+// unescapeName returns the service path or the server address of a znode name.
+func unescapeName(name string) string {
+	s, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return s
+}
@@ -0,0 +1,281 @@
+package zookeeper
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/codec"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/plugin/registry"
+	"github.com/henrylee2cn/myrpc/plugin/registry/internal/registrytest"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// fakeZK is an in-memory ZooKeeper, with the watches of the children and the existence of the znodes.
+type fakeZK struct {
+	nodes   map[string][]byte
+	owners  map[string]*fakeConn // ephemeral znode -> session
+	watches map[string][]chan zk.Event
+	mu      sync.Mutex
+}
+
+func newFakeZK() *fakeZK {
+	return &fakeZK{
+		nodes:   map[string][]byte{"/": nil},
+		owners:  make(map[string]*fakeConn),
+		watches: make(map[string][]chan zk.Event),
+	}
+}
+
+// fakeConn is a session of fakeZK.
+type fakeConn struct {
+	zk     *fakeZK
+	events chan zk.Event
+	closed bool
+}
+
+func (f *fakeZK) connect(servers []string, sessionTimeout time.Duration) (conn, <-chan zk.Event, error) {
+	c := &fakeConn{zk: f, events: make(chan zk.Event, 10)}
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	return c, c.events, nil
+}
+
+func parent(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// fire sends the watches of path an event, f.mu is held.
+func (f *fakeZK) fire(path string, typ zk.EventType) {
+	for _, ch := range f.watches[path] {
+		ch <- zk.Event{Type: typ, Path: path}
+	}
+	delete(f.watches, path)
+}
+
+func (f *fakeZK) watch(path string) <-chan zk.Event {
+	ch := make(chan zk.Event, 1)
+	f.watches[path] = append(f.watches[path], ch)
+	return ch
+}
+
+func (f *fakeZK) children(path string) []string {
+	var names []string
+	for p := range f.nodes {
+		if p != "/" && parent(p) == path {
+			names = append(names, p[len(path)+1:])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// delete removes the znode path, f.mu is held.
+func (f *fakeZK) delete(path string) {
+	delete(f.nodes, path)
+	delete(f.owners, path)
+	f.fire(path, zk.EventNodeDeleted)
+	f.fire(parent(path), zk.EventNodeChildrenChanged)
+}
+
+// expire ends the session of c, as when its server was cut from ZooKeeper, and starts a new one.
+func (f *fakeZK) expire(c *fakeConn) {
+	f.mu.Lock()
+	for path, owner := range f.owners {
+		if owner == c {
+			f.delete(path)
+		}
+	}
+	f.mu.Unlock()
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateExpired}
+	c.events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+}
+
+func (c *fakeConn) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c.closed {
+		return "", zk.ErrClosing
+	}
+	if _, ok := f.nodes[path]; ok {
+		return "", zk.ErrNodeExists
+	}
+	if _, ok := f.nodes[parent(path)]; !ok {
+		return "", zk.ErrNoNode
+	}
+	f.nodes[path] = data
+	if flags&zk.FlagEphemeral != 0 {
+		f.owners[path] = c
+	}
+	f.fire(path, zk.EventNodeCreated)
+	f.fire(parent(path), zk.EventNodeChildrenChanged)
+	return path, nil
+}
+
+func (c *fakeConn) Exists(path string) (bool, *zk.Stat, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.nodes[path]
+	return ok, &zk.Stat{}, nil
+}
+
+func (c *fakeConn) ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.nodes[path]
+	return ok, &zk.Stat{}, f.watch(path), nil
+}
+
+func (c *fakeConn) ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.nodes[path]; !ok {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+	return f.children(path), &zk.Stat{}, f.watch(path), nil
+}
+
+func (c *fakeConn) Delete(path string, version int32) error {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.nodes[path]; !ok {
+		return zk.ErrNoNode
+	}
+	if len(f.children(path)) > 0 {
+		return zk.ErrNotEmpty
+	}
+	f.delete(path)
+	return nil
+}
+
+func (c *fakeConn) Close() {
+	f := c.zk
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for path, owner := range f.owners {
+		if owner == c {
+			f.delete(path)
+		}
+	}
+	close(c.events)
+}
+
+// serve starts a server of the service name announced by p.
+func serve(t *testing.T, p *ZooKeeperRegisterPlugin, name string) *ZooKeeperRegisterPlugin {
+	registrytest.Serve(t, memnet.Network, name, func(serviceAddress string) server.IPlugin {
+		p.ServiceAddress = serviceAddress
+		return p
+	}, "version=2")
+	return p
+}
+
+func TestRegistry(t *testing.T) {
+	f := newFakeZK()
+	connect = f.connect
+
+	s := &ZooKeeperSelector{BasePath: "/rpc/test"}
+	defer s.Close()
+	// the base path does not exist yet.
+	if _, err := s.Select("/arith/mul"); err != registry.ErrNoServer {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p1 := serve(t, &ZooKeeperRegisterPlugin{BasePath: "/rpc/test"}, "arith")
+	defer p1.Close()
+	node := "/rpc/test/%2Farith%2Fmul/" + znodeName(p1.ServiceAddress)
+	f.mu.Lock()
+	data, ok := f.nodes[node]
+	f.mu.Unlock()
+	if !ok || string(data) != "version=2" {
+		t.Fatalf("unexpected znode %s: %v, %q", node, ok, data)
+	}
+
+	c := client.NewClient(client.Client{}, s)
+	s.SetSelectMode(client.RoundRobin)
+	args := &codec.Args{A: 7, B: 8}
+	var reply codec.Reply
+	registrytest.WaitFor(t, func() bool {
+		return c.Call("/arith/mul", args, &reply) == nil
+	})
+	if reply.C != 56 {
+		t.Fatalf("unexpected result: %v", reply.C)
+	}
+
+	p2 := serve(t, &ZooKeeperRegisterPlugin{BasePath: "/rpc/test"}, "arith")
+	defer p2.Close()
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 2
+	})
+
+	// the servers whose session expired are dropped, until they register again.
+	f.expire(p1.conn.(*fakeConn))
+	registrytest.WaitFor(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		_, ok := f.nodes[node]
+		return ok
+	})
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 2
+	})
+
+	// the closed servers are removed.
+	if err := p1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	registrytest.WaitFor(t, func() bool {
+		_, err := s.Select("/arith/mul")
+		return err == registry.ErrNoServer
+	})
+}
+
+func TestSelectorResync(t *testing.T) {
+	f := newFakeZK()
+	connect = f.connect
+
+	p := serve(t, &ZooKeeperRegisterPlugin{}, "arith")
+	defer p.Close()
+	s := &ZooKeeperSelector{RetryInterval: 10 * time.Millisecond}
+	defer s.Close()
+	client.NewClient(client.Client{}, s)
+	s.SetSelectMode(client.RoundRobin)
+	if _, err := s.Select("/arith/mul"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the watches are lost, the znodes are read again.
+	f.mu.Lock()
+	for path, watches := range f.watches {
+		for _, ch := range watches {
+			ch <- zk.Event{Type: zk.EventNotWatching, Path: path, Err: zk.ErrSessionExpired}
+		}
+	}
+	f.watches = make(map[string][]chan zk.Event)
+	f.mu.Unlock()
+	p2 := serve(t, &ZooKeeperRegisterPlugin{}, "arith")
+	defer p2.Close()
+	registrytest.WaitFor(t, func() bool {
+		return registrytest.Servers(s, "/arith/mul") == 2
+	})
+}
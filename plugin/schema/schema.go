@@ -0,0 +1,274 @@
+// Package schema detects breaking changes of the arg and reply types of the registered services,
+// e.g. of protobuf or gencode messages, against a baseline stored by a previous deploy.
+//
+// A type is described by the wire type of each field path:
+//
+//	""          struct
+//	"A"         int
+//	"Items"     []struct
+//	"Items[].Id" int64
+//
+// Removing a field or changing its type is a breaking change, adding a field is not.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type (
+	// Descriptor maps the field paths of a type to their wire types.
+	Descriptor map[string]string
+
+	// ServiceSchema describes the types of a service method.
+	ServiceSchema struct {
+		Args  Descriptor `json:"args"`
+		Reply Descriptor `json:"reply,omitempty"`
+	}
+
+	// Baseline maps the service method paths to their schemas.
+	Baseline map[string]ServiceSchema
+
+	// Change is a breaking change of a service method.
+	Change struct {
+		Path string
+		// Type is "args" or "reply".
+		Type  string
+		Field string
+		Kind  ChangeKind
+		// Old and New are the wire types of the field, New is empty if the field was removed.
+		Old, New string
+	}
+)
+
+// ChangeKind is the kind of a breaking change.
+type ChangeKind int
+
+const (
+	// FieldRemoved means a field of the baseline no longer exists.
+	FieldRemoved ChangeKind = iota
+	// TypeChanged means the wire type of a field changed.
+	TypeChanged
+)
+
+func (c Change) String() string {
+	field := c.Field
+	if field == "" {
+		field = "(root)"
+	}
+	if c.Kind == FieldRemoved {
+		return fmt.Sprintf("%s %s: field %s (%s) removed", c.Path, c.Type, field, c.Old)
+	}
+	return fmt.Sprintf("%s %s: field %s changed from %s to %s", c.Path, c.Type, field, c.Old, c.New)
+}
+
+// Mode decides what to do on a breaking change.
+type Mode int
+
+const (
+	// Warn logs the breaking changes.
+	Warn Mode = iota
+	// Fail fails the registration of a service method with breaking changes.
+	Fail
+)
+
+// SchemaPlugin compares the types of the registered service methods with a baseline.
+type SchemaPlugin struct {
+	baseline Baseline
+	mode     Mode
+	current  Baseline
+	changes  []Change
+	mu       sync.Mutex
+}
+
+var _ server.IRegisterServicePlugin = new(SchemaPlugin)
+
+// NewSchemaPlugin creates a SchemaPlugin, baseline may be nil to only collect the schemas.
+func NewSchemaPlugin(baseline Baseline, mode Mode) *SchemaPlugin {
+	return &SchemaPlugin{
+		baseline: baseline,
+		mode:     mode,
+		current:  make(Baseline),
+	}
+}
+
+// Name returns plugin name.
+func (p *SchemaPlugin) Name() string {
+	return "SchemaPlugin"
+}
+
+// RegisterService compares the types of the service method with the baseline.
+func (p *SchemaPlugin) RegisterService(info server.ServiceInfo) error {
+	schema := ServiceSchema{Args: Describe(info.ArgType)}
+	if info.ReplyType != nil {
+		schema.Reply = Describe(info.ReplyType)
+	}
+	p.mu.Lock()
+	p.current[info.Path] = schema
+	var changes []Change
+	if old, ok := p.baseline[info.Path]; ok {
+		changes = append(Compare(info.Path, "args", old.Args, schema.Args),
+			Compare(info.Path, "reply", old.Reply, schema.Reply)...)
+		p.changes = append(p.changes, changes...)
+	}
+	p.mu.Unlock()
+	if len(changes) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(changes))
+	for i, c := range changes {
+		msgs[i] = c.String()
+	}
+	if p.mode == Fail {
+		return fmt.Errorf("breaking changes: %s", strings.Join(msgs, "; "))
+	}
+	for _, msg := range msgs {
+		log.Warnf("rpc: schema: breaking change: %s", msg)
+	}
+	return nil
+}
+
+// Changes returns the breaking changes found so far.
+func (p *SchemaPlugin) Changes() []Change {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Change(nil), p.changes...)
+}
+
+// Missing returns the paths of the baseline that are not registered, sorted.
+// It is meaningful once all the services are registered.
+func (p *SchemaPlugin) Missing() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var missing []string
+	for path := range p.baseline {
+		if _, ok := p.current[path]; !ok {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Current returns the schemas of the registered service methods, to store as the next baseline.
+func (p *SchemaPlugin) Current() Baseline {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := make(Baseline, len(p.current))
+	for path, schema := range p.current {
+		current[path] = schema
+	}
+	return current
+}
+
+// ReadBaseline reads a baseline written by Baseline.Write.
+func ReadBaseline(r io.Reader) (Baseline, error) {
+	var b Baseline
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write writes the baseline as JSON.
+func (b Baseline) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Compare returns the breaking changes from old to new, sorted by field.
+func Compare(path, typ string, old, new Descriptor) []Change {
+	var changes []Change
+	for field, oldType := range old {
+		newType, ok := new[field]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Type: typ, Field: field, Kind: FieldRemoved, Old: oldType})
+		case newType != oldType:
+			changes = append(changes, Change{Path: path, Type: typ, Field: field, Kind: TypeChanged, Old: oldType, New: newType})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// Describe returns the descriptor of t.
+// Pointers are transparent, and named types are described by their underlying wire type.
+func Describe(t reflect.Type) Descriptor {
+	d := make(Descriptor)
+	if t != nil {
+		describe(d, t, "", make(map[reflect.Type]bool))
+	}
+	return d
+}
+
+func describe(d Descriptor, t reflect.Type, path string, visiting map[reflect.Type]bool) {
+	t = deref(t)
+	d[path] = wireType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			// recursive type, already described.
+			return
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if path != "" {
+				name = path + "." + name
+			}
+			describe(d, f.Type, name, visiting)
+		}
+	case reflect.Slice, reflect.Array:
+		if elem := deref(t.Elem()); elem.Kind() == reflect.Struct {
+			describe(d, elem, path+"[]", visiting)
+		}
+	case reflect.Map:
+		if elem := deref(t.Elem()); elem.Kind() == reflect.Struct {
+			describe(d, elem, path+"{}", visiting)
+		}
+	}
+}
+
+// wireType returns the shape of t, independent of the type names.
+func wireType(t reflect.Type) string {
+	t = deref(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		return "struct"
+	case reflect.Slice:
+		return "[]" + wireType(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), wireType(t.Elem()))
+	case reflect.Map:
+		return "map[" + wireType(t.Key()) + "]" + wireType(t.Elem())
+	default:
+		return t.Kind().String()
+	}
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
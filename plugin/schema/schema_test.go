@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type node struct {
+	Name     string
+	Children []*node
+}
+
+type argsV1 struct {
+	A     int
+	B     string
+	Items []struct{ ID int64 }
+	Tree  *node
+	inner int
+}
+
+type argsV2 struct {
+	A     int64
+	Items []struct {
+		ID   int64
+		Name string
+	}
+	Tree *node
+	C    bool
+}
+
+func TestDescribe(t *testing.T) {
+	d := Describe(reflect.TypeOf(new(argsV1)))
+	expect := Descriptor{
+		"":                "struct",
+		"A":               "int",
+		"B":               "string",
+		"Items":           "[]struct",
+		"Items[]":         "struct",
+		"Items[].ID":      "int64",
+		"Tree":            "struct",
+		"Tree.Name":       "string",
+		"Tree.Children":   "[]struct",
+		"Tree.Children[]": "struct",
+	}
+	if !reflect.DeepEqual(d, expect) {
+		t.Fatalf("expect %v, got %v", expect, d)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	changes := Compare("/a/b", "args", Describe(reflect.TypeOf(argsV1{})), Describe(reflect.TypeOf(argsV2{})))
+	if len(changes) != 2 {
+		t.Fatalf("expect 2 changes, got %v", changes)
+	}
+	if c := changes[0]; c.Field != "A" || c.Kind != TypeChanged || c.Old != "int" || c.New != "int64" {
+		t.Errorf("unexpected change %v", c)
+	}
+	if c := changes[1]; c.Field != "B" || c.Kind != FieldRemoved {
+		t.Errorf("unexpected change %v", c)
+	}
+}
+
+func TestSchemaPlugin(t *testing.T) {
+	collect := NewSchemaPlugin(nil, Fail)
+	err := collect.RegisterService(server.ServiceInfo{Path: "/a/b", ArgType: reflect.TypeOf(argsV1{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = collect.Current().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := NewSchemaPlugin(baseline, Fail)
+	err = check.RegisterService(server.ServiceInfo{Path: "/a/b", ArgType: reflect.TypeOf(argsV2{})})
+	if err == nil {
+		t.Fatal("expect the registration to fail")
+	}
+	if missing := check.Missing(); len(missing) != 0 {
+		t.Fatalf("unexpected missing paths %v", missing)
+	}
+
+	warn := NewSchemaPlugin(baseline, Warn)
+	if err = warn.RegisterService(server.ServiceInfo{Path: "/a/c", ArgType: reflect.TypeOf(argsV2{})}); err != nil {
+		t.Fatal(err)
+	}
+	if missing := warn.Missing(); !reflect.DeepEqual(missing, []string{"/a/b"}) {
+		t.Fatalf("unexpected missing paths %v", missing)
+	}
+}
@@ -0,0 +1,112 @@
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type (
+	// Scheduler is a server.Scheduler that runs requests in one of N shards,
+	// chosen by a key extracted from the request.
+	// The requests with the same key are executed one by one in arrival order,
+	// which is useful for in-memory stateful services that need per-entity ordering.
+	// When the queue of a shard is full, Schedule blocks the reading goroutine of the connection.
+	// The server closes it once it is shut down, see Close.
+	// Usage: server.NewServer(server.Server{Scheduler: sharding.NewScheduler(16, 64, keyFunc)})
+	Scheduler struct {
+		shards  []chan func()
+		keyFunc KeyFunc
+		closed  bool
+		closeMu sync.RWMutex // held for reading while a task is queued
+	}
+
+	// KeyFunc extracts the sharding key from the request.
+	// If ok is false, the request is not sharded and runs in a new goroutine.
+	KeyFunc func(ctx *server.Context) (key string, ok bool)
+)
+
+// NewScheduler creates a Scheduler with n shards, each queueing up to queueSize requests.
+func NewScheduler(n, queueSize int, keyFunc KeyFunc) *Scheduler {
+	if n <= 0 {
+		n = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	s := &Scheduler{
+		shards:  make([]chan func(), n),
+		keyFunc: keyFunc,
+	}
+	for i := range s.shards {
+		s.shards[i] = make(chan func(), queueSize)
+		go run(s.shards[i])
+	}
+	return s
+}
+
+var (
+	_ server.Scheduler = new(Scheduler)
+	_ io.Closer        = new(Scheduler)
+)
+
+// Schedule runs task in the shard of the request key.
+// Once the scheduler is closed, task runs in a new goroutine.
+func (s *Scheduler) Schedule(ctx *server.Context, task func()) {
+	key, ok := s.keyFunc(ctx)
+	if !ok {
+		go task()
+		return
+	}
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closed {
+		go task()
+		return
+	}
+	s.shards[s.shardIndex(key)] <- task
+}
+
+// Close stops the goroutines of the shards once they have run the tasks queued.
+func (s *Scheduler) Close() error {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		for _, shard := range s.shards {
+			close(shard)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+func run(tasks chan func()) {
+	for task := range tasks {
+		task()
+	}
+}
+
+// FieldKey returns a KeyFunc that uses the named field of the struct argument as key.
+func FieldKey(fieldName string) KeyFunc {
+	return func(ctx *server.Context) (string, bool) {
+		v := reflect.Indirect(reflect.ValueOf(ctx.Args()))
+		if v.Kind() != reflect.Struct {
+			return "", false
+		}
+		f := v.FieldByName(fieldName)
+		if !f.IsValid() || !f.CanInterface() {
+			return "", false
+		}
+		return fmt.Sprint(f.Interface()), true
+	}
+}
@@ -0,0 +1,80 @@
+// Package txn lets services take part in the distributed transactions of a TCC or SAGA coordinator.
+//
+// The transaction ID travels in the "xid" query parameter of the service methods.
+// The initiator begins the transaction in the context of its calls:
+//
+//	ctx := txn.Begin(context.Background(), xid)
+//	c.CallContext(ctx, "/order/try_create", args, &reply)
+//
+// The servers register the branches of the transaction with the coordinator:
+//
+//	srv.PluginContainer.Add(&txn.TxnPlugin{RegisterBranch: func(ctx *server.Context, xid string) error {
+//		return coordinator.Register(xid, ctx.Path())
+//	}})
+//
+// and their service methods taking a context.Context forward the transaction to their downstream calls:
+//
+//	func (o *Order) TryCreate(ctx context.Context, args *Args, reply *Reply) error {
+//		return stock.CallContext(ctx, "/stock/try_reserve", args.Items, nil).Err()
+//	}
+package txn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/plugin"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+// QueryXID is the query parameter of the service methods that holds the transaction ID.
+const QueryXID = "xid"
+
+// NewXID returns a random transaction ID.
+func NewXID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Begin returns a copy of ctx in the transaction xid, the calls made with it are branches of the transaction.
+func Begin(ctx context.Context, xid string) context.Context {
+	return common.WithMetadata(ctx, QueryXID, xid)
+}
+
+// XID returns the transaction ID of ctx, or "" if it is not in a transaction.
+func XID(ctx context.Context) string {
+	return common.MetadataFromContext(ctx).Get(QueryXID)
+}
+
+// TxnPlugin is a server plugin that propagates the transaction of the calls to the context of their service method,
+// and registers the calls as branches of the transaction.
+type TxnPlugin struct {
+	// RegisterBranch, if it is not nil, is called for each call in a transaction, before its service method.
+	// If it returns an error, the call fails.
+	RegisterBranch func(ctx *server.Context, xid string) error
+}
+
+var _ plugin.IPlugin = new(TxnPlugin)
+
+// Name returns plugin name.
+func (p *TxnPlugin) Name() string {
+	return "TxnPlugin"
+}
+
+var _ server.IPostReadRequestHeaderPlugin = new(TxnPlugin)
+
+// PostReadRequestHeader propagates the transaction ID of the call, and registers its branch.
+func (p *TxnPlugin) PostReadRequestHeader(ctx *server.Context) error {
+	xid := ctx.Query().Get(QueryXID)
+	if xid == "" {
+		return nil
+	}
+	ctx.Propagate(QueryXID, xid)
+	if p.RegisterBranch != nil {
+		return p.RegisterBranch(ctx, xid)
+	}
+	return nil
+}
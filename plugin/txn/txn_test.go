@@ -0,0 +1,81 @@
+package txn
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type coordinator struct {
+	branches []string
+	mu       sync.Mutex
+}
+
+func (c *coordinator) register(ctx *server.Context, xid string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.branches = append(c.branches, xid+" "+ctx.Path())
+	return nil
+}
+
+type Stock struct{}
+
+func (*Stock) TryReserve(ctx context.Context, items int, ok *bool) error {
+	*ok = XID(ctx) != ""
+	return nil
+}
+
+type Order struct {
+	stock *client.Client
+}
+
+func (o *Order) TryCreate(ctx context.Context, items int, ok *bool) error {
+	return o.stock.CallContext(ctx, "/stock/try_reserve", items, ok).Err()
+}
+
+// serve serves rcvr on the in-memory address, and returns a client of it.
+// The listener is ready once serve returns, and it is closed with the client at the end of the test.
+func serve(t *testing.T, address string, coord *coordinator, rcvr interface{}) *client.Client {
+	lis, err := memnet.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.NewServer(server.Server{})
+	srv.PluginContainer.Add(&TxnPlugin{RegisterBranch: coord.register})
+	srv.Register(rcvr)
+	go srv.ServeListener(lis)
+	c := client.NewClient(client.Client{}, &selector.DirectSelector{Network: memnet.Network, Address: address})
+	t.Cleanup(func() {
+		c.Close()
+		lis.Close()
+	})
+	return c
+}
+
+func TestPropagation(t *testing.T) {
+	coord := new(coordinator)
+	stock := serve(t, "txn-stock", coord, new(Stock))
+	order := serve(t, "txn-order", coord, &Order{stock: stock})
+
+	xid := NewXID()
+	var ok bool
+	if rpcErr := order.CallContext(Begin(context.Background(), xid), "/order/try_create", 2, &ok); rpcErr != nil || !ok {
+		t.Fatalf("unexpected result: %v, %v", ok, rpcErr)
+	}
+	expect := []string{xid + " /order/try_create", xid + " /stock/try_reserve"}
+	if len(coord.branches) != 2 || coord.branches[0] != expect[0] || coord.branches[1] != expect[1] {
+		t.Fatalf("unexpected branches: %v", coord.branches)
+	}
+
+	if rpcErr := order.CallContext(context.Background(), "/order/try_create", 2, &ok); rpcErr != nil || ok {
+		t.Fatalf("unexpected result out of transaction: %v, %v", ok, rpcErr)
+	}
+	if len(coord.branches) != 2 {
+		t.Fatalf("unexpected branches: %v", coord.branches)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	// minAcceptDelay is the delay before accepting again after a first temporary error.
+	minAcceptDelay = 5 * time.Millisecond
+	// defaultMaxAcceptDelay is the default of Server.MaxAcceptDelay.
+	defaultMaxAcceptDelay = time.Second
+)
+
+// temporaryAcceptError reports whether accepting may succeed later, e.g. once file descriptors are released,
+// or once a connection reset before it is accepted is skipped.
+func temporaryAcceptError(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) && t.Temporary() {
+		return true
+	}
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.ENOMEM) ||
+		errors.Is(err, syscall.ECONNABORTED)
+}
+
+// acceptDelay returns the delay before accepting again after a temporary error, given the previous delay:
+// it doubles up to MaxAcceptDelay, and a quarter of it is random so that the servers sharing a host do not retry together.
+func (server *Server) acceptDelay(previous time.Duration) time.Duration {
+	max := server.MaxAcceptDelay
+	if max <= 0 {
+		max = defaultMaxAcceptDelay
+	}
+	delay := 2 * previous
+	if delay < minAcceptDelay {
+		delay = minAcceptDelay
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/4)+1))
+}
+
+// acceptFailed handles the error of accepting a connection on lis.
+// It returns the delay before accepting again, or 0 if the error is fatal.
+func (server *Server) acceptFailed(lis net.Listener, err error, previous time.Duration) time.Duration {
+	if temporaryAcceptError(err) {
+		return server.acceptDelay(previous)
+	}
+	if server.OnAcceptError != nil {
+		server.OnAcceptError(lis, err)
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// ArgPolicy rejects the argument types of the services that are dangerous to decode from untrusted clients,
+// e.g. of public-facing servers, see Server.ArgPolicy.
+// The services whose argument type is rejected are not registered, see Server.OnRegisterError,
+// and the requests whose argument nests deeper than MaxDepth once decoded fail with an error of type
+// ErrorTypeServerReadRequestBody, before their service is called.
+type ArgPolicy struct {
+	// Blocked are the types rejected wherever they appear in an argument type.
+	Blocked []reflect.Type
+	// AllowInterfaces accepts the interface types within the argument types, e.g. map[string]interface{}.
+	// They are rejected by default, the clients choosing the concrete types of their values, e.g. with gob.
+	AllowInterfaces bool
+	// MaxDepth is the maximum nesting of the argument types, and of the arguments decoded
+	// of a recursive type, e.g. a tree.
+	// If it is 0, 32 is used.
+	MaxDepth int
+
+	recursive sync.Map // reflect.Type -> bool, whether the values of the argument type are to be walked, see checkValue
+}
+
+// maxDepth returns the MaxDepth of the policy.
+func (p *ArgPolicy) maxDepth() int {
+	if p.MaxDepth <= 0 {
+		return 32
+	}
+	return p.MaxDepth
+}
+
+// checkType returns the error rejecting the argument type t, or nil.
+func (p *ArgPolicy) checkType(t reflect.Type) error {
+	recursive := false
+	path := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type, depth int) error
+	walk = func(t reflect.Type, depth int) error {
+		for _, blocked := range p.Blocked {
+			if t == blocked {
+				return fmt.Errorf("the type %s is blocked", t)
+			}
+		}
+		if t.Kind() == reflect.Interface && !p.AllowInterfaces {
+			return fmt.Errorf("the interface type %s is blocked", t)
+		}
+		if path[t] {
+			recursive = true
+			return nil
+		}
+		if depth > p.maxDepth() {
+			return fmt.Errorf("the type nests deeper than %d", p.maxDepth())
+		}
+		path[t] = true
+		defer delete(path, t)
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Chan:
+			return walk(t.Elem(), depth+1)
+		case reflect.Map:
+			if err := walk(t.Key(), depth+1); err != nil {
+				return err
+			}
+			return walk(t.Elem(), depth+1)
+		case reflect.Struct:
+			for i := 0; i < t.NumField(); i++ {
+				if f := t.Field(i); f.PkgPath == "" {
+					if err := walk(f.Type, depth+1); err != nil {
+						return fmt.Errorf("%s: %w", f.Name, err)
+					}
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(t, 0); err != nil {
+		return err
+	}
+	p.recursive.Store(t, recursive || p.AllowInterfaces)
+	return nil
+}
+
+// checkValue returns the error rejecting the argument decoded into body, a pointer to it, or nil.
+// Only the arguments of a recursive type, or containing interfaces, are walked, the others are within MaxDepth.
+func (p *ArgPolicy) checkValue(body interface{}) error {
+	t := reflect.TypeOf(body)
+	walk, ok := p.recursive.Load(t)
+	if !ok {
+		walk, ok = p.recursive.Load(t.Elem())
+	}
+	if ok && !walk.(bool) {
+		return nil
+	}
+	if !valueWithin(reflect.ValueOf(body).Elem(), p.maxDepth()) {
+		return fmt.Errorf("the argument nests deeper than %d", p.maxDepth())
+	}
+	return nil
+}
+
+// valueWithin reports whether v nests no deeper than depth.
+func valueWithin(v reflect.Value, depth int) bool {
+	if depth < 0 {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || valueWithin(v.Elem(), depth-1)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !valueWithin(v.Index(i), depth-1) {
+				return false
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if !valueWithin(iter.Key(), depth-1) || !valueWithin(iter.Value(), depth-1) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !valueWithin(v.Field(i), depth-1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkArgs returns the errors rejecting the argument types of services, as RegisterErrors.
+func (p *ArgPolicy) checkArgs(services []IService, failed func(spath string, err error) error) []error {
+	if p == nil {
+		return nil
+	}
+	var errs []error
+	for _, service := range services {
+		argType := service.GetArgType()
+		if err := p.checkType(argType); err != nil {
+			errs = append(errs, failed(service.GetPath(), common.ErrArgTypeRejected.Format(argType.String(), err.Error())))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// ConcurrencyPolicy decides what to do with a request beyond the limits of the requests in progress,
+// see Server.MaxConcurrentRequests and Server.MaxConnConcurrentRequests.
+type ConcurrencyPolicy int
+
+const (
+	// ConcurrencyReject replies an error of type common.ErrorTypeServerOverloaded to the request.
+	ConcurrencyReject ConcurrencyPolicy = iota
+	// ConcurrencyWait holds the request, and stops reading the connection, until a request in progress is done,
+	// so that the connections are slowed down rather than failed.
+	ConcurrencyWait
+	// ConcurrencyQueue queues the request, and keeps reading the connection, until a request in progress is done.
+	// The requests beyond ConcurrencyQueueSize are rejected. With Ordered, the requests wait as with ConcurrencyWait.
+	ConcurrencyQueue
+)
+
+// defaultConcurrencyQueueSize is the default of Server.ConcurrencyQueueSize.
+const defaultConcurrencyQueueSize = 128
+
+// concurrencyLimits counts the requests in progress, of the server and of each connection,
+// and holds those waiting for room with ConcurrencyQueue.
+type concurrencyLimits struct {
+	running int
+	queue   []queuedCall
+	cond    *sync.Cond // protects the above, and connWriter.running
+}
+
+// queuedCall is a request waiting for room, see ConcurrencyQueue.
+type queuedCall struct {
+	w    *connWriter
+	ctx  *Context
+	task func()
+}
+
+func newConcurrencyLimits() *concurrencyLimits {
+	return &concurrencyLimits{cond: sync.NewCond(new(sync.Mutex))}
+}
+
+// limited reports whether the requests in progress are limited.
+func (server *Server) limited() bool {
+	return server.MaxConcurrentRequests > 0 || server.MaxConnConcurrentRequests > 0
+}
+
+// tryAcquire counts a request in progress on the connection of w, if the limits leave room for it.
+// l.cond.L is held.
+func (server *Server) tryAcquire(w *connWriter) bool {
+	l := server.limits
+	if server.MaxConcurrentRequests > 0 && l.running >= server.MaxConcurrentRequests ||
+		server.MaxConnConcurrentRequests > 0 && w.running >= server.MaxConnConcurrentRequests {
+		return false
+	}
+	l.running++
+	w.running++
+	return true
+}
+
+// acquire counts the request of ctx in progress, task running it, waiting for room as ConcurrencyPolicy decides.
+// It reports whether the request is queued, task being scheduled once there is room,
+// else the caller runs it, or returns an error if the request is rejected.
+func (server *Server) acquire(w *connWriter, ctx *Context, task func()) (queued bool, err error) {
+	if !server.limited() {
+		return false, nil
+	}
+	l := server.limits
+	l.cond.L.Lock()
+	defer l.cond.L.Unlock()
+	for !server.tryAcquire(w) {
+		switch {
+		case server.ConcurrencyPolicy == ConcurrencyWait || server.ConcurrencyPolicy == ConcurrencyQueue && server.Ordered:
+			l.cond.Wait()
+			continue
+		case server.ConcurrencyPolicy == ConcurrencyQueue && len(l.queue) < server.concurrencyQueueSize():
+			l.queue = append(l.queue, queuedCall{w: w, ctx: ctx, task: task})
+			return true, nil
+		}
+		ctx.rpcErrorType = common.ErrorTypeServerOverloaded
+		if server.MaxConcurrentRequests > 0 && l.running >= server.MaxConcurrentRequests {
+			return false, common.NewError("the " + strconv.Itoa(l.running) + " requests in progress reach the limit of the server")
+		}
+		return false, common.NewError("the " + strconv.Itoa(w.running) + " requests in progress reach the limit of the connection")
+	}
+	ctx.inProgress = true
+	return false, nil
+}
+
+// releaseSlot counts the request of ctx done, and schedules the first request queued that there is room for.
+func (server *Server) releaseSlot(w *connWriter, ctx *Context) {
+	if !ctx.inProgress {
+		return
+	}
+	ctx.inProgress = false
+	l := server.limits
+	l.cond.L.Lock()
+	l.running--
+	w.running--
+	var next *queuedCall
+	for i := range l.queue {
+		if q := l.queue[i]; server.tryAcquire(q.w) {
+			q.ctx.inProgress = true
+			next = &q
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	l.cond.L.Unlock()
+	l.cond.Broadcast()
+	if next != nil {
+		// released by the writer of a connection, which must not block on the Scheduler.
+		go server.Scheduler.Schedule(next.ctx, next.task)
+	}
+}
+
+func (server *Server) concurrencyQueueSize() int {
+	if server.ConcurrencyQueueSize <= 0 {
+		return defaultConcurrencyQueueSize
+	}
+	return server.ConcurrencyQueueSize
+}
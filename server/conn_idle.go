@@ -0,0 +1,85 @@
+package server
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// drainInterval is how often a connection older than MaxConnAge is checked for requests in progress.
+const drainInterval = 10 * time.Millisecond
+
+// watchConn closes conn once it is idle for IdleTimeout, or once it is older than MaxConnAge
+// and has no request in progress, or MaxConnAgeGrace later, until done is closed.
+func (server *Server) watchConn(conn ServerCodecConn, done <-chan struct{}) {
+	stats := conn.Stats()
+	var expires, deadline time.Time
+	if server.MaxConnAge > 0 {
+		// a tenth of the age is random, so that the connections accepted together are not closed together.
+		age := server.MaxConnAge - connJitter(conn, server.MaxConnAge/10)
+		expires = stats.ConnectedAt().Add(age)
+		if server.MaxConnAgeGrace > 0 {
+			deadline = expires.Add(server.MaxConnAgeGrace)
+		}
+	}
+	for {
+		timer := server.Clock.NewTimer(server.nextConnCheck(stats, expires))
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		now := server.Clock.Now()
+		idle := stats.Pending() == 0
+		switch {
+		case server.IdleTimeout > 0 && idle && now.Sub(stats.LastActivity()) >= server.IdleTimeout:
+			log.Debugf("rpc: closing %s, idle for %s", conn.RemoteAddr().String(), server.IdleTimeout)
+		case !expires.IsZero() && !now.Before(expires) && idle:
+			log.Debugf("rpc: closing %s, older than %s", conn.RemoteAddr().String(), server.MaxConnAge)
+		case !deadline.IsZero() && !now.Before(deadline):
+			log.Debugf("rpc: closing %s with %d requests in progress, older than %s and %s of grace",
+				conn.RemoteAddr().String(), stats.Pending(), server.MaxConnAge, server.MaxConnAgeGrace)
+		default:
+			continue
+		}
+		conn.Close()
+		return
+	}
+}
+
+// nextConnCheck returns the time until the next check of watchConn.
+func (server *Server) nextConnCheck(stats *ConnStats, expires time.Time) time.Duration {
+	now := server.Clock.Now()
+	next := time.Duration(-1)
+	if server.IdleTimeout > 0 {
+		next = stats.LastActivity().Add(server.IdleTimeout).Sub(now)
+		if next <= 0 {
+			// requests in progress, the connection is idle IdleTimeout after they are written at the earliest.
+			next = server.IdleTimeout
+		}
+	}
+	if !expires.IsZero() {
+		d := expires.Sub(now)
+		if d <= 0 {
+			d = drainInterval
+		}
+		if next < 0 || d < next {
+			next = d
+		}
+	}
+	return next
+}
+
+// connJitter returns a random duration up to max for conn, drawn from the time it is accepted on the Clock
+// and its remote address, so that it is the same in each run of a simulation, see Server.Clock.
+func connJitter(conn ServerCodecConn, max time.Duration) time.Duration {
+	h := fnv.New64a()
+	if addr := conn.RemoteAddr(); addr != nil {
+		h.Write([]byte(addr.String()))
+	}
+	seed := conn.Stats().ConnectedAt().UnixNano() ^ int64(h.Sum64())
+	return time.Duration(rand.New(rand.NewSource(seed)).Int63n(int64(max) + 1))
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+// timerClock signals each timer made, so that the test advances the time once watchConn waits.
+type timerClock struct {
+	*sim.Sim
+	timers chan struct{}
+}
+
+func (c timerClock) NewTimer(d time.Duration) common.Timer {
+	t := c.Sim.NewTimer(d)
+	c.timers <- struct{}{}
+	return t
+}
+
+// watch runs watchConn on a connection of server, it returns the connection and a channel closed once it is closed.
+func watch(server *Server, clock timerClock) (ServerCodecConn, <-chan struct{}) {
+	c1, c2 := net.Pipe()
+	go func() {
+		b := make([]byte, 1)
+		for {
+			if _, err := c2.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+	conn := NewServerCodecConn(c1)
+	conn.Stats().setClock(clock)
+	closed := make(chan struct{})
+	go func() {
+		server.watchConn(conn, make(chan struct{}))
+		close(closed)
+	}()
+	return conn, closed
+}
+
+// advance moves the time forward by d, firing the timer of watchConn,
+// and waits for it to wait again or to close the connection.
+// It reports whether the connection is closed.
+func advance(clock timerClock, d time.Duration, closed <-chan struct{}) bool {
+	clock.Advance(d)
+	select {
+	case <-clock.timers:
+		return false
+	case <-closed:
+		return true
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	clock := timerClock{Sim: sim.New(1), timers: make(chan struct{})}
+	server := &Server{Clock: clock, IdleTimeout: time.Minute}
+	conn, closed := watch(server, clock)
+	<-clock.timers
+	clock.Advance(30 * time.Second)
+	conn.Stats().touch()
+	if advance(clock, 30*time.Second, closed) {
+		t.Fatal("expect the connection active 30s ago to be open")
+	}
+	if !advance(clock, 30*time.Second, closed) || !conn.IsBroken() {
+		t.Fatal("expect the connection to be closed after IdleTimeout")
+	}
+}
+
+func TestMaxConnAge(t *testing.T) {
+	clock := timerClock{Sim: sim.New(1), timers: make(chan struct{})}
+	server := &Server{Clock: clock, MaxConnAge: time.Hour, MaxConnAgeGrace: 10 * time.Minute}
+	conn, closed := watch(server, clock)
+	// a request in progress holds the connection open until the grace expires,
+	// which is longer than the jitter of the age, a tenth of it.
+	conn.Stats().addRequest()
+	<-clock.timers
+	if advance(clock, time.Hour, closed) {
+		t.Fatal("expect the connection with a request in progress to be open before MaxConnAgeGrace")
+	}
+	if !advance(clock, 10*time.Minute, closed) || !conn.IsBroken() {
+		t.Fatal("expect the connection to be closed after MaxConnAge and MaxConnAgeGrace")
+	}
+}
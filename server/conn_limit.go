@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/rpc"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// ConnLimitPolicy decides what to do with the connections beyond Server.MaxConnections.
+type ConnLimitPolicy int
+
+const (
+	// ConnLimitQueue stops accepting until a connection is closed,
+	// the new connections wait in the backlog of the listener.
+	ConnLimitQueue ConnLimitPolicy = iota
+	// ConnLimitBusy accepts the connection, replies its first request with an error
+	// of type common.ErrorTypeServerOverloaded, "server busy", and closes it.
+	ConnLimitBusy
+)
+
+// busyTimeout is how long a connection refused by ConnLimitBusy has to send its first request.
+const busyTimeout = time.Second
+
+// connLimiter counts the connections accepted by the Serve methods, and paces the accepts, see Server.AcceptRate.
+type connLimiter struct {
+	conns  int
+	tokens float64 // of the accepts
+	last   time.Time
+	closed bool       // the server is shut down
+	cond   *sync.Cond // protects the above
+}
+
+func newConnLimiter() *connLimiter {
+	return &connLimiter{cond: sync.NewCond(new(sync.Mutex))}
+}
+
+// NumConns returns the number of connections being served.
+func (server *Server) NumConns() int {
+	server.connsMu.Lock()
+	defer server.connsMu.Unlock()
+	return len(server.conns)
+}
+
+// waitAccept waits until the listener may accept a connection: with ConnLimitQueue, until there is room
+// for it under MaxConnections, and until the AcceptRate allows it.
+// It returns at once once the server is shut down, the Accept failing.
+func (server *Server) waitAccept() {
+	l := server.connLimiter
+	if server.MaxConnections > 0 && server.ConnLimitPolicy == ConnLimitQueue {
+		l.cond.L.Lock()
+		for l.conns >= server.MaxConnections && !l.closed {
+			l.cond.Wait()
+		}
+		l.cond.L.Unlock()
+	}
+	if server.AcceptRate <= 0 {
+		return
+	}
+	burst := float64(server.AcceptBurst)
+	if burst < 1 {
+		burst = 1
+	}
+	l.cond.L.Lock()
+	now := server.Clock.Now()
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * server.AcceptRate
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	wait := time.Duration(-l.tokens / server.AcceptRate * float64(time.Second))
+	l.cond.L.Unlock()
+	common.Sleep(server.Clock, wait)
+}
+
+// admitConn counts a connection accepted, it returns false if it is beyond MaxConnections.
+func (server *Server) admitConn() bool {
+	l := server.connLimiter
+	l.cond.L.Lock()
+	defer l.cond.L.Unlock()
+	if server.MaxConnections > 0 && l.conns >= server.MaxConnections {
+		return false
+	}
+	l.conns++
+	return true
+}
+
+// releaseConn counts a connection closed.
+func (server *Server) releaseConn() {
+	l := server.connLimiter
+	l.cond.L.Lock()
+	l.conns--
+	l.cond.L.Unlock()
+	l.cond.Broadcast()
+}
+
+// stopAccept wakes the listeners waiting for room, the server being shut down, or starts them again.
+func (server *Server) stopAccept(stop bool) {
+	l := server.connLimiter
+	l.cond.L.Lock()
+	l.closed = stop
+	l.cond.L.Unlock()
+	l.cond.Broadcast()
+}
+
+// serveBusy replies the first request of conn, beyond MaxConnections, with a "server busy" error, and closes it.
+func (server *Server) serveBusy(conn ServerCodecConn, codecFunc ServerCodecFunc) {
+	defer conn.Close()
+	if conn.GetServerCodec() == nil {
+		if codecFunc == nil {
+			codecFunc = server.ServerCodecFunc
+		}
+		conn.SetServerCodec(codecFunc)
+	}
+	conn.SetDeadline(time.Now().Add(busyTimeout))
+	var req rpc.Request
+	if err := conn.ReadRequestHeader(&req); err != nil {
+		return
+	}
+	conn.ReadRequestBody(nil)
+	resp := rpc.Response{
+		ServiceMethod: req.ServiceMethod,
+		Seq:           req.Seq,
+		Error: common.EncodeErrorType(common.ErrorTypeServerOverloaded) + "server busy: the " +
+			strconv.Itoa(server.MaxConnections) + " connections reach the limit of the server",
+	}
+	if err := conn.WriteResponse(&resp, invalidRequest); err == nil {
+		conn.Flush()
+	}
+	log.Debugf("rpc: refused %s, the server is busy", conn.RemoteAddr().String())
+}
+
+// serveLimited serves conn accepted on a listener, counted until it is closed.
+func (server *Server) serveLimited(conn ServerCodecConn) {
+	defer server.releaseConn()
+	server.ServeConn(conn)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// ConnStats holds the counters of a connection, in total and in time slices, see Slices,
+// and its LatencyHistogram, e.g. for abuse analysis and capacity planning, see ConnsService.
+// It is safe for concurrent use.
+type ConnStats struct {
+	clock        common.Clock // of connectedAt and lastActivity, see Server.Clock
+	connectedAt  time.Time
+	lastActivity int64 // unix nano
+	requests     uint64
+	pending      int64 // the requests read whose response is not written yet
+	errors       uint64
+	bytesRead    uint64
+	bytesWritten uint64
+	bytesEncoded uint64 // the bytes of the responses, including those held back by Cork
+	firstReadAt  int64  // unix nano on clock of the first read since markRead, 0 if none
+	window       connWindow
+}
+
+func newConnStats(clock common.Clock) *ConnStats {
+	now := clock.Now()
+	return &ConnStats{
+		clock:        clock,
+		connectedAt:  now,
+		lastActivity: now.UnixNano(),
+	}
+}
+
+// setClock restarts the times of the connection on clock, before it is served, see Server.Clock.
+func (s *ConnStats) setClock(clock common.Clock) {
+	now := clock.Now()
+	s.clock = clock
+	s.connectedAt = now
+	atomic.StoreInt64(&s.lastActivity, now.UnixNano())
+}
+
+// ConnectedAt returns the time when the connection was accepted.
+func (s *ConnStats) ConnectedAt() time.Time {
+	return s.connectedAt
+}
+
+// LastActivity returns the time of the last read or write.
+func (s *ConnStats) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastActivity))
+}
+
+// Requests returns the number of requests whose header was read.
+func (s *ConnStats) Requests() uint64 {
+	return atomic.LoadUint64(&s.requests)
+}
+
+// Pending returns the number of requests read whose response is not written yet.
+func (s *ConnStats) Pending() int {
+	return int(atomic.LoadInt64(&s.pending))
+}
+
+// Errors returns the number of responses that carried an error or failed to be written.
+func (s *ConnStats) Errors() uint64 {
+	return atomic.LoadUint64(&s.errors)
+}
+
+// BytesRead returns the number of bytes read from the connection.
+func (s *ConnStats) BytesRead() uint64 {
+	return atomic.LoadUint64(&s.bytesRead)
+}
+
+// BytesWritten returns the number of bytes written to the connection.
+func (s *ConnStats) BytesWritten() uint64 {
+	return atomic.LoadUint64(&s.bytesWritten)
+}
+
+// Slices returns the counters of the last StatsSlices time slices, of StatsSliceDuration each, the oldest first.
+func (s *ConnStats) Slices() []StatsSlice {
+	return s.window.last(s.clock.Now())
+}
+
+// Latencies returns the LatencyHistogram of the requests served.
+func (s *ConnStats) Latencies() LatencyHistogram {
+	return s.window.histogram()
+}
+
+// addRequest counts a request read, pending until its response is written, see connWriter.finish.
+func (s *ConnStats) addRequest() {
+	atomic.AddUint64(&s.requests, 1)
+	atomic.AddInt64(&s.pending, 1)
+	s.window.add(s.clock.Now(), 1, 0, 0, 0)
+}
+
+// addLatency counts a request served in d, see Latencies.
+func (s *ConnStats) addLatency(d time.Duration) {
+	s.window.addLatency(d)
+}
+
+func (s *ConnStats) removePending() {
+	atomic.AddInt64(&s.pending, -1)
+}
+
+// encoded returns the number of bytes of the responses, including those held back by Cork.
+func (s *ConnStats) encoded() uint64 {
+	return atomic.LoadUint64(&s.bytesEncoded)
+}
+
+func (s *ConnStats) addEncoded(n int) {
+	atomic.AddUint64(&s.bytesEncoded, uint64(n))
+}
+
+func (s *ConnStats) addError() {
+	atomic.AddUint64(&s.errors, 1)
+	s.window.add(s.clock.Now(), 0, 1, 0, 0)
+}
+
+// markRead starts recording the time of the next read, see firstRead.
+func (s *ConnStats) markRead() {
+	atomic.StoreInt64(&s.firstReadAt, 0)
+}
+
+// firstRead returns the time of the first read since markRead, zero if none.
+func (s *ConnStats) firstRead() time.Time {
+	if at := atomic.LoadInt64(&s.firstReadAt); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
+// touch records an activity, it returns its time.
+func (s *ConnStats) touch() time.Time {
+	now := s.clock.Now()
+	atomic.StoreInt64(&s.lastActivity, now.UnixNano())
+	return now
+}
+
+// statsConn is a net.Conn that counts the bytes read and written.
+type statsConn struct {
+	net.Conn
+	stats *ConnStats
+}
+
+func (c *statsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.AddUint64(&c.stats.bytesRead, uint64(n))
+		now := c.stats.touch()
+		c.stats.window.add(now, 0, 0, uint64(n), 0)
+		atomic.CompareAndSwapInt64(&c.stats.firstReadAt, 0, now.UnixNano())
+	}
+	return n, err
+}
+
+func (c *statsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddUint64(&c.stats.bytesWritten, uint64(n))
+		c.stats.window.add(c.stats.touch(), 0, 0, 0, uint64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StatsSliceDuration is the duration of a StatsSlice of a connection.
+	StatsSliceDuration = 10 * time.Second
+	// StatsSlices is the number of StatsSlice kept for a connection, those of the last 5 minutes.
+	StatsSlices = 30
+)
+
+// StatsSlice holds the counters of a connection during StatsSliceDuration, from Start.
+type StatsSlice struct {
+	Start        time.Time
+	Requests     uint64
+	Errors       uint64
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+// LatencyBounds are the upper bounds of the buckets of a LatencyHistogram.
+var LatencyBounds = [...]time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// LatencyHistogram counts the requests of a connection by latency, from the arrival of their header
+// until their response is written: Counts[i] is the number of requests taking up to LatencyBounds[i],
+// and beyond the last bound for the last one.
+type LatencyHistogram struct {
+	Counts [len(LatencyBounds) + 1]uint64
+}
+
+// connWindow holds the StatsSlices of a connection in a ring, and its LatencyHistogram.
+type connWindow struct {
+	slices    [StatsSlices]StatsSlice
+	mu        sync.Mutex
+	latencies LatencyHistogram // updated atomically
+}
+
+// slice returns the slice of now, reset if it is that of StatsSlices earlier. w.mu is held.
+func (w *connWindow) slice(now time.Time) *StatsSlice {
+	start := now.Truncate(StatsSliceDuration)
+	s := &w.slices[start.UnixNano()/int64(StatsSliceDuration)%StatsSlices]
+	if !s.Start.Equal(start) {
+		*s = StatsSlice{Start: start}
+	}
+	return s
+}
+
+// add counts the requests, the errors and the bytes at now.
+func (w *connWindow) add(now time.Time, requests, errors, read, written uint64) {
+	w.mu.Lock()
+	s := w.slice(now)
+	s.Requests += requests
+	s.Errors += errors
+	s.BytesRead += read
+	s.BytesWritten += written
+	w.mu.Unlock()
+}
+
+// last returns the slices of the StatsSlices * StatsSliceDuration until now, the oldest first.
+func (w *connWindow) last(now time.Time) []StatsSlice {
+	slices := make([]StatsSlice, StatsSlices)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	start := now.Truncate(StatsSliceDuration).Add(-(StatsSlices - 1) * StatsSliceDuration)
+	for i := range slices {
+		s := w.slice(start.Add(time.Duration(i) * StatsSliceDuration))
+		slices[i] = *s
+	}
+	return slices
+}
+
+// addLatency counts a request taking d.
+func (w *connWindow) addLatency(d time.Duration) {
+	i := 0
+	for i < len(LatencyBounds) && d > LatencyBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&w.latencies.Counts[i], 1)
+}
+
+// histogram returns a copy of the LatencyHistogram.
+func (w *connWindow) histogram() LatencyHistogram {
+	var h LatencyHistogram
+	for i := range h.Counts {
+		h.Counts[i] = atomic.LoadUint64(&w.latencies.Counts[i])
+	}
+	return h
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+func TestConnWindow(t *testing.T) {
+	clock := sim.New(1)
+	stats := newConnStats(clock)
+	stats.addRequest()
+	stats.addError()
+	clock.Advance(StatsSliceDuration)
+	stats.addRequest()
+	stats.addRequest()
+	stats.addLatency(3 * time.Millisecond)
+	stats.addLatency(time.Minute)
+
+	slices := stats.Slices()
+	if len(slices) != StatsSlices {
+		t.Fatalf("expect %d slices, got %d", StatsSlices, len(slices))
+	}
+	prev, last := slices[StatsSlices-2], slices[StatsSlices-1]
+	if prev.Requests != 1 || prev.Errors != 1 || last.Requests != 2 || last.Errors != 0 {
+		t.Fatalf("unexpected slices %+v, %+v", prev, last)
+	}
+	if !last.Start.Equal(clock.Now().Truncate(StatsSliceDuration)) {
+		t.Fatalf("expect the last slice to start at %v, got %v", clock.Now().Truncate(StatsSliceDuration), last.Start)
+	}
+
+	// the slices older than StatsSlices are dropped.
+	clock.Advance(StatsSlices * StatsSliceDuration)
+	for _, s := range stats.Slices() {
+		if s.Requests != 0 {
+			t.Fatalf("expect the old slices to be dropped, got %+v", s)
+		}
+	}
+
+	h := stats.Latencies()
+	if h.Counts[2] != 1 || h.Counts[len(LatencyBounds)] != 1 {
+		t.Fatalf("unexpected histogram %v", h.Counts)
+	}
+}
+
+func TestConnsServiceList(t *testing.T) {
+	server := NewServer(Server{})
+	server.Internal().NamedRegister(ConnsServiceName, NewConnsService(server))
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	conn := NewServerCodecConn(c1)
+	conn.Stats().addRequest()
+	server.trackConn(conn, true)
+
+	var infos []ConnInfo
+	if rpcErr := server.Invoke(ConnsListPath, &ConnsArgs{}, &infos, false); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if len(infos) != 1 || infos[0].Requests != 1 || len(infos[0].Slices) != StatsSlices {
+		t.Fatalf("unexpected conns %+v", infos)
+	}
+	if err := NewConnsService(server).List(&ConnsArgs{RemoteAddr: "other"}, &infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Fatalf("expect no conn of another remote address, got %+v", infos)
+	}
+}
+
+func TestFirstReadClock(t *testing.T) {
+	clock := sim.New(1)
+	stats := newConnStats(clock)
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := &statsConn{Conn: server, stats: stats}
+	go client.Write([]byte("request"))
+	stats.markRead()
+	clock.Advance(time.Second)
+	conn.Read(make([]byte, 16))
+	if arrived := stats.firstRead(); !arrived.Equal(clock.Now()) {
+		t.Fatalf("expect the first read at %v on the clock of the stats, got %v", clock.Now(), arrived)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+const defaultWriteQueueSize = 64
+
+// WriteQueuePolicy decides what to do with a response when the write queue of the connection is full.
+type WriteQueuePolicy int
+
+const (
+	// WriteQueueBlock blocks the handler until there is room in the queue.
+	WriteQueueBlock WriteQueuePolicy = iota
+	// WriteQueueDisconnect closes the connection.
+	WriteQueueDisconnect
+	// WriteQueueDrop drops the response.
+	WriteQueueDrop
+)
+
+// connWriter writes the responses of a connection from a single goroutine,
+// in the order in which they are queued.
+type connWriter struct {
+	server  *Server
+	queue   chan response
+	pending sync.WaitGroup // the responses that will be queued
+	done    chan struct{}
+	calls   map[uint64]*Context // the calls in progress by Seq, which the client may cancel
+	callsMu sync.Mutex
+	memory  int64 // the bytes of the requests in progress, see Server.MaxConnMemory
+	memCond *sync.Cond
+	running int // the requests in progress, see Server.MaxConnConcurrentRequests
+}
+
+type response struct {
+	ctx   *Context
+	reply interface{}
+}
+
+func (server *Server) newConnWriter() *connWriter {
+	size := server.WriteQueueSize
+	if size <= 0 {
+		size = defaultWriteQueueSize
+	}
+	return &connWriter{
+		server:  server,
+		queue:   make(chan response, size),
+		done:    make(chan struct{}),
+		calls:   make(map[uint64]*Context),
+		memCond: sync.NewCond(new(sync.Mutex)),
+	}
+}
+
+// run writes the queued responses until the writer is closed.
+func (w *connWriter) run() {
+	for resp := range w.queue {
+		w.write(resp)
+	}
+	close(w.done)
+}
+
+// send queues the response, the server's WriteQueuePolicy applies when the queue is full.
+// The caller must have called pending.Add(1).
+func (w *connWriter) send(ctx *Context, reply interface{}) {
+	resp := response{ctx: ctx, reply: reply}
+	if w.server.WriteQueuePolicy == WriteQueueBlock {
+		w.queue <- resp
+		return
+	}
+	select {
+	case w.queue <- resp:
+		return
+	default:
+	}
+	if w.server.WriteQueuePolicy == WriteQueueDisconnect {
+		log.Noticef("rpc: write queue of %s is full, disconnect it", ctx.RemoteAddr())
+		ctx.codecConn.Close()
+	} else {
+		log.Noticef("rpc: write queue of %s is full, drop the response of %s", ctx.RemoteAddr(), ctx.Path())
+	}
+	w.finish(ctx)
+}
+
+// close waits for the pending responses to be written and stops the writer.
+func (w *connWriter) close() {
+	w.pending.Wait()
+	close(w.queue)
+	<-w.done
+}
+
+func (w *connWriter) write(resp response) {
+	err := resp.ctx.writeResponse(resp.reply)
+	if err != nil {
+		log.Debugf("rpc: writing response: %s", err.Error())
+	}
+	w.finish(resp.ctx)
+}
+
+// track records the call of ctx as in progress until its response is written.
+func (w *connWriter) track(ctx *Context) {
+	w.callsMu.Lock()
+	w.calls[ctx.req.Seq] = ctx
+	w.callsMu.Unlock()
+}
+
+// cancel cancels the call of seq, if it is in progress.
+func (w *connWriter) cancel(seq uint64) {
+	w.callsMu.Lock()
+	defer w.callsMu.Unlock()
+	if ctx, ok := w.calls[seq]; ok {
+		ctx.cancelCall()
+	}
+}
+
+// cancelAll cancels the calls in progress, e.g. when the connection is closed.
+func (w *connWriter) cancelAll() {
+	w.callsMu.Lock()
+	defer w.callsMu.Unlock()
+	for _, ctx := range w.calls {
+		ctx.cancelCall()
+	}
+}
+
+// finish releases the context of a response.
+func (w *connWriter) finish(ctx *Context) {
+	w.callsMu.Lock()
+	if w.calls[ctx.req.Seq] == ctx {
+		delete(w.calls, ctx.req.Seq)
+	}
+	w.callsMu.Unlock()
+	w.release(ctx)
+	w.server.releaseSlot(w, ctx)
+	// every response follows a request counted by addRequest.
+	ctx.codecConn.Stats().removePending()
+	w.server.putContext(ctx)
+	w.server.callGroup.Done()
+	w.pending.Done()
+}
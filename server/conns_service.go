@@ -0,0 +1,71 @@
+package server
+
+import "time"
+
+// ConnsServiceName is the name under which a ConnsService is registered among the built-in services of the server,
+// so that its service is "/_/conns/list".
+//
+//	srv.Internal().NamedRegister(server.ConnsServiceName, server.NewConnsService(srv))
+const ConnsServiceName = "conns"
+
+// ConnsListPath is the path of the service listing the connections, see ConnsService.List.
+const ConnsListPath = "/_/" + ConnsServiceName + "/list"
+
+type (
+	// ConnsService exports the ConnStats of the connections of a server, e.g. for abuse analysis and capacity planning.
+	ConnsService struct {
+		server *Server
+	}
+
+	// ConnsArgs are the arguments of ConnsService.List.
+	ConnsArgs struct {
+		// RemoteAddr selects the connection of this remote address, all of them if it is empty.
+		RemoteAddr string
+	}
+
+	// ConnInfo is the ConnStats of a connection, as replied by ConnsService.List.
+	ConnInfo struct {
+		RemoteAddr   string
+		ConnectedAt  time.Time
+		LastActivity time.Time
+		Requests     uint64
+		Pending      int
+		Errors       uint64
+		BytesRead    uint64
+		BytesWritten uint64
+		// Slices are the counters of the last StatsSlices time slices, the oldest first.
+		Slices    []StatsSlice
+		Latencies LatencyHistogram
+	}
+)
+
+// NewConnsService creates the ConnsService of server.
+func NewConnsService(server *Server) *ConnsService {
+	return &ConnsService{server: server}
+}
+
+// List is the "/conns/list" service, it replies the ConnInfo of the connections being served.
+func (s *ConnsService) List(args *ConnsArgs, reply *[]ConnInfo) error {
+	infos := []ConnInfo{}
+	for _, conn := range s.server.Conns() {
+		remoteAddr := conn.RemoteAddr().String()
+		if args.RemoteAddr != "" && args.RemoteAddr != remoteAddr {
+			continue
+		}
+		stats := conn.Stats()
+		infos = append(infos, ConnInfo{
+			RemoteAddr:   remoteAddr,
+			ConnectedAt:  stats.ConnectedAt(),
+			LastActivity: stats.LastActivity(),
+			Requests:     stats.Requests(),
+			Pending:      stats.Pending(),
+			Errors:       stats.Errors(),
+			BytesRead:    stats.BytesRead(),
+			BytesWritten: stats.BytesWritten(),
+			Slices:       stats.Slices(),
+			Latencies:    stats.Latencies(),
+		})
+	}
+	*reply = infos
+	return nil
+}
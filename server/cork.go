@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// corkConn is a net.Conn whose writes can be held back and coalesced.
+type corkConn struct {
+	net.Conn
+	stats  *ConnStats
+	buf    bytes.Buffer
+	corked bool
+	closed bool
+	timer  common.Timer
+	// failed is called with the error of a flush of FlushAfter, which has no caller to return it to.
+	failed func(error)
+	mu     sync.Mutex
+}
+
+func newCorkConn(conn net.Conn, stats *ConnStats, failed func(error)) *corkConn {
+	return &corkConn{Conn: conn, stats: stats, failed: failed}
+}
+
+// Write writes directly to the connection, unless it is corked.
+// It fails with net.ErrClosed once the connection is closed, rather than holding b back forever.
+func (c *corkConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if c.stats != nil {
+		c.stats.addEncoded(len(b))
+	}
+	if c.corked {
+		return c.buf.Write(b)
+	}
+	if c.buf.Len() == 0 {
+		return c.Conn.Write(b)
+	}
+	c.buf.Write(b)
+	if err := c.flush(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Cork holds back the following writes until Flush is called.
+func (c *corkConn) Cork() {
+	c.mu.Lock()
+	c.corked = true
+	c.mu.Unlock()
+}
+
+// Flush uncorks the connection and writes the held data immediately.
+func (c *corkConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// FlushAfter flushes the held data after delay, on the clock of the stats, see Server.Clock.
+// The data written in the meantime is flushed together, and the error of the flush is passed to failed.
+func (c *corkConn) FlushAfter(delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer == nil && !c.closed {
+		clock := common.SystemClock
+		if c.stats != nil {
+			clock = c.stats.clock
+		}
+		c.timer = clock.AfterFunc(delay, func() {
+			if err := c.Flush(); err != nil && c.failed != nil {
+				c.failed(err)
+			}
+		})
+	}
+}
+
+// Close flushes the held data and closes the connection.
+// The following calls do nothing but close the connection again.
+func (c *corkConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.flush()
+		c.closed = true
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *corkConn) flush() error {
+	c.corked = false
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	_, err := c.Conn.Write(c.buf.Bytes())
+	c.buf.Reset()
+	return err
+}
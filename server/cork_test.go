@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+
+	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+// closeConn signals its Close.
+type closeConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *closeConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+func TestFlushAfterFailed(t *testing.T) {
+	c1, c2 := net.Pipe()
+	c2.Close()
+	c := &closeConn{Conn: c1, closed: make(chan struct{})}
+	clock := sim.New(1)
+	conn := NewServerCodecConn(c)
+	conn.Stats().setClock(clock)
+	conn.SetServerCodec(codecGob.NewGobServerCodec)
+
+	conn.Cork()
+	if err := conn.WriteResponse(&rpc.Response{ServiceMethod: "/a/b", Seq: 1}, "reply"); err != nil {
+		t.Fatalf("expect the corked response to be held, got %v", err)
+	}
+	conn.FlushAfter(time.Second)
+	clock.Advance(time.Second)
+	select {
+	case <-c.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect the connection to be closed once the delayed flush fails")
+	}
+	if !conn.IsBroken() || conn.Stats().Errors() != 1 {
+		t.Fatalf("expect the connection broken with 1 error, got broken %v and %d errors", conn.IsBroken(), conn.Stats().Errors())
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// dedupTable holds the results of the requests with an ID, see Server.DedupWindow.
+type dedupTable struct {
+	results map[string]*dedupResult // client host, path and ID -> result
+	swept   time.Time
+	mu      sync.Mutex
+}
+
+// dedupResult is the result of the first request of an ID, shared with the copies.
+type dedupResult struct {
+	done    chan struct{} // closed once the result is set
+	expires time.Time
+	replyv  reflect.Value
+	errmsg  string
+	errType common.ErrorType
+	trailer url.Values
+}
+
+// begin returns the result of the request of ctx, shared by the requests of its ID for window, or until it is set
+// if it takes longer, and whether the request is the first of its ID, which must then finish the result.
+// It returns nil if the request has no ID.
+func (t *dedupTable) begin(ctx *Context, window time.Duration) (result *dedupResult, first bool) {
+	id := ctx.query.Get(common.RequestIDKey)
+	if id == "" {
+		return nil, false
+	}
+	key := clientHost(ctx) + " " + ctx.path + "?" + id
+	now := ctx.server.Clock.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.swept) >= window {
+		t.sweep(now)
+	}
+	if result = t.results[key]; result != nil && (now.Before(result.expires) || !result.finished()) {
+		return result, false
+	}
+	if t.results == nil {
+		t.results = make(map[string]*dedupResult)
+	}
+	result = &dedupResult{done: make(chan struct{}), expires: now.Add(window)}
+	t.results[key] = result
+	return result, true
+}
+
+// clientHost returns the host of the client of ctx, which scopes the IDs of its requests,
+// so that a client does not get the results of the others by reusing their IDs.
+// It is the whole remote address if it has no port, e.g. on memnet.
+func clientHost(ctx *Context) string {
+	addr := ctx.RemoteAddr()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// sweep forgets the results expired, not those in progress, t.mu is held.
+func (t *dedupTable) sweep(now time.Time) {
+	t.swept = now
+	for key, result := range t.results {
+		if result.finished() && !now.Before(result.expires) {
+			delete(t.results, key)
+		}
+	}
+}
+
+// finished reports whether the result is set.
+func (r *dedupResult) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// finish sets the result of the first request from ctx, and releases the copies waiting for it.
+// It does nothing if r is nil or set already.
+func (r *dedupResult) finish(ctx *Context, errmsg string) {
+	if r == nil || r.finished() {
+		return
+	}
+	r.replyv, r.errmsg, r.errType = ctx.replyv, errmsg, ctx.rpcErrorType
+	ctx.RLock()
+	for key, values := range ctx.trailer {
+		if r.trailer == nil {
+			r.trailer = make(url.Values)
+		}
+		r.trailer[key] = values
+	}
+	ctx.RUnlock()
+	close(r.done)
+}
+
+// replyDuplicate answers the request of ctx with the result r of the first request of its ID, once it is set.
+func (server *Server) replyDuplicate(writer *connWriter, ctx *Context, r *dedupResult) {
+	<-r.done
+	ctx.replyv, ctx.rpcErrorType = r.replyv, r.errType
+	ctx.Lock()
+	for key, values := range r.trailer {
+		if ctx.trailer == nil {
+			ctx.trailer = make(url.Values)
+		}
+		ctx.trailer[key] = values
+	}
+	ctx.Unlock()
+	server.sendResponse(writer, ctx, r.errmsg)
+}
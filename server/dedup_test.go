@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+// withID returns the path of the wait calls of id.
+func withID(id string) string {
+	return "/test/wait?" + common.RequestIDKey + "=" + id
+}
+
+func TestDedupWindow(t *testing.T) {
+	clock := sim.New(1)
+	blocker := newBlocker()
+	close(blocker.release)
+	srv := NewServer(Server{DedupWindow: time.Second, Clock: clock})
+	srv.NamedRegister("test", blocker)
+	dial := serve(t, srv)
+	c := dial()
+
+	for seq, test := range []struct {
+		advance  time.Duration
+		executed bool
+	}{
+		{0, true},
+		{time.Second / 2, false}, // within the window of the first
+		{time.Second / 2, true},  // the first is expired
+		{0, false},
+	} {
+		clock.Advance(test.advance)
+		var reply string
+		send(t, c, uint64(seq), withID("1"), "hello")
+		if resp := receive(t, c, &reply); resp.Error != "" || reply != "hello" {
+			t.Fatalf("%d: expect the reply of the call, got %+v", seq, resp)
+		}
+		if executed := len(blocker.started) > 0; executed != test.executed {
+			t.Fatalf("%d: expect the call executed %v, got %v", seq, test.executed, executed)
+		}
+		if test.executed {
+			<-blocker.started
+		}
+	}
+	// the IDs of another client are not those of c.
+	other := dial()
+	send(t, other, 1, withID("1"), "hello")
+	receive(t, other, nil)
+	if len(blocker.started) == 0 {
+		t.Fatal("expect the call of another client to be executed")
+	}
+}
+
+func TestDedupInProgress(t *testing.T) {
+	blocker := newBlocker()
+	srv := NewServer(Server{DedupWindow: time.Second, Clock: sim.New(1)})
+	srv.NamedRegister("test", blocker)
+	c := serve(t, srv)()
+
+	send(t, c, 1, withID("1"), "hello")
+	<-blocker.started
+	send(t, c, 2, withID("1"), "hello")
+	// the copy waits for the result of the first.
+	replied := make(chan *rpc.Response)
+	go func() {
+		resp := new(rpc.Response)
+		c.ReadResponseHeader(resp)
+		c.ReadResponseBody(nil)
+		replied <- resp
+	}()
+	select {
+	case <-replied:
+		t.Fatal("expect the copy to wait for the first call")
+	case <-blocker.started:
+		t.Fatal("expect the copy not to be executed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	blocker.release <- struct{}{}
+	if resp := <-replied; resp.Error != "" {
+		t.Fatalf("expect the result of the first call, got %+v", resp)
+	}
+	var reply string
+	if resp := receive(t, c, &reply); resp.Error != "" || reply != "hello" {
+		t.Fatalf("expect both calls to get the result of the first, got %+v", resp)
+	}
+	if len(blocker.started) > 0 {
+		t.Fatal("expect the copy not to be executed")
+	}
+}
+
+func TestDedupSweep(t *testing.T) {
+	clock := sim.New(1)
+	blocker := newBlocker()
+	srv := NewServer(Server{DedupWindow: time.Second, Clock: clock})
+	srv.NamedRegister("test", blocker)
+	c := serve(t, srv)()
+
+	send(t, c, 1, withID("1"), "hello")
+	<-blocker.started
+	blocker.release <- struct{}{}
+	receive(t, c, nil)
+	send(t, c, 2, withID("2"), "hello")
+	<-blocker.started
+	clock.Advance(time.Second)
+	// the next call sweeps the expired result of 1, but not 2, still in progress.
+	send(t, c, 3, withID("3"), "hello")
+	<-blocker.started
+	srv.dedup.mu.Lock()
+	var ids []string
+	for key := range srv.dedup.results {
+		ids = append(ids, key[strings.LastIndex(key, "?")+1:])
+	}
+	srv.dedup.mu.Unlock()
+	if len(ids) != 2 || strings.Contains(strings.Join(ids, ","), "1") {
+		t.Fatalf("expect the results of 2 and 3 to be kept, got %v", ids)
+	}
+	close(blocker.release)
+	receive(t, c, nil)
+	receive(t, c, nil)
+}
@@ -0,0 +1,43 @@
+package server
+
+// MethodFilter reports whether the method of the receiver should be registered as a service.
+type MethodFilter func(methodName string) bool
+
+// IMethodNamer is implemented by the IService that knows the name of its receiver's method.
+// MethodFilter only applies to such services, the others are always registered.
+type IMethodNamer interface {
+	GetMethodName() string
+}
+
+// IncludeMethods returns a MethodFilter that only accepts the given methods.
+func IncludeMethods(methodNames ...string) MethodFilter {
+	set := make(map[string]bool, len(methodNames))
+	for _, name := range methodNames {
+		set[name] = true
+	}
+	return func(methodName string) bool {
+		return set[methodName]
+	}
+}
+
+// ExcludeMethods returns a MethodFilter that accepts all methods except the given ones.
+func ExcludeMethods(methodNames ...string) MethodFilter {
+	set := make(map[string]bool, len(methodNames))
+	for _, name := range methodNames {
+		set[name] = true
+	}
+	return func(methodName string) bool {
+		return !set[methodName]
+	}
+}
+
+func filterServices(services []IService, filter MethodFilter) []IService {
+	var accepted []IService
+	for _, service := range services {
+		if namer, ok := service.(IMethodNamer); ok && !filter(namer.GetMethodName()) {
+			continue
+		}
+		accepted = append(accepted, service)
+	}
+	return accepted
+}
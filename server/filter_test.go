@@ -0,0 +1,29 @@
+package server
+
+import "testing"
+
+func TestMethodFilter(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		filter MethodFilter
+		paths  map[string]bool // the paths expected registered or not
+		failed bool            // whether the registration fails, no method being accepted
+	}{
+		{"nil", nil, map[string]bool{"/test/name": true, "/test/other": true}, false},
+		{"include", IncludeMethods("Other"), map[string]bool{"/test/name": false, "/test/other": true}, false},
+		{"exclude", ExcludeMethods("Other"), map[string]bool{"/test/name": true, "/test/other": false}, false},
+		{"none", IncludeMethods("Missing"), map[string]bool{"/test/name": false, "/test/other": false}, true},
+	} {
+		var registerErr error
+		srv := NewServer(Server{OnRegisterError: func(err error) { registerErr = err }})
+		srv.NamedRegisterFiltered("test", Beta{}, test.filter)
+		if failed := registerErr != nil; failed != test.failed {
+			t.Fatalf("%s: expect the registration failed %v, got %v", test.name, test.failed, registerErr)
+		}
+		for path, expect := range test.paths {
+			if registered(srv, path) != expect {
+				t.Fatalf("%s: expect %s registered %v", test.name, path, expect)
+			}
+		}
+	}
+}
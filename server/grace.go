@@ -9,6 +9,7 @@ import (
 
 	"github.com/henrylee2cn/myrpc/gracenet"
 	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/memnet"
 	kcp "github.com/xtaci/kcp-go"
 )
 
@@ -115,6 +116,8 @@ func makeListener(network, address string) (ln net.Listener, err error) {
 	switch network {
 	case "kcp":
 		ln, err = kcp.ListenWithOptions(address, nil, 10, 3)
+	case memnet.Network:
+		ln, err = memnet.Listen(address)
 	default: //tcp
 		ln, err = grace.Listen(network, address)
 		// ln, err = net.Listen(network, address)
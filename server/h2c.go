@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// H2CContentType is the content type of the h2c request and response bodies.
+const H2CContentType = "application/x-myrpc"
+
+// ServeH2C serves HTTP/2 cleartext (h2c) connections on lis.
+// Each call is a POST stream whose path and query carry the service method,
+// and whose body carries the request encoded by ServerCodecFunc, as on a plain connection.
+// HTTP/2 provides the multiplexing and flow control, so the calls go through standard proxies.
+// PostConnAccept plugins are not invoked for h2c streams.
+func (server *Server) ServeH2C(lis net.Listener) error {
+	err := grace.Append(lis)
+	if err != nil {
+		return err
+	}
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Handler:   server.H2CHandler(),
+		Protocols: &protocols,
+	}
+	return srv.Serve(lis)
+}
+
+// H2CHandler returns an http.Handler that answers RPC calls carried by HTTP/2 streams,
+// for mounting on an existing HTTP/2 server.
+func (server *Server) H2CHandler() http.Handler {
+	return http.HandlerFunc(server.serveH2C)
+}
+
+func (server *Server) serveH2C(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 must POST\n")
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		log.Debugf("rpc: h2c: reading %s: %s", req.RemoteAddr, err.Error())
+		return
+	}
+	addr := &MessageAddr{Net: "h2c", Addr: req.RemoteAddr}
+	resp, err := server.ServeMessage(server.ServerCodecFunc, addr, body)
+	if err != nil {
+		log.Debugf("rpc: h2c: %s", err.Error())
+	}
+	if len(resp) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", H2CContentType)
+	w.Write(resp)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// RawBodyCodec is implemented by the server codecs that can read a request body without decoding it,
+// see Server.LazyBody.
+type RawBodyCodec interface {
+	// ReadRequestBodyRaw reads the body of the request whose header was just read, without decoding it.
+	ReadRequestBodyRaw() ([]byte, error)
+	// DecodeRequestBody decodes into body a raw body returned by ReadRequestBodyRaw.
+	// It may be called from another goroutine, after the following requests were read.
+	DecodeRequestBody(raw []byte, body interface{}) error
+}
+
+// rawBodyCodec returns the codec of the connection of ctx if the body is to be read lazily.
+func (ctx *Context) rawBodyCodec() (RawBodyCodec, bool) {
+	if !ctx.server.LazyBody || ctx.codecConn == nil {
+		return nil, false
+	}
+	codec, ok := ctx.codecConn.GetServerCodec().(RawBodyCodec)
+	return codec, ok
+}
+
+// readRequestBodyRaw reads the body without decoding it, body will be decoded by decodeBody.
+func (ctx *Context) readRequestBodyRaw(codec RawBodyCodec, body interface{}) error {
+	raw, err := codec.ReadRequestBodyRaw()
+	if err != nil {
+		return err
+	}
+	ctx.Lock()
+	ctx.rawBody = raw
+	ctx.rawCodec = codec
+	ctx.lazyBody = body
+	ctx.Unlock()
+	return nil
+}
+
+// RawBody returns the request body as read from the connection when it is decoded lazily, see Server.LazyBody,
+// or when the request is routed, see IRouteRequestPlugin, so that a proxy can forward it without decoding it.
+// Otherwise it returns nil.
+func (ctx *Context) RawBody() []byte {
+	ctx.RLock()
+	defer ctx.RUnlock()
+	return ctx.rawBody
+}
+
+// decodeBody decodes the body read lazily, once.
+func (ctx *Context) decodeBody() error {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if ctx.lazyBody == nil {
+		return ctx.lazyErr
+	}
+	err := ctx.rawCodec.DecodeRequestBody(ctx.rawBody, ctx.lazyBody)
+	if err == nil && ctx.server.ArgPolicy != nil {
+		err = ctx.server.ArgPolicy.checkValue(ctx.lazyBody)
+	}
+	if err != nil {
+		ctx.lazyErr = common.NewError("ReadRequestBody: " + err.Error())
+	}
+	ctx.lazyBody = nil
+	return ctx.lazyErr
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"time"
+)
+
+// ServeMessage serves a single request carried by a message,
+// e.g. of a message broker, instead of a connection.
+// The request is encoded by codecFunc, and so is the returned response.
+// remoteAddr is the address reported by Context.RemoteAddr().
+func (server *Server) ServeMessage(codecFunc ServerCodecFunc, remoteAddr net.Addr, request []byte) ([]byte, error) {
+	conn := &messageConn{
+		request:    bytes.NewReader(request),
+		remoteAddr: remoteAddr,
+	}
+	codecConn := NewServerCodecConn(conn)
+	codecConn.SetServerCodec(codecFunc)
+	err := server.serveRequest(codecConn)
+	return conn.response.Bytes(), err
+}
+
+// MessageAddr is a net.Addr of a message transport.
+type MessageAddr struct {
+	Net  string
+	Addr string
+}
+
+// Network returns the name of the transport.
+func (a *MessageAddr) Network() string {
+	return a.Net
+}
+
+// String returns the address, e.g. the subject or queue name.
+func (a *MessageAddr) String() string {
+	return a.Addr
+}
+
+// messageConn is a net.Conn that reads a request message and writes a response message.
+type messageConn struct {
+	request    *bytes.Reader
+	response   bytes.Buffer
+	remoteAddr net.Addr
+}
+
+var _ net.Conn = new(messageConn)
+
+func (c *messageConn) Read(b []byte) (int, error) {
+	return c.request.Read(b)
+}
+
+func (c *messageConn) Write(b []byte) (int, error) {
+	return c.response.Write(b)
+}
+
+func (c *messageConn) Close() error {
+	return nil
+}
+
+func (c *messageConn) LocalAddr() net.Addr {
+	return &MessageAddr{Net: "message"}
+}
+
+func (c *messageConn) RemoteAddr() net.Addr {
+	if c.remoteAddr == nil {
+		return &MessageAddr{Net: "message"}
+	}
+	return c.remoteAddr
+}
+
+func (c *messageConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *messageConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *messageConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
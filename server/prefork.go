@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// preforkEnv marks the environment of the worker processes started by Server.Prefork, with their index.
+const preforkEnv = "MYRPC_PREFORK_WORKER"
+
+// preforkFailFast is how long a worker must live, else its exit fails the prefork, e.g. it cannot listen.
+const preforkFailFast = time.Second
+
+// IsPreforkWorker reports whether the process is a worker started by Server.Prefork,
+// e.g. to run the one-time initialization in the parent process only.
+func IsPreforkWorker() bool {
+	return os.Getenv(preforkEnv) != ""
+}
+
+// listen opens the listener of Serve and ServeTLS, with SO_REUSEPORT if ReusePort or Prefork is set.
+func (server *Server) listen(network, address string) (net.Listener, error) {
+	if !server.ReusePort && server.Prefork <= 0 {
+		return makeListener(network, address)
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("rpc: SO_REUSEPORT is not supported on the network %s", network)
+	}
+	lis, err := listenReusePort(network, address)
+	if err != nil {
+		return nil, err
+	}
+	// passed on to a rebooted process as the other listeners.
+	if err = grace.Append(lis); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
+// workers are the worker processes started by Server.Prefork.
+type workers struct {
+	procs    map[int]*os.Process // by pid
+	stopping bool
+	mu       sync.Mutex // protects the above
+	exited   chan workerExit
+	done     chan struct{} // closed once all the workers exited
+}
+
+// workerExit is the exit of a worker.
+type workerExit struct {
+	index int
+	pid   int
+	lived time.Duration
+	err   error
+}
+
+// prefork starts Prefork worker processes serving on address, and restarts them until the server is shut down.
+// It returns an error if a worker exits at once, the others being stopped.
+func (server *Server) prefork(network, address string) error {
+	w := &workers{
+		procs:  make(map[int]*os.Process, server.Prefork),
+		exited: make(chan workerExit),
+		done:   make(chan struct{}),
+	}
+	defer close(w.done)
+	server.mu.Lock()
+	server.workers = w
+	server.running = true
+	server.mu.Unlock()
+	log.Infof("rpc: preforking %d workers serving %s on %s", server.Prefork, strings.ToUpper(network), address)
+	for i := 0; i < server.Prefork; i++ {
+		if err := w.start(i); err != nil {
+			w.stop()
+			w.wait()
+			return err
+		}
+	}
+	for {
+		e, ok := w.next()
+		if !ok {
+			return nil
+		}
+		if e.lived < preforkFailFast {
+			w.stop()
+			w.wait()
+			return fmt.Errorf("rpc: prefork worker %d exited at once: %v", e.pid, e.err)
+		}
+		log.Warnf("rpc: prefork worker %d exited: %v, restarting it", e.pid, e.err)
+		if err := w.start(e.index); err != nil {
+			w.stop()
+			w.wait()
+			return err
+		}
+	}
+}
+
+// start starts the worker of index i, with the arguments and the environment of the process.
+func (w *workers) start(i int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	for _, v := range os.Environ() {
+		// the workers inherit no listener, see gracenet.
+		if !strings.HasPrefix(v, preforkEnv+"=") && !strings.HasPrefix(v, "LISTEN_FDS=") {
+			cmd.Env = append(cmd.Env, v)
+		}
+	}
+	cmd.Env = append(cmd.Env, preforkEnv+"="+strconv.Itoa(i+1))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopping {
+		return nil
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	w.procs[cmd.Process.Pid] = cmd.Process
+	started := time.Now()
+	go func() {
+		err := cmd.Wait()
+		w.exited <- workerExit{index: i, pid: cmd.Process.Pid, lived: time.Since(started), err: err}
+	}()
+	return nil
+}
+
+// next returns the next exit of a worker to restart, or false once the workers are stopped and exited.
+func (w *workers) next() (workerExit, bool) {
+	for {
+		w.mu.Lock()
+		if w.stopping && len(w.procs) == 0 {
+			w.mu.Unlock()
+			return workerExit{}, false
+		}
+		w.mu.Unlock()
+		e := <-w.exited
+		w.mu.Lock()
+		delete(w.procs, e.pid)
+		stopping := w.stopping
+		w.mu.Unlock()
+		if !stopping {
+			return e, true
+		}
+	}
+}
+
+// wait waits for the workers stopped to exit.
+func (w *workers) wait() {
+	for {
+		if _, ok := w.next(); !ok {
+			return
+		}
+	}
+}
+
+// stop asks the workers to shut down gracefully.
+func (w *workers) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopping = true
+	for pid, p := range w.procs {
+		if err := terminate(p); err != nil {
+			log.Debugf("rpc: stopping prefork worker %d: %s", pid, err.Error())
+		}
+	}
+}
+
+// kill kills the workers left.
+func (w *workers) kill() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range w.procs {
+		p.Kill()
+	}
+}
+
+// close stops the workers, and waits for them to exit until ctx is done, when they are killed.
+func (w *workers) close(ctx context.Context) error {
+	w.stop()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.kill()
+		return ctx.Err()
+	}
+}
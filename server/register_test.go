@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// Alpha and Beta both have the method Name, replying their name, and Beta the method Other.
+type (
+	Alpha struct{}
+	Beta  struct{}
+)
+
+func (Alpha) Name(arg string, reply *string) error {
+	*reply = "alpha"
+	return nil
+}
+
+func (Beta) Name(arg string, reply *string) error {
+	*reply = "beta"
+	return nil
+}
+
+func (Beta) Other(arg string, reply *string) error {
+	*reply = arg
+	return nil
+}
+
+// registered reports whether the service of path is registered in srv.
+func registered(srv *Server, path string) bool {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	_, ok := srv.serviceMap[path]
+	return ok
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	for _, test := range []struct {
+		policy DuplicatePolicy
+		name   string // the reply of /test/name
+		other  bool   // whether /test/other is registered
+		err    error
+	}{
+		{ErrorOnDuplicate, "alpha", false, common.ErrServiceAlreadyExists},
+		{ReplaceExisting, "beta", true, nil},
+		{IgnoreDuplicate, "alpha", true, nil},
+	} {
+		var registerErr error
+		srv := NewServer(Server{DuplicatePolicy: test.policy, OnRegisterError: func(err error) { registerErr = err }})
+		srv.NamedRegister("test", Alpha{})
+		srv.NamedRegister("test", Beta{})
+
+		if test.err == nil && registerErr != nil || test.err != nil && !errors.Is(registerErr, test.err) {
+			t.Fatalf("policy %d: expect the error %v, got %v", test.policy, test.err, registerErr)
+		}
+		var reply string
+		if rpcErr := srv.Invoke("/test/name", "", &reply, false); rpcErr != nil || reply != test.name {
+			t.Fatalf("policy %d: expect /test/name served by %s, got %q, %v", test.policy, test.name, reply, rpcErr)
+		}
+		if registered(srv, "/test/other") != test.other {
+			t.Fatalf("policy %d: expect /test/other registered %v", test.policy, test.other)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// listenReusePort fails, the windows system doesn't support SO_REUSEPORT.
+func listenReusePort(network, address string) (net.Listener, error) {
+	return nil, errors.New("rpc: the windows system doesn't support SO_REUSEPORT")
+}
+
+// terminate kills the worker process p, the windows system has no signal to shut it down gracefully.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
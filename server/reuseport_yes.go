@@ -0,0 +1,35 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenReusePort listens on address with SO_REUSEPORT,
+// so that the listeners of several processes share it, the kernel balancing the connections.
+func listenReusePort(network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			}); cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+	return lc.Listen(context.Background(), network, address)
+}
+
+// terminate asks the worker process p to shut down gracefully, see graceSignal.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io"
+	"sync"
+)
+
+// Scheduler decides how a decoded request becomes a running handler.
+type Scheduler interface {
+	// Schedule runs task, which calls the service of ctx and sends its response.
+	// It is called from the reading goroutine of the connection,
+	// so blocking in it stops the connection from reading further requests.
+	Schedule(ctx *Context, task func())
+}
+
+// GoScheduler runs each request in a new goroutine immediately.
+type GoScheduler struct{}
+
+var _ Scheduler = GoScheduler{}
+
+// Schedule runs task in a new goroutine.
+func (GoScheduler) Schedule(_ *Context, task func()) {
+	go task()
+}
+
+// PoolScheduler runs requests in a fixed number of worker goroutines.
+// When all workers are busy, requests wait in a queue;
+// when the queue is full, Schedule blocks, and so does the reading goroutine of the connection:
+// its next requests are not read, which pushes back on the client through the network.
+// Close stops the workers, the server closes it once it is shut down.
+type PoolScheduler struct {
+	tasks   chan func()
+	closed  bool
+	closeMu sync.RWMutex // held for reading while a task is queued
+	limit   int          // the workers allowed to run tasks, 0 is all of them
+	running int
+	cond    *sync.Cond
+}
+
+var (
+	_ Scheduler = new(PoolScheduler)
+	_ io.Closer = new(PoolScheduler)
+)
+
+// NewPoolScheduler creates a PoolScheduler with the given number of workers and queue size.
+func NewPoolScheduler(workers, queueSize int) *PoolScheduler {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	s := &PoolScheduler{
+		tasks: make(chan func(), queueSize),
+		cond:  sync.NewCond(new(sync.Mutex)),
+	}
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// Schedule queues task to the workers, it blocks while the queue is full.
+// Once the scheduler is closed, task runs in a new goroutine.
+func (s *PoolScheduler) Schedule(_ *Context, task func()) {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closed {
+		go task()
+		return
+	}
+	s.tasks <- task
+}
+
+// Close stops the workers once they have run the tasks queued.
+func (s *PoolScheduler) Close() error {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.tasks)
+	}
+	return nil
+}
+
+// SetLimit limits the number of workers running tasks to n, e.g. to shed load, see Watchdog.DegradedWorkers.
+// If n is 0, all the workers run tasks.
+func (s *PoolScheduler) SetLimit(n int) {
+	s.cond.L.Lock()
+	s.limit = n
+	s.cond.L.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *PoolScheduler) work() {
+	for {
+		s.cond.L.Lock()
+		for s.limit > 0 && s.running >= s.limit {
+			s.cond.Wait()
+		}
+		s.running++
+		s.cond.L.Unlock()
+		task, ok := <-s.tasks
+		if ok {
+			task()
+		}
+		s.cond.L.Lock()
+		s.running--
+		s.cond.L.Unlock()
+		s.cond.Signal()
+		if !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPoolSchedulerClose(t *testing.T) {
+	s := NewPoolScheduler(2, 4)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ran := 0
+	task := func() {
+		mu.Lock()
+		ran++
+		mu.Unlock()
+		wg.Done()
+	}
+	wg.Add(4)
+	for i := 0; i < 4; i++ {
+		s.Schedule(nil, task)
+	}
+	s.Close()
+	s.Close()
+	// the tasks scheduled once the scheduler is closed still run.
+	wg.Add(1)
+	s.Schedule(nil, task)
+	wg.Wait()
+	if ran != 5 {
+		t.Fatalf("expect 5 tasks to run, got %d", ran)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +19,7 @@ import (
 	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
 	"github.com/henrylee2cn/myrpc/common"
 	"github.com/henrylee2cn/myrpc/log"
+	"github.com/henrylee2cn/myrpc/memnet"
 	"github.com/henrylee2cn/myrpc/plugin"
 )
 
@@ -30,15 +32,151 @@ type (
 		WriteTimeout    time.Duration
 		ServerCodecFunc ServerCodecFunc
 		ServiceBuilder  IServiceBuilder
+		// Naming names the services registered without a name, checks the names and maps them to the path segments,
+		// e.g. to kebab case. If it is nil, common.DefaultNaming is used.
+		// It applies to the path segments through the default ServiceBuilder only.
+		Naming common.NamingStrategy
+		// WriteQueueSize is the maximum number of responses waiting to be written to a connection.
+		// If it is 0, 64 is used.
+		WriteQueueSize int
+		// WriteQueuePolicy decides what to do when the write queue of a connection is full,
+		// e.g. because the client stops reading.
+		WriteQueuePolicy WriteQueuePolicy
+		// DuplicatePolicy decides how to register a service whose path already exists.
+		DuplicatePolicy DuplicatePolicy
+		// Scheduler decides how a decoded request becomes a running handler.
+		// If it is nil, GoScheduler is used. If it is an io.Closer, e.g. PoolScheduler,
+		// it is closed once the server is shut down.
+		Scheduler Scheduler
+		// Ordered guarantees that the requests from the same connection are executed
+		// and answered one by one in arrival order, like net/rpc clients may expect.
+		// The Scheduler is not used when it is true.
+		Ordered bool
+		// LazyBody reads the request body without decoding it, and decodes it when the service method is called
+		// or Context.Args is first called, so that the calls rejected by a plugin, or forwarded with Context.RawBody,
+		// are never decoded. The PostReadRequestBody plugins get the body not decoded yet.
+		// It only applies to the codecs implementing RawBodyCodec, the others decode the body at once.
+		LazyBody bool
+		// MaxRequestMemory, if it is not 0, is the budget in bytes of a request,
+		// the requests read larger than it are rejected before their service is called.
+		// Only the bytes read for the request are charged, not its reply, see Context.RequestSize.
+		MaxRequestMemory int64
+		// MaxRequestBodySize, if it is not 0, is the maximum number of bytes read for a request, header and body:
+		// the reads of the codec fail beyond it, so that a request announcing a huge length is not allocated,
+		// and the request fails with an error of type common.ErrorTypeServerMessageTooLarge,
+		// the connection being closed once it is replied. The size is approximate, see Context.RequestSize.
+		// The codecs reading the body with the header, e.g. jsonrpc, don't know the request to reply
+		// once its header is too large, so the connection is closed without reply then.
+		MaxRequestBodySize int64
+		// MaxConnMemory, if it is not 0, is the budget in bytes of the requests in progress of a connection,
+		// from their read until their response is written. MemoryPolicy decides what to do with a request exceeding it.
+		// Each request is charged the bytes read for it only: its reply, whose size is known once it is encoded,
+		// is not charged, so the memory of the services and of their replies is not bounded by it.
+		// The size of a request is approximate because the codecs buffer their reads, see Context.RequestSize.
+		MaxConnMemory int64
+		// MemoryPolicy decides what to do with a request exceeding MaxConnMemory.
+		MemoryPolicy MemoryPolicy
+		// Watchdog, if it is not nil, degrades the server while its Go runtime is overloaded.
+		// It starts with NewServer and stops with the shutdown.
+		Watchdog *Watchdog
+		// MaxAcceptDelay is the longest wait before accepting again after a temporary error,
+		// e.g. EMFILE when the process runs out of file descriptors. The wait doubles from 5ms
+		// after each consecutive error, with jitter. If it is 0, 1s is used.
+		MaxAcceptDelay time.Duration
+		// OnAcceptError, if it is not nil, is called with the fatal errors of accepting connections on lis,
+		// before the Serve methods return them, e.g. to alert or to exit. The temporary errors are retried instead.
+		OnAcceptError func(lis net.Listener, err error)
+		// OnRegisterError, if it is not nil, is called with the errors of a registration or of the creation of a group,
+		// a *common.MultiError of *common.RegisterError telling the groups, the service, the path and the plugin failing,
+		// in place of exiting with log.Fatal. The services failing are not registered, nor any in a group failing.
+		OnRegisterError func(err error)
+		// OnPanic, if it is not nil, is called with the value and the stack of a panic of a service method,
+		// e.g. to report it to an error tracker. The panic is recovered, and the call fails
+		// with an error of type common.ErrorTypeServerServicePanic. It must not panic.
+		OnPanic func(ctx *Context, p interface{}, stack []byte)
+		// StructuredErrors sends the Code and the Details of the errors made by common.NewCodeError,
+		// returned by a service method or a plugin, with the message of the response error, see common.ErrorMessage.
+		// The clients older than common.ParseResponseError show such a message as a NUL byte followed by JSON,
+		// the messages of the other errors are unchanged.
+		StructuredErrors bool
+		// DedupWindow, if it is not 0, executes once the requests of a service path with the same ID,
+		// see common.RequestIDKey, e.g. the hedged requests of client.Failbackup reaching the same server:
+		// those received within DedupWindow of the first, or while it is in progress, get its result.
+		// The results are kept for DedupWindow, and shared only by the requests from the same host,
+		// whatever their connection, so the clients sharing a host, e.g. behind a NAT, may get the results
+		// of one another if they reuse their IDs.
+		DedupWindow time.Duration
+		// MaxConcurrentRequests, if it is not 0, is the maximum number of requests in progress on the server,
+		// from their read until their response is written, e.g. to bound the goroutines of GoScheduler under a flood.
+		// ConcurrencyPolicy decides what to do with the requests beyond it.
+		MaxConcurrentRequests int
+		// MaxConnConcurrentRequests, if it is not 0, is the maximum number of requests in progress on a connection.
+		// ConcurrencyPolicy decides what to do with the requests beyond it.
+		MaxConnConcurrentRequests int
+		// ConcurrencyPolicy decides what to do with a request beyond MaxConcurrentRequests or MaxConnConcurrentRequests.
+		ConcurrencyPolicy ConcurrencyPolicy
+		// ConcurrencyQueueSize is the maximum number of requests queued by ConcurrencyQueue.
+		// If it is 0, 128 is used.
+		ConcurrencyQueueSize int
+		// ArgPolicy, if it is not nil, rejects the services whose argument type is dangerous to decode,
+		// and the arguments decoded nesting too deep, see ArgPolicy. It must be set before the registrations.
+		ArgPolicy *ArgPolicy
+		// MaxConnections, if it is not 0, is the maximum number of connections served at once on the listeners.
+		// ConnLimitPolicy decides what to do with the connections beyond it.
+		MaxConnections int
+		// ConnLimitPolicy decides what to do with the connections beyond MaxConnections.
+		ConnLimitPolicy ConnLimitPolicy
+		// AcceptRate, if it is not 0, is the maximum number of connections accepted per second on the listeners,
+		// e.g. to smooth the reconnections of all the clients after a restart.
+		AcceptRate float64
+		// AcceptBurst is the number of connections accepted at once beyond AcceptRate.
+		// If it is 0, 1 is used.
+		AcceptBurst int
+		// ReusePort binds the TCP listeners of Serve and ServeTLS with SO_REUSEPORT,
+		// so that several processes serve on the same address, the kernel balancing the connections.
+		ReusePort bool
+		// Prefork, if it is not 0, is the number of worker processes started by Serve and ServeTLS,
+		// running the program again, and serving on the same address with ReusePort.
+		// The process starting them serves nothing, it restarts the workers exiting until it is shut down,
+		// when it shuts them down, see IsPreforkWorker.
+		Prefork int
+		// Clock is the source of the time of the accept backoff, of AcceptRate, of DedupWindow,
+		// of IdleTimeout and MaxConnAge, of the delayed flushes of Context.DelayFlush, of the checks of the Watchdog,
+		// of SlowThreshold, and of the ConnStats, e.g. the virtual clock of a test, see sim.Sim.
+		// If it is nil, common.SystemClock is used. The deadlines of Timeout are enforced by the network in real time.
+		Clock common.Clock
+		// SlowThreshold, if it is not 0, logs the requests taking longer than it, from the arrival of their header
+		// until their response is written, with the durations of their stages, see Timings.
+		SlowThreshold time.Duration
+		// IdleTimeout, if it is not 0, closes the connections without any request in progress,
+		// nor any read or write, for longer, e.g. to release the connections the clients left open.
+		IdleTimeout time.Duration
+		// MaxConnAge, if it is not 0, is the age of a connection after which it is closed, as soon as it has
+		// no request in progress, so that the clients reconnect, e.g. to be rebalanced by an L4 load balancer
+		// over the servers added since. A tenth of it is random, so that the connections accepted together
+		// are not closed together. A request sent by the client while the connection is closed fails with it.
+		MaxConnAge time.Duration
+		// MaxConnAgeGrace, if it is not 0, is how long a connection older than MaxConnAge waits
+		// for its requests in progress, after which it is closed with them.
+		MaxConnAgeGrace time.Duration
 
 		serviceMap   map[string]IService
-		mu           sync.RWMutex // protects the serviceMap
+		metadataMap  map[string][]string
+		mu           sync.RWMutex // protects the serviceMap and metadataMap
 		routers      []string
 		listener     net.Listener
 		contextPool  sync.Pool
 		baseMetadata string
 		callGroup    sync.WaitGroup
 		running      bool
+		conns        map[ServerCodecConn]struct{}
+		connsMu      sync.Mutex // protects the conns
+		callsCtx     context.Context
+		cancelCalls  context.CancelFunc // cancels the contexts of the calls in progress
+		dedup        *dedupTable
+		limits       *concurrencyLimits
+		connLimiter  *connLimiter
+		workers      *workers // of Prefork
 	}
 
 	// ServiceGroup is the group of service.
@@ -46,9 +184,28 @@ type (
 		prefixes        []string
 		PluginContainer IServerPluginContainer
 		server          *Server
+		internal        bool // of the built-in services, under InternalPrefix
+		failed          bool // its creation failed, nothing is registered in it
 	}
 )
 
+// InternalPrefix is the first path segment of the built-in services, e.g. "/_/jobs/status".
+// It is reserved, so that the services of the users and the built-in ones never collide:
+// only the group returned by Internal registers services under it.
+const InternalPrefix = "_"
+
+// DuplicatePolicy decides how to register a service whose path already exists.
+type DuplicatePolicy int
+
+const (
+	// ErrorOnDuplicate fails the registration and registers none of the receiver's services.
+	ErrorOnDuplicate DuplicatePolicy = iota
+	// ReplaceExisting replaces the existing service with the new one.
+	ReplaceExisting
+	// IgnoreDuplicate keeps the existing service and skips the new one.
+	IgnoreDuplicate
+)
+
 // NewServer returns a new Server.
 func NewServer(srv Server) *Server {
 	return srv.init()
@@ -58,6 +215,12 @@ func NewServer(srv Server) *Server {
 func (server *Server) init() *Server {
 	server.routers = []string{}
 	server.serviceMap = make(map[string]IService)
+	server.metadataMap = make(map[string][]string)
+	server.conns = make(map[ServerCodecConn]struct{})
+	server.dedup = new(dedupTable)
+	server.limits = newConcurrencyLimits()
+	server.connLimiter = newConnLimiter()
+	server.callsCtx, server.cancelCalls = context.WithCancel(context.Background())
 	server.contextPool.New = func() interface{} {
 		return &Context{
 			server: server,
@@ -73,8 +236,15 @@ func (server *Server) init() *Server {
 		server.ServerCodecFunc = codecGob.NewGobServerCodec
 	}
 	if server.ServiceBuilder == nil {
-		server.ServiceBuilder = NewNormServiceBuilder(new(URLFormat))
+		server.ServiceBuilder = NewNormServiceBuilder(&URLFormat{Naming: server.Naming})
+	}
+	if server.Scheduler == nil {
+		server.Scheduler = GoScheduler{}
 	}
+	if server.Clock == nil {
+		server.Clock = common.SystemClock
+	}
+	server.Watchdog.start(server)
 
 	addServers(server)
 	return server
@@ -87,6 +257,23 @@ func (server *Server) SetBaseMetadata(metadata string) {
 	server.baseMetadata = metadata
 }
 
+// Internal returns the group of the built-in services, under InternalPrefix, e.g. for a jobs.Manager.
+// Its prefix is not checked by the Naming of the server.
+func (server *Server) Internal(plugins ...plugin.IPlugin) *ServiceGroup {
+	group := &ServiceGroup{
+		prefixes: []string{InternalPrefix},
+		server:   server,
+		internal: true,
+	}
+	p := new(ServerPluginContainer)
+	if err := p.Add(plugins...); err != nil {
+		group.failed = true
+		server.registerFailed([]error{&common.RegisterError{Groups: group.prefixes, Err: err}})
+	}
+	group.PluginContainer = p
+	return group
+}
+
 // Group add service group
 func (server *Server) Group(prefix string, plugins ...plugin.IPlugin) *ServiceGroup {
 	return (&ServiceGroup{
@@ -96,17 +283,30 @@ func (server *Server) Group(prefix string, plugins ...plugin.IPlugin) *ServiceGr
 
 // Group add service group
 func (group *ServiceGroup) Group(prefix string, plugins ...plugin.IPlugin) *ServiceGroup {
-	if err := common.CheckSname(prefix); err != nil {
-		log.Fatal("rpc: " + err.Error())
+	// the sibling groups must not share the array of their prefixes.
+	prefixes := append(append([]string(nil), group.prefixes...), prefix)
+	sub := &ServiceGroup{
+		prefixes: prefixes,
+		server:   group.server,
+		internal: group.internal,
+		failed:   group.failed,
+	}
+	var errs []error
+	if err := group.server.naming().CheckSname(prefix); err != nil {
+		errs = append(errs, &common.RegisterError{Groups: prefixes, Err: err})
 	}
 	p := new(ServerPluginContainer)
 	if group.PluginContainer != nil {
 		p.Add(group.PluginContainer.GetAll()...)
 	}
 	if err := p.Add(plugins...); err != nil {
-		log.Fatal("rpc: " + err.Error())
+		errs = append(errs, &common.RegisterError{Groups: prefixes, Err: err})
+	}
+	sub.PluginContainer = p
+	if len(errs) > 0 {
+		sub.failed = true
+		group.server.registerFailed(errs)
 	}
-	prefixes := append(group.prefixes, prefix)
 	groupPath := group.server.ServiceBuilder.URIEncode(nil, prefixes...)
 	for _, plugin := range plugins {
 		if _, ok := plugin.(IPostConnAcceptPlugin); ok {
@@ -119,11 +319,7 @@ func (group *ServiceGroup) Group(prefix string, plugins ...plugin.IPlugin) *Serv
 			log.Noticef("rpc: 'PostReadRequestHeader()' of '%s' plugin in '%s' group is invalid", plugin.Name(), groupPath)
 		}
 	}
-	return &ServiceGroup{
-		prefixes:        prefixes,
-		PluginContainer: p,
-		server:          group.server,
-	}
+	return sub
 }
 
 // Register publishes in the server the set of methods of the
@@ -137,30 +333,62 @@ func (group *ServiceGroup) Group(prefix string, plugins ...plugin.IPlugin) *Serv
 // The client accesses each method using a string of the form "Type.Method",
 // where Type is the receiver's concrete type.
 func (server *Server) Register(rcvr interface{}, metadata ...string) {
-	name := common.ObjectName(rcvr)
+	name := server.naming().ObjectName(rcvr)
 	server.NamedRegister(name, rcvr, metadata...)
 }
 
 // NamedRegister is like Register but uses the provided name for the type
 // instead of the receiver's concrete type.
 func (server *Server) NamedRegister(name string, rcvr interface{}, metadata ...string) {
-	if err := common.CheckSname(name); err != nil {
-		log.Fatal("rpc: " + err.Error())
+	server.NamedRegisterFiltered(name, rcvr, nil, metadata...)
+}
+
+// RegisterFiltered is like Register but only registers the methods accepted by filter.
+// If filter is nil, all suitable methods are registered.
+func (server *Server) RegisterFiltered(rcvr interface{}, filter MethodFilter, metadata ...string) {
+	name := server.naming().ObjectName(rcvr)
+	server.NamedRegisterFiltered(name, rcvr, filter, metadata...)
+}
+
+// NamedRegisterFiltered is like NamedRegister but only registers the methods accepted by filter.
+// If filter is nil, all suitable methods are registered.
+func (server *Server) NamedRegisterFiltered(name string, rcvr interface{}, filter MethodFilter, metadata ...string) {
+	if err := server.naming().CheckSname(name); err != nil {
+		server.registerFailed([]error{&common.RegisterError{Service: name, Err: err}})
+		return
 	}
 	p := new(ServerPluginContainer)
-	server.register([]string{name}, rcvr, p, metadata...)
+	if errs := server.register(nil, name, rcvr, filter, p, false, metadata...); len(errs) > 0 {
+		server.registerFailed(errs)
+	}
 }
 
 // Register register service based on group
 func (group *ServiceGroup) Register(rcvr interface{}, metadata ...string) {
-	name := common.ObjectName(rcvr)
+	name := group.server.naming().ObjectName(rcvr)
 	group.NamedRegister(name, rcvr, metadata...)
 }
 
 // NamedRegister register service based on group
 func (group *ServiceGroup) NamedRegister(name string, rcvr interface{}, metadata ...string) {
-	if err := common.CheckSname(name); err != nil {
-		log.Fatal("rpc: " + err.Error())
+	group.NamedRegisterFiltered(name, rcvr, nil, metadata...)
+}
+
+// RegisterFiltered register service based on group, only the methods accepted by filter are registered.
+func (group *ServiceGroup) RegisterFiltered(rcvr interface{}, filter MethodFilter, metadata ...string) {
+	name := group.server.naming().ObjectName(rcvr)
+	group.NamedRegisterFiltered(name, rcvr, filter, metadata...)
+}
+
+// NamedRegisterFiltered register service based on group, only the methods accepted by filter are registered.
+// Nothing is registered in a group whose creation failed, see Server.OnRegisterError.
+func (group *ServiceGroup) NamedRegisterFiltered(name string, rcvr interface{}, filter MethodFilter, metadata ...string) {
+	if group.failed {
+		return
+	}
+	if err := group.server.naming().CheckSname(name); err != nil {
+		group.server.registerFailed([]error{&common.RegisterError{Groups: group.prefixes, Service: name, Err: err}})
+		return
 	}
 	var all []plugin.IPlugin
 	if group.PluginContainer != nil {
@@ -173,52 +401,139 @@ func (group *ServiceGroup) NamedRegister(name string, rcvr interface{}, metadata
 			Plugins: all,
 		},
 	}
-	group.server.register(append(group.prefixes, name), rcvr, p, metadata...)
+	if errs := group.server.register(group.prefixes, name, rcvr, filter, p, group.internal, metadata...); len(errs) > 0 {
+		group.server.registerFailed(errs)
+	}
+}
+
+func (server *Server) naming() common.NamingStrategy {
+	if server.Naming == nil {
+		return common.DefaultNaming
+	}
+	return server.Naming
 }
 
-func (server *Server) register(pathSegments []string, rcvr interface{}, p IServerPluginContainer, metadata ...string) {
+// internalPath reports whether the service path is under InternalPrefix.
+func internalPath(spath string) bool {
+	return spath == "/"+InternalPrefix || strings.HasPrefix(spath, "/"+InternalPrefix+"/")
+}
+
+// registerFailed reports the errors of a registration, see OnRegisterError.
+func (server *Server) registerFailed(errs []error) {
+	err := common.NewMultiError(errs)
+	if server.OnRegisterError != nil {
+		server.OnRegisterError(err)
+		return
+	}
+	log.Fatal("rpc: " + err.Error())
+}
+
+// registerErrors returns the RegisterErrors of err, an error of the plugins, in the groups and the service name.
+func registerErrors(err error, groups []string, name string) []error {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if multi, ok := err.(*common.MultiError); ok {
+		errs = multi.Errors()
+	}
+	for i, err := range errs {
+		if e, ok := err.(*common.RegisterError); ok {
+			e.Groups, e.Service = groups, name
+		} else {
+			errs[i] = &common.RegisterError{Groups: groups, Service: name, Err: err}
+		}
+	}
+	return errs
+}
+
+// register registers the services of rcvr named name in the groups, and returns the errors, as RegisterErrors.
+// The services rejected by a plugin are not registered, the others are.
+func (server *Server) register(groups []string, name string, rcvr interface{}, filter MethodFilter, p IServerPluginContainer, internal bool, metadata ...string) []error {
 	server.mu.Lock()
 	defer server.mu.Unlock()
-	services, err := server.ServiceBuilder.NewServices(rcvr, pathSegments...)
+	groups = append([]string(nil), groups...)
+	failed := func(spath string, err error) error {
+		return &common.RegisterError{Groups: groups, Service: name, Path: spath, Err: err}
+	}
+	services, err := server.ServiceBuilder.NewServices(rcvr, append(groups, name)...)
 	if err != nil {
-		log.Fatal("rpc: " + err.Error())
+		return []error{failed("", err)}
+	}
+	if filter != nil {
+		services = filterServices(services, filter)
 	}
 	if len(services) == 0 {
-		log.Fatal("rpc: can not register invalid service: '" + reflect.ValueOf(rcvr).String() + "'")
+		return []error{failed("", errors.New("can not register invalid service: '"+reflect.ValueOf(rcvr).String()+"'"))}
 	}
 	var errs []error
+	for _, service := range services {
+		if spath := service.GetPath(); internalPath(spath) && !internal {
+			errs = append(errs, failed(spath, common.ErrReservedPath.Format(spath)))
+		}
+	}
+	errs = append(errs, server.ArgPolicy.checkArgs(services, failed)...)
+	if len(errs) > 0 {
+		return errs
+	}
+	if server.DuplicatePolicy == ErrorOnDuplicate {
+		for _, service := range services {
+			spath := service.GetPath()
+			if _, present := server.serviceMap[spath]; present {
+				errs = append(errs, failed(spath, common.ErrServiceAlreadyExists.Format(spath)))
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	metadata = append(metadata, server.baseMetadata)
 	for _, service := range services {
 		spath := service.GetPath()
 
-		if _, present := server.serviceMap[spath]; present {
-			errs = append(errs, common.ErrServiceAlreadyExists.Format(spath))
+		old, present := server.serviceMap[spath]
+		if present && server.DuplicatePolicy == IgnoreDuplicate {
+			log.Noticef("rpc: route ->	%s already exists, ignore the new one", spath)
+			continue
 		}
+		oldMetadata := server.metadataMap[spath]
 
-		metadata = append(metadata, server.baseMetadata)
+		rejected := len(errs)
+		errs = append(errs, registerErrors(server.PluginContainer.doRegister(spath, rcvr, metadata...), groups, name)...)
+		errs = append(errs, registerErrors(p.doRegister(spath, rcvr, metadata...), groups, name)...)
 
-		var err error
-		err = server.PluginContainer.doRegister(spath, rcvr, metadata...)
-		if err != nil {
-			errs = append(errs, common.NewError(err.Error()))
+		service.SetPluginContainer(p)
+		server.serviceMap[spath] = service
+		server.metadataMap[spath] = metadata
+
+		info := server.serviceInfo(service)
+		errs = append(errs, registerErrors(server.PluginContainer.doRegisterService(info), groups, name)...)
+		errs = append(errs, registerErrors(p.doRegisterService(info), groups, name)...)
+
+		if len(errs) > rejected {
+			// keep the service registered before, if any.
+			if present {
+				server.serviceMap[spath] = old
+				server.metadataMap[spath] = oldMetadata
+			} else {
+				delete(server.serviceMap, spath)
+				delete(server.metadataMap, spath)
+			}
+			continue
 		}
-		err = p.doRegister(spath, rcvr, metadata...)
-		if err != nil {
-			errs = append(errs, common.NewError(err.Error()))
+		if present {
+			log.Noticef("rpc: route ->	%s already exists, replace it", spath)
+		} else {
+			server.routers = append(server.routers, spath)
 		}
 
-		service.SetPluginContainer(p)
-
 		// print routers.
-		server.routers = append(server.routers, spath)
 		log.Infof("rpc: route ->	%s", spath)
-
-		server.serviceMap[spath] = service
-	}
-	if len(errs) > 0 {
-		log.Fatal("rpc: " + common.NewMultiError(errs).Error())
 	}
 	// sort router
 	sort.Strings(server.routers)
+	return errs
 }
 
 // Routers return registered routers.
@@ -227,69 +542,109 @@ func (server *Server) Routers() []string {
 }
 
 // Serve open RPC service at the specified network address.
-func (server *Server) Serve(network, address string) {
-	lis, err := makeListener(network, address)
+// It returns the error of the listener, or nil once the server is shut down, see ServeListener.
+func (server *Server) Serve(network, address string) error {
+	if server.Prefork > 0 && !IsPreforkWorker() {
+		return server.prefork(network, address)
+	}
+	lis, err := server.listen(network, address)
 	if err != nil {
-		log.Fatal("rpc: " + err.Error())
+		return err
 	}
-	server.serveListener(lis)
+	return server.serveListener(lis, nil)
 }
 
 // ServeTLS open secure RPC service at the specified network address.
-func (server *Server) ServeTLS(network, address string, config *tls.Config) {
-	lis, err := makeListener(network, address)
+// It returns the error of the listener, or nil once the server is shut down, see ServeListener.
+func (server *Server) ServeTLS(network, address string, config *tls.Config) error {
+	if server.Prefork > 0 && !IsPreforkWorker() {
+		return server.prefork(network, address)
+	}
+	lis, err := server.listen(network, address)
 	if err != nil {
-		log.Fatalf("rpc: %s", err.Error())
+		return err
 	}
 	lis = tls.NewListener(lis, config)
-	server.serveListener(lis)
+	return server.serveListener(lis, nil)
 }
 
 // ServeListener accepts connection on the listener and serves requests.
-// ServeListener blocks until the listener returns a non-nil error.
+// ServeListener blocks until the listener returns a non-nil error, which it returns,
+// or until the listener is closed and the server shut down, when it returns nil.
 // The caller typically invokes ServeListener in a go statement.
-func (server *Server) ServeListener(lis net.Listener) {
-	err := grace.Append(lis)
-	if err != nil {
-		log.Fatalf("rpc: %s", err.Error())
+func (server *Server) ServeListener(lis net.Listener) error {
+	return server.ServeListenerCodec(lis, nil)
+}
+
+// ServeListenerCodec is like ServeListener but uses codecFunc instead of
+// the server's ServerCodecFunc for the connections accepted on this listener,
+// e.g. jsonline.NewJSONLineServerCodec for thin clients in scripting languages.
+// A codec set by a PostConnAccept plugin still takes precedence.
+func (server *Server) ServeListenerCodec(lis net.Listener, codecFunc ServerCodecFunc) error {
+	// an in-memory listener has no file to pass on to a rebooted process.
+	if _, ok := lis.(*memnet.Listener); !ok {
+		if err := grace.Append(lis); err != nil {
+			return err
+		}
 	}
-	server.serveListener(lis)
+	return server.serveListener(lis, codecFunc)
 }
 
 // serveListener accepts connection on the listener and serves requests.
 // serveListener blocks until the listener returns a non-nil error.
 // The caller typically invokes serveListener in a go statement.
-func (server *Server) serveListener(lis net.Listener) {
+func (server *Server) serveListener(lis net.Listener, codecFunc ServerCodecFunc) error {
 	server.mu.Lock()
 	server.listener = lis
 	server.running = true
 	server.mu.Unlock()
-	defer func() {
-		<-exit
-	}()
+	server.stopAccept(false)
 	log.Infof("rpc: listening and serving %s on %s", strings.ToUpper(server.listener.Addr().Network()), server.listener.Addr().String())
+	var delay time.Duration
 	for {
+		server.waitAccept()
 		c, err := lis.Accept()
 		if err != nil {
-			if !strings.Contains(err.Error(), "use of closed network connection") {
-				log.Debugf("rpc: accept: %s", err.Error())
+			if errors.Is(err, net.ErrClosed) {
+				// closed by the shutdown, wait for it to complete.
+				<-exit
+				return nil
 			}
-			return
+			if delay = server.acceptFailed(lis, err, delay); delay > 0 {
+				log.Warnf("rpc: accept: %s, retrying in %s", err.Error(), delay)
+				common.Sleep(server.Clock, delay)
+				continue
+			}
+			log.Debugf("rpc: accept: %s", err.Error())
+			return err
+		}
+		delay = 0
+		if server.Watchdog.refuse() {
+			log.Debugf("rpc: refused %s, the server is degraded", c.RemoteAddr().String())
+			c.Close()
+			continue
 		}
 		conn := NewServerCodecConn(c)
 		if err = server.PluginContainer.doPostConnAccept(conn); err != nil {
 			log.Debugf("rpc: PostConnAccept: %s", err.Error())
 			continue
 		}
-		go server.ServeConn(conn)
+		if codecFunc != nil && conn.GetServerCodec() == nil {
+			conn.SetServerCodec(codecFunc)
+		}
+		if !server.admitConn() {
+			go server.serveBusy(conn, codecFunc)
+			continue
+		}
+		go server.serveLimited(conn)
 	}
 }
 
 // ServeByHTTP serves
-func (server *Server) ServeByHTTP(lis net.Listener, rpcPath ...string) {
+func (server *Server) ServeByHTTP(lis net.Listener, rpcPath ...string) error {
 	err := grace.Append(lis)
 	if err != nil {
-		log.Fatalf("rpc: %s", err.Error())
+		return err
 	}
 	var p = rpc.DefaultRPCPath
 	if len(rpcPath) > 0 && len(rpcPath[0]) > 0 {
@@ -297,14 +652,14 @@ func (server *Server) ServeByHTTP(lis net.Listener, rpcPath ...string) {
 	}
 	http.Handle(p, server)
 	srv := &http.Server{Handler: nil}
-	srv.Serve(lis)
+	return srv.Serve(lis)
 }
 
 // ServeByMux serves
-func (server *Server) ServeByMux(lis net.Listener, mux *http.ServeMux, rpcPath ...string) {
+func (server *Server) ServeByMux(lis net.Listener, mux *http.ServeMux, rpcPath ...string) error {
 	err := grace.Append(lis)
 	if err != nil {
-		log.Fatalf("rpc: %s", err.Error())
+		return err
 	}
 	var p = rpc.DefaultRPCPath
 	if len(rpcPath) > 0 && len(rpcPath[0]) > 0 {
@@ -312,7 +667,7 @@ func (server *Server) ServeByMux(lis net.Listener, mux *http.ServeMux, rpcPath .
 	}
 	mux.Handle(p, server)
 	srv := &http.Server{Handler: mux}
-	srv.Serve(lis)
+	return srv.Serve(lis)
 }
 
 // ServeHTTP implements an http.Handler that answers RPC requests.
@@ -354,10 +709,22 @@ func (server *Server) Address() string {
 
 // close listener and server.
 func (server *Server) close(ctx context.Context) error {
+	server.Watchdog.close()
+	server.mu.Lock()
+	w := server.workers
+	if w != nil {
+		server.running = false
+	}
+	server.mu.Unlock()
+	if w != nil {
+		log.Infof("rpc: stopping the prefork workers")
+		return w.close(ctx)
+	}
 	if server.listener == nil {
 		return nil
 	}
 	server.listener.Close()
+	server.stopAccept(true)
 	server.mu.Lock()
 	defer server.mu.Unlock()
 	if !server.running {
@@ -370,12 +737,17 @@ func (server *Server) close(ctx context.Context) error {
 		server.callGroup.Wait()
 		close(c)
 	}()
+	var err error
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		server.cancelCalls()
+		err = ctx.Err()
 	case <-c:
-		return nil
 	}
+	if closer, ok := server.Scheduler.(io.Closer); ok {
+		closer.Close()
+	}
+	return err
 }
 
 func (server *Server) isRunning() bool {
@@ -393,27 +765,65 @@ func (server *Server) ServeConn(conn ServerCodecConn) {
 	if conn.GetServerCodec() == nil {
 		conn.SetServerCodec(server.ServerCodecFunc)
 	}
-	sending := new(sync.Mutex)
+	if stats := conn.Stats(); stats.clock != server.Clock {
+		stats.setClock(server.Clock)
+	}
+	server.trackConn(conn, true)
+	writer := server.newConnWriter()
+	go writer.run()
+	if server.IdleTimeout > 0 || server.MaxConnAge > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go server.watchConn(conn, done)
+	}
 	var ctx *Context
-	for server.isRunning() {
+	for server.isRunning() && !conn.IsBroken() {
 		ctx = server.getContext(conn)
 		keepReading, notSend, err := server.readRequest(ctx)
 		server.callGroup.Add(1)
 		if err == nil {
-			go func(c *Context) {
-				server.call(sending, c)
-				server.putContext(c)
-				server.callGroup.Done()
-			}(ctx)
+			err = server.Watchdog.shed(ctx)
+		}
+		if err == nil {
+			err = writer.admit(ctx)
+		}
+		if err == nil {
+			writer.pending.Add(1)
+			writer.track(ctx)
+			c := ctx
+			task := func() {
+				server.call(writer, c)
+			}
+			if queued, err := server.acquire(writer, c, task); err != nil {
+				server.sendResponse(writer, c, server.errorMessage(err))
+				continue
+			} else if queued {
+				continue
+			}
+			if server.Ordered {
+				task()
+				continue
+			}
+			server.Scheduler.Schedule(c, task)
 			continue
 		}
-		if err != io.EOF {
+		if err == errCancelRequest {
+			writer.cancel(ctx.req.Seq)
+		} else if err != io.EOF {
 			log.Debugf("rpc: %s", err.Error())
 		}
 		if keepReading {
 			// send a response if we actually managed to read a header.
 			if !notSend {
-				server.sendResponse(sending, ctx, err.Error())
+				tooLarge := ctx.rpcErrorType == common.ErrorTypeServerMessageTooLarge
+				writer.pending.Add(1)
+				server.sendResponse(writer, ctx, server.errorMessage(err))
+				if tooLarge {
+					// the rest of the request is not read, the connection is closed once the error is replied.
+					writer.pending.Wait()
+					break
+				}
+				continue
 			}
 			server.putContext(ctx)
 			server.callGroup.Done()
@@ -424,6 +834,35 @@ func (server *Server) ServeConn(conn ServerCodecConn) {
 		break
 	}
 	conn.Close()
+	writer.cancelAll()
+	go func() {
+		writer.close()
+		server.trackConn(conn, false)
+		if err := server.PluginContainer.doPostDisconnect(conn); err != nil {
+			log.Debugf("rpc: PostDisconnect: %s", err.Error())
+		}
+	}()
+}
+
+// Conns returns the connections being served.
+func (server *Server) Conns() []ServerCodecConn {
+	server.connsMu.Lock()
+	defer server.connsMu.Unlock()
+	conns := make([]ServerCodecConn, 0, len(server.conns))
+	for conn := range server.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func (server *Server) trackConn(conn ServerCodecConn, add bool) {
+	server.connsMu.Lock()
+	defer server.connsMu.Unlock()
+	if add {
+		server.conns[conn] = struct{}{}
+	} else {
+		delete(server.conns, conn)
+	}
 }
 
 // ServeRequest is like ServeConn but synchronously serves a single request.
@@ -432,22 +871,35 @@ func (server *Server) ServeRequest(conn ServerCodecConn) error {
 	if !server.isRunning() {
 		return errors.New("rpc: server has stopped")
 	}
+	return server.serveRequest(conn)
+}
+
+func (server *Server) serveRequest(conn ServerCodecConn) error {
 	if conn.GetServerCodec() == nil {
 		conn.SetServerCodec(server.ServerCodecFunc)
 	}
-	sending := new(sync.Mutex)
+	writer := server.newConnWriter()
+	go writer.run()
+	defer writer.close()
 	ctx := server.getContext(conn)
 	keepReading, notSend, err := server.readRequest(ctx)
 	server.callGroup.Add(1)
 	if err == nil {
-		server.call(sending, ctx)
-		server.putContext(ctx)
-		server.callGroup.Done()
+		err = server.Watchdog.shed(ctx)
+	}
+	if err == nil {
+		err = writer.admit(ctx)
+	}
+	if err == nil {
+		writer.pending.Add(1)
+		server.call(writer, ctx)
 		return nil
 	}
 	if keepReading && !notSend {
 		// send a response if we actually managed to read a header.
-		server.sendResponse(sending, ctx, err.Error())
+		writer.pending.Add(1)
+		server.sendResponse(writer, ctx, server.errorMessage(err))
+		return err
 	}
 	server.putContext(ctx)
 	server.callGroup.Done()
@@ -455,6 +907,20 @@ func (server *Server) ServeRequest(conn ServerCodecConn) error {
 }
 
 func (server *Server) readRequest(ctx *Context) (keepReading bool, notSend bool, err error) {
+	read := ctx.codecConn.Stats().BytesRead()
+	limited, _ := ctx.codecConn.(readLimiter)
+	if limited != nil {
+		limited.limitRead(server.MaxRequestBodySize)
+	}
+	defer func() {
+		ctx.requestSize = int64(ctx.codecConn.Stats().BytesRead() - read)
+		if err != nil && limited != nil && limited.readExceeded() {
+			err = common.ErrMessageTooLarge.Format(strconv.FormatInt(server.MaxRequestBodySize, 10))
+			if keepReading {
+				ctx.rpcErrorType = common.ErrorTypeServerMessageTooLarge
+			}
+		}
+	}()
 	keepReading, notSend, err = ctx.readRequestHeader()
 	if err != nil {
 		if !keepReading {
@@ -465,6 +931,11 @@ func (server *Server) readRequest(ctx *Context) (keepReading bool, notSend bool,
 		return
 	}
 
+	if _, ok := ctx.service.(*routeService); ok {
+		err = ctx.readRouteBody()
+		return
+	}
+
 	// get arg value
 	argType := ctx.service.GetArgType()
 	argIsValue := false // if true, need to indirect before calling.
@@ -487,22 +958,58 @@ func (server *Server) readRequest(ctx *Context) (keepReading bool, notSend bool,
 	return
 }
 
-func (server *Server) call(sending *sync.Mutex, ctx *Context) {
+func (server *Server) call(writer *connWriter, ctx *Context) {
+	var result *dedupResult
 	defer func() {
 		if p := recover(); p != nil {
-			log.Criticalf("rpc: (%s): %v\n[PANIC]\n%s\n", ctx.Path(), p, common.PanicTrace(4))
+			server.recovered(ctx, p)
 			ctx.rpcErrorType = common.ErrorTypeServerServicePanic
-			server.sendResponse(sending, ctx, "Service Panic!")
+			result.finish(ctx, "Service Panic!")
+			server.sendResponse(writer, ctx, "Service Panic!")
 		}
 	}()
-	var err error
+	start := time.Now()
+	err := ctx.decodeBody()
+	ctx.timings.BodyDecode += time.Since(start)
+	if err != nil {
+		ctx.rpcErrorType = common.ErrorTypeServerReadRequestBody
+		server.sendResponse(writer, ctx, server.errorMessage(err))
+		return
+	}
+	if server.DedupWindow > 0 {
+		var first bool
+		if result, first = server.dedup.begin(ctx, server.DedupWindow); result != nil && !first {
+			server.replyDuplicate(writer, ctx, result)
+			return
+		}
+	}
+	start = time.Now()
 	ctx.replyv, err = ctx.service.Call(ctx.argv, ctx)
+	ctx.timings.Handler = time.Since(start)
 	errmsg := ""
 	if err != nil {
-		errmsg = err.Error()
+		errmsg = server.errorMessage(err)
 		ctx.rpcErrorType = common.ErrorTypeServerService
 	}
-	server.sendResponse(sending, ctx, errmsg)
+	result.finish(ctx, errmsg)
+	server.sendResponse(writer, ctx, errmsg)
+}
+
+// errorMessage returns the message of the response error of err, see StructuredErrors.
+func (server *Server) errorMessage(err error) string {
+	if server.StructuredErrors {
+		return common.ErrorMessage(err)
+	}
+	return err.Error()
+}
+
+// recovered reports the panic p of the service method of ctx, see OnPanic.
+func (server *Server) recovered(ctx *Context, p interface{}) {
+	stack := common.PanicTrace(4)
+	log.Criticalf("rpc: (%s): %v\n[PANIC]\n%s\n", ctx.Path(), p, stack)
+	if server.OnPanic != nil {
+		server.OnPanic(ctx, p, stack)
+	}
 }
 
 // A value sent as a placeholder for the server's response value when the server
@@ -510,7 +1017,9 @@ func (server *Server) call(sending *sync.Mutex, ctx *Context) {
 // contains an error when it is used.
 var invalidRequest = struct{}{}
 
-func (server *Server) sendResponse(sending *sync.Mutex, ctx *Context, errmsg string) {
+// sendResponse queues the response to the connection writer,
+// which releases ctx after the response is written.
+func (server *Server) sendResponse(writer *connWriter, ctx *Context, errmsg string) {
 	var reply interface{}
 	// Encode the response header
 	ctx.resp.ServiceMethod = ctx.req.ServiceMethod
@@ -521,12 +1030,7 @@ func (server *Server) sendResponse(sending *sync.Mutex, ctx *Context, errmsg str
 		reply = ctx.replyv.Interface()
 	}
 	ctx.resp.Seq = ctx.req.Seq
-	sending.Lock()
-	err := ctx.writeResponse(reply)
-	if err != nil {
-		log.Debugf("rpc: writing response: %s", err.Error())
-	}
-	sending.Unlock()
+	writer.send(ctx, reply)
 }
 
 func (server *Server) getContext(conn ServerCodecConn) *Context {
@@ -551,6 +1055,23 @@ func (server *Server) putContext(ctx *Context) {
 	ctx.query = url.Values{}
 	ctx.argv = reflect.Value{}
 	ctx.replyv = reflect.Value{}
+	ctx.flushDelay = 0
+	ctx.trailer = nil
+	if ctx.cancel != nil {
+		ctx.cancel()
+		ctx.cancel = nil
+	}
+	ctx.stdCtx = nil
+	ctx.canceled = false
+	ctx.propagated = nil
+	ctx.rawBody = nil
+	ctx.rawCodec = nil
+	ctx.lazyBody = nil
+	ctx.lazyErr = nil
+	ctx.requestSize = 0
+	ctx.replySize = 0
+	ctx.timings = Timings{}
+	ctx.started = time.Time{}
 	ctx.Unlock()
 	server.contextPool.Put(ctx)
 }
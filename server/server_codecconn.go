@@ -1,9 +1,16 @@
 package server
 
 import (
+	"errors"
 	"io"
 	"net"
 	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
 )
 
 type (
@@ -20,6 +27,21 @@ type (
 		// WriteResponse must be safe for concurrent use by multiple goroutines.
 		WriteResponse(*rpc.Response, interface{}) error
 
+		// IsBroken reports whether writing to the connection has failed, or it is closed.
+		// A broken connection is closed and should no longer be served.
+		IsBroken() bool
+
+		// Cork holds back the following responses until Flush or FlushAfter is called.
+		Cork()
+		// Flush writes the held responses immediately.
+		Flush() error
+		// FlushAfter writes the held responses after delay,
+		// so that the responses written in the meantime are coalesced.
+		FlushAfter(delay time.Duration)
+
+		// Stats returns the counters of the connection.
+		Stats() *ConnStats
+
 		GetServerCodec() rpc.ServerCodec
 
 		//Must ensure that both Conn and ServerCodecFunc are not nil
@@ -32,12 +54,20 @@ type (
 	serverCodecConn struct {
 		net.Conn
 		rpc.ServerCodec
+		cork   *corkConn
+		limit  *common.LimitedConn // of the reads, see Server.MaxRequestBodySize
+		stats  *ConnStats
+		broken int32
+		// closed is set once Close is called, see Close.
+		closed    int32
+		closeOnce sync.Once
+		closeErr  error
 	}
 )
 
 // NewServerCodecConn get a ServerCodecConn.
 func NewServerCodecConn(conn net.Conn) ServerCodecConn {
-	return &serverCodecConn{Conn: conn}
+	return &serverCodecConn{Conn: conn, stats: newConnStats(common.SystemClock)}
 }
 
 func (conn *serverCodecConn) SetConn(c net.Conn) {
@@ -51,7 +81,9 @@ func (conn *serverCodecConn) GetConn() net.Conn {
 // SetServerCodec must ensure that both Conn and ServerCodecFunc are not nil
 func (conn *serverCodecConn) SetServerCodec(fn ServerCodecFunc) {
 	if fn != nil && conn.Conn != nil {
-		conn.ServerCodec = fn(conn.Conn)
+		conn.limit = common.NewLimitedConn(&statsConn{Conn: conn.Conn, stats: conn.stats})
+		conn.cork = newCorkConn(conn.limit, conn.stats, conn.flushFailed)
+		conn.ServerCodec = fn(conn.cork)
 	}
 }
 
@@ -59,14 +91,123 @@ func (conn *serverCodecConn) GetServerCodec() rpc.ServerCodec {
 	return conn.ServerCodec
 }
 
-// Close closes the connection.
-// Any blocked Read or Write operations will be unblocked and return errors.
-func (conn *serverCodecConn) Close() error {
-	var err error
-	if conn.ServerCodec != nil {
-		err = conn.ServerCodec.Close()
-	} else {
-		err = conn.Conn.Close()
+// WriteResponse writes the response.
+// If it fails because of the connection, the connection is marked broken and closed.
+// Once the connection is closed, it fails with common.ErrConnClosed without encoding the response.
+func (conn *serverCodecConn) WriteResponse(resp *rpc.Response, body interface{}) error {
+	if atomic.LoadInt32(&conn.closed) == 1 {
+		return common.ErrConnClosed
+	}
+	err := conn.ServerCodec.WriteResponse(resp, body)
+	if err != nil && isConnError(err) {
+		conn.fail()
+	}
+	return err
+}
+
+// fail marks the connection broken and closes it, once writing to it has failed.
+func (conn *serverCodecConn) fail() {
+	if atomic.CompareAndSwapInt32(&conn.broken, 0, 1) {
+		conn.Close()
+	}
+}
+
+// flushFailed records the error of a flush of FlushAfter, like that of a response written:
+// it is counted in the Stats, and the connection is marked broken and closed.
+func (conn *serverCodecConn) flushFailed(err error) {
+	conn.stats.addError()
+	log.Debugf("rpc: FlushAfter: %s", err.Error())
+	conn.fail()
+}
+
+// readLimiter is a ServerCodecConn limiting the bytes read for a request, see Server.MaxRequestBodySize.
+type readLimiter interface {
+	limitRead(max int64)
+	readExceeded() bool
+}
+
+// limitRead limits the bytes read for the next request to max, if it is not 0, see Server.MaxRequestBodySize.
+func (conn *serverCodecConn) limitRead(max int64) {
+	if conn.limit != nil {
+		conn.limit.Limit(max)
+	}
+}
+
+// readExceeded reports whether the request read exceeds the limit of limitRead.
+func (conn *serverCodecConn) readExceeded() bool {
+	return conn.limit != nil && conn.limit.Exceeded()
+}
+
+// IsBroken reports whether writing to the connection has failed, or it is closed.
+func (conn *serverCodecConn) IsBroken() bool {
+	return atomic.LoadInt32(&conn.broken) == 1
+}
+
+// Stats returns the counters of the connection.
+func (conn *serverCodecConn) Stats() *ConnStats {
+	return conn.stats
+}
+
+// Cork holds back the following responses until Flush or FlushAfter is called.
+func (conn *serverCodecConn) Cork() {
+	if conn.cork != nil {
+		conn.cork.Cork()
+	}
+}
+
+// Flush writes the held responses immediately.
+// If it fails, the connection is marked broken and closed, like when WriteResponse fails.
+func (conn *serverCodecConn) Flush() error {
+	if conn.cork == nil {
+		return nil
+	}
+	err := conn.cork.Flush()
+	if err != nil {
+		conn.fail()
 	}
 	return err
 }
+
+// FlushAfter writes the held responses after delay, on the Clock of the server.
+// If it fails, the error is counted in the Stats, and the connection is marked broken and closed.
+func (conn *serverCodecConn) FlushAfter(delay time.Duration) {
+	if conn.cork != nil {
+		conn.cork.FlushAfter(delay)
+	}
+}
+
+// Close flushes the held responses, then closes the codec and the connection.
+// Any blocked Read or Write operations will be unblocked and return errors.
+// Close is idempotent: the following calls return the error of the first one,
+// and the connection is broken from the first one, see IsBroken.
+func (conn *serverCodecConn) Close() error {
+	conn.closeOnce.Do(func() {
+		atomic.StoreInt32(&conn.closed, 1)
+		atomic.StoreInt32(&conn.broken, 1)
+		conn.Flush()
+		if conn.ServerCodec != nil {
+			conn.closeErr = conn.ServerCodec.Close()
+		}
+		// the codec may not close the connection, e.g. when a plugin wraps it.
+		if err := conn.Conn.Close(); conn.closeErr == nil && !isClosedError(err) {
+			conn.closeErr = err
+		}
+	})
+	return conn.closeErr
+}
+
+// isClosedError reports whether err is caused by closing a connection already closed.
+func isClosedError(err error) bool {
+	return err == nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe)
+}
+
+// isConnError reports whether err is caused by the underlying connection rather than by the codec.
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, common.ErrConnClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/rpc"
 	"net/url"
@@ -27,6 +29,22 @@ type (
 		query        url.Values
 		data         *Store
 		rpcErrorType common.ErrorType
+		flushDelay   time.Duration
+		trailer      url.Values
+		stdCtx       context.Context
+		cancel       context.CancelFunc
+		canceled     bool // by the client
+		propagated   url.Values
+		rawBody      []byte       // the body read lazily
+		rawCodec     RawBodyCodec // decodes rawBody
+		lazyBody     interface{}  // the args rawBody is still to be decoded into
+		lazyErr      error        // the error of decoding rawBody
+		requestSize  int64
+		replySize    int64
+		charged      int64 // the bytes of the request charged to the memory budget of the connection
+		inProgress   bool  // the request is counted in progress, see Server.MaxConcurrentRequests
+		timings      Timings
+		started      time.Time // the start of Timings.HeaderDecode
 		sync.RWMutex
 	}
 	// Store concurrent secure data storage.
@@ -81,8 +99,11 @@ func (store *Store) Each(callback func(key interface{}, data map[interface{}]int
 	}
 }
 
-// RemoteAddr returns remote address
+// RemoteAddr returns remote address, LocalAddr for the calls made in process.
 func (ctx *Context) RemoteAddr() string {
+	if ctx.codecConn == nil {
+		return LocalAddr
+	}
 	addr := ctx.codecConn.RemoteAddr()
 	return addr.String()
 }
@@ -119,6 +140,90 @@ func (ctx *Context) Query() url.Values {
 	return ctx.query
 }
 
+// Args returns the decoded request body, or nil if it has not been read.
+// When the body is read lazily, see Server.LazyBody, the first call decodes it,
+// and Args returns nil if it cannot be decoded.
+func (ctx *Context) Args() interface{} {
+	if !ctx.argv.IsValid() || ctx.decodeBody() != nil {
+		return nil
+	}
+	return ctx.argv.Interface()
+}
+
+// DelayFlush allows the response to be held back for up to delay,
+// so that several small responses to the same connection are coalesced.
+// By default, the response is flushed immediately.
+// It can be called by the service method or by a PreWriteResponse plugin.
+func (ctx *Context) DelayFlush(delay time.Duration) {
+	ctx.flushDelay = delay
+}
+
+// SetTrailer sets a trailer metadata, which is delivered to the client with the reply,
+// e.g. the processing time, a cache status or partial-failure information.
+// It can be called by the service method or by a PreWriteResponse plugin.
+func (ctx *Context) SetTrailer(key, value string) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if ctx.trailer == nil {
+		ctx.trailer = make(url.Values)
+	}
+	ctx.trailer.Set(key, value)
+}
+
+// errCancelRequest is returned when the request cancels a call, see common.CancelServiceMethod.
+var errCancelRequest = errors.New("rpc: cancel request")
+
+// contextKey is the key of the Context in its context.Context.
+type contextKey struct{}
+
+// StdContext returns the context.Context of the request, from which FromContext returns ctx.
+// It is canceled once the response is written, when the client cancels the call, see client.Client.CallContext,
+// when the connection is closed, or when the shutdown of the server times out.
+func (ctx *Context) StdContext() context.Context {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if ctx.stdCtx == nil {
+		var c context.Context
+		c, ctx.cancel = context.WithCancel(ctx.server.callsCtx)
+		for key, values := range ctx.propagated {
+			c = common.WithMetadata(c, key, values[0])
+		}
+		ctx.stdCtx = context.WithValue(c, contextKey{}, ctx)
+		if ctx.canceled {
+			ctx.cancel()
+		}
+	}
+	return ctx.stdCtx
+}
+
+// Propagate adds the metadata key=value to StdContext, so that the calls made with it forward it downstream,
+// e.g. a transaction ID, see common.WithMetadata.
+// It is called by the plugins, before the service method.
+func (ctx *Context) Propagate(key, value string) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if ctx.propagated == nil {
+		ctx.propagated = make(url.Values)
+	}
+	ctx.propagated.Set(key, value)
+}
+
+// cancelCall cancels the context of the call, which the client abandoned.
+func (ctx *Context) cancelCall() {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.canceled = true
+	if ctx.cancel != nil {
+		ctx.cancel()
+	}
+}
+
+// FromContext returns the Context of the request that c is derived from, see Context.StdContext.
+func FromContext(c context.Context) (*Context, bool) {
+	ctx, ok := c.Value(contextKey{}).(*Context)
+	return ctx, ok
+}
+
 func (ctx *Context) readRequestHeader() (keepReading bool, notSend bool, err error) {
 	// set timeout
 	if ctx.server.Timeout > 0 {
@@ -136,7 +241,14 @@ func (ctx *Context) readRequestHeader() (keepReading bool, notSend bool, err err
 	}
 
 	// decode request header
+	ctx.codecConn.Stats().markRead()
+	ctx.started = ctx.now()
 	err = ctx.codecConn.ReadRequestHeader(ctx.req)
+	if arrived := ctx.codecConn.Stats().firstRead(); arrived.After(ctx.started) {
+		// not the time waiting for the request on an idle connection.
+		ctx.started = arrived
+	}
+	ctx.timings.HeaderDecode = ctx.now().Sub(ctx.started)
 	if err != nil {
 		ctx.rpcErrorType = common.ErrorTypeServerReadRequestHeader
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
@@ -150,6 +262,12 @@ func (ctx *Context) readRequestHeader() (keepReading bool, notSend bool, err err
 	// We read the header successfully. If we see an error now,
 	// we can still recover and move on to the next request.
 	keepReading = true
+	if ctx.req.ServiceMethod == common.CancelServiceMethod {
+		notSend = true
+		err = errCancelRequest
+		return
+	}
+	ctx.codecConn.Stats().addRequest()
 
 	// parse serviceMethod
 	ctx.path, ctx.query, err = ctx.server.ServiceBuilder.URIParse(ctx.req.ServiceMethod)
@@ -166,6 +284,17 @@ func (ctx *Context) readRequestHeader() (keepReading bool, notSend bool, err err
 		return
 	}
 
+	// route
+	handler, err := ctx.server.PluginContainer.doRouteRequest(ctx)
+	if err != nil {
+		ctx.rpcErrorType = common.ErrorTypeServerPostReadRequestHeader
+		return
+	}
+	if handler != nil {
+		ctx.service = &routeService{path: ctx.path, handler: handler}
+		return
+	}
+
 	// get service
 	ctx.server.mu.RLock()
 	ctx.service = ctx.server.serviceMap[ctx.path]
@@ -190,7 +319,16 @@ func (ctx *Context) readRequestBody(body interface{}) error {
 		return err
 	}
 
-	err = ctx.codecConn.ReadRequestBody(body)
+	start := time.Now()
+	if codec, ok := ctx.rawBodyCodec(); ok {
+		err = ctx.readRequestBodyRaw(codec, body)
+	} else {
+		err = ctx.codecConn.ReadRequestBody(body)
+		if err == nil && ctx.server.ArgPolicy != nil {
+			err = ctx.server.ArgPolicy.checkValue(body)
+		}
+	}
+	ctx.timings.BodyDecode += time.Since(start)
 	if err != nil {
 		ctx.rpcErrorType = common.ErrorTypeServerReadRequestBody
 		return common.NewError("ReadRequestBody: " + err.Error())
@@ -228,19 +366,45 @@ func (ctx *Context) writeResponse(body interface{}) error {
 	if err != nil {
 		log.Debug("rpc: PreWriteResponse: " + err.Error())
 		ctx.rpcErrorType = common.ErrorTypeServerPreWriteResponse
-		ctx.resp.Error = err.Error()
+		ctx.resp.Error = ctx.server.errorMessage(err)
 		body = nil
 	}
 
 	// decode request header
 	if len(ctx.resp.Error) > 0 {
-		ctx.resp.Error = string(ctx.rpcErrorType) + ctx.resp.Error
+		ctx.codecConn.Stats().addError()
+		ctx.resp.Error = common.EncodeErrorType(ctx.rpcErrorType) + ctx.resp.Error
+	}
+	ctx.RLock()
+	ctx.resp.ServiceMethod = common.JoinTrailer(ctx.resp.ServiceMethod, ctx.trailer)
+	ctx.RUnlock()
+	if ctx.flushDelay > 0 {
+		ctx.codecConn.Cork()
 	}
+	encoded := ctx.codecConn.Stats().encoded()
+	start := time.Now()
 	err = ctx.codecConn.WriteResponse(ctx.resp, body)
+	ctx.timings.Encode = time.Since(start)
+	ctx.replySize = int64(ctx.codecConn.Stats().encoded() - encoded)
+	if err == nil {
+		if ctx.flushDelay > 0 {
+			ctx.codecConn.FlushAfter(ctx.flushDelay)
+		} else {
+			start = time.Now()
+			err = ctx.codecConn.Flush()
+			ctx.timings.Flush = time.Since(start)
+		}
+	}
+	ctx.server.logSlow(ctx)
+	ctx.codecConn.Stats().addLatency(ctx.now().Sub(ctx.started))
 	if err != nil {
+		ctx.codecConn.Stats().addError()
 		ctx.rpcErrorType = common.ErrorTypeServerWriteResponse
-		ctx.resp.Error = string(ctx.rpcErrorType) + err.Error()
-		ctx.codecConn.WriteResponse(ctx.resp, invalidRequest)
+		// the connection is dead, don't try to report the error to the peer.
+		if !ctx.codecConn.IsBroken() {
+			ctx.resp.Error = common.EncodeErrorType(ctx.rpcErrorType) + err.Error()
+			ctx.codecConn.WriteResponse(ctx.resp, invalidRequest)
+		}
 		return common.NewError("WriteResponse: " + err.Error())
 	}
 
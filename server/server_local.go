@@ -0,0 +1,122 @@
+package server
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// LocalAddr is the RemoteAddr of the contexts of the calls made in process, see Invoke.
+const LocalAddr = "local"
+
+// Invoke calls the service of serviceMethod in the same process, without connection nor encoding,
+// so args and the reply are shared with the service method, and reply must be a pointer of its reply type.
+// If plugins is true, the PostReadRequestHeader, PostReadRequestBody and PreWriteResponse plugins are run,
+// like for a call read from a connection.
+// The error is of the type of the step that failed, like the error of a remote call.
+func (server *Server) Invoke(serviceMethod string, args interface{}, reply interface{}, plugins bool) *common.RPCError {
+	ctx := server.getContext(nil)
+	defer server.putContext(ctx)
+	server.callGroup.Add(1)
+	defer server.callGroup.Done()
+
+	ctx.req.ServiceMethod = serviceMethod
+	var err error
+	ctx.path, ctx.query, err = server.ServiceBuilder.URIParse(serviceMethod)
+	if err != nil {
+		return localError(common.ErrorTypeServerInvalidServiceMethod, err)
+	}
+	if plugins {
+		if err = server.PluginContainer.doPostReadRequestHeader(ctx); err != nil {
+			return localError(common.ErrorTypeServerPostReadRequestHeader, err)
+		}
+	}
+	server.mu.RLock()
+	ctx.service = server.serviceMap[ctx.path]
+	server.mu.RUnlock()
+	if ctx.service == nil {
+		return common.NewRPCError(common.ErrorTypeServerNotFoundService, "can't find service '"+ctx.path+"'")
+	}
+
+	if ctx.argv, err = localArgs(args, ctx.service.GetArgType()); err != nil {
+		return localError(common.ErrorTypeServerReadRequestBody, err)
+	}
+	if plugins {
+		err = ctx.service.GetPluginContainer().doPostReadRequestBody(ctx, args)
+		if err == nil {
+			err = server.PluginContainer.doPostReadRequestBody(ctx, args)
+		}
+		if err != nil {
+			return localError(common.ErrorTypeServerPostReadRequestBody, err)
+		}
+	}
+
+	if rpcErr := server.invokeService(ctx); rpcErr != nil {
+		return rpcErr
+	}
+	if plugins {
+		body := ctx.replyv.Interface()
+		err = server.PluginContainer.doPreWriteResponse(ctx, body)
+		if err == nil {
+			err = ctx.service.GetPluginContainer().doPreWriteResponse(ctx, body)
+		}
+		if err != nil {
+			return localError(common.ErrorTypeServerPreWriteResponse, err)
+		}
+	}
+
+	replyv := reflect.ValueOf(reply)
+	if replyv.Kind() != reflect.Ptr || replyv.IsNil() || replyv.Type() != ctx.replyv.Type() {
+		return common.NewRPCError(common.ErrorTypeClientReadResponseBody, "reply type is not "+ctx.replyv.Type().String())
+	}
+	replyv.Elem().Set(ctx.replyv.Elem())
+	return nil
+}
+
+// invokeService calls the service method of ctx, recovering its panic.
+func (server *Server) invokeService(ctx *Context) (rpcErr *common.RPCError) {
+	defer func() {
+		if p := recover(); p != nil {
+			server.recovered(ctx, p)
+			rpcErr = common.NewRPCError(common.ErrorTypeServerServicePanic, "Service Panic!")
+		}
+	}()
+	var err error
+	start := time.Now()
+	ctx.replyv, err = ctx.service.Call(ctx.argv, ctx)
+	ctx.timings.Handler = time.Since(start)
+	if err != nil {
+		return localError(common.ErrorTypeServerService, err)
+	}
+	return nil
+}
+
+// localError returns the RPCError of type errorType of err, with the Code and the Details of err, see common.NewCodeError.
+func localError(errorType common.ErrorType, err error) *common.RPCError {
+	rpcErr := common.NewRPCError(errorType, err.Error())
+	if e, ok := common.AsRPCError(err); ok {
+		rpcErr.Code, rpcErr.Details = e.Code, e.Details
+	}
+	return rpcErr
+}
+
+// localArgs returns the value of args of type argType, args may also be a pointer of argType, or its element.
+func localArgs(args interface{}, argType reflect.Type) (reflect.Value, error) {
+	v := reflect.ValueOf(args)
+	switch {
+	case !v.IsValid() && argType.Kind() == reflect.Ptr:
+		return reflect.New(argType.Elem()), nil
+	case !v.IsValid():
+		return reflect.Zero(argType), nil
+	case v.Type() == argType:
+		return v, nil
+	case v.Kind() == reflect.Ptr && v.Type().Elem() == argType && !v.IsNil():
+		return v.Elem(), nil
+	case argType.Kind() == reflect.Ptr && v.Type() == argType.Elem():
+		p := reflect.New(argType.Elem())
+		p.Elem().Set(v)
+		return p, nil
+	}
+	return reflect.Value{}, common.NewError("args type " + v.Type().String() + " is not " + argType.String())
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// MemoryPolicy decides what to do with a request exceeding the memory budget of its connection, see Server.MaxConnMemory.
+type MemoryPolicy int
+
+const (
+	// MemoryReject replies an error of type common.ErrorTypeServerMemoryLimit to the request.
+	MemoryReject MemoryPolicy = iota
+	// MemoryWait holds the request, and stops reading the connection, until the requests in progress
+	// of the connection leave room for it, so that the connection is slowed down rather than failed.
+	MemoryWait
+)
+
+// RequestSize returns the approximate number of bytes read for the request, header and body.
+// The codecs buffer their reads, so the bytes read ahead are counted for the request being read.
+func (ctx *Context) RequestSize() int64 {
+	return ctx.requestSize
+}
+
+// ReplySize returns the number of bytes of the encoded response, it is 0 before the response is written,
+// so it is available to the PostWriteResponse plugins. It is not charged to the memory budgets.
+func (ctx *Context) ReplySize() int64 {
+	return ctx.replySize
+}
+
+// admit charges the bytes read for the request of ctx to the memory budget of the connection,
+// it returns an error if the request exceeds the budgets of the server.
+func (w *connWriter) admit(ctx *Context) error {
+	server := w.server
+	size := ctx.requestSize
+	if server.MaxRequestMemory > 0 && size > server.MaxRequestMemory {
+		ctx.rpcErrorType = common.ErrorTypeServerMemoryLimit
+		return common.NewError("request of " + strconv.FormatInt(size, 10) + " bytes exceeds the budget of " +
+			strconv.FormatInt(server.MaxRequestMemory, 10) + " bytes")
+	}
+	if server.MaxConnMemory <= 0 {
+		return nil
+	}
+	w.memCond.L.Lock()
+	defer w.memCond.L.Unlock()
+	// a request is always admitted if none is in progress, whatever its size.
+	for w.memory > 0 && w.memory+size > server.MaxConnMemory {
+		if server.MemoryPolicy != MemoryWait {
+			ctx.rpcErrorType = common.ErrorTypeServerMemoryLimit
+			return common.NewError("requests in progress of " + strconv.FormatInt(w.memory, 10) +
+				" bytes leave no room in the budget of " + strconv.FormatInt(server.MaxConnMemory, 10) + " bytes of the connection")
+		}
+		w.memCond.Wait()
+	}
+	w.memory += size
+	ctx.charged = size
+	return nil
+}
+
+// release gives the memory charged for the request of ctx back to the budget of the connection.
+func (w *connWriter) release(ctx *Context) {
+	if ctx.charged == 0 {
+		return
+	}
+	w.memCond.L.Lock()
+	w.memory -= ctx.charged
+	ctx.charged = 0
+	w.memCond.L.Unlock()
+	w.memCond.Broadcast()
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// body is the argument of the requests, so that each request is charged about 1KB.
+var body = strings.Repeat("x", 1000)
+
+// errorType returns the type of the error of a response, 0 if there is none.
+func errorType(errMsg string) common.ErrorType {
+	if errMsg == "" {
+		return 0
+	}
+	return common.ParseResponseError(errMsg).Type
+}
+
+func TestMaxRequestMemory(t *testing.T) {
+	blocker := newBlocker()
+	srv := NewServer(Server{MaxRequestMemory: 500})
+	srv.NamedRegister("test", blocker)
+	c := serve(t, srv)()
+
+	send(t, c, 1, "/test/wait", body)
+	if resp := receive(t, c, nil); errorType(resp.Error) != common.ErrorTypeServerMemoryLimit || resp.Seq != 1 {
+		t.Fatalf("expect the request larger than MaxRequestMemory to be rejected, got %+v", resp)
+	}
+	// the connection goes on.
+	close(blocker.release)
+	var reply string
+	send(t, c, 2, "/test/wait", "small")
+	if resp := receive(t, c, &reply); resp.Error != "" || reply != "small" {
+		t.Fatalf("expect the small request to be served, got %+v", resp)
+	}
+}
+
+func TestMemoryReject(t *testing.T) {
+	blocker := newBlocker()
+	srv := NewServer(Server{MaxConnMemory: 1500, MemoryPolicy: MemoryReject})
+	srv.NamedRegister("test", blocker)
+	c := serve(t, srv)()
+
+	send(t, c, 1, "/test/wait", body)
+	<-blocker.started
+	// the request in progress leaves no room for the second one.
+	send(t, c, 2, "/test/wait", body)
+	if resp := receive(t, c, nil); errorType(resp.Error) != common.ErrorTypeServerMemoryLimit || resp.Seq != 2 {
+		t.Fatalf("expect the request beyond MaxConnMemory to be rejected, got %+v", resp)
+	}
+	blocker.release <- struct{}{}
+	if resp := receive(t, c, nil); resp.Error != "" || resp.Seq != 1 {
+		t.Fatalf("expect the first request to be served, got %+v", resp)
+	}
+	// the memory of the first request is released once it is replied.
+	idle(t, srv)
+	send(t, c, 3, "/test/wait", body)
+	<-blocker.started
+	blocker.release <- struct{}{}
+	if resp := receive(t, c, nil); resp.Error != "" || resp.Seq != 3 {
+		t.Fatalf("expect the request to be served once the budget is released, got %+v", resp)
+	}
+}
+
+func TestMemoryWait(t *testing.T) {
+	blocker := newBlocker()
+	srv := NewServer(Server{MaxConnMemory: 1500, MemoryPolicy: MemoryWait})
+	srv.NamedRegister("test", blocker)
+	c := serve(t, srv)()
+
+	send(t, c, 1, "/test/wait", body)
+	<-blocker.started
+	send(t, c, 2, "/test/wait", body)
+	// the second request is held, and the connection is no longer read, until the first one is replied.
+	written := make(chan struct{})
+	go func() {
+		c.WriteRequest(&rpc.Request{Seq: 3, ServiceMethod: "/test/wait"}, "small")
+		close(written)
+	}()
+	select {
+	case arg := <-blocker.started:
+		t.Fatalf("expect the request beyond MaxConnMemory to wait, %d bytes started", len(arg))
+	case <-written:
+		t.Fatal("expect the connection not to be read while a request waits for memory")
+	case <-time.After(50 * time.Millisecond):
+	}
+	blocker.release <- struct{}{}
+	if resp := receive(t, c, nil); resp.Error != "" || resp.Seq != 1 {
+		t.Fatalf("expect the first request to be served, got %+v", resp)
+	}
+	// the held request starts, and the connection is read again.
+	<-written
+	started := map[string]bool{<-blocker.started: true, <-blocker.started: true}
+	if !started[body] || !started["small"] {
+		t.Fatal("expect the held requests to start once the first one is replied")
+	}
+	close(blocker.release)
+	for n := 0; n < 2; n++ {
+		if resp := receive(t, c, nil); resp.Error != "" {
+			t.Fatalf("expect the held requests to be served, got %+v", resp)
+		}
+	}
+}
+
+func TestMemoryReleasedOnError(t *testing.T) {
+	blocker := newBlocker()
+	srv := NewServer(Server{MaxConnMemory: 1500, MemoryPolicy: MemoryReject})
+	srv.NamedRegister("test", blocker)
+	c := serve(t, srv)()
+
+	for seq, path := range []string{"/test/fail", "/test/panic", "/test/unknown"} {
+		send(t, c, uint64(seq), path, body)
+		if resp := receive(t, c, nil); resp.Error == "" {
+			t.Fatalf("expect %s to fail, got %+v", path, resp)
+		}
+	}
+	// the failed requests leave the whole budget.
+	idle(t, srv)
+	send(t, c, 10, "/test/wait", body)
+	<-blocker.started
+	close(blocker.release)
+	if resp := receive(t, c, nil); resp.Error != "" {
+		t.Fatalf("expect the memory of the failed requests to be released, got %+v", resp)
+	}
+}
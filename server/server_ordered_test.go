@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func TestOrdered(t *testing.T) {
+	one, two := newBlocker(), newBlocker()
+	srv := NewServer(Server{Ordered: true})
+	srv.NamedRegister("one", one)
+	srv.NamedRegister("two", two)
+	dial := serve(t, srv)
+	c1, c2 := dial(), dial()
+
+	send(t, c1, 1, "/one/wait", "a")
+	<-one.started
+	// the next request of the connection waits for the first, its connection is not read meanwhile.
+	written := make(chan struct{})
+	go func() {
+		c1.WriteRequest(&rpc.Request{Seq: 2, ServiceMethod: "/one/wait"}, "b")
+		close(written)
+	}()
+	// the other connections go on.
+	send(t, c2, 1, "/two/wait", "c")
+	<-two.started
+	select {
+	case arg := <-one.started:
+		t.Fatalf("expect %s not to start before the first request of its connection is answered", arg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	two.release <- struct{}{}
+	if resp := receive(t, c2, nil); resp.Error != "" || resp.Seq != 1 {
+		t.Fatalf("expect the request of the other connection to be answered, got %+v", resp)
+	}
+
+	close(one.release)
+	<-written
+	for seq := uint64(1); seq <= 2; seq++ {
+		var reply string
+		if resp := receive(t, c1, &reply); resp.Error != "" || resp.Seq != seq {
+			t.Fatalf("expect the requests to be answered in arrival order, got %+v", resp)
+		}
+	}
+	if arg := <-one.started; arg != "b" {
+		t.Fatalf("expect b to start after a, got %s", arg)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+func TestOnPanic(t *testing.T) {
+	type panicked struct {
+		path  string
+		p     interface{}
+		stack []byte
+	}
+	panics := make(chan panicked, 1)
+	srv := NewServer(Server{OnPanic: func(ctx *Context, p interface{}, stack []byte) {
+		panics <- panicked{ctx.Path(), p, stack}
+	}})
+	srv.NamedRegister("test", newBlocker())
+	c := serve(t, srv)()
+
+	for _, test := range []struct {
+		name string
+		call func() common.ErrorType
+	}{
+		{"network", func() common.ErrorType {
+			send(t, c, 1, "/test/panic", "boom")
+			return errorType(receive(t, c, nil).Error)
+		}},
+		{"Invoke", func() common.ErrorType {
+			var reply string
+			if rpcErr := srv.Invoke("/test/panic", "boom", &reply, true); rpcErr != nil {
+				return rpcErr.Type
+			}
+			return 0
+		}},
+	} {
+		if errorType := test.call(); errorType != common.ErrorTypeServerServicePanic {
+			t.Fatalf("%s: expect the call to fail with a service panic, got the error type %d", test.name, errorType)
+		}
+		got := <-panics
+		if got.path != "/test/panic" || got.p != "boom" {
+			t.Fatalf("%s: expect OnPanic to get the panic of /test/panic, got %v of %s", test.name, got.p, got.path)
+		}
+		if !bytes.Contains(got.stack, []byte("(*Blocker).Panic")) {
+			t.Fatalf("%s: expect OnPanic to get the stack of the panic, got %q", test.name, got.stack)
+		}
+	}
+}
@@ -15,6 +15,12 @@ type (
 		Register(nodePath string, rcvr interface{}, metadata ...string) error
 	}
 
+	//IRegisterServicePlugin is called for each registered service method, with its arg and reply types.
+	// if returns error, the registration fails.
+	IRegisterServicePlugin interface {
+		RegisterService(info ServiceInfo) error
+	}
+
 	//IPostConnAcceptPlugin is connection accept plugin.
 	// if returns error, it means subsequent IPostConnAcceptPlugins should not contiune to handle this conn
 	// and this conn has been closed.
@@ -22,6 +28,12 @@ type (
 		PostConnAccept(ServerCodecConn) error
 	}
 
+	//IPostDisconnectPlugin is connection close plugin.
+	// It is called after the server stops serving the conn, the conn.Stats() are final.
+	IPostDisconnectPlugin interface {
+		PostDisconnect(ServerCodecConn) error
+	}
+
 	//IPreReadRequestHeaderPlugin means as its name.
 	IPreReadRequestHeaderPlugin interface {
 		PreReadRequestHeader(*Context) error
@@ -32,6 +44,15 @@ type (
 		PostReadRequestHeader(*Context) error
 	}
 
+	//IRouteRequestPlugin routes the requests on their header only, e.g. for a reverse proxy,
+	// after the PostReadRequestHeader plugins and before the service is looked up and the body is read.
+	// It returns the RouteHandler that handles the request in place of its service, or nil to let the server handle it,
+	// so the service path of a routed request needs not be registered.
+	// If it returns an error, the request is rejected without its body being decoded.
+	IRouteRequestPlugin interface {
+		RouteRequest(*Context) (RouteHandler, error)
+	}
+
 	//IPreReadRequestBodyPlugin means as its name.
 	IPreReadRequestBodyPlugin interface {
 		PreReadRequestBody(ctx *Context, body interface{}) error
@@ -58,11 +79,14 @@ type (
 		plugin.IPluginContainer
 
 		doRegister(nodePath string, rcvr interface{}, metadata ...string) error
+		doRegisterService(info ServiceInfo) error
 
 		doPostConnAccept(ServerCodecConn) error
+		doPostDisconnect(ServerCodecConn) error
 
 		doPreReadRequestHeader(*Context) error
 		doPostReadRequestHeader(*Context) error
+		doRouteRequest(*Context) (RouteHandler, error)
 
 		doPreReadRequestBody(ctx *Context, body interface{}) error
 		doPostReadRequestBody(ctx *Context, body interface{}) error
@@ -80,14 +104,17 @@ type ServerPluginContainer struct {
 var _ IServerPluginContainer = new(ServerPluginContainer)
 
 // doRegister invokes doRegister plugin.
+// The panic of a plugin is collected with the errors of the others, see plugin.PluginContainer.Run.
 func (p *ServerPluginContainer) doRegister(nodePath string, rcvr interface{}, metadata ...string) error {
 	var errors []error
 	for i := range p.Plugins {
-
-		if plugin, ok := p.Plugins[i].(IRegisterPlugin); ok {
-			err := plugin.Register(nodePath, rcvr, metadata...)
+		if plugin, ok := p.Plugins[i].(IRegisterPlugin); ok && p.Enabled(i) {
+			err := p.Run("Register", i, func() error {
+				return plugin.Register(nodePath, rcvr, metadata...)
+			})
 			if err != nil {
-				errors = append(errors, common.ErrRegisterPlugin.Format(p.Plugins[i].Name(), err.Error()))
+				name := p.Plugins[i].Name()
+				errors = append(errors, &common.RegisterError{Path: nodePath, Plugin: name, Err: common.ErrRegisterPlugin.Format(name, err)})
 			}
 		}
 	}
@@ -98,28 +125,72 @@ func (p *ServerPluginContainer) doRegister(nodePath string, rcvr interface{}, me
 	return nil
 }
 
-//doPostConnAccept handles accepted conn
-func (p *ServerPluginContainer) doPostConnAccept(conn ServerCodecConn) error {
-	var err error
+// doRegisterService invokes doRegisterService plugin.
+// The panic of a plugin is collected with the errors of the others, see plugin.PluginContainer.Run.
+func (p *ServerPluginContainer) doRegisterService(info ServiceInfo) error {
+	var errors []error
 	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostConnAcceptPlugin); ok {
+		if plugin, ok := p.Plugins[i].(IRegisterServicePlugin); ok && p.Enabled(i) {
+			err := p.Run("RegisterService", i, func() error {
+				return plugin.RegisterService(info)
+			})
+			if err != nil {
+				name := p.Plugins[i].Name()
+				errors = append(errors, &common.RegisterError{Path: info.Path, Plugin: name, Err: common.ErrRegisterServicePlugin.Format(name, err)})
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return common.NewMultiError(errors)
+	}
+	return nil
+}
+
+//doPostConnAccept handles accepted conn
+func (p *ServerPluginContainer) doPostConnAccept(conn ServerCodecConn) (err error) {
+	var i int
+	defer p.Recover("PostConnAccept", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostConnAcceptPlugin); ok && p.Enabled(i) {
 			err = plugin.PostConnAccept(conn)
 			if err != nil { //interrupt
 				conn.Close()
-				return common.ErrPostConnAccept.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPostConnAccept.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
 	return nil
 }
 
-// doPreReadRequestHeader invokes doPreReadRequestHeader plugin.
-func (p *ServerPluginContainer) doPreReadRequestHeader(ctx *Context) error {
+//doPostDisconnect handles closed conn
+// The panic of a plugin is collected with the errors of the others, see plugin.PluginContainer.Run.
+func (p *ServerPluginContainer) doPostDisconnect(conn ServerCodecConn) error {
+	var errors []error
 	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPreReadRequestHeaderPlugin); ok {
+		if plugin, ok := p.Plugins[i].(IPostDisconnectPlugin); ok && p.Enabled(i) {
+			err := p.Run("PostDisconnect", i, func() error {
+				return plugin.PostDisconnect(conn)
+			})
+			if err != nil {
+				errors = append(errors, common.ErrPostDisconnect.Format(p.Plugins[i].Name(), err))
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return common.NewMultiError(errors)
+	}
+	return nil
+}
+
+// doPreReadRequestHeader invokes doPreReadRequestHeader plugin.
+func (p *ServerPluginContainer) doPreReadRequestHeader(ctx *Context) (err error) {
+	var i int
+	defer p.Recover("PreReadRequestHeader", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPreReadRequestHeaderPlugin); ok && p.Enabled(i) {
 			err := plugin.PreReadRequestHeader(ctx)
 			if err != nil {
-				return common.ErrPreReadRequestHeader.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPreReadRequestHeader.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
@@ -128,12 +199,14 @@ func (p *ServerPluginContainer) doPreReadRequestHeader(ctx *Context) error {
 }
 
 // doPostReadRequestHeader invokes doPostReadRequestHeader plugin.
-func (p *ServerPluginContainer) doPostReadRequestHeader(ctx *Context) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostReadRequestHeaderPlugin); ok {
+func (p *ServerPluginContainer) doPostReadRequestHeader(ctx *Context) (err error) {
+	var i int
+	defer p.Recover("PostReadRequestHeader", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostReadRequestHeaderPlugin); ok && p.Enabled(i) {
 			err := plugin.PostReadRequestHeader(ctx)
 			if err != nil {
-				return common.ErrPostReadRequestHeader.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPostReadRequestHeader.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
@@ -141,13 +214,34 @@ func (p *ServerPluginContainer) doPostReadRequestHeader(ctx *Context) error {
 	return nil
 }
 
+// doRouteRequest invokes doRouteRequest plugin, the first RouteHandler returned is used.
+func (p *ServerPluginContainer) doRouteRequest(ctx *Context) (_ RouteHandler, err error) {
+	var i int
+	defer p.Recover("RouteRequest", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IRouteRequestPlugin); ok && p.Enabled(i) {
+			handler, err := plugin.RouteRequest(ctx)
+			if err != nil {
+				return nil, common.ErrRouteRequest.Format(p.Plugins[i].Name(), err)
+			}
+			if handler != nil {
+				return handler, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
 // doPreReadRequestBody invokes doPreReadRequestBody plugin.
-func (p *ServerPluginContainer) doPreReadRequestBody(ctx *Context, body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPreReadRequestBodyPlugin); ok {
+func (p *ServerPluginContainer) doPreReadRequestBody(ctx *Context, body interface{}) (err error) {
+	var i int
+	defer p.Recover("PreReadRequestBody", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPreReadRequestBodyPlugin); ok && p.Enabled(i) {
 			err := plugin.PreReadRequestBody(ctx, body)
 			if err != nil {
-				return common.ErrPreReadRequestBody.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPreReadRequestBody.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
@@ -156,12 +250,14 @@ func (p *ServerPluginContainer) doPreReadRequestBody(ctx *Context, body interfac
 }
 
 // doPostReadRequestBody invokes doPostReadRequestBody plugin.
-func (p *ServerPluginContainer) doPostReadRequestBody(ctx *Context, body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostReadRequestBodyPlugin); ok {
+func (p *ServerPluginContainer) doPostReadRequestBody(ctx *Context, body interface{}) (err error) {
+	var i int
+	defer p.Recover("PostReadRequestBody", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostReadRequestBodyPlugin); ok && p.Enabled(i) {
 			err := plugin.PostReadRequestBody(ctx, body)
 			if err != nil {
-				return common.ErrPostReadRequestBody.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPostReadRequestBody.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
@@ -170,12 +266,14 @@ func (p *ServerPluginContainer) doPostReadRequestBody(ctx *Context, body interfa
 }
 
 // doPreWriteResponse invokes doPreWriteResponse plugin.
-func (p *ServerPluginContainer) doPreWriteResponse(ctx *Context, body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPreWriteResponsePlugin); ok {
+func (p *ServerPluginContainer) doPreWriteResponse(ctx *Context, body interface{}) (err error) {
+	var i int
+	defer p.Recover("PreWriteResponse", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPreWriteResponsePlugin); ok && p.Enabled(i) {
 			err := plugin.PreWriteResponse(ctx, body)
 			if err != nil {
-				return common.ErrPreWriteResponse.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPreWriteResponse.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
@@ -184,12 +282,14 @@ func (p *ServerPluginContainer) doPreWriteResponse(ctx *Context, body interface{
 }
 
 // doPostWriteResponse invokes doPostWriteResponse plugin.
-func (p *ServerPluginContainer) doPostWriteResponse(ctx *Context, body interface{}) error {
-	for i := range p.Plugins {
-		if plugin, ok := p.Plugins[i].(IPostWriteResponsePlugin); ok {
+func (p *ServerPluginContainer) doPostWriteResponse(ctx *Context, body interface{}) (err error) {
+	var i int
+	defer p.Recover("PostWriteResponse", &i, &err)
+	for i = range p.Plugins {
+		if plugin, ok := p.Plugins[i].(IPostWriteResponsePlugin); ok && p.Enabled(i) {
 			err := plugin.PostWriteResponse(ctx, body)
 			if err != nil {
-				return common.ErrPostWriteResponse.Format(p.Plugins[i].Name(), err.Error())
+				return common.ErrPostWriteResponse.Format(p.Plugins[i].Name(), err)
 			}
 		}
 	}
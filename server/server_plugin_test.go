@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/plugin"
+)
+
+type Echo struct{}
+
+func (*Echo) Echo(arg string, reply *string) error {
+	*reply = arg
+	return nil
+}
+
+// panicPlugin panics in its hooks, and fails the registrations with err, if it is not nil.
+type panicPlugin struct {
+	name string
+	err  error
+}
+
+func (p *panicPlugin) Name() string { return p.name }
+
+func (p *panicPlugin) PostReadRequestHeader(ctx *Context) error {
+	panic("boom")
+}
+
+func (p *panicPlugin) Register(nodePath string, rcvr interface{}, metadata ...string) error {
+	if p.err != nil {
+		return p.err
+	}
+	panic("boom")
+}
+
+func TestPluginPanic(t *testing.T) {
+	srv := NewServer(Server{
+		PluginContainer: &ServerPluginContainer{PluginContainer: plugin.PluginContainer{MaxPanics: 2}},
+	})
+	srv.NamedRegister("test", new(Echo))
+	srv.PluginContainer.Add(&panicPlugin{name: "broken"})
+
+	var reply string
+	for n := 0; n < 2; n++ {
+		rpcErr := srv.Invoke("/test/echo", "hello", &reply, true)
+		if rpcErr == nil || rpcErr.Type != common.ErrorTypeServerPostReadRequestHeader {
+			t.Fatalf("expect the panic to fail the request in PostReadRequestHeader, got %v", rpcErr)
+		}
+		if !strings.Contains(rpcErr.Error, "'broken' panicked in PostReadRequestHeader: boom") {
+			t.Fatalf("expect the error to name the plugin, got %q", rpcErr.Error)
+		}
+	}
+	// the plugin is disabled after MaxPanics panics.
+	if rpcErr := srv.Invoke("/test/echo", "hello", &reply, true); rpcErr != nil || reply != "hello" {
+		t.Fatalf("expect the disabled plugin to be skipped, got %q, %v", reply, rpcErr)
+	}
+}
+
+func TestRegisterPluginPanic(t *testing.T) {
+	p := new(ServerPluginContainer)
+	p.Add(&panicPlugin{name: "broken"}, &panicPlugin{name: "failing", err: errors.New("rejected")})
+	err := p.doRegister("/test", new(Echo))
+	var multi *common.MultiError
+	if !errors.As(err, &multi) || len(multi.Errors()) != 2 {
+		t.Fatalf("expect the errors of both plugins, got %v", err)
+	}
+	if !errors.Is(err, common.ErrPluginPanic) || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("expect the panic and the error of the plugins, got %v", err)
+	}
+}
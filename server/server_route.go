@@ -0,0 +1,73 @@
+package server
+
+import (
+	"reflect"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+// RouteHandler handles a request routed by an IRouteRequestPlugin, in place of its service,
+// e.g. replies it at once, or forwards it upstream.
+// body is the request body as read from the connection if the codec implements RawBodyCodec, otherwise it is nil,
+// the body is never decoded. It is also returned by ctx.RawBody and ctx.Args.
+// reply is written as the response like the reply of a service, the JSON codecs write a json.RawMessage as it is.
+type RouteHandler func(ctx *Context, body []byte) (reply interface{}, err error)
+
+// routeService is the service of a routed request.
+type routeService struct {
+	path    string
+	handler RouteHandler
+}
+
+var _ IService = new(routeService)
+
+// routePlugins are the service plugins of the routed requests, none.
+var routePlugins = new(ServerPluginContainer)
+
+var typeOfBytes = reflect.TypeOf([]byte(nil))
+
+func (s *routeService) SetPluginContainer(IServerPluginContainer) {}
+
+func (s *routeService) GetPluginContainer() IServerPluginContainer {
+	return routePlugins
+}
+
+func (s *routeService) GetPath() string {
+	return s.path
+}
+
+func (s *routeService) GetArgType() reflect.Type {
+	return typeOfBytes
+}
+
+func (s *routeService) Call(argv reflect.Value, ctx *Context) (reflect.Value, error) {
+	reply, err := s.handler(ctx, argv.Interface().([]byte))
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if reply == nil {
+		reply = invalidRequest
+	}
+	return reflect.ValueOf(reply), nil
+}
+
+// readRouteBody reads the body of a routed request without decoding it.
+// The body plugins are not run, there is no decoded body.
+func (ctx *Context) readRouteBody() error {
+	var raw []byte
+	var err error
+	if codec, ok := ctx.codecConn.GetServerCodec().(RawBodyCodec); ok {
+		raw, err = codec.ReadRequestBodyRaw()
+	} else {
+		err = ctx.codecConn.ReadRequestBody(nil)
+	}
+	if err != nil {
+		ctx.rpcErrorType = common.ErrorTypeServerReadRequestBody
+		return common.NewError("ReadRequestBody: " + err.Error())
+	}
+	ctx.Lock()
+	ctx.rawBody = raw
+	ctx.argv = reflect.ValueOf(raw)
+	ctx.Unlock()
+	return nil
+}
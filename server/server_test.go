@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"testing"
+	"time"
+
+	codecGob "github.com/henrylee2cn/myrpc/codec/gob"
+	"github.com/henrylee2cn/myrpc/memnet"
+)
+
+// Blocker is a service whose calls of Wait block until they are released.
+type Blocker struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlocker() *Blocker {
+	return &Blocker{started: make(chan string, 16), release: make(chan struct{})}
+}
+
+// Wait signals that the call of arg started, and replies arg once a call is released.
+func (b *Blocker) Wait(arg string, reply *string) error {
+	b.started <- arg
+	<-b.release
+	*reply = arg
+	return nil
+}
+
+// Fail fails at once.
+func (b *Blocker) Fail(arg string, reply *string) error {
+	return errors.New("failed")
+}
+
+// Panic panics with arg.
+func (b *Blocker) Panic(arg string, reply *string) error {
+	panic(arg)
+}
+
+// serve serves srv on an in-memory listener until the end of the test,
+// and returns a function opening a connection to it with the gob codec.
+func serve(t *testing.T, srv *Server) func() rpc.ClientCodec {
+	address := t.Name()
+	lis, err := memnet.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeListener(lis)
+	t.Cleanup(func() {
+		// the connections, closed by their own cleanups, are done reading before the server is closed.
+		for deadline := time.Now().Add(time.Second); len(srv.Conns()) > 0 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.close(ctx)
+	})
+	return func() rpc.ClientCodec {
+		conn, err := memnet.Dial(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := codecGob.NewGobClientCodec(conn)
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+}
+
+// idle waits until the responses of the connections of srv are all written, and their requests released.
+func idle(t *testing.T, srv *Server) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		pending := 0
+		for _, conn := range srv.Conns() {
+			pending += conn.Stats().Pending()
+		}
+		if pending == 0 {
+			return
+		}
+	}
+	t.Fatal("expect the requests in progress to be done")
+}
+
+// send writes the request of seq.
+func send(t *testing.T, c rpc.ClientCodec, seq uint64, serviceMethod string, args interface{}) {
+	if err := c.WriteRequest(&rpc.Request{Seq: seq, ServiceMethod: serviceMethod}, args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive reads the next response into reply, which is left as is if the response is an error.
+func receive(t *testing.T, c rpc.ClientCodec, reply interface{}) *rpc.Response {
+	resp := new(rpc.Response)
+	if err := c.ReadResponseHeader(resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" {
+		reply = nil
+	}
+	if err := c.ReadResponseBody(reply); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
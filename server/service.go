@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"reflect"
 	"sync"
 	"unicode"
@@ -44,6 +45,7 @@ type (
 		method          reflect.Method
 		ArgType         reflect.Type
 		ReplyType       reflect.Type
+		ctxType         reflect.Type // type of the first parameter, *Context or context.Context, nil if none
 		numCalls        uint
 		sync.Mutex      // protects counters
 		pluginContainer IServerPluginContainer
@@ -85,13 +87,13 @@ func (n *NormService) GetArgType() reflect.Type {
 	return n.ArgType
 }
 
-// // GetReplyType returns the receiver type of request body.
-// func (n *NormService) GetReplyType() reflect.Type {
-// 	return n.ReplyType
-// }
+// GetReplyType returns the receiver type of response body.
+func (n *NormService) GetReplyType() reflect.Type {
+	return n.ReplyType
+}
 
 // Call calls service method, and returns response result.
-func (n *NormService) Call(argv reflect.Value, _ *Context) (replyv reflect.Value, err error) {
+func (n *NormService) Call(argv reflect.Value, ctx *Context) (replyv reflect.Value, err error) {
 	n.Lock()
 	n.numCalls++
 	n.Unlock()
@@ -109,8 +111,15 @@ func (n *NormService) Call(argv reflect.Value, _ *Context) (replyv reflect.Value
 	}
 
 	function := n.method.Func
+	in := []reflect.Value{n.rcvr, argv, replyv}
+	switch n.ctxType {
+	case typeOfContext:
+		in = []reflect.Value{n.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	case typeOfStdContext:
+		in = []reflect.Value{n.rcvr, reflect.ValueOf(ctx.StdContext()), argv, replyv}
+	}
 	// Invoke the method, providing a new value for the reply.
-	returnValues := function.Call([]reflect.Value{n.rcvr, argv, replyv})
+	returnValues := function.Call(in)
 	// The return value for the method is an error.
 	errInter := returnValues[0].Interface()
 	if errInter != nil {
@@ -124,6 +133,11 @@ func (n *NormService) GetPath() string {
 	return n.path
 }
 
+// GetMethodName returns the name of the receiver's method.
+func (n *NormService) GetMethodName() string {
+	return n.method.Name
+}
+
 // Is this an exported - upper case - name?
 func isExported(name string) bool {
 	rune, _ := utf8.DecodeRuneInString(name)
@@ -144,8 +158,15 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 // because Typeof takes an empty interface value. This is annoying.
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
 
+// The types of the optional first parameter of the methods.
+var (
+	typeOfContext    = reflect.TypeOf((*Context)(nil))
+	typeOfStdContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 // suitableMethods returns suitable Rpc methods of typ, it will report
 // error using log if reportErr is true.
+// The methods may take a *Context or a context.Context before args, to access the request.
 func (*NormServiceBuilder) suitableMethods(typ reflect.Type, reportErr bool) map[string]*NormService {
 	methods := make(map[string]*NormService)
 	for m := 0; m < typ.NumMethod(); m++ {
@@ -156,15 +177,27 @@ func (*NormServiceBuilder) suitableMethods(typ reflect.Type, reportErr bool) map
 		if method.PkgPath != "" {
 			continue
 		}
-		// Method needs three ins: receiver, *args, *reply.
-		if mtype.NumIn() != 3 {
+		// Method needs three ins: receiver, *args, *reply, or four with a context first.
+		var ctxType reflect.Type
+		switch mtype.NumIn() {
+		case 3:
+		case 4:
+			ctxType = mtype.In(1)
+			if ctxType != typeOfContext && ctxType != typeOfStdContext {
+				if reportErr {
+					// log.Notice("rpc: method", mname, "context type not *server.Context or context.Context:", ctxType)
+				}
+				continue
+			}
+		default:
 			if reportErr {
 				// log.Notice("rpc: method", mname, "has wrong number of ins:", mtype.NumIn())
 			}
 			continue
 		}
+		in := mtype.NumIn() - 2
 		// First arg need not be a pointer.
-		argType := mtype.In(1)
+		argType := mtype.In(in)
 		if !isExportedOrBuiltinType(argType) {
 			if reportErr {
 				// log.Notice("rpc:", mname, "argument type not exported:", argType)
@@ -172,7 +205,7 @@ func (*NormServiceBuilder) suitableMethods(typ reflect.Type, reportErr bool) map
 			continue
 		}
 		// Second arg must be a pointer.
-		replyType := mtype.In(2)
+		replyType := mtype.In(in + 1)
 		if replyType.Kind() != reflect.Ptr {
 			if reportErr {
 				// log.Notice("rpc: method", mname, "reply type not a pointer:", replyType)
@@ -200,7 +233,7 @@ func (*NormServiceBuilder) suitableMethods(typ reflect.Type, reportErr bool) map
 			}
 			continue
 		}
-		methods[mname] = &NormService{method: method, ArgType: argType, ReplyType: replyType}
+		methods[mname] = &NormService{method: method, ArgType: argType, ReplyType: replyType, ctxType: ctxType}
 	}
 	return methods
 }
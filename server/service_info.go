@@ -0,0 +1,68 @@
+package server
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ServiceInfo describes a registered service.
+type ServiceInfo struct {
+	// Path is the service method path.
+	Path string
+	// Metadata is the metadata passed to Register, followed by the base metadata.
+	Metadata []string
+	// ArgType is the type of request body.
+	ArgType reflect.Type
+	// ReplyType is the type of response body, it is nil if the service does not know it.
+	ReplyType reflect.Type
+	// Plugins is the names of the plugins attached to the service.
+	Plugins []string
+}
+
+// IReplyTyper is implemented by the IService that knows the type of its response body.
+type IReplyTyper interface {
+	GetReplyType() reflect.Type
+}
+
+// ServiceInfo returns the information of the service registered at path.
+func (server *Server) ServiceInfo(path string) (ServiceInfo, bool) {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	service, ok := server.serviceMap[path]
+	if !ok {
+		return ServiceInfo{}, false
+	}
+	return server.serviceInfo(service), true
+}
+
+// ServiceInfos returns the information of all registered services, sorted by path.
+func (server *Server) ServiceInfos() []ServiceInfo {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	infos := make([]ServiceInfo, 0, len(server.serviceMap))
+	for _, service := range server.serviceMap {
+		infos = append(infos, server.serviceInfo(service))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Path < infos[j].Path
+	})
+	return infos
+}
+
+func (server *Server) serviceInfo(service IService) ServiceInfo {
+	path := service.GetPath()
+	info := ServiceInfo{
+		Path:     path,
+		Metadata: append([]string(nil), server.metadataMap[path]...),
+		ArgType:  service.GetArgType(),
+	}
+	if typer, ok := service.(IReplyTyper); ok {
+		info.ReplyType = typer.GetReplyType()
+	}
+	if p := service.GetPluginContainer(); p != nil {
+		for _, plugin := range p.GetAll() {
+			info.Plugins = append(info.Plugins, plugin.Name())
+		}
+	}
+	return info
+}
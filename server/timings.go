@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// Timings are the durations of the stages of serving a request, see Context.Timings,
+// e.g. to attribute the latency of the slow requests, see Server.SlowThreshold.
+// The time waiting in between, e.g. for the Scheduler or for the write queue, is in none of them.
+type Timings struct {
+	// HeaderDecode is the time reading and decoding the request header,
+	// from the arrival of its first bytes, or from the end of the previous request if they were buffered.
+	HeaderDecode time.Duration
+	// BodyDecode is the time reading and decoding the request body, including its decoding by LazyBody.
+	BodyDecode time.Duration
+	// Handler is the time of the service method.
+	Handler time.Duration
+	// Encode is the time encoding the response, which writes it unless it is corked.
+	Encode time.Duration
+	// Flush is the time writing the response held back by the codec, 0 if it is delayed, see Context.DelayFlush.
+	Flush time.Duration
+}
+
+// Total returns the sum of the stages.
+func (t Timings) Total() time.Duration {
+	return t.HeaderDecode + t.BodyDecode + t.Handler + t.Encode + t.Flush
+}
+
+func (t Timings) String() string {
+	return fmt.Sprintf("header %s, body %s, handler %s, encode %s, flush %s",
+		t.HeaderDecode, t.BodyDecode, t.Handler, t.Encode, t.Flush)
+}
+
+// Timings returns the durations of the stages of the request served so far,
+// complete in the PostWriteResponse plugins.
+func (ctx *Context) Timings() Timings {
+	return ctx.timings
+}
+
+// now returns the time on the clock of the ConnStats of ctx, that of the arrival of its request, see Server.Clock.
+func (ctx *Context) now() time.Time {
+	return ctx.codecConn.Stats().clock.Now()
+}
+
+// logSlow logs the request served in ctx if it is slower than SlowThreshold.
+func (server *Server) logSlow(ctx *Context) {
+	if server.SlowThreshold <= 0 {
+		return
+	}
+	elapsed := ctx.now().Sub(ctx.started)
+	if elapsed < server.SlowThreshold {
+		return
+	}
+	log.Warnf("rpc: slow request %s (seq %d) from %s: %s, %s in the stages: %s",
+		ctx.req.ServiceMethod, ctx.req.Seq, ctx.RemoteAddr(), elapsed, ctx.timings.Total(), ctx.timings.String())
+}
@@ -18,23 +18,30 @@ type URIFormator interface {
 }
 
 // URLFormat implements a URIFormator in URL format.
-type URLFormat struct{}
+type URLFormat struct {
+	// Naming maps the path segments, e.g. to snake case.
+	// If it is nil, common.DefaultNaming is used.
+	Naming common.NamingStrategy
+}
 
 // URIEncode encode the parmaters to uri.
 func (u *URLFormat) URIEncode(query url.Values, pathSegment ...string) (uri string) {
-	for i := len(pathSegment) - 1; i >= 0; i-- {
-		pathSegment[i] = common.SnakeString(pathSegment[i])
+	naming := u.Naming
+	if naming == nil {
+		naming = common.DefaultNaming
 	}
-	sm := url.URL{
-		Path: path.Join(pathSegment...),
+	for i := len(pathSegment) - 1; i >= 0; i-- {
+		pathSegment[i] = naming.Segment(pathSegment[i])
 	}
-	if !strings.HasPrefix(sm.Path, "/") {
-		sm.Path = "/" + sm.Path
+	uri = path.Join(pathSegment...)
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
 	}
+	// the path is not escaped, as URIParse unescapes it, e.g. of the names in other scripts than latin.
 	if len(query) != 0 {
-		sm.RawQuery = query.Encode()
+		uri += "?" + query.Encode()
 	}
-	return sm.String()
+	return uri
 }
 
 // URIParse parses URI and returns parmaters(path and query).
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// Watchdog protects a server from exhausting its Go runtime. It checks the goroutines, the heap and the GC pauses
+// periodically, and trips a degraded mode while any of them exceeds its limit:
+// the low priority requests are shed, the PoolScheduler of the server runs fewer workers,
+// and the new connections are refused, until the runtime stays under the limits for RecoverAfter.
+// A Watchdog serves one Server, see Server.Watchdog.
+type Watchdog struct {
+	// MaxGoroutines, if it is not 0, is the number of goroutines above which the server is degraded.
+	MaxGoroutines int
+	// MaxHeap, if it is not 0, is the number of bytes of allocated heap objects above which the server is degraded.
+	MaxHeap uint64
+	// MaxGCPause, if it is not 0, is the GC pause above which the server is degraded,
+	// the longest pause since the previous check is compared.
+	MaxGCPause time.Duration
+	// Interval is how often the runtime is checked.
+	// If it is 0, 1s is used.
+	Interval time.Duration
+	// RecoverAfter is how long the runtime stays under the limits before the degraded mode ends.
+	// If it is 0, 3 times Interval is used.
+	RecoverAfter time.Duration
+	// LowPriority reports whether the request of ctx, whose header is read, is shed in degraded mode.
+	// The requests shed get an error of type common.ErrorTypeServerOverloaded.
+	// If it is nil, no request is shed.
+	LowPriority func(ctx *Context) bool
+	// DegradedWorkers, if it is not 0, is the number of workers of the PoolScheduler of the server in degraded mode.
+	DegradedWorkers int
+	// RefuseConns closes the connections accepted in degraded mode.
+	RefuseConns bool
+	// OnEvent, if it is not nil, is called with each event, in the goroutine of the watchdog.
+	OnEvent func(WatchdogEvent)
+
+	degraded     int32 // atomic
+	shedRequests uint64
+	refusedConns uint64
+	stats        WatchdogStats
+	lastExceeded time.Time
+	stop         chan struct{}
+	mu           sync.Mutex
+}
+
+// RuntimeSample is the state of the Go runtime checked by a Watchdog.
+type RuntimeSample struct {
+	Time       time.Time
+	Goroutines int
+	// Heap is the number of bytes of allocated heap objects.
+	Heap uint64
+	// GCPause is the longest GC pause since the previous check.
+	GCPause time.Duration
+}
+
+// WatchdogEventType is the type of a WatchdogEvent.
+type WatchdogEventType int
+
+const (
+	// WatchdogTripped means the server entered the degraded mode.
+	WatchdogTripped WatchdogEventType = iota
+	// WatchdogRecovered means the server left the degraded mode.
+	WatchdogRecovered
+)
+
+func (t WatchdogEventType) String() string {
+	if t == WatchdogTripped {
+		return "tripped"
+	}
+	return "recovered"
+}
+
+// WatchdogEvent is a change of the mode of a server.
+type WatchdogEvent struct {
+	Type   WatchdogEventType
+	Sample RuntimeSample
+	// Reason is the limit exceeded when the watchdog tripped.
+	Reason string
+}
+
+// WatchdogStats holds the counters of a Watchdog.
+type WatchdogStats struct {
+	Degraded bool
+	// Since is the time when the current mode began.
+	Since time.Time
+	// Sample is the last state of the runtime checked.
+	Sample       RuntimeSample
+	Trips        uint64
+	ShedRequests uint64
+	RefusedConns uint64
+	// Events are the last events, the oldest first.
+	Events []WatchdogEvent
+}
+
+// maxWatchdogEvents is the number of events kept in the stats.
+const maxWatchdogEvents = 32
+
+// Degraded reports whether the server is in degraded mode.
+func (w *Watchdog) Degraded() bool {
+	return w != nil && atomic.LoadInt32(&w.degraded) != 0
+}
+
+// Stats returns the counters and the last events of the watchdog.
+func (w *Watchdog) Stats() WatchdogStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	stats.Degraded = w.Degraded()
+	stats.ShedRequests = atomic.LoadUint64(&w.shedRequests)
+	stats.RefusedConns = atomic.LoadUint64(&w.refusedConns)
+	stats.Events = append([]WatchdogEvent(nil), w.stats.Events...)
+	return stats
+}
+
+// start starts checking the runtime for server.
+func (w *Watchdog) start(server *Server) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.stats.Since = server.Clock.Now()
+	go w.run(server, w.stop)
+}
+
+// close stops checking the runtime.
+func (w *Watchdog) close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+func (w *Watchdog) run(server *Server, stop chan struct{}) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	recoverAfter := w.RecoverAfter
+	if recoverAfter <= 0 {
+		recoverAfter = 3 * interval
+	}
+	_, numGC := readRuntime(server.Clock.Now(), 0)
+	for {
+		timer := server.Clock.NewTimer(interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		var sample RuntimeSample
+		sample, numGC = readRuntime(server.Clock.Now(), numGC)
+		w.check(server, sample, recoverAfter)
+	}
+}
+
+// readRuntime samples the runtime at now, with the GC pauses after the GC numGC.
+func readRuntime(now time.Time, numGC uint32) (RuntimeSample, uint32) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	sample := RuntimeSample{
+		Time:       now,
+		Goroutines: runtime.NumGoroutine(),
+		Heap:       m.HeapAlloc,
+	}
+	n := m.NumGC - numGC
+	if n > uint32(len(m.PauseNs)) {
+		n = uint32(len(m.PauseNs))
+	}
+	for i := uint32(0); i < n; i++ {
+		// PauseNs[(NumGC+255)%256] is the most recent pause.
+		pause := time.Duration(m.PauseNs[(m.NumGC-i+255)%256])
+		if pause > sample.GCPause {
+			sample.GCPause = pause
+		}
+	}
+	return sample, m.NumGC
+}
+
+// exceeded returns the limit exceeded by sample, or "".
+func (w *Watchdog) exceeded(sample RuntimeSample) string {
+	switch {
+	case w.MaxGoroutines > 0 && sample.Goroutines > w.MaxGoroutines:
+		return fmt.Sprintf("%d goroutines exceed %d", sample.Goroutines, w.MaxGoroutines)
+	case w.MaxHeap > 0 && sample.Heap > w.MaxHeap:
+		return fmt.Sprintf("heap of %d bytes exceeds %d", sample.Heap, w.MaxHeap)
+	case w.MaxGCPause > 0 && sample.GCPause > w.MaxGCPause:
+		return fmt.Sprintf("GC pause of %s exceeds %s", sample.GCPause, w.MaxGCPause)
+	}
+	return ""
+}
+
+// check trips or ends the degraded mode after sample.
+func (w *Watchdog) check(server *Server, sample RuntimeSample, recoverAfter time.Duration) {
+	reason := w.exceeded(sample)
+	w.mu.Lock()
+	w.stats.Sample = sample
+	var event *WatchdogEvent
+	if reason != "" {
+		w.lastExceeded = sample.Time
+		if !w.Degraded() {
+			event = &WatchdogEvent{Type: WatchdogTripped, Sample: sample, Reason: reason}
+			w.stats.Trips++
+			atomic.StoreInt32(&w.degraded, 1)
+		}
+	} else if w.Degraded() && sample.Time.Sub(w.lastExceeded) >= recoverAfter {
+		event = &WatchdogEvent{Type: WatchdogRecovered, Sample: sample}
+		atomic.StoreInt32(&w.degraded, 0)
+	}
+	if event != nil {
+		w.stats.Since = sample.Time
+		if len(w.stats.Events) == maxWatchdogEvents {
+			w.stats.Events = append(w.stats.Events[:0], w.stats.Events[1:]...)
+		}
+		w.stats.Events = append(w.stats.Events, *event)
+	}
+	w.mu.Unlock()
+	if event == nil {
+		return
+	}
+	if pool, ok := server.Scheduler.(*PoolScheduler); ok && w.DegradedWorkers > 0 {
+		if event.Type == WatchdogTripped {
+			pool.SetLimit(w.DegradedWorkers)
+		} else {
+			pool.SetLimit(0)
+		}
+	}
+	if event.Type == WatchdogTripped {
+		log.Warnf("rpc: watchdog tripped the degraded mode: %s", reason)
+	} else {
+		log.Noticef("rpc: watchdog ended the degraded mode")
+	}
+	if w.OnEvent != nil {
+		w.OnEvent(*event)
+	}
+}
+
+// shed returns an error if the request of ctx is shed.
+func (w *Watchdog) shed(ctx *Context) error {
+	if w == nil || w.LowPriority == nil || !w.Degraded() || !w.LowPriority(ctx) {
+		return nil
+	}
+	atomic.AddUint64(&w.shedRequests, 1)
+	ctx.rpcErrorType = common.ErrorTypeServerOverloaded
+	return common.NewError("server overloaded, low priority request shed")
+}
+
+// refuse reports whether a connection just accepted is refused.
+func (w *Watchdog) refuse() bool {
+	if w == nil || !w.RefuseConns || !w.Degraded() {
+		return false
+	}
+	atomic.AddUint64(&w.refusedConns, 1)
+	return true
+}
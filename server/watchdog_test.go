@@ -0,0 +1,51 @@
+package server
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/sim"
+)
+
+func TestWatchdogClock(t *testing.T) {
+	clock := sim.New(1)
+	events := make(chan WatchdogEvent, 4)
+	w := &Watchdog{
+		MaxGoroutines: runtime.NumGoroutine() + 50,
+		Interval:      time.Second,
+		OnEvent:       func(event WatchdogEvent) { events <- event },
+	}
+	NewServer(Server{Watchdog: w, Clock: clock})
+	defer w.close()
+	if since := w.Stats().Since; !since.Equal(clock.Now()) {
+		t.Fatalf("expect the watchdog to start at the time of the clock, got %s", since)
+	}
+
+	block := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		go func() { <-block }()
+	}
+	clock.WaitTimers(1)
+	clock.Advance(time.Second)
+	if event := <-events; event.Type != WatchdogTripped || !event.Sample.Time.Equal(clock.Now()) {
+		t.Fatalf("expect the watchdog to trip at the time of the clock, got %+v", event)
+	}
+	close(block)
+	for runtime.NumGoroutine() > w.MaxGoroutines {
+		time.Sleep(time.Millisecond)
+	}
+	// the runtime stays under the limits for RecoverAfter, 3 intervals, before the degraded mode ends.
+	for i := 0; i < 2; i++ {
+		clock.WaitTimers(1)
+		clock.Advance(time.Second)
+	}
+	clock.WaitTimers(1)
+	if !w.Degraded() || len(events) != 0 {
+		t.Fatal("expect the watchdog to stay degraded before RecoverAfter")
+	}
+	clock.Advance(time.Second)
+	if event := <-events; event.Type != WatchdogRecovered || !event.Sample.Time.Equal(clock.Now()) {
+		t.Fatalf("expect the watchdog to recover after RecoverAfter, got %+v", event)
+	}
+}
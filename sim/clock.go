@@ -0,0 +1,91 @@
+package sim
+
+import (
+	"sort"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/common"
+)
+
+var _ common.Clock = new(Sim)
+
+// timer is a Timer of the simulated time, fired by Advance and by the latencies of the messages.
+type timer struct {
+	sim *Sim
+	at  time.Time
+	c   chan time.Time
+	f   func()
+}
+
+// NewTimer returns a Timer firing once the simulated time has advanced by d,
+// e.g. for the Clock of client.Client or of server.Server.
+func (s *Sim) NewTimer(d time.Duration) common.Timer {
+	return s.addTimer(d, nil)
+}
+
+// AfterFunc calls f in its own goroutine once the simulated time has advanced by d.
+func (s *Sim) AfterFunc(d time.Duration, f func()) common.Timer {
+	return s.addTimer(d, f)
+}
+
+func (s *Sim) addTimer(d time.Duration, f func()) *timer {
+	t := &timer{sim: s, f: f}
+	if f == nil {
+		t.c = make(chan time.Time, 1)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.at = s.now.Add(d)
+	if d <= 0 {
+		t.fire()
+		return t
+	}
+	s.timers = append(s.timers, t)
+	s.added.Broadcast()
+	return t
+}
+
+// WaitTimers waits until n timers at least are pending, e.g. until the goroutines of a test
+// wait for the simulated time before it advances, see Advance.
+func (s *Sim) WaitTimers(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.timers) < n {
+		s.added.Wait()
+	}
+}
+
+// fireTimers fires the timers due at the simulated time, in the order of their time. s.mu is held.
+func (s *Sim) fireTimers() {
+	sort.SliceStable(s.timers, func(i, j int) bool { return s.timers[i].at.Before(s.timers[j].at) })
+	n := 0
+	for ; n < len(s.timers) && !s.timers[n].at.After(s.now); n++ {
+		s.timers[n].fire()
+	}
+	s.timers = s.timers[n:]
+}
+
+func (t *timer) fire() {
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	t.c <- t.at
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	s := t.sim
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, pending := range s.timers {
+		if pending == t {
+			s.timers = append(s.timers[:i], s.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
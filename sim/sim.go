@@ -0,0 +1,215 @@
+// Package sim runs servers and clients over the in-memory network in a deterministic simulation:
+// the time, the network errors and the latencies are decided by a scheduler seeded at New,
+// so that retries and failover are tested without sleeps, and a failing seed replays the same run.
+//
+//	s := sim.New(seed)
+//	lis, _ := s.Listen("primary")
+//	go srv.ServeListener(lis)
+//	s.SetLink("primary", sim.Link{Latency: 5 * time.Millisecond, ErrorRate: 0.1})
+//	c := client.NewClient(client.Client{}, &selector.TieredSelector{
+//		Network: memnet.Network,
+//		Primary: []string{"primary"},
+//		Clock:   s,
+//	})
+//
+// The decisions are taken in the order of the dials and writes of the clients,
+// so a run is deterministic as long as the calls are made in turn by one goroutine.
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/memnet"
+)
+
+// Epoch is the simulated time at the start of a simulation.
+var Epoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ErrRefused is returned by the dials refused by a Link.
+	ErrRefused = errors.New("sim: connection refused")
+	// ErrReset is returned by the writes on a connection broken by a Link.
+	ErrReset = errors.New("sim: connection reset")
+)
+
+// Link are the conditions of the connections to an address.
+type Link struct {
+	// Latency is added to the simulated time by each message sent to the address.
+	Latency time.Duration
+	// Jitter is a random extra latency, up to Jitter.
+	Jitter time.Duration
+	// ErrorRate is the probability, in [0, 1], that a message breaks its connection.
+	ErrorRate float64
+	// RefuseRate is the probability, in [0, 1], that a dial is refused.
+	RefuseRate float64
+	// Down refuses the dials and breaks the connections.
+	Down bool
+}
+
+// Sim is a simulation, its zero value is not usable, see New.
+type Sim struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	now    time.Time
+	links  map[string]Link
+	log    []string
+	timers []*timer   // pending, see NewTimer
+	added  *sync.Cond // broadcast once a timer is added, see WaitTimers
+}
+
+// New creates a simulation whose decisions are seeded by seed.
+func New(seed int64) *Sim {
+	s := &Sim{
+		rand:  rand.New(rand.NewSource(seed)),
+		now:   Epoch,
+		links: make(map[string]Link),
+	}
+	s.added = sync.NewCond(&s.mu)
+	return s
+}
+
+// Now returns the simulated time.
+// A Sim is a common.Clock, e.g. for the Clock of client.Client or of server.Server.
+func (s *Sim) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// Advance moves the simulated time forward by d, firing the timers due, see NewTimer.
+func (s *Sim) Advance(d time.Duration) {
+	s.mu.Lock()
+	s.now = s.now.Add(d)
+	s.fireTimers()
+	s.mu.Unlock()
+}
+
+// SetLink sets the conditions of the connections to address, including those already made.
+func (s *Sim) SetLink(address string, link Link) {
+	s.mu.Lock()
+	s.links[address] = link
+	s.mu.Unlock()
+}
+
+// Log returns the events of the simulation so far, one per dial or message,
+// e.g. "+5ms primary: write 42 bytes". Two runs with the same seed have the same log.
+func (s *Sim) Log() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+// Listen announces on the in-memory address, the connections dialed to it are subject to its Link.
+func (s *Sim) Listen(address string) (*memnet.Listener, error) {
+	lis, err := memnet.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	lis.DialHook = func(c net.Conn) (net.Conn, error) {
+		if err := s.dial(address); err != nil {
+			return nil, err
+		}
+		return &conn{Conn: c, sim: s, address: address}, nil
+	}
+	return lis, nil
+}
+
+func (s *Sim) dial(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link := s.links[address]
+	if link.Down || s.chance(link.RefuseRate) {
+		s.logf(address, "dial refused")
+		return ErrRefused
+	}
+	s.logf(address, "dial")
+	return nil
+}
+
+// send decides the fate of a message of n bytes to address, which times out if its latency exceeds timeout.
+func (s *Sim) send(address string, n int, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link := s.links[address]
+	if link.Down || s.chance(link.ErrorRate) {
+		s.logf(address, "write %d bytes: reset", n)
+		return ErrReset
+	}
+	latency := link.Latency
+	if link.Jitter > 0 {
+		latency += time.Duration(s.rand.Int63n(int64(link.Jitter) + 1))
+	}
+	s.now = s.now.Add(latency)
+	s.fireTimers()
+	if timeout > 0 && latency > timeout {
+		s.logf(address, "write %d bytes: timeout", n)
+		return os.ErrDeadlineExceeded
+	}
+	s.logf(address, "write %d bytes", n)
+	return nil
+}
+
+// chance reports true with probability p, it draws a number only if 0 < p < 1.
+func (s *Sim) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	if p >= 1 {
+		return true
+	}
+	return s.rand.Float64() < p
+}
+
+func (s *Sim) logf(address, format string, args ...interface{}) {
+	s.log = append(s.log, fmt.Sprintf("+%s %s: ", s.now.Sub(Epoch), address)+fmt.Sprintf(format, args...))
+}
+
+// conn is the client end of a simulated connection.
+// A deadline is taken as the timeout of the next messages, relative to when it is set,
+// since the simulated time does not pass while waiting. The underlying pipe has no deadline.
+type conn struct {
+	net.Conn
+	sim     *Sim
+	address string
+	mu      sync.Mutex
+	timeout time.Duration
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	timeout := c.timeout
+	c.mu.Unlock()
+	if err := c.sim.send(c.address, len(b), timeout); err != nil {
+		if err == ErrReset {
+			c.Conn.Close()
+		}
+		return 0, &net.OpError{Op: "write", Net: memnet.Network, Addr: c.RemoteAddr(), Err: err}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.IsZero() {
+		c.timeout = 0
+	} else {
+		// the real time elapsed since the caller computed t is not simulated.
+		c.timeout = time.Until(t).Round(time.Millisecond)
+	}
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
@@ -0,0 +1,166 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/memnet"
+	"github.com/henrylee2cn/myrpc/server"
+)
+
+type Node struct {
+	name string
+}
+
+func (n *Node) Name(_ string, reply *string) error {
+	*reply = n.name
+	return nil
+}
+
+func serve(t *testing.T, s *Sim, address string) *memnet.Listener {
+	lis, err := s.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	srv := server.NewServer(server.Server{})
+	srv.Register(&Node{name: address})
+	go srv.ServeListener(lis)
+	return lis
+}
+
+func call(c *client.Client) (string, *common.RPCError) {
+	var name string
+	rpcErr := c.Call("/node/name", "", &name)
+	return name, rpcErr
+}
+
+func TestFailover(t *testing.T) {
+	s := New(1)
+	serve(t, s, "TestFailover-primary")
+	serve(t, s, "TestFailover-secondary")
+	c := client.NewClient(client.Client{}, &selector.TieredSelector{
+		Network:       memnet.Network,
+		Primary:       []string{"TestFailover-primary"},
+		Secondary:     []string{"TestFailover-secondary"},
+		RetryInterval: time.Minute,
+		Clock:         s,
+	})
+	defer c.Close()
+
+	s.SetLink("TestFailover-primary", Link{Down: true})
+	if name, rpcErr := call(c); rpcErr != nil || name != "TestFailover-secondary" {
+		t.Fatalf("expect the secondary, got %q, %v", name, rpcErr)
+	}
+	s.SetLink("TestFailover-primary", Link{})
+	if name, _ := call(c); name != "TestFailover-secondary" {
+		t.Fatalf("expect the secondary within the retry interval, got %q", name)
+	}
+	s.Advance(time.Minute)
+	if name, _ := call(c); name != "TestFailover-primary" {
+		t.Fatalf("expect the primary after the retry interval, got %q", name)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := New(1)
+	serve(t, s, "TestTimeout")
+	s.SetLink("TestTimeout", Link{Latency: 2 * time.Second})
+	c := client.NewClient(client.Client{Timeout: time.Second, MaxTry: 1},
+		&selector.DirectSelector{Network: memnet.Network, Address: "TestTimeout"})
+	defer c.Close()
+
+	start := time.Now()
+	if _, rpcErr := call(c); rpcErr == nil {
+		t.Fatal("expect a timeout")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expect the simulated latency not to be waited for")
+	}
+	if elapsed := s.Now().Sub(Epoch); elapsed != 2*time.Second {
+		t.Fatalf("unexpected simulated time: %s", elapsed)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	run := func() ([]bool, []string) {
+		s := New(42)
+		lis := serve(t, s, "TestDeterminism")
+		defer lis.Close()
+		s.SetLink("TestDeterminism", Link{Latency: time.Millisecond, Jitter: time.Millisecond, ErrorRate: 0.3, RefuseRate: 0.2})
+		c := client.NewClient(client.Client{MaxTry: 1},
+			&selector.DirectSelector{Network: memnet.Network, Address: "TestDeterminism"})
+		defer c.Close()
+		var oks []bool
+		for i := 0; i < 20; i++ {
+			_, rpcErr := call(c)
+			oks = append(oks, rpcErr == nil)
+		}
+		return oks, s.Log()
+	}
+	oks1, log1 := run()
+	oks2, log2 := run()
+	if !reflect.DeepEqual(oks1, oks2) {
+		t.Fatalf("the same seed gives different outcomes:\n%v\n%v", oks1, oks2)
+	}
+	if !reflect.DeepEqual(log1, log2) {
+		t.Fatalf("the same seed gives different logs:\n%q\n%q", log1, log2)
+	}
+}
+
+func TestClock(t *testing.T) {
+	s := New(1)
+	timer := s.NewTimer(time.Second)
+	stopped := s.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Fatal("expect the timer to stop")
+	}
+	fired := make(chan struct{})
+	s.AfterFunc(2*time.Second, func() { close(fired) })
+	s.Advance(time.Second)
+	select {
+	case at := <-timer.C():
+		if at.Sub(Epoch) != time.Second {
+			t.Fatalf("unexpected time of the timer: %s", at.Sub(Epoch))
+		}
+	default:
+		t.Fatal("expect the timer to fire")
+	}
+	select {
+	case <-stopped.C():
+		t.Fatal("expect the timer stopped not to fire")
+	case <-fired:
+		t.Fatal("expect the func not to be called yet")
+	default:
+	}
+	s.Advance(time.Second)
+	<-fired
+}
+
+func TestClockBreaker(t *testing.T) {
+	s := New(1)
+	serve(t, s, "TestClockBreaker")
+	c := client.NewClient(client.Client{
+		MaxTry:  1,
+		Breaker: &client.Breaker{Failures: 1, OpenTimeout: time.Minute},
+		Clock:   s,
+	}, &selector.DirectSelector{Network: memnet.Network, Address: "TestClockBreaker"})
+	defer c.Close()
+
+	s.SetLink("TestClockBreaker", Link{ErrorRate: 1})
+	if _, rpcErr := call(c); rpcErr == nil {
+		t.Fatal("expect the call to fail")
+	}
+	s.SetLink("TestClockBreaker", Link{})
+	if _, rpcErr := call(c); rpcErr == nil {
+		t.Fatal("expect the circuit to be open")
+	}
+	s.Advance(time.Minute)
+	if _, rpcErr := call(c); rpcErr != nil {
+		t.Fatalf("expect the circuit to let a probe pass after the open timeout, got %v", rpcErr)
+	}
+}
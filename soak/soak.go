@@ -0,0 +1,304 @@
+// Package soak runs mixed workloads against a server for a long time, and checks that its goroutines,
+// file descriptors and heap stay bounded, catching the leaks which only show in long-lived servers:
+//
+//	go test -run TestSoak -timeout 0 ./soak -soak.duration=30m
+//
+// or make soak. The workloads run at once against the reference server of package conformance:
+//   - calls: small calls on long-lived TCP connections.
+//   - payloads: calls whose argument and reply are Config.PayloadSize bytes.
+//   - streams: calls over h2c, each an HTTP/2 stream.
+//   - reconnects: clients dialing, calling once and closing, and connections dropped without a request.
+package soak
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/myrpc/client"
+	"github.com/henrylee2cn/myrpc/client/selector"
+	"github.com/henrylee2cn/myrpc/common"
+	"github.com/henrylee2cn/myrpc/conformance"
+	"github.com/henrylee2cn/myrpc/log"
+)
+
+// Config is the configuration of Run, its zero values are replaced by the defaults.
+type Config struct {
+	// Duration is how long the workloads run. If it is 0, 1 minute is used.
+	Duration time.Duration
+	// Workers is the number of goroutines of each workload. If it is 0, 8 is used.
+	Workers int
+	// PayloadSize is the size in bytes of the argument of the payloads workload. If it is 0, 1MB is used.
+	PayloadSize int
+	// Interval is the interval of the samples. If it is 0, 1s is used.
+	Interval time.Duration
+	// MaxGoroutines is the number of goroutines allowed over the baseline while the workloads run.
+	// If it is 0, 64 per worker is used.
+	MaxGoroutines int
+	// MaxFDs is the number of file descriptors allowed over the baseline while the workloads run,
+	// the client and the server ends of the connections. If it is 0, 16 per worker is used.
+	MaxFDs int
+	// MaxHeap is the heap in bytes allowed over the baseline while the workloads run.
+	// If it is 0, 4 payloads per worker plus 64MB is used.
+	MaxHeap uint64
+	// Settle is how long the goroutines and the file descriptors have to return to the baseline
+	// once the workloads stop, the server still running. If it is 0, 10s is used.
+	Settle time.Duration
+	// Sampled, if it is not nil, is called with each sample, e.g. to log the progress.
+	Sampled func(Sample)
+}
+
+// Sample is a measure of the process.
+type Sample struct {
+	// Elapsed is the time since the start of the workloads.
+	Elapsed time.Duration
+	// Goroutines is the number of goroutines.
+	Goroutines int
+	// FDs is the number of file descriptors open, -1 if it is unknown on the platform.
+	FDs int
+	// Heap is the bytes of the heap in use, after a garbage collection.
+	Heap uint64
+	// Calls and Errors are the numbers of calls completed and failed by the workloads.
+	Calls, Errors uint64
+}
+
+func (s Sample) String() string {
+	return fmt.Sprintf("%s: %d goroutines, %d fds, %d KB heap, %d calls, %d errors",
+		s.Elapsed.Truncate(time.Millisecond), s.Goroutines, s.FDs, s.Heap>>10, s.Calls, s.Errors)
+}
+
+// Report is the result of Run.
+type Report struct {
+	// Baseline is the sample before the workloads start, the server running.
+	Baseline Sample
+	// Samples are those taken while the workloads run.
+	Samples []Sample
+	// Final is the sample once the workloads stop and settle.
+	Final Sample
+	// Violations are the bounds exceeded, empty if none.
+	Violations []string
+}
+
+func (c *Config) init() {
+	if c.Duration <= 0 {
+		c.Duration = time.Minute
+	}
+	if c.Workers <= 0 {
+		c.Workers = 8
+	}
+	if c.PayloadSize <= 0 {
+		c.PayloadSize = 1 << 20
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.MaxGoroutines <= 0 {
+		c.MaxGoroutines = 64 * c.Workers
+	}
+	if c.MaxFDs <= 0 {
+		c.MaxFDs = 16 * c.Workers
+	}
+	if c.MaxHeap <= 0 {
+		c.MaxHeap = uint64(4*c.PayloadSize*c.Workers) + 64<<20
+	}
+	if c.Settle <= 0 {
+		c.Settle = 10 * time.Second
+	}
+}
+
+// counters are the calls of the workloads.
+type counters struct {
+	calls, errors uint64
+}
+
+func (c *counters) add(rpcErr *common.RPCError) {
+	atomic.AddUint64(&c.calls, 1)
+	if rpcErr != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+}
+
+// Run runs the workloads against a server listening on the loopback for cfg.Duration, sampling the process,
+// and returns the samples with the bounds exceeded. It returns an error if the server cannot listen.
+func Run(cfg Config) (*Report, error) {
+	cfg.init()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer lis.Close()
+	h2cLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer h2cLis.Close()
+	srv := conformance.NewEchoServer(nil)
+	go srv.ServeListener(lis)
+	go srv.ServeH2C(h2cLis)
+
+	report := new(Report)
+	var cnt counters
+	start := time.Now()
+	sample := func() Sample {
+		s := measure()
+		s.Elapsed = time.Since(start)
+		s.Calls, s.Errors = atomic.LoadUint64(&cnt.calls), atomic.LoadUint64(&cnt.errors)
+		if cfg.Sampled != nil {
+			cfg.Sampled(s)
+		}
+		return s
+	}
+	report.Baseline = sample()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	workloads := []func(){
+		func() { calls(lis.Addr().String(), "tcp", &cnt, stop, make([]byte, 16)) },
+		func() { calls(lis.Addr().String(), "tcp", &cnt, stop, make([]byte, cfg.PayloadSize)) },
+		func() { calls(h2cLis.Addr().String(), "h2c", &cnt, stop, make([]byte, 16)) },
+		func() { reconnects(lis.Addr().String(), &cnt, stop) },
+	}
+	for _, workload := range workloads {
+		for i := 0; i < cfg.Workers; i++ {
+			wg.Add(1)
+			go func(workload func()) {
+				defer wg.Done()
+				workload()
+			}(workload)
+		}
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	deadline := time.After(cfg.Duration)
+	for running := true; running; {
+		select {
+		case <-deadline:
+			running = false
+		case <-ticker.C:
+			s := sample()
+			report.Samples = append(report.Samples, s)
+			report.check(s, cfg)
+		}
+	}
+	ticker.Stop()
+	close(stop)
+	wg.Wait()
+
+	// the server keeps running, its goroutines and connections must return to the baseline.
+	settled := time.Now().Add(cfg.Settle)
+	for {
+		report.Final = sample()
+		if report.Final.Goroutines <= report.Baseline.Goroutines && report.Final.FDs <= report.Baseline.FDs ||
+			time.Now().After(settled) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if d := report.Final.Goroutines - report.Baseline.Goroutines; d > 0 {
+		report.violate("%d goroutines leaked", d)
+	}
+	if d := report.Final.FDs - report.Baseline.FDs; d > 0 {
+		report.violate("%d file descriptors leaked", d)
+	}
+	if report.Final.Heap > report.Baseline.Heap+cfg.MaxHeap {
+		report.violate("%d KB heap kept after the workloads", (report.Final.Heap-report.Baseline.Heap)>>10)
+	}
+	if report.Final.Calls == 0 || report.Final.Errors*10 > report.Final.Calls {
+		report.violate("%d calls of %d failed", report.Final.Errors, report.Final.Calls)
+	}
+	return report, nil
+}
+
+// check records the bounds exceeded by s while the workloads run.
+func (r *Report) check(s Sample, cfg Config) {
+	if s.Goroutines > r.Baseline.Goroutines+cfg.MaxGoroutines {
+		r.violate("%s: %d goroutines over the baseline", s.Elapsed, s.Goroutines-r.Baseline.Goroutines)
+	}
+	if s.FDs > r.Baseline.FDs+cfg.MaxFDs {
+		r.violate("%s: %d file descriptors over the baseline", s.Elapsed, s.FDs-r.Baseline.FDs)
+	}
+	if s.Heap > r.Baseline.Heap+cfg.MaxHeap {
+		r.violate("%s: %d KB heap over the baseline", s.Elapsed, (s.Heap-r.Baseline.Heap)>>10)
+	}
+}
+
+func (r *Report) violate(format string, args ...interface{}) {
+	v := fmt.Sprintf(format, args...)
+	log.Warnf("soak: %s", v)
+	r.Violations = append(r.Violations, v)
+}
+
+// calls calls the echo server with payload on a long-lived client until stop is closed.
+func calls(address, network string, cnt *counters, stop <-chan struct{}, payload []byte) {
+	c := newClient(network, address)
+	defer c.Close()
+	args := &conformance.EchoArgs{Bytes: payload}
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		var reply conformance.EchoArgs
+		cnt.add(c.Call(conformance.EchoStructPath, args, &reply))
+	}
+}
+
+// reconnects dials the echo server, calls it once and closes the client, or drops the connection
+// without a request, until stop is closed.
+func reconnects(address string, cnt *counters, stop <-chan struct{}) {
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if i%2 == 0 {
+			if conn, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+				conn.Close()
+			}
+			continue
+		}
+		c := newClient("tcp", address)
+		var reply string
+		cnt.add(c.Call(conformance.EchoPath, "reconnect", &reply))
+		c.Close()
+	}
+}
+
+func newClient(network, address string) *client.Client {
+	return client.NewClient(client.Client{
+		Timeout: 10 * time.Second,
+	}, &selector.DirectSelector{
+		Network:     network,
+		Address:     address,
+		DialTimeout: 10 * time.Second,
+	})
+}
+
+// measure samples the goroutines, the file descriptors and the heap of the process.
+func measure() Sample {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return Sample{
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        numFDs(),
+		Heap:       m.HeapInuse,
+	}
+}
+
+// numFDs returns the number of file descriptors open by the process, -1 if it is unknown.
+func numFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if fds, err := os.ReadDir(dir); err == nil {
+			// the descriptor reading the directory is listed.
+			return len(fds) - 1
+		}
+	}
+	return -1
+}
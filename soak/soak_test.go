@@ -0,0 +1,27 @@
+package soak
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+var duration = flag.Duration("soak.duration", 3*time.Second, "how long TestSoak runs the workloads")
+
+func TestSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak in short mode")
+	}
+	report, err := Run(Config{
+		Duration: *duration,
+		Workers:  2,
+		Interval: *duration / 10,
+		Sampled:  func(s Sample) { t.Log(s) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range report.Violations {
+		t.Error(v)
+	}
+}